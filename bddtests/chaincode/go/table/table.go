@@ -55,6 +55,12 @@ func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args [
 		return nil, fmt.Errorf("Error creating table four during init. %s", err)
 	}
 
+	// Create table five
+	err = createTableFive(stub)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating table five during init. %s", err)
+	}
+
 	return nil, nil
 }
 
@@ -216,6 +222,46 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 			return nil, errors.New("insertRowTableFour operation failed. Row with given key already exists")
 		}
 
+	case "insertRowTableFive", "replaceRowTableFive":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%s failed. Must include 2 column values", function)
+		}
+
+		var columns []*shim.Column
+		col1 := shim.Column{Value: &shim.Column_String_{String_: args[0]}}
+		col2 := shim.Column{Value: &shim.Column_String_{String_: args[1]}}
+		columns = append(columns, &col1)
+		columns = append(columns, &col2)
+
+		row := shim.Row{Columns: columns}
+		var ok bool
+		var err error
+		if function == "insertRowTableFive" {
+			ok, err = stub.InsertRow("tableFive", row)
+		} else {
+			ok, err = stub.ReplaceRow("tableFive", row)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s operation failed. %s", function, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("%s operation failed. Row with given key could not be written", function)
+		}
+
+	case "deleteRowTableFive":
+		if len(args) < 1 {
+			return nil, errors.New("deleteRowTableFive failed. Must include 1 key value")
+		}
+
+		var columns []shim.Column
+		col1 := shim.Column{Value: &shim.Column_String_{String_: args[0]}}
+		columns = append(columns, col1)
+
+		err := stub.DeleteRow("tableFive", columns)
+		if err != nil {
+			return nil, fmt.Errorf("deleteRowTableFive operation failed. %s", err)
+		}
+
 	case "deleteRowTableOne":
 		if len(args) < 1 {
 			return nil, errors.New("deleteRowTableOne failed. Must include 1 key value")
@@ -458,6 +504,30 @@ func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args
 
 		return jsonRows, nil
 
+	case "getRowsByIndexTableFive":
+		if len(args) < 1 {
+			return nil, errors.New("getRowsByIndexTableFive failed. Must include 1 column value")
+		}
+
+		col2 := shim.Column{Value: &shim.Column_String_{String_: args[0]}}
+
+		rowChannel, err := stub.GetRowsByIndex("tableFive", "colTwoTableFive", col2)
+		if err != nil {
+			return nil, fmt.Errorf("getRowsByIndexTableFive operation failed. %s", err)
+		}
+
+		rows := []shim.Row{}
+		for row := range rowChannel {
+			rows = append(rows, row)
+		}
+
+		jsonRows, err := json.Marshal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("getRowsByIndexTableFive operation failed. Error marshaling JSON: %s", err)
+		}
+
+		return jsonRows, nil
+
 	default:
 		return nil, errors.New("Unsupported operation")
 	}
@@ -535,3 +605,14 @@ func createTableFour(stub *shim.ChaincodeStub) error {
 	columnDefsTableFour = append(columnDefsTableFour, &columnOneTableFourDef)
 	return stub.CreateTable("tableFour", columnDefsTableFour)
 }
+
+func createTableFive(stub *shim.ChaincodeStub) error {
+	var columnDefsTableFive []*shim.ColumnDefinition
+	columnOneTableFiveDef := shim.ColumnDefinition{Name: "colOneTableFive",
+		Type: shim.ColumnDefinition_STRING, Key: true}
+	columnTwoTableFiveDef := shim.ColumnDefinition{Name: "colTwoTableFive",
+		Type: shim.ColumnDefinition_STRING, Key: false, Indexed: true}
+	columnDefsTableFive = append(columnDefsTableFive, &columnOneTableFiveDef)
+	columnDefsTableFive = append(columnDefsTableFive, &columnTwoTableFiveDef)
+	return stub.CreateTable("tableFive", columnDefsTableFive)
+}
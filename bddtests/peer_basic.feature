@@ -311,6 +311,61 @@ Feature: Network of Peers
         | foobar |
       Then I should get a JSON response with "result.message" = "[{"columns":[{"Value":{"String_":"foobar"}}]}]"
 
+      When I invoke chaincode "table_test" function name "insertRowTableFive" on "vp0"
+        | arg1   | arg2  |
+        | asset1 | alice |
+      Then I should have received a transactionID
+      Then I wait up to "25" seconds for transaction to be committed to all peers
+      When requesting "/chain" from "vp0"
+      Then I should get a JSON response with "height" = "18"
+
+      When I invoke chaincode "table_test" function name "insertRowTableFive" on "vp0"
+        | arg1   | arg2 |
+        | asset2 | bob  |
+      Then I should have received a transactionID
+      Then I wait up to "25" seconds for transaction to be committed to all peers
+      When requesting "/chain" from "vp0"
+      Then I should get a JSON response with "height" = "19"
+
+      When I invoke chaincode "table_test" function name "insertRowTableFive" on "vp0"
+        | arg1   | arg2  |
+        | asset3 | alice |
+      Then I should have received a transactionID
+      Then I wait up to "25" seconds for transaction to be committed to all peers
+      When requesting "/chain" from "vp0"
+      Then I should get a JSON response with "height" = "20"
+
+      When I query chaincode "table_test" function name "getRowsByIndexTableFive" on "vp0":
+        | arg1  |
+        | alice |
+      Then I should get a JSON response with "result.message" = "[{"columns":[{"Value":{"String_":"asset1"}},{"Value":{"String_":"alice"}}]},{"columns":[{"Value":{"String_":"asset3"}},{"Value":{"String_":"alice"}}]}]"
+
+      When I invoke chaincode "table_test" function name "replaceRowTableFive" on "vp0"
+        | arg1   | arg2 |
+        | asset1 | bob  |
+      Then I should have received a transactionID
+      Then I wait up to "25" seconds for transaction to be committed to all peers
+      When requesting "/chain" from "vp0"
+      Then I should get a JSON response with "height" = "21"
+
+      When I invoke chaincode "table_test" function name "deleteRowTableFive" on "vp0"
+        | arg1   |
+        | asset2 |
+      Then I should have received a transactionID
+      Then I wait up to "25" seconds for transaction to be committed to all peers
+      When requesting "/chain" from "vp0"
+      Then I should get a JSON response with "height" = "22"
+
+      When I query chaincode "table_test" function name "getRowsByIndexTableFive" on "vp0":
+        | arg1  |
+        | alice |
+      Then I should get a JSON response with "result.message" = "[{"columns":[{"Value":{"String_":"asset3"}},{"Value":{"String_":"alice"}}]}]"
+
+      When I query chaincode "table_test" function name "getRowsByIndexTableFive" on "vp0":
+        | arg1 |
+        | bob  |
+      Then I should get a JSON response with "result.message" = "[{"columns":[{"Value":{"String_":"asset1"}},{"Value":{"String_":"bob"}}]}]"
+
 @doNotDecompose
 #    @wip
 	Scenario: chaincode example 01 single peer erroneous TX
@@ -35,6 +35,21 @@ type Consenter interface {
 	ExecutionConsumer
 }
 
+// StatusReporter is implemented by consenters which can report their internal state
+type StatusReporter interface {
+	Status() *pb.ConsensusStatus // Returns a snapshot of the consenter state, may be called from any goroutine
+}
+
+// EvidenceCollector is implemented by consenters which collect evidence of misbehaving replicas
+type EvidenceCollector interface {
+	Evidence() []*pb.ConsensusEvidence // Returns the evidence collected so far, may be called from any goroutine
+}
+
+// Reconfigurer is implemented by consenters whose replica set can change
+type Reconfigurer interface {
+	Reconfigure(replicas []uint64, f int) error // Requests that the network switch to a new replica set tolerating f byzantine faults
+}
+
 // Inquirer is used to retrieve info about the validating network
 type Inquirer interface {
 	GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error)
@@ -57,6 +72,7 @@ type NetworkStack interface {
 type SecurityUtils interface {
 	Sign(msg []byte) ([]byte, error)
 	Verify(peerID *pb.PeerID, signature []byte, message []byte) error
+	SessionKey(peerID *pb.PeerID) ([]byte, error) // Returns the symmetric key shared with another validator, for authenticating messages with MACs
 }
 
 // ReadOnlyLedger is used for interrogating the blockchain
@@ -103,6 +119,16 @@ type StatePersistor interface {
 	DelState(key string)
 }
 
+// TransactionRejecter is used to tell clients that their transactions will not be ordered
+type TransactionRejecter interface {
+	RejectTransaction(tx *pb.Transaction, reason string) // Sends a rejection event for the transaction to its submitter
+}
+
+// EvidenceReporter is used to publish evidence of misbehaving replicas
+type EvidenceReporter interface {
+	ReportEvidence(evidence *pb.ConsensusEvidence) // Sends an event carrying the evidence to the consumers registered for it
+}
+
 // Stack is the set of stack-facing methods available to the consensus plugin
 type Stack interface {
 	NetworkStack
@@ -112,4 +138,6 @@ type Stack interface {
 	LedgerManager
 	ReadOnlyLedger
 	StatePersistor
+	TransactionRejecter
+	EvidenceReporter
 }
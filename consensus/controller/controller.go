@@ -17,32 +17,30 @@ limitations under the License.
 package controller
 
 import (
-	"strings"
-
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/consensus"
-	"github.com/hyperledger/fabric/consensus/noops"
-	"github.com/hyperledger/fabric/consensus/pbft"
+
+	// The built-in consensus plugins register themselves on import
+	_ "github.com/hyperledger/fabric/consensus/noops"
+	_ "github.com/hyperledger/fabric/consensus/pbft"
+	_ "github.com/hyperledger/fabric/consensus/raft"
 )
 
 var logger *logging.Logger // package-level logger
-var consenter consensus.Consenter
 
 func init() {
 	logger = logging.MustGetLogger("consensus/controller")
 }
 
-// NewConsenter constructs a Consenter object if not already present
-func NewConsenter(stack consensus.Stack) consensus.Consenter {
-
-	plugin := strings.ToLower(viper.GetString("peer.validator.consensus.plugin"))
-	if plugin == "pbft" {
-		logger.Infof("Creating consensus plugin %s", plugin)
-		return pbft.GetPlugin(stack)
+// NewConsenter constructs the Consenter of the consensus plugin named by peer.validator.consensus.plugin
+func NewConsenter(stack consensus.Stack) (consensus.Consenter, error) {
+	plugin := viper.GetString("peer.validator.consensus.plugin")
+	factory, err := consensus.GetPluginFactory(plugin)
+	if err != nil {
+		return nil, err
 	}
-	logger.Info("Creating default consensus plugin (noops)")
-	return noops.GetNoops(stack)
-
+	logger.Infof("Creating consensus plugin %s", plugin)
+	return factory(stack), nil
 }
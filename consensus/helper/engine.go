@@ -90,6 +90,42 @@ func (eng *EngineImpl) ProcessTransactionMsg(msg *pb.Message, tx *pb.Transaction
 	return response
 }
 
+// GetConsensusStatus returns a snapshot of the state of the consenter, if it can report it
+func (eng *EngineImpl) GetConsensusStatus() (*pb.ConsensusStatus, error) {
+	if eng.consenter == nil {
+		return nil, fmt.Errorf("Engine not initialized")
+	}
+	reporter, ok := eng.consenter.(consensus.StatusReporter)
+	if !ok {
+		return nil, fmt.Errorf("The consensus plugin does not report its status")
+	}
+	return reporter.Status(), nil
+}
+
+// GetConsensusEvidence returns the evidence of misbehaving validators collected by the consenter
+func (eng *EngineImpl) GetConsensusEvidence() ([]*pb.ConsensusEvidence, error) {
+	if eng.consenter == nil {
+		return nil, fmt.Errorf("Engine not initialized")
+	}
+	collector, ok := eng.consenter.(consensus.EvidenceCollector)
+	if !ok {
+		return nil, fmt.Errorf("The consensus plugin does not collect evidence")
+	}
+	return collector.Evidence(), nil
+}
+
+// ReconfigureConsensus requests that the consenter switch the network to a new replica set
+func (eng *EngineImpl) ReconfigureConsensus(replicas []uint64, f int) error {
+	if eng.consenter == nil {
+		return fmt.Errorf("Engine not initialized")
+	}
+	reconfigurer, ok := eng.consenter.(consensus.Reconfigurer)
+	if !ok {
+		return fmt.Errorf("The consensus plugin does not support reconfiguration")
+	}
+	return reconfigurer.Reconfigure(replicas, f)
+}
+
 func (eng *EngineImpl) setConsenter(consenter consensus.Consenter) *EngineImpl {
 	eng.consenter = consenter
 	return eng
@@ -114,7 +150,10 @@ func GetEngine(coord peer.MessageHandlerCoordinator) (peer.Engine, error) {
 	engineOnce.Do(func() {
 		engine = new(EngineImpl)
 		engine.helper = NewHelper(coord)
-		engine.consenter = controller.NewConsenter(engine.helper)
+		engine.consenter, err = controller.NewConsenter(engine.helper)
+		if err != nil {
+			return
+		}
 		engine.helper.setConsenter(engine.consenter)
 		engine.peerEndpoint, err = coord.GetPeerEndpoint()
 		engine.consensusFan = util.NewMessageFan()
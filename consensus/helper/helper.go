@@ -30,6 +30,7 @@ import (
 	crypto "github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/peer"
+	"github.com/hyperledger/fabric/events/producer"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
@@ -155,6 +156,26 @@ func (h *Helper) Verify(replicaID *pb.PeerID, signature []byte, message []byte)
 	return fmt.Errorf("Could not verify message from %s (unknown peer)", replicaID.Name)
 }
 
+// SessionKey returns the symmetric key this validator shares with the given replica
+// When security is disabled, validators have no keys to derive it from, and share none
+func (h *Helper) SessionKey(replicaID *pb.PeerID) ([]byte, error) {
+	if !h.secOn {
+		return nil, fmt.Errorf("Security is disabled, no session key is shared with %s", replicaID.Name)
+	}
+
+	_, network, err := h.GetNetworkInfo()
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't retrieve validating network's endpoints: %v", err)
+	}
+
+	for _, endpoint := range network {
+		if *replicaID == *endpoint.ID {
+			return h.secHelper.DeriveSessionKey(endpoint.PkiID)
+		}
+	}
+	return nil, fmt.Errorf("Could not derive session key for %s (unknown peer)", replicaID.Name)
+}
+
 // BeginTxBatch gets invoked when the next round
 // of transaction-batch execution begins
 func (h *Helper) BeginTxBatch(id interface{}) error {
@@ -180,22 +201,9 @@ func (h *Helper) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error)
 	// cxt := context.WithValue(context.Background(), "security", h.coordinator.GetSecHelper())
 	// TODO return directly once underlying implementation no longer returns []error
 
-	succeededTxs, res, ccevents, txerrs, err := chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, txs)
-
-	h.curBatch = append(h.curBatch, succeededTxs...) // TODO, remove after issue 579
+	succeededTxs, res, txresults, err := chaincode.ExecuteTransactions(context.Background(), chaincode.DefaultChain, txs)
 
-	//copy errs to result
-	txresults := make([]*pb.TransactionResult, len(txerrs))
-
-	//process errors for each transaction
-	for i, e := range txerrs {
-		//NOTE- it'll be nice if we can have error values. For now success == 0, error == 1
-		if txerrs[i] != nil {
-			txresults[i] = &pb.TransactionResult{Uuid: txs[i].Uuid, Error: e.Error(), ErrorCode: 1, ChaincodeEvent: ccevents[i]}
-		} else {
-			txresults[i] = &pb.TransactionResult{Uuid: txs[i].Uuid, ChaincodeEvent: ccevents[i]}
-		}
-	}
+	h.curBatch = append(h.curBatch, succeededTxs...)      // TODO, remove after issue 579
 	h.curBatchErrs = append(h.curBatchErrs, txresults...) // TODO, remove after issue 579
 
 	return res, err
@@ -329,6 +337,18 @@ func (h *Helper) ValidateState() {
 	h.valid = true
 }
 
+// RejectTransaction sends a rejection event for a transaction the consensus plugin refused to order
+func (h *Helper) RejectTransaction(tx *pb.Transaction, reason string) {
+	logger.Debugf("Rejecting transaction %s: %s", tx.Uuid, reason)
+	producer.Send(producer.CreateRejectionEvent(tx, reason))
+}
+
+// ReportEvidence sends an event with the evidence of a misbehaving replica found by the consensus plugin
+func (h *Helper) ReportEvidence(evidence *pb.ConsensusEvidence) {
+	logger.Warningf("Validator %v misbehaved: %s", evidence.Faulty, evidence.Description)
+	producer.Send(producer.CreateConsensusEvidenceEvent(evidence))
+}
+
 // Execute will execute a set of transactions, this may be called in succession
 func (h *Helper) Execute(tag interface{}, txs []*pb.Transaction) {
 	h.executor.Execute(tag, txs)
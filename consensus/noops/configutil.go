@@ -17,37 +17,17 @@ limitations under the License.
 package noops
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"github.com/hyperledger/fabric/consensus"
 
 	"github.com/spf13/viper"
 )
 
-const configPrefix = "CORE_NOOPS"
+const pluginName = "noops"
 
 func loadConfig() (config *viper.Viper) {
-	config = viper.New()
-
-	// for environment variables
-	config.SetEnvPrefix(configPrefix)
-	config.AutomaticEnv()
-	replacer := strings.NewReplacer(".", "_")
-	config.SetEnvKeyReplacer(replacer)
-
-	config.SetConfigName("config")
-	config.AddConfigPath("./")
-	config.AddConfigPath("../consensus/noops/")
-	// Path to look for the config file in based on GOPATH
-	gopath := os.Getenv("GOPATH")
-	for _, p := range filepath.SplitList(gopath) {
-		path := filepath.Join(p, "src/github.com/hyperledger/fabric/consensus/noops")
-		config.AddConfigPath(path)
-	}
-	err := config.ReadInConfig()
+	config, err := consensus.LoadPluginConfig(pluginName)
 	if err != nil {
-		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
+		panic(err)
 	}
-	return config
+	return
 }
@@ -0,0 +1,70 @@
+// Code generated by protoc-gen-go.
+// source: messages.proto
+// DO NOT EDIT!
+
+/*
+Package noops is a generated protocol buffer package.
+
+It is generated from these files:
+
+	messages.proto
+
+It has these top-level messages:
+
+	Message
+	OrderedBlock
+	FetchBlocks
+*/
+package noops
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// message is the payload of the consensus messages exchanged in single orderer mode
+type Message struct {
+	Relay []byte        `protobuf:"bytes,1,opt,name=relay,proto3" json:"relay,omitempty"`
+	Block *OrderedBlock `protobuf:"bytes,2,opt,name=block" json:"block,omitempty"`
+	Fetch *FetchBlocks  `protobuf:"bytes,3,opt,name=fetch" json:"fetch,omitempty"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+func (m *Message) GetBlock() *OrderedBlock {
+	if m != nil {
+		return m.Block
+	}
+	return nil
+}
+
+func (m *Message) GetFetch() *FetchBlocks {
+	if m != nil {
+		return m.Fetch
+	}
+	return nil
+}
+
+type OrderedBlock struct {
+	Number       uint64   `protobuf:"varint,1,opt,name=number" json:"number,omitempty"`
+	Transactions [][]byte `protobuf:"bytes,2,rep,name=transactions,proto3" json:"transactions,omitempty"`
+}
+
+func (m *OrderedBlock) Reset()         { *m = OrderedBlock{} }
+func (m *OrderedBlock) String() string { return proto.CompactTextString(m) }
+func (*OrderedBlock) ProtoMessage()    {}
+
+type FetchBlocks struct {
+	From uint64 `protobuf:"varint,1,opt,name=from" json:"from,omitempty"`
+	To   uint64 `protobuf:"varint,2,opt,name=to" json:"to,omitempty"`
+}
+
+func (m *FetchBlocks) Reset()         { *m = FetchBlocks{} }
+func (m *FetchBlocks) String() string { return proto.CompactTextString(m) }
+func (*FetchBlocks) ProtoMessage()    {}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/op/go-logging"
+	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/consensus"
 	"github.com/hyperledger/fabric/core/ledger"
@@ -35,15 +36,45 @@ var logger *logging.Logger // package-level logger
 
 func init() {
 	logger = logging.MustGetLogger("consensus/noops")
+	consensus.RegisterPlugin(pluginName, GetNoops)
+}
+
+const (
+	maxPendingBlocks = 1000 // blocks from the orderer a validator keeps while it fetches the ones it missed
+	maxFetchBlocks   = 100  // blocks the orderer resends for a single request
+)
+
+// noopsLedger is the part of the ledger noops reads to announce blocks and detect replays
+type noopsLedger interface {
+	GetBlockchainSize() uint64
+	GetBlockByNumber(blockNumber uint64) (*pb.Block, error)
+	GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error)
+	GetTransactionResultByUUID(txUUID string) (*pb.TransactionResult, error)
 }
 
 // Noops is a plugin object implementing the consensus.Consenter interface.
 type Noops struct {
-	stack    consensus.Stack
-	txQ      *txq
-	timer    *time.Timer
-	duration time.Duration
-	channel  chan *pb.Transaction
+	stack        consensus.Stack
+	ledger       noopsLedger
+	txQ          *txq
+	timer        *time.Timer
+	duration     time.Duration
+	channel      chan *pb.Transaction
+	blockChannel chan *OrderedBlock
+	fetchChannel chan *fetchRequest
+	replay       *replayDetector
+	self         *pb.PeerID
+	orderer      *pb.PeerID // in single orderer mode, the validator cutting the blocks
+
+	pending   map[uint64]*OrderedBlock // blocks from the orderer received ahead of a missed one
+	fetchFrom uint64                   // first missed block last requested from the orderer
+	fetchTime time.Time                // when it was requested
+}
+
+// fetchRequest is a request of a validator for the blocks it missed
+type fetchRequest struct {
+	fetch     *FetchBlocks
+	requester *pb.PeerID
 }
 
 // Setting up a singleton NOOPS consenter
@@ -52,20 +83,24 @@ var iNoops consensus.Consenter
 // GetNoops returns a singleton of NOOPS
 func GetNoops(c consensus.Stack) consensus.Consenter {
 	if iNoops == nil {
-		iNoops = newNoops(c)
+		l, err := ledger.GetLedger()
+		if err != nil {
+			panic(fmt.Errorf("Cannot get the ledger: %s", err))
+		}
+		iNoops = newNoops(c, l, loadConfig())
 	}
 	return iNoops
 }
 
 // newNoops is a constructor returning a consensus.Consenter object.
-func newNoops(c consensus.Stack) consensus.Consenter {
+func newNoops(c consensus.Stack, l noopsLedger, config *viper.Viper) *Noops {
 	var err error
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debug("Creating a NOOPS object")
 	}
 	i := &Noops{}
 	i.stack = c
-	config := loadConfig()
+	i.ledger = l
 	blockSize := config.GetInt("block.size")
 	blockWait := config.GetString("block.wait")
 	if _, err = strconv.Atoi(blockWait); err == nil {
@@ -76,24 +111,47 @@ func newNoops(c consensus.Stack) consensus.Consenter {
 		panic(fmt.Errorf("Cannot parse block wait: %s", err))
 	}
 
+	i.self, _, err = c.GetNetworkHandles()
+	if err != nil {
+		panic(fmt.Errorf("Cannot get network handles: %s", err))
+	}
+	if orderer := config.GetString("orderer"); orderer != "" {
+		i.orderer = &pb.PeerID{Name: orderer}
+	}
+
 	logger.Infof("NOOPS consensus type = %T", i)
 	logger.Infof("NOOPS block size = %v", blockSize)
 	logger.Infof("NOOPS block wait = %v", i.duration)
+	if i.orderer != nil {
+		logger.Infof("NOOPS single orderer = %v", i.orderer.Name)
+	}
 
 	i.txQ = newTXQ(blockSize)
+	i.replay = newReplayDetector(config.GetInt("replay.window"), i.isCommitted)
+	i.pending = make(map[uint64]*OrderedBlock)
 
 	i.channel = make(chan *pb.Transaction, 100)
+	i.blockChannel = make(chan *OrderedBlock, 100)
+	i.fetchChannel = make(chan *fetchRequest, 100)
 	i.timer = time.NewTimer(i.duration) // start timer now so we can just reset it
 	i.timer.Stop()
 	go i.handleChannels()
 	return i
 }
 
+// isOrderer reports whether this validator cuts the blocks in single orderer mode
+func (i *Noops) isOrderer() bool {
+	return i.orderer != nil && i.orderer.Name == i.self.Name
+}
+
 // RecvMsg is called for Message_CHAIN_TRANSACTION and Message_CONSENSUS messages.
 func (i *Noops) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debugf("Handling Message of type: %s ", msg.Type)
 	}
+	if i.orderer != nil {
+		return i.recvOrderedMsg(msg, senderHandle)
+	}
 	if msg.Type == pb.Message_CHAIN_TRANSACTION {
 		if err := i.broadcastConsensusMsg(msg); nil != err {
 			return err
@@ -112,6 +170,71 @@ func (i *Noops) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
 	return nil
 }
 
+// recvOrderedMsg handles messages in single orderer mode: transactions are relayed
+// to the orderer, and the other validators execute the blocks the orderer sends,
+// fetching those they missed from it
+func (i *Noops) recvOrderedMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
+	switch msg.Type {
+	case pb.Message_CHAIN_TRANSACTION:
+		if !i.isOrderer() {
+			return i.relayToOrderer(msg)
+		}
+		return i.queueTransaction(msg.Payload)
+	case pb.Message_CONSENSUS:
+		noopsMsg := &Message{}
+		if err := proto.Unmarshal(msg.Payload, noopsMsg); err != nil {
+			return err
+		}
+		if block := noopsMsg.GetBlock(); block != nil {
+			if senderHandle == nil || senderHandle.Name != i.orderer.Name {
+				return fmt.Errorf("Ignoring block from %v, only the orderer %s may send blocks", senderHandle, i.orderer.Name)
+			}
+			if !i.isOrderer() {
+				i.blockChannel <- block
+			}
+			return nil
+		}
+		if !i.isOrderer() {
+			return fmt.Errorf("Ignoring message from %v, this validator is not the orderer", senderHandle)
+		}
+		if fetch := noopsMsg.GetFetch(); fetch != nil {
+			i.fetchChannel <- &fetchRequest{fetch: fetch, requester: senderHandle}
+			return nil
+		}
+		return i.queueTransaction(noopsMsg.Relay)
+	}
+	return nil
+}
+
+// queueTransaction queues a transaction for the orderer to cut into a block
+func (i *Noops) queueTransaction(raw []byte) error {
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(raw, tx); err != nil {
+		return fmt.Errorf("Error unmarshalling transaction: %s", err)
+	}
+	i.channel <- tx
+	return nil
+}
+
+func (i *Noops) relayToOrderer(msg *pb.Message) error {
+	t := &pb.Transaction{}
+	if err := proto.Unmarshal(msg.Payload, t); err != nil {
+		return fmt.Errorf("Error unmarshalling payload of received Message:%s.", msg.Type)
+	}
+	if logger.IsEnabledFor(logging.DEBUG) {
+		logger.Debugf("Relaying tx uuid %s to orderer %s", t.Uuid, i.orderer.Name)
+	}
+	return i.sendToOrderer(&Message{Relay: msg.Payload})
+}
+
+func (i *Noops) sendToOrderer(noopsMsg *Message) error {
+	payload, err := proto.Marshal(noopsMsg)
+	if err != nil {
+		return err
+	}
+	return i.stack.Unicast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, i.orderer)
+}
+
 func (i *Noops) broadcastConsensusMsg(msg *pb.Message) error {
 	t := &pb.Transaction{}
 	if err := proto.Unmarshal(msg.Payload, t); err != nil {
@@ -158,6 +281,10 @@ func (i *Noops) handleChannels() {
 	for {
 		select {
 		case tx := <-i.channel:
+			if i.replay.isReplay(tx.Uuid) {
+				logger.Warningf("Dropping replayed transaction %s", tx.Uuid)
+				continue
+			}
 			if i.canProcessBlock(tx) {
 				if logger.IsEnabledFor(logging.DEBUG) {
 					logger.Debug("Process block due to size")
@@ -173,6 +300,17 @@ func (i *Noops) handleChannels() {
 			if err := i.processBlock(); nil != err {
 				logger.Error(err.Error())
 			}
+		case block := <-i.blockChannel:
+			if logger.IsEnabledFor(logging.DEBUG) {
+				logger.Debugf("Process block %d of %d transactions from the orderer", block.Number, len(block.Transactions))
+			}
+			if err := i.deliverBlock(block); nil != err {
+				logger.Error(err.Error())
+			}
+		case req := <-i.fetchChannel:
+			if err := i.resendBlocks(req); nil != err {
+				logger.Error(err.Error())
+			}
 		}
 	}
 }
@@ -186,11 +324,133 @@ func (i *Noops) processBlock() error {
 		}
 		return nil
 	}
+	txarr := i.txQ.getTXs()
+	var block []byte
+	var err error
+	if i.isOrderer() {
+		// Marshal before executing, so the other validators get the transactions as received
+		if block, err = marshalOrderedBlock(i.stack.GetBlockchainSize(), txarr); err != nil {
+			return err
+		}
+	}
+	if err = i.applyBlock(txarr); nil != err {
+		return err
+	}
+	if i.isOrderer() {
+		if logger.IsEnabledFor(logging.DEBUG) {
+			logger.Debugf("Broadcasting block of %d transactions to validators", len(txarr))
+		}
+		if err = i.stack.Broadcast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: block}, pb.PeerEndpoint_VALIDATOR); nil != err {
+			return fmt.Errorf("Failed to broadcast block: %v", err)
+		}
+	}
+	return nil
+}
+
+// marshalOrderedBlock builds the message carrying a block of the orderer
+func marshalOrderedBlock(number uint64, txarr []*pb.Transaction) ([]byte, error) {
+	block := &OrderedBlock{Number: number}
+	for _, tx := range txarr {
+		raw, err := proto.Marshal(tx)
+		if err != nil {
+			return nil, err
+		}
+		block.Transactions = append(block.Transactions, raw)
+	}
+	return proto.Marshal(&Message{Block: block})
+}
+
+// deliverBlock applies the blocks of the orderer in the order of their numbers;
+// a block ahead of the blockchain reveals missed blocks, which are fetched from
+// the orderer while the block waits
+func (i *Noops) deliverBlock(block *OrderedBlock) error {
+	next := i.stack.GetBlockchainSize()
+	if block.Number < next {
+		if logger.IsEnabledFor(logging.DEBUG) {
+			logger.Debugf("Ignoring block %d from the orderer, the blockchain already holds it", block.Number)
+		}
+		return nil
+	}
+	if block.Number > next {
+		if len(i.pending) < maxPendingBlocks {
+			i.pending[block.Number] = block
+		}
+		return i.fetchMissedBlocks(next, block.Number-1)
+	}
+
+	for ; block != nil; block = i.pending[next] {
+		delete(i.pending, next)
+		txarr := make([]*pb.Transaction, len(block.Transactions))
+		for j, raw := range block.Transactions {
+			txarr[j] = &pb.Transaction{}
+			if err := proto.Unmarshal(raw, txarr[j]); err != nil {
+				return fmt.Errorf("Error unmarshalling transaction of block %d: %s", block.Number, err)
+			}
+		}
+		if err := i.applyBlock(txarr); err != nil {
+			return err
+		}
+		next++
+	}
+	for number := range i.pending {
+		if number < next {
+			delete(i.pending, number)
+		}
+	}
+	return nil
+}
+
+// fetchMissedBlocks asks the orderer to resend blocks, unless it was asked
+// for them less than a block wait ago
+func (i *Noops) fetchMissedBlocks(from, to uint64) error {
+	if from == i.fetchFrom && time.Since(i.fetchTime) < i.duration {
+		return nil
+	}
+	if to-from >= maxFetchBlocks {
+		to = from + maxFetchBlocks - 1
+	}
+	i.fetchFrom = from
+	i.fetchTime = time.Now()
+	logger.Warningf("Missed blocks %d to %d, fetching them from the orderer %s", from, to, i.orderer.Name)
+	return i.sendToOrderer(&Message{Fetch: &FetchBlocks{From: from, To: to}})
+}
+
+// resendBlocks sends the blocks a validator missed from the blockchain of the orderer
+func (i *Noops) resendBlocks(req *fetchRequest) error {
+	from, to := req.fetch.From, req.fetch.To
+	if height := i.stack.GetBlockchainSize(); to >= height {
+		to = height - 1
+	}
+	if from == 0 || from > to {
+		return fmt.Errorf("Cannot resend blocks %d to %d to %v", req.fetch.From, req.fetch.To, req.requester)
+	}
+	if to-from >= maxFetchBlocks {
+		to = from + maxFetchBlocks - 1
+	}
+	logger.Infof("Resending blocks %d to %d to %v", from, to, req.requester)
+	for number := from; number <= to; number++ {
+		block, err := i.stack.GetBlock(number)
+		if err != nil {
+			return err
+		}
+		payload, err := marshalOrderedBlock(number, block.Transactions)
+		if err != nil {
+			return err
+		}
+		if err = i.stack.Unicast(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, req.requester); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyBlock executes and commits a block and announces it to the non-validating peers
+func (i *Noops) applyBlock(txarr []*pb.Transaction) error {
 	var data *pb.Block
 	var delta *statemgmt.StateDelta
 	var err error
 
-	if err = i.processTransactions(); nil != err {
+	if err = i.processTransactions(txarr); nil != err {
 		return err
 	}
 	if data, delta, err = i.getBlockData(); nil != err {
@@ -200,7 +460,7 @@ func (i *Noops) processBlock() error {
 	return nil
 }
 
-func (i *Noops) processTransactions() error {
+func (i *Noops) processTransactions(txarr []*pb.Transaction) error {
 	timestamp := util.CreateUtcTimestamp()
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debugf("Starting TX batch with timestamp: %v", timestamp)
@@ -209,8 +469,7 @@ func (i *Noops) processTransactions() error {
 		return err
 	}
 
-	// Grab all transactions from the FIFO queue and run them in order
-	txarr := i.txQ.getTXs()
+	// Run the transactions in the order they were queued
 	if logger.IsEnabledFor(logging.DEBUG) {
 		logger.Debugf("Executing batch of %d transactions with timestamp %v", len(txarr), timestamp)
 	}
@@ -234,6 +493,12 @@ func (i *Noops) processTransactions() error {
 	return nil
 }
 
+// isCommitted reports whether the ledger holds the result of the transaction
+func (i *Noops) isCommitted(uuid string) bool {
+	_, err := i.ledger.GetTransactionResultByUUID(uuid)
+	return err == nil
+}
+
 func (i *Noops) getTxFromMsg(msg *pb.Message) (*pb.Transaction, error) {
 	txs := &pb.TransactionBlock{}
 	if err := proto.Unmarshal(msg.Payload, txs); err != nil {
@@ -243,10 +508,7 @@ func (i *Noops) getTxFromMsg(msg *pb.Message) (*pb.Transaction, error) {
 }
 
 func (i *Noops) getBlockData() (*pb.Block, *statemgmt.StateDelta, error) {
-	ledger, err := ledger.GetLedger()
-	if err != nil {
-		return nil, nil, fmt.Errorf("Fail to get the ledger: %v", err)
-	}
+	ledger := i.ledger
 
 	blockHeight := ledger.GetBlockchainSize()
 	if logger.IsEnabledFor(logging.DEBUG) {
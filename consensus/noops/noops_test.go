@@ -0,0 +1,235 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package noops
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// testNetwork connects an orderer vp0 with a validator vp1, messages for which drop returns true are lost
+type testNetwork struct {
+	mutex  sync.Mutex
+	stacks map[string]*testStack
+	drop   func(dst string, msg *Message) bool
+}
+
+func (net *testNetwork) send(dst string, msg *pb.Message, src *pb.PeerID) {
+	noopsMsg := &Message{}
+	if err := proto.Unmarshal(msg.Payload, noopsMsg); err != nil {
+		return
+	}
+	net.mutex.Lock()
+	dropped := net.drop != nil && net.drop(dst, noopsMsg)
+	net.mutex.Unlock()
+	if !dropped {
+		net.stacks[dst].noops.RecvMsg(msg, src)
+	}
+}
+
+// testStack is the consensus.Stack and ledger of a validator, the methods noops does not use are left unimplemented
+type testStack struct {
+	consensus.Stack
+	self  *pb.PeerID
+	net   *testNetwork
+	noops *Noops
+
+	mutex  sync.Mutex
+	blocks []*pb.Block
+	batch  []*pb.Transaction
+}
+
+func (stack *testStack) GetNetworkHandles() (*pb.PeerID, []*pb.PeerID, error) {
+	return stack.self, nil, nil
+}
+
+func (stack *testStack) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	if peerType != pb.PeerEndpoint_VALIDATOR {
+		return nil
+	}
+	for name := range stack.net.stacks {
+		if name != stack.self.Name {
+			stack.net.send(name, msg, stack.self)
+		}
+	}
+	return nil
+}
+
+func (stack *testStack) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	stack.net.send(receiverHandle.Name, msg, stack.self)
+	return nil
+}
+
+func (stack *testStack) BeginTxBatch(id interface{}) error {
+	return nil
+}
+
+func (stack *testStack) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	stack.batch = append(stack.batch, txs...)
+	return nil, nil
+}
+
+func (stack *testStack) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	block := &pb.Block{Transactions: stack.batch}
+	stack.blocks = append(stack.blocks, block)
+	stack.batch = nil
+	return block, nil
+}
+
+func (stack *testStack) RollbackTxBatch(id interface{}) error {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	stack.batch = nil
+	return nil
+}
+
+func (stack *testStack) GetBlockchainSize() uint64 {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	return uint64(len(stack.blocks))
+}
+
+func (stack *testStack) GetBlock(id uint64) (*pb.Block, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	if id >= uint64(len(stack.blocks)) {
+		return nil, fmt.Errorf("block %d not found", id)
+	}
+	// The caller may modify the block, as it would a block read from the database
+	return proto.Clone(stack.blocks[id]).(*pb.Block), nil
+}
+
+func (stack *testStack) GetBlockByNumber(blockNumber uint64) (*pb.Block, error) {
+	return stack.GetBlock(blockNumber)
+}
+
+func (stack *testStack) GetStateDelta(blockNumber uint64) (*statemgmt.StateDelta, error) {
+	return statemgmt.NewStateDelta(), nil
+}
+
+func (stack *testStack) GetTransactionResultByUUID(txUUID string) (*pb.TransactionResult, error) {
+	return nil, fmt.Errorf("transaction %s not found", txUUID)
+}
+
+// uuids returns the UUIDs of the transactions of each block after the genesis block
+func (stack *testStack) uuids() []string {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	var uuids []string
+	for _, block := range stack.blocks[1:] {
+		for _, tx := range block.Transactions {
+			uuids = append(uuids, tx.Uuid)
+		}
+	}
+	return uuids
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	config := viper.New()
+	config.Set("block.size", 1)
+	config.Set("block.wait", "100ms")
+	config.Set("orderer", "vp0")
+	config.Set("replay.window", 100)
+
+	net := &testNetwork{stacks: make(map[string]*testStack)}
+	for _, name := range []string{"vp0", "vp1"} {
+		stack := &testStack{self: &pb.PeerID{Name: name}, net: net, blocks: []*pb.Block{{}}}
+		net.stacks[name] = stack
+	}
+	for _, stack := range net.stacks {
+		stack.noops = newNoops(stack, stack, config)
+	}
+	return net
+}
+
+func createTxMsg(uuid string) *pb.Message {
+	raw, _ := proto.Marshal(&pb.Transaction{Type: pb.Transaction_CHAINCODE_INVOKE, Uuid: uuid})
+	return &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: raw}
+}
+
+func waitForUUIDs(t *testing.T, stack *testStack, expected []string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for fmt.Sprint(stack.uuids()) != fmt.Sprint(expected) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Validator %s expected to commit %v, has %v", stack.self.Name, expected, stack.uuids())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFollowerFetchesMissedBlock(t *testing.T) {
+	net := newTestNetwork(t)
+	orderer, follower := net.stacks["vp0"], net.stacks["vp1"]
+
+	// The follower misses block 2 once
+	dropped := false
+	net.drop = func(dst string, msg *Message) bool {
+		if dst == "vp1" && msg.GetBlock() != nil && msg.Block.Number == 2 && !dropped {
+			dropped = true
+			return true
+		}
+		return false
+	}
+
+	for _, uuid := range []string{"a", "b"} {
+		if err := orderer.noops.RecvMsg(createTxMsg(uuid), nil); err != nil {
+			t.Fatalf("Orderer rejected transaction %s: %s", uuid, err)
+		}
+	}
+	waitForUUIDs(t, orderer, []string{"a", "b"})
+	waitForUUIDs(t, follower, []string{"a"})
+
+	// Block 3 reveals the missed block 2, which the follower fetches before applying block 3;
+	// a transaction submitted to the follower is relayed to the orderer
+	if err := follower.noops.RecvMsg(createTxMsg("c"), nil); err != nil {
+		t.Fatalf("Follower rejected transaction: %s", err)
+	}
+	waitForUUIDs(t, orderer, []string{"a", "b", "c"})
+	waitForUUIDs(t, follower, []string{"a", "b", "c"})
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	if !dropped {
+		t.Fatalf("Expected block 2 to be dropped")
+	}
+}
+
+func TestFollowerIgnoresBlocksOfOthers(t *testing.T) {
+	net := newTestNetwork(t)
+	follower := net.stacks["vp1"]
+
+	payload, _ := marshalOrderedBlock(1, []*pb.Transaction{{Uuid: "a"}})
+	if err := follower.noops.RecvMsg(&pb.Message{Type: pb.Message_CONSENSUS, Payload: payload}, &pb.PeerID{Name: "vp2"}); err == nil {
+		t.Fatalf("Expected a block from a validator other than the orderer to be rejected")
+	}
+	fetch, _ := proto.Marshal(&Message{Fetch: &FetchBlocks{From: 1, To: 1}})
+	if err := follower.noops.RecvMsg(&pb.Message{Type: pb.Message_CONSENSUS, Payload: fetch}, &pb.PeerID{Name: "vp0"}); err == nil {
+		t.Fatalf("Expected a fetch request to a validator other than the orderer to be rejected")
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package noops
+
+// replayDetector remembers the UUIDs of the most recently received transactions
+// and consults the ledger for older ones, so a retransmitted transaction is not
+// executed a second time
+type replayDetector struct {
+	window    int
+	seen      map[string]struct{}
+	order     []string // remembered UUIDs, oldest first
+	committed func(uuid string) bool
+}
+
+func newReplayDetector(window int, committed func(uuid string) bool) *replayDetector {
+	if window < 1 {
+		window = 1
+	}
+	return &replayDetector{
+		window:    window,
+		seen:      make(map[string]struct{}),
+		committed: committed,
+	}
+}
+
+// isReplay reports whether a transaction with this UUID was received or committed before,
+// the UUID is remembered otherwise
+func (r *replayDetector) isReplay(uuid string) bool {
+	if uuid == "" {
+		return false
+	}
+	if _, ok := r.seen[uuid]; ok {
+		return true
+	}
+	if r.committed != nil && r.committed(uuid) {
+		return true
+	}
+	r.seen[uuid] = struct{}{}
+	r.order = append(r.order, uuid)
+	if len(r.order) > r.window {
+		delete(r.seen, r.order[0])
+		r.order = r.order[1:]
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package noops
+
+import "testing"
+
+func TestReplayDetector(t *testing.T) {
+	committed := map[string]bool{"old": true}
+	r := newReplayDetector(2, func(uuid string) bool { return committed[uuid] })
+
+	if r.isReplay("a") || r.isReplay("b") {
+		t.Fatal("Expected first transactions not to be replays")
+	}
+	if !r.isReplay("a") {
+		t.Error("Expected a retransmitted transaction to be detected")
+	}
+	if !r.isReplay("old") {
+		t.Error("Expected a transaction committed to the ledger to be detected")
+	}
+	if r.isReplay("c") {
+		t.Error("Expected a new transaction not to be a replay")
+	}
+	if r.isReplay("a") {
+		t.Error("Expected a transaction to be forgotten once it left the window")
+	}
+	if r.isReplay("") || r.isReplay("") {
+		t.Error("Expected transactions without UUID never to be reported")
+	}
+}
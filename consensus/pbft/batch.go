@@ -37,10 +37,11 @@ type obcBatch struct {
 	broadcaster *broadcaster
 
 	batchSize        int
-	batchStore       []*Request
+	batchStore       *fairQueue
 	batchTimer       events.Timer
 	batchTimerActive bool
 	batchTimeout     time.Duration
+	quota            int // outstanding requests an enrolled submitter may have at this replica, 0 for no limit
 
 	manager events.Manager // TODO, remove eventually, the event manager
 
@@ -68,6 +69,13 @@ type batchMessageEvent batchMessage
 type batchTimerEvent struct{}
 
 func newObcBatch(id uint64, config *viper.Viper, stack consensus.Stack) *obcBatch {
+	manager := events.NewManagerImpl() // TODO, this is hacky, eventually rip it out
+	return newObcBatchWithEvents(id, config, stack, manager, events.NewTimerFactoryImpl(manager), false)
+}
+
+// newObcBatchWithEvents creates an obcBatch whose events and timers are driven by the
+// given manager and timer factory, a direct one sends messages from the event thread
+func newObcBatchWithEvents(id uint64, config *viper.Viper, stack consensus.Stack, manager events.Manager, etf events.TimerFactory, direct bool) *obcBatch {
 	var err error
 
 	op := &obcBatch{
@@ -78,22 +86,30 @@ func newObcBatch(id uint64, config *viper.Viper, stack consensus.Stack) *obcBatc
 
 	logger.Debugf("Replica %d obtaining startup information", id)
 
-	op.manager = events.NewManagerImpl() // TODO, this is hacky, eventually rip it out
+	op.manager = manager
 	op.manager.SetReceiver(op)
-	etf := events.NewTimerFactoryImpl(op.manager)
 	op.pbft = newPbftCore(id, config, op, etf)
 	op.manager.Start()
 	op.externalEventReceiver.manager = op.manager
-	op.broadcaster = newBroadcaster(id, op.pbft.N, op.pbft.f, stack)
+	if direct {
+		op.broadcaster = newDirectBroadcaster(id, op.pbft.N, op.pbft.f, stack)
+	} else {
+		op.broadcaster = newBroadcaster(id, op.pbft.N, op.pbft.f, stack)
+	}
+	op.broadcaster.updateMembership(op.pbft.replicas, op.pbft.f) // the membership may have been restored from the ledger
 
 	op.batchSize = config.GetInt("general.batchsize")
-	op.batchStore = nil
+	op.batchStore = newFairQueue()
 	op.batchTimeout, err = time.ParseDuration(config.GetString("general.timeout.batch"))
 	if err != nil {
 		panic(fmt.Errorf("Cannot parse batch timeout: %s", err))
 	}
 	logger.Infof("PBFT Batch size = %d", op.batchSize)
 	logger.Infof("PBFT Batch timeout = %v", op.batchTimeout)
+	op.quota = config.GetInt("general.quota.outstanding")
+	if op.quota > 0 {
+		logger.Infof("PBFT outstanding request quota per submitter = %d", op.quota)
+	}
 
 	if op.batchTimeout >= op.pbft.requestTimeout {
 		op.pbft.requestTimeout = 3 * op.batchTimeout / 2
@@ -183,10 +199,52 @@ func (op *obcBatch) verify(senderID uint64, signature []byte, message []byte) er
 	return op.stack.Verify(senderHandle, signature, message)
 }
 
+// session key shared with another replica, for message authenticators
+func (op *obcBatch) sessionKey(replicaID uint64) ([]byte, error) {
+	replicaHandle, err := getValidatorHandle(replicaID)
+	if err != nil {
+		return nil, err
+	}
+	return op.stack.SessionKey(replicaHandle)
+}
+
+// adjust the set of replicas we send to
+func (op *obcBatch) membershipChanged(replicas []uint64, f int) {
+	if op.broadcaster == nil {
+		// Still being constructed, the broadcaster picks up the restored membership on creation
+		return
+	}
+	op.broadcaster.updateMembership(replicas, f)
+}
+
+// verifyReconfiguration checks that a reconfiguration request was signed
+// by the replica it claims to come from, so that the primary cannot vote
+// on behalf of other replicas
+func (op *obcBatch) verifyReconfiguration(req *Request) error {
+	unsigned := *req
+	unsigned.Signature = nil
+	raw, err := proto.Marshal(&unsigned)
+	if err != nil {
+		return err
+	}
+	return op.verify(req.ReplicaId, req.Signature, raw)
+}
+
 // execute an opaque request which corresponds to an OBC Transaction
 func (op *obcBatch) execute(seqNo uint64, reqBatch *RequestBatch) {
 	var txs []*pb.Transaction
 	for _, req := range reqBatch.GetBatch() {
+		if membership := req.GetReconfiguration(); membership != nil {
+			logger.Infof("Batch replica %d executing reconfiguration request from replica %d, seqNo=%d", op.pbft.id, req.ReplicaId, seqNo)
+			op.reqStore.remove(req)
+			op.deduplicator.Execute(req)
+			if err := op.verifyReconfiguration(req); err != nil {
+				logger.Warningf("Batch replica %d ignoring reconfiguration request from replica %d at seqNo %d: %s", op.pbft.id, req.ReplicaId, seqNo, err)
+				continue
+			}
+			op.pbft.reconfigure(seqNo, membership, req.ReplicaId)
+			continue
+		}
 		tx := &pb.Transaction{}
 		if err := proto.Unmarshal(req.Payload, tx); err != nil {
 			logger.Warningf("Batch replica %d could not unmarshal transaction %s", op.pbft.id, err)
@@ -199,7 +257,12 @@ func (op *obcBatch) execute(seqNo uint64, reqBatch *RequestBatch) {
 		txs = append(txs, tx)
 		op.deduplicator.Execute(req)
 	}
-	meta, _ := proto.Marshal(&Metadata{seqNo})
+	meta, _ := proto.Marshal(&Metadata{
+		SeqNo:                seqNo,
+		Membership:           op.pbft.membership(),
+		PendingMembership:    op.pbft.pendingMembership,
+		ReconfigurationVotes: op.pbft.reconfigurationVoteList(),
+	})
 	logger.Debugf("Batch replica %d received exec for seqNo %d containing %d transactions", op.pbft.id, seqNo, len(txs))
 	op.stack.Execute(meta, txs) // This executes in the background, we will receive an executedEvent once it completes
 }
@@ -209,36 +272,62 @@ func (op *obcBatch) execute(seqNo uint64, reqBatch *RequestBatch) {
 // =============================================================================
 
 func (op *obcBatch) leaderProcReq(req *Request) events.Event {
+	op.queueRequest(req)
+
+	if op.batchStore.Len() >= op.batchSize && op.canSendBatch() {
+		return op.sendBatch()
+	}
+
+	return nil
+}
+
+func (op *obcBatch) queueRequest(req *Request) {
 	// XXX check req sig
 	digest := hash(req)
 	logger.Debugf("Batch primary %d queueing new request %s", op.pbft.id, digest)
-	op.batchStore = append(op.batchStore, req)
+	op.batchStore.push(req)
 	op.reqStore.storePending(req)
 
 	if !op.batchTimerActive {
 		op.startBatchTimer()
 	}
+}
 
-	if len(op.batchStore) >= op.batchSize {
-		return op.sendBatch()
-	}
-
-	return nil
+// canSendBatch returns whether pbft could pre-prepare a batch right away; until it
+// can, requests stay in the batch store, where they are served fairly
+func (op *obcBatch) canSendBatch() bool {
+	return op.pbft.seqNoUnavailable(op.pbft.seqNo+1) == ""
 }
 
 func (op *obcBatch) sendBatch() events.Event {
 	op.stopBatchTimer()
-	if len(op.batchStore) == 0 {
+	if op.batchStore.Len() == 0 {
 		logger.Error("Told to send an empty batch store for ordering, ignoring")
 		return nil
 	}
 
-	reqBatch := &RequestBatch{Batch: op.batchStore}
-	op.batchStore = nil
+	reqBatch := &RequestBatch{Batch: op.batchStore.pop(op.batchSize)}
+	if op.batchStore.Len() > 0 {
+		op.startBatchTimer()
+	}
 	logger.Infof("Creating batch with %d requests", len(reqBatch.Batch))
 	return reqBatch
 }
 
+// sendBatches hands pbft batches from the batch store for as long as it can
+// pre-prepare them, a batch which is not full is only sent if flush is set
+func (op *obcBatch) sendBatches(flush bool) events.Event {
+	for op.batchStore.Len() >= op.batchSize || (flush && op.batchStore.Len() > 0) {
+		if !op.canSendBatch() {
+			return nil
+		}
+		if res := op.pbft.ProcessEvent(op.sendBatch()); res != nil {
+			return res
+		}
+	}
+	return nil
+}
+
 func (op *obcBatch) txToReq(tx []byte) *Request {
 	now := time.Now()
 	req := &Request{
@@ -253,9 +342,33 @@ func (op *obcBatch) txToReq(tx []byte) *Request {
 	return req
 }
 
+// overQuota returns why a request submitted by a client to this replica must be
+// rejected, or the empty string if its submitter is within the quota. Only
+// clients identified by their enrollment ID have a quota: the requests of the
+// others are all attributed to this replica, and one of them could otherwise
+// use up the quota of all of them
+func (op *obcBatch) overQuota(req *Request) string {
+	if op.quota <= 0 || requestEnrollmentID(req) == "" {
+		return ""
+	}
+	if outstanding := op.reqStore.outstandingFrom(requestSubmitter(req)); outstanding >= op.quota {
+		return fmt.Sprintf("submitter already has %d outstanding requests, the quota is %d", outstanding, op.quota)
+	}
+	return ""
+}
+
 func (op *obcBatch) processMessage(ocMsg *pb.Message, senderHandle *pb.PeerID) events.Event {
 	if ocMsg.Type == pb.Message_CHAIN_TRANSACTION {
 		req := op.txToReq(ocMsg.Payload)
+		if reason := op.overQuota(req); reason != "" {
+			tx := &pb.Transaction{}
+			if err := proto.Unmarshal(ocMsg.Payload, tx); err != nil {
+				logger.Errorf("Replica %d was sent a transaction which did not unmarshal: %s", op.pbft.id, err)
+				return nil
+			}
+			op.stack.RejectTransaction(tx, reason)
+			return nil
+		}
 		return op.submitToLeader(req)
 	}
 
@@ -326,18 +439,12 @@ func (op *obcBatch) resubmitOutstandingReqs() events.Event {
 	// we run out of requests, or a new batch message is triggered (this path will re-enter after execution)
 	// Do not enter while an execution is in progress to prevent duplicating a request
 	if op.pbft.primary(op.pbft.view) == op.pbft.id && op.pbft.activeView && op.pbft.currentExec == nil {
-		needed := op.batchSize - len(op.batchStore)
-
-		for op.reqStore.hasNonPending() {
-			outstanding := op.reqStore.getNextNonPending(needed)
-
-			// If we have enough outstanding requests, this will trigger a batch
-			for _, nreq := range outstanding {
-				if msg := op.leaderProcReq(nreq); msg != nil {
-					op.manager.Inject(msg)
-				}
-			}
+		for _, nreq := range op.reqStore.getNextNonPending(op.reqStore.outstandingRequests.Len()) {
+			op.queueRequest(nreq)
 		}
+
+		// If we have enough outstanding requests, this will trigger batches
+		return op.sendBatches(false)
 	}
 	return nil
 }
@@ -362,8 +469,14 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 		return op.resubmitOutstandingReqs()
 	case batchTimerEvent:
 		logger.Infof("Replica %d batch timer expired", op.pbft.id)
-		if op.pbft.activeView && (len(op.batchStore) > 0) {
-			return op.sendBatch()
+		op.batchTimerActive = false
+		if op.pbft.activeView && (op.batchStore.Len() > 0) {
+			res := op.sendBatches(true)
+			if op.batchStore.Len() > 0 && !op.batchTimerActive {
+				// pbft is out of sequence numbers, try again later
+				op.startBatchTimer()
+			}
+			return res
 		}
 	case *Commit:
 		// TODO, this is extremely hacky, but should go away when batch and core are merged
@@ -371,7 +484,7 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 		op.startTimerIfOutstandingRequests()
 		return res
 	case viewChangedEvent:
-		op.batchStore = nil
+		op.batchStore = newFairQueue()
 		// Outstanding reqs doesn't make sense for batch, as all the requests in a batch may be processed
 		// in a different batch, but PBFT core can't see through the opaque structure to see this
 		// so, on view change, clear it out
@@ -412,6 +525,20 @@ func (op *obcBatch) ProcessEvent(event events.Event) events.Event {
 		}
 
 		return op.resubmitOutstandingReqs()
+	case reconfigureEvent:
+		req := op.txToReq(nil)
+		req.Reconfiguration = et.membership
+		req.Reconfiguration.SequenceNumber = op.pbft.membershipSeqNo // binds the vote to the membership it replaces
+		raw, err := proto.Marshal(req)
+		if err != nil {
+			logger.Errorf("Batch replica %d could not marshal reconfiguration request: %s", op.pbft.id, err)
+			return nil
+		}
+		if req.Signature, err = op.sign(raw); err != nil {
+			logger.Errorf("Batch replica %d could not sign reconfiguration request: %s", op.pbft.id, err)
+			return nil
+		}
+		return op.submitToLeader(req)
 	case stateUpdatedEvent:
 		// When the state is updated, clear any outstanding requests, they may have been processed while we were gone
 		op.reqStore = newRequestStore()
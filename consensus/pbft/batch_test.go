@@ -22,8 +22,10 @@ import (
 
 	"github.com/hyperledger/fabric/consensus"
 	"github.com/hyperledger/fabric/consensus/util/events"
+	"github.com/hyperledger/fabric/core/crypto/utils"
 	pb "github.com/hyperledger/fabric/protos"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/spf13/viper"
 )
 
@@ -57,7 +59,7 @@ func TestNetworkBatch(t *testing.T) {
 	net.process()
 	net.process()
 
-	if l := len(net.endpoints[0].(*consumerEndpoint).consumer.(*obcBatch).batchStore); l != 0 {
+	if l := net.endpoints[0].(*consumerEndpoint).consumer.(*obcBatch).batchStore.Len(); l != 0 {
 		t.Errorf("%d messages expected in primary's batchStore, found %v", 0,
 			net.endpoints[0].(*consumerEndpoint).consumer.(*obcBatch).batchStore)
 	}
@@ -137,7 +139,9 @@ func TestOutstandingReqsIngestion(t *testing.T) {
 }
 
 func TestOutstandingReqsResubmission(t *testing.T) {
-	omni := &omniProto{}
+	omni := &omniProto{
+		SignImpl: func(msg []byte) ([]byte, error) { return msg, nil },
+	}
 	config := loadConfig()
 	config.Set("general.batchsize", 2)
 	b := newObcBatch(0, config, omni)
@@ -350,13 +354,268 @@ func TestClearBatchStoreOnViewChange(t *testing.T) {
 	b := newObcBatch(1, loadConfig(), &omniProto{})
 	defer b.Close()
 
-	b.batchStore = []*Request{&Request{}}
+	b.batchStore.push(&Request{})
 
 	// Send a request, which will be ignored, triggering view change
 	b.manager.Queue() <- viewChangedEvent{}
 	b.manager.Queue() <- nil
 
-	if len(b.batchStore) != 0 {
+	if b.batchStore.Len() != 0 {
 		t.Fatalf("Should have cleared the batch store on view change")
 	}
 }
+
+func TestOutstandingQuota(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.quota.outstanding", 2)
+	rejected := make(map[string]string)
+	omni := &omniProto{
+		UnicastImpl: func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		RejectTransactionImpl: func(tx *pb.Transaction, reason string) {
+			rejected[string(tx.Payload)] = reason
+		},
+	}
+	b := newObcBatch(1, config, omni)
+	defer b.Close()
+
+	submit := func(tag int64, cert []byte) {
+		tx := createTx(tag)
+		tx.Cert = cert
+		events.SendEvent(b, batchMessageEvent{
+			msg:    &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: marshalTx(tx)},
+			sender: &pb.PeerID{Name: "vp1"},
+		})
+	}
+	// each transaction carries a fresh certificate, yet the ECerts of
+	// alice are charged to her enrollment ID
+	submit(1, createCert("alice"))
+	submit(2, createCert("alice"))
+	submit(3, createCert("alice"))
+	submit(4, createCert("bob"))
+
+	if _, ok := rejected["3"]; !ok || len(rejected) != 1 {
+		t.Fatalf("Expected only the third request of the first submitter to be rejected, got %v", rejected)
+	}
+	if count := b.reqStore.outstandingRequests.Len(); count != 3 {
+		t.Fatalf("Expected 3 outstanding requests, got %d", count)
+	}
+
+	// unlinkable TCerts cannot be told apart by submitter, so they have no
+	// quota, lest one client flooding the replica starve the others
+	submit(5, createCert(utils.TCertSubjectCommonName))
+	submit(6, createCert(utils.TCertSubjectCommonName))
+	submit(7, createCert(utils.TCertSubjectCommonName))
+
+	if len(rejected) != 1 {
+		t.Fatalf("Expected no request signed with a TCert to be rejected, got %v", rejected)
+	}
+}
+
+func TestFairBatches(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.batchsize", 2)
+	omni := &omniProto{
+		UnicastImpl: func(ocMsg *pb.Message, peer *pb.PeerID) error { return nil },
+		SignImpl:    func(msg []byte) ([]byte, error) { return msg, nil },
+	}
+	b := newObcBatch(0, config, omni)
+	defer b.Close()
+
+	// Exhaust the sequence numbers the primary may assign
+	b.pbft.seqNo = b.pbft.h + b.pbft.L/2
+
+	request := func(tag int64, cert string) *Request {
+		tx := createTx(tag)
+		tx.Cert = createCert(cert)
+		return &Request{Timestamp: tx.Timestamp, Payload: marshalTx(tx), ReplicaId: 0}
+	}
+	for i := int64(1); i <= 4; i++ {
+		b.reqStore.storeOutstanding(request(i, "flooder"))
+	}
+	b.reqStore.storeOutstanding(request(5, "other"))
+	events.SendEvent(b, execDoneEvent{})
+
+	if len(b.pbft.outstandingReqBatches) != 0 || b.batchStore.Len() != 5 {
+		t.Fatalf("Expected the requests to wait for a sequence number, %d batches sent, %d requests queued",
+			len(b.pbft.outstandingReqBatches), b.batchStore.Len())
+	}
+
+	b.pbft.seqNo = b.pbft.h
+	events.SendEvent(b, execDoneEvent{})
+
+	batch := b.pbft.certStore[msgID{v: b.pbft.view, n: b.pbft.h + 1}].prePrepare.RequestBatch.Batch
+	if len(batch) != 2 || requestSubmitter(batch[0]) == requestSubmitter(batch[1]) {
+		t.Fatalf("Expected the first batch to hold a request from each submitter")
+	}
+}
+
+func TestReconfigureAddReplica(t *testing.T) {
+	validatorCount := 5
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).pbft.K = 2
+		ce.consumer.(*obcBatch).pbft.L = 4
+		// Replica 4 is not part of the initial membership
+		ce.consumer.(*obcBatch).pbft.setMembership(&Membership{Replicas: []uint64{0, 1, 2, 3}, F: 1})
+	})
+	defer net.stop()
+
+	replica := func(id int) *obcBatch {
+		return net.endpoints[id].(*consumerEndpoint).consumer.(*obcBatch)
+	}
+	if err := replica(0).Reconfigure([]uint64{0, 1, 2}, 1); err == nil {
+		t.Fatalf("Expected a membership of 3 replicas tolerating 1 fault to be rejected")
+	}
+	if err := replica(0).Reconfigure([]uint64{4, 3, 2, 1, 0}, 1); err != nil {
+		t.Fatalf("Reconfiguration was rejected: %s", err)
+	}
+	net.process()
+
+	// A single replica cannot change the membership
+	for id := 0; id < 4; id++ {
+		obc := replica(id)
+		if obc.pbft.pendingMembership != nil || len(obc.pbft.reconfigurationVotes) != 1 {
+			t.Fatalf("Replica %d expected to record the request of replica 0 only, pending %v, votes %v", id, obc.pbft.pendingMembership, obc.pbft.reconfigurationVotes)
+		}
+	}
+
+	// With the requests of replicas 1 and 2 at seqNo 2 and 3, a quorum of 3 requested the membership,
+	// which takes effect at seqNo 8
+	for _, id := range []int{1, 2} {
+		if err := replica(id).Reconfigure([]uint64{0, 1, 2, 3, 4}, 1); err != nil {
+			t.Fatalf("Reconfiguration was rejected: %s", err)
+		}
+		net.process()
+	}
+
+	broadcaster := net.endpoints[generateBroadcaster(4)].getHandle()
+	for n := 4; n <= 12; n++ {
+		net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(int64(n)), broadcaster)
+	}
+	net.process()
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		obc := ce.consumer.(*obcBatch)
+		if obc.pbft.N != 5 || obc.pbft.f != 1 || !obc.pbft.isMember(4) {
+			t.Errorf("Replica %d expected to use the new membership, has %v (N=%d, f=%d)", ce.id, obc.pbft.replicas, obc.pbft.N, obc.pbft.f)
+		}
+		if _, err := obc.stack.GetBlock(12); err != nil {
+			t.Errorf("Replica %d expected to reach block 12: %s", ce.id, err)
+		}
+	}
+
+	raw, _ := replica(0).stack.GetBlockHeadMetadata()
+	meta := &Metadata{}
+	if err := proto.Unmarshal(raw, meta); err != nil {
+		t.Fatalf("Could not unmarshal block metadata: %s", err)
+	}
+	if m := meta.GetMembership(); m == nil || len(m.Replicas) != 5 || m.SequenceNumber != 8 {
+		t.Errorf("Expected the new membership to be recorded with the block, found %v", m)
+	}
+}
+
+func TestReconfigureQuietNetwork(t *testing.T) {
+	validatorCount := 5
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).pbft.K = 2
+		ce.consumer.(*obcBatch).pbft.L = 4
+		ce.consumer.(*obcBatch).pbft.requestTimeout = time.Hour // We do not want any view changes
+		// Replica 4 is not part of the initial membership
+		ce.consumer.(*obcBatch).pbft.setMembership(&Membership{Replicas: []uint64{0, 1, 2, 3}, F: 1})
+	})
+	defer net.stop()
+
+	// No request follows the reconfiguration, scheduled at seqNo 8
+	for id := 0; id < 3; id++ {
+		if err := net.endpoints[id].(*consumerEndpoint).consumer.(*obcBatch).Reconfigure([]uint64{0, 1, 2, 3, 4}, 1); err != nil {
+			t.Fatalf("Reconfiguration was rejected: %s", err)
+		}
+		net.process()
+	}
+
+	// The primary issued null requests up to the next checkpoint, seqNo 10, to
+	// which replica 4 transferred state
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		obc := ce.consumer.(*obcBatch)
+		if obc.pbft.pendingMembership != nil || obc.pbft.N != 5 || !obc.pbft.isMember(4) {
+			t.Errorf("Replica %d expected to use the new membership, has %v (N=%d), pending %v", ce.id, obc.pbft.replicas, obc.pbft.N, obc.pbft.pendingMembership)
+		}
+		if obc.pbft.lastExec != 10 {
+			t.Errorf("Replica %d expected to reach seqNo 10, executed %d", ce.id, obc.pbft.lastExec)
+		}
+	}
+}
+
+func TestReconfigureStaleRequest(t *testing.T) {
+	validatorCount := 4
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper)
+	defer net.stop()
+
+	obc := net.endpoints[0].(*consumerEndpoint).consumer.(*obcBatch)
+	obc.pbft.membershipSeqNo = 8
+	for id := uint64(0); id < 3; id++ {
+		// Requests issued for the membership before the one of seqNo 8, e.g. replayed by a faulty primary
+		obc.pbft.reconfigure(uint64(10+id), &Membership{Replicas: []uint64{0, 1, 2, 3, 4}, F: 1}, id)
+	}
+	if obc.pbft.pendingMembership != nil || len(obc.pbft.reconfigurationVotes) != 0 {
+		t.Fatalf("Expected stale reconfiguration requests to be ignored, pending %v, votes %v", obc.pbft.pendingMembership, obc.pbft.reconfigurationVotes)
+	}
+}
+
+func TestReconfigureJoinByStateTransfer(t *testing.T) {
+	validatorCount := 5
+	net := makeConsumerNetwork(validatorCount, obcBatchSizeOneHelper, func(ce *consumerEndpoint) {
+		ce.consumer.(*obcBatch).pbft.K = 2
+		ce.consumer.(*obcBatch).pbft.L = 4
+		ce.consumer.(*obcBatch).pbft.requestTimeout = time.Hour // We do not want any view changes
+		// Replica 4 is not part of the initial membership
+		ce.consumer.(*obcBatch).pbft.setMembership(&Membership{Replicas: []uint64{0, 1, 2, 3}, F: 1})
+	})
+	defer net.stop()
+
+	// Replica 4 is down until after the new membership took effect
+	filterMsg := true
+	net.filterFn = func(src int, dst int, msg []byte) []byte {
+		if filterMsg && dst == 4 {
+			return nil
+		}
+		return msg
+	}
+
+	for id := 0; id < 3; id++ {
+		if err := net.endpoints[id].(*consumerEndpoint).consumer.(*obcBatch).Reconfigure([]uint64{0, 1, 2, 3, 4}, 1); err != nil {
+			t.Fatalf("Reconfiguration was rejected: %s", err)
+		}
+		net.process()
+	}
+	broadcaster := net.endpoints[generateBroadcaster(validatorCount)].getHandle()
+	for n := 4; n <= 8; n++ {
+		net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(int64(n)), broadcaster)
+	}
+	net.process()
+
+	joining := net.endpoints[4].(*consumerEndpoint).consumer.(*obcBatch)
+	if joining.pbft.isMember(4) || joining.pbft.lastExec != 0 {
+		t.Fatalf("Expected replica 4 to have missed the reconfiguration, has membership %v and lastExec %d", joining.pbft.replicas, joining.pbft.lastExec)
+	}
+
+	// Replica 4 sees checkpoints beyond its watermarks, transfers state, and
+	// learns the new membership from the metadata of the transferred block
+	filterMsg = false
+	for n := 9; n <= 16; n++ {
+		net.endpoints[1].(*consumerEndpoint).consumer.RecvMsg(createTxMsg(int64(n)), broadcaster)
+	}
+	net.process()
+
+	for _, ep := range net.endpoints {
+		ce := ep.(*consumerEndpoint)
+		obc := ce.consumer.(*obcBatch)
+		if obc.pbft.N != 5 || obc.pbft.f != 1 || !obc.pbft.isMember(4) {
+			t.Errorf("Replica %d expected to use the new membership, has %v (N=%d, f=%d)", ce.id, obc.pbft.replicas, obc.pbft.N, obc.pbft.f)
+		}
+		if _, err := obc.stack.GetBlock(16); err != nil {
+			t.Errorf("Replica %d expected to reach block 16: %s", ce.id, err)
+		}
+	}
+}
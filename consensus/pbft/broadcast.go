@@ -18,6 +18,7 @@ package pbft
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -33,42 +34,96 @@ type communicator interface {
 type broadcaster struct {
 	comm communicator
 
+	self     uint64
 	f        int
+	lock     sync.Mutex // protects f, msgChans and members, which change with the membership
 	msgChans map[uint64]chan *sendRequest
 	closed   sync.WaitGroup
 	closedCh chan struct{}
+
+	direct  bool     // send from the calling thread instead of through msgChans
+	members []uint64 // sorted destinations of a direct broadcaster
 }
 
+const broadcastQueueSize = 10 // XXX increase after testing
+
 type sendRequest struct {
 	msg  *pb.Message
 	done chan bool
 }
 
 func newBroadcaster(self uint64, N int, f int, c communicator) *broadcaster {
-	queueSize := 10 // XXX increase after testing
-
-	chans := make(map[uint64]chan *sendRequest)
 	b := &broadcaster{
 		comm:     c,
-		f:        f,
-		msgChans: chans,
+		self:     self,
+		msgChans: make(map[uint64]chan *sendRequest),
 		closedCh: make(chan struct{}),
 	}
-	for i := 0; i < N; i++ {
-		if uint64(i) == self {
-			continue
-		}
-		chans[uint64(i)] = make(chan *sendRequest, queueSize)
+	replicas := make([]uint64, N)
+	for i := range replicas {
+		replicas[i] = uint64(i)
 	}
+	b.updateMembership(replicas, f)
 
-	// We do not start the go routines in the above loop to avoid concurrent map read/writes
-	for i := 0; i < N; i++ {
-		go b.drainer(uint64(i))
+	return b
+}
+
+// newDirectBroadcaster creates a broadcaster which sends from the calling thread,
+// one destination after the other in replica order, rather than through a queue
+// per destination; it suits communicators which never block, like a simulated network
+func newDirectBroadcaster(self uint64, N int, f int, c communicator) *broadcaster {
+	b := &broadcaster{
+		comm:     c,
+		self:     self,
+		closedCh: make(chan struct{}),
+		direct:   true,
+	}
+	replicas := make([]uint64, N)
+	for i := range replicas {
+		replicas[i] = uint64(i)
 	}
+	b.updateMembership(replicas, f)
 
 	return b
 }
 
+// updateMembership starts sending to replicas which joined the network
+// and stops sending to replicas which left it
+func (b *broadcaster) updateMembership(replicas []uint64, f int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.f = f
+	if b.direct {
+		b.members = nil
+		for _, id := range replicas {
+			if id != b.self {
+				b.members = append(b.members, id)
+			}
+		}
+		sort.Sort(sortableUint64Slice(b.members))
+		return
+	}
+	members := make(map[uint64]bool)
+	for _, id := range replicas {
+		if id == b.self {
+			continue
+		}
+		members[id] = true
+		if _, ok := b.msgChans[id]; !ok {
+			destChan := make(chan *sendRequest, broadcastQueueSize)
+			b.msgChans[id] = destChan
+			go b.drainer(id, destChan)
+		}
+	}
+	for id := range b.msgChans {
+		if !members[id] {
+			// The drainer keeps running until close, but receives no new messages
+			delete(b.msgChans, id)
+		}
+	}
+}
+
 func (b *broadcaster) Close() {
 	close(b.closedCh)
 	b.closed.Wait()
@@ -106,9 +161,8 @@ func (b *broadcaster) drainerSend(dest uint64, send *sendRequest, successLastTim
 
 }
 
-func (b *broadcaster) drainer(dest uint64) {
+func (b *broadcaster) drainer(dest uint64, destChan chan *sendRequest) {
 	successLastTime := false
-	destChan := b.msgChans[dest] // Avoid doing the map lookup every send
 
 	for {
 		select {
@@ -149,6 +203,11 @@ func (b *broadcaster) send(msg *pb.Message, dest *uint64) error {
 	default:
 	}
 
+	if b.direct {
+		return b.sendDirect(msg, dest)
+	}
+
+	b.lock.Lock()
 	var destCount int
 	var required int
 	if dest != nil {
@@ -170,6 +229,7 @@ func (b *broadcaster) send(msg *pb.Message, dest *uint64) error {
 			b.unicastOne(msg, i, wait)
 		}
 	}
+	b.lock.Unlock()
 
 	succeeded := 0
 	timer := time.NewTimer(time.Second) // TODO, make this configurable
@@ -199,6 +259,27 @@ outer:
 	return nil
 }
 
+func (b *broadcaster) sendDirect(msg *pb.Message, dest *uint64) error {
+	b.lock.Lock()
+	dests := b.members
+	if dest != nil {
+		dests = []uint64{*dest}
+	}
+	b.lock.Unlock()
+
+	for _, id := range dests {
+		h, err := getValidatorHandle(id)
+		if err != nil {
+			logger.Warningf("could not get handle for replica %d", id)
+			continue
+		}
+		if err = b.comm.Unicast(msg, h); err != nil {
+			logger.Debugf("could not send to replica %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
 func (b *broadcaster) Unicast(msg *pb.Message, dest uint64) error {
 	return b.send(msg, &dest)
 }
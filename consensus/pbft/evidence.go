@@ -0,0 +1,348 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"google/protobuf"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Kinds of misbehavior recorded as evidence
+const (
+	evidenceEquivocation = "equivocation" // a primary sent conflicting pre-prepares
+	evidenceCheckpoint   = "checkpoint"   // a replica sent a checkpoint which disagrees with a weak certificate
+)
+
+// maxSignedDigests is how many digests a replica's signatures are kept for, per
+// view and sequence number: two conflicting messages suffice as evidence
+const maxSignedDigests = 2
+
+// signedKey identifies the pre-prepares or checkpoints a replica sent for a
+// view (of pre-prepares only) and sequence number, the messages which are
+// signed
+type signedKey struct {
+	v       uint64
+	n       uint64
+	replica uint64
+}
+
+// signedMsgKey returns the key and the batch digest or state id of a
+// pre-prepare or checkpoint, it returns false for the other messages, which
+// are not signed
+func signedMsgKey(msg *Message) (signedKey, string, bool) {
+	switch payload := msg.Payload.(type) {
+	case *Message_PrePrepare:
+		p := payload.PrePrepare
+		return signedKey{p.View, p.SequenceNumber, p.ReplicaId}, p.BatchDigest, true
+	case *Message_Checkpoint:
+		c := payload.Checkpoint
+		return signedKey{0, c.SequenceNumber, c.ReplicaId}, c.Id, true
+	}
+	return signedKey{}, "", false
+}
+
+// evidenceKey identifies a misbehavior: the replica, the kind, and the view
+// and sequence number it happened at
+type evidenceKey struct {
+	replica uint64
+	kind    string
+	v       uint64
+	n       uint64
+}
+
+// String returns the key the evidence is persisted under
+func (key evidenceKey) String() string {
+	return fmt.Sprintf("evidence.%d.%s.%d.%d", key.replica, key.kind, key.v, key.n)
+}
+
+func parseEvidenceKey(s string) (evidenceKey, error) {
+	fields := strings.Split(s, ".")
+	if len(fields) != 5 || fields[0] != "evidence" {
+		return evidenceKey{}, fmt.Errorf("malformed evidence key %s", s)
+	}
+	var numbers [3]uint64
+	for i, field := range []string{fields[1], fields[3], fields[4]} {
+		number, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return evidenceKey{}, fmt.Errorf("malformed evidence key %s: %s", s, err)
+		}
+		numbers[i] = number
+	}
+	return evidenceKey{numbers[0], fields[2], numbers[1], numbers[2]}, nil
+}
+
+// addSignature keeps a signature until the watermarks move past it, unless
+// maxSignedDigests other digests are signed already
+func (instance *pbftCore) addSignature(key signedKey, digest string, sig []byte) {
+	sigs, ok := instance.signatures[key]
+	if !ok {
+		sigs = make(map[string][]byte)
+		instance.signatures[key] = sigs
+	}
+	if _, ok = sigs[digest]; ok || len(sigs) < maxSignedDigests {
+		sigs[digest] = sig
+	}
+}
+
+// signEvidence signs the payload of a pre-prepare or checkpoint, which can
+// then serve as evidence against this replica. Nothing is signed without
+// security.
+func (instance *pbftCore) signEvidence(msg *Message) error {
+	key, digest, ok := signedMsgKey(msg)
+	if !instance.collectEvidence || !ok || msg.Signature != nil {
+		return nil
+	}
+	content, err := authenticatedContent(msg)
+	if err != nil {
+		return err
+	}
+	if msg.Signature, err = instance.consumer.sign(content); err != nil {
+		return err
+	}
+	instance.addSignature(key, digest, msg.Signature)
+	return nil
+}
+
+// storeSignature keeps the valid signature of a pre-prepare of the current
+// view or a checkpoint, sent by a member within the watermarks
+func (instance *pbftCore) storeSignature(msg *Message) {
+	key, digest, ok := signedMsgKey(msg)
+	if !instance.collectEvidence || !ok || msg.Signature == nil || !instance.inW(key.n) || !instance.isMember(key.replica) {
+		return
+	}
+	if msg.GetPrePrepare() != nil && key.v != instance.view {
+		return
+	}
+	if sigs, ok := instance.signatures[key]; ok && sigs[digest] == nil && len(sigs) >= maxSignedDigests {
+		return
+	}
+	content, err := authenticatedContent(msg)
+	if err != nil {
+		return
+	}
+	if err = instance.consumer.verify(key.replica, msg.Signature, content); err != nil {
+		logger.Warningf("Replica %d received an invalid signature of replica %d for seqNo=%d: %s", instance.id, key.replica, key.n, err)
+		return
+	}
+	instance.addSignature(key, digest, msg.Signature)
+}
+
+// signedMsg returns a pre-prepare or checkpoint with the signature of its
+// sender, which was checked when stored; evidence is only useful if others
+// can check it
+func (instance *pbftCore) signedMsg(msg *Message) (*Message, error) {
+	key, digest, _ := signedMsgKey(msg)
+	sig, ok := instance.signatures[key][digest]
+	if !ok {
+		return nil, fmt.Errorf("no signature of replica %d for seqNo=%d", key.replica, key.n)
+	}
+	return &Message{Payload: msg.Payload, Signature: sig}, nil
+}
+
+// recordEvidence keeps, persists and reports evidence that a replica
+// misbehaved, made of signed messages; the same misbehavior, identified by
+// the kind, view and sequence number, is only recorded once. Only misbehavior
+// within the watermarks is recorded, the evidence is then kept for operators
+// to query until more than general.evidence.retention records are collected.
+func (instance *pbftCore) recordEvidence(replica uint64, kind string, v uint64, n uint64, description string, signed []*Message) {
+	key := evidenceKey{replica, kind, v, n}
+	if _, ok := instance.evidence[key]; ok || !instance.inW(n) {
+		return
+	}
+
+	now := time.Now()
+	evidence := &pb.ConsensusEvidence{
+		Plugin:      "pbft",
+		ReplicaId:   replica,
+		Kind:        kind,
+		Description: description,
+		Timestamp:   &google_protobuf.Timestamp{Seconds: now.Unix(), Nanos: int32(now.UnixNano() % 1000000000)},
+	}
+	evidence.Faulty, _ = getValidatorHandle(replica)
+	for _, msg := range signed {
+		raw, err := proto.Marshal(msg)
+		if err != nil {
+			logger.Warningf("Replica %d could not marshal evidence against replica %d: %s", instance.id, replica, err)
+			return
+		}
+		evidence.Messages = append(evidence.Messages, raw)
+	}
+
+	logger.Warningf("Replica %d found evidence that replica %d misbehaved: %s", instance.id, replica, description)
+	instance.evidence[key] = evidence
+	instance.persistEvidence(key, evidence)
+	instance.consumer.reportEvidence(evidence)
+	instance.pruneEvidence()
+}
+
+// pruneEvidence drops the oldest evidence beyond the retention
+func (instance *pbftCore) pruneEvidence() {
+	if instance.evidenceRetention <= 0 || len(instance.evidence) <= instance.evidenceRetention {
+		return
+	}
+	keys := make(map[*pb.ConsensusEvidence]evidenceKey)
+	for key, evidence := range instance.evidence {
+		keys[evidence] = key
+	}
+	collected := instance.collectedEvidence()
+	for _, evidence := range collected[:len(collected)-instance.evidenceRetention] {
+		key := keys[evidence]
+		logger.Infof("Replica %d dropping evidence %s, more than %d records are kept", instance.id, key, instance.evidenceRetention)
+		delete(instance.evidence, key)
+		instance.persistDelEvidence(key)
+	}
+}
+
+// recordEquivocation records evidence against a primary which sent two
+// pre-prepares with different digests for the same view and sequence number
+func (instance *pbftCore) recordEquivocation(first *PrePrepare, second *PrePrepare) {
+	if !instance.collectEvidence {
+		return
+	}
+	var signed []*Message
+	for _, preprep := range []*PrePrepare{first, second} {
+		msg, err := instance.signedMsg(&Message{Payload: &Message_PrePrepare{PrePrepare: preprep}})
+		if err != nil {
+			logger.Warningf("Replica %d cannot prove that primary %d sent conflicting pre-prepares: %s", instance.id, second.ReplicaId, err)
+			return
+		}
+		signed = append(signed, msg)
+	}
+	instance.recordEvidence(second.ReplicaId, evidenceEquivocation, second.View, second.SequenceNumber,
+		fmt.Sprintf("primary sent pre-prepares with digests %s and %s for view=%d/seqNo=%d", first.BatchDigest, second.BatchDigest, second.View, second.SequenceNumber),
+		signed)
+}
+
+// recordConflictingCheckpoints records evidence against the replicas whose
+// checkpoint for seqNo disagrees with a weak certificate: f+1 matching
+// checkpoints include one from a correct replica, and correct replicas reach
+// the same state. Nothing is recorded if several states have a weak
+// certificate, the chaincode is then most likely non-deterministic.
+func (instance *pbftCore) recordConflictingCheckpoints(seqNo uint64) {
+	if !instance.collectEvidence {
+		return
+	}
+	byID := make(map[string][]Checkpoint)
+	for chkpt := range instance.checkpointStore {
+		if chkpt.SequenceNumber == seqNo {
+			byID[chkpt.Id] = append(byID[chkpt.Id], chkpt)
+		}
+	}
+
+	weakID := ""
+	for id, chkpts := range byID {
+		if len(chkpts) <= instance.f {
+			continue
+		}
+		if weakID != "" {
+			logger.Warningf("Replica %d found weak certificates for several states at seqNo=%d, not blaming any replica", instance.id, seqNo)
+			return
+		}
+		weakID = id
+	}
+	if weakID == "" || len(byID) == 1 {
+		return
+	}
+
+	weak := checkpointsByReplica(byID[weakID])
+	sort.Sort(weak)
+	var proof []*Message
+	for _, chkpt := range weak {
+		c := chkpt
+		if msg, err := instance.signedMsg(&Message{Payload: &Message_Checkpoint{Checkpoint: &c}}); err == nil {
+			proof = append(proof, msg)
+		}
+	}
+	if len(proof) <= instance.f {
+		logger.Debugf("Replica %d has only %d validly signed checkpoints for state %s at seqNo=%d", instance.id, len(proof), weakID, seqNo)
+		return
+	}
+	proof = proof[:instance.f+1]
+
+	for id, chkpts := range byID {
+		if id == weakID {
+			continue
+		}
+		for _, chkpt := range chkpts {
+			if chkpt.ReplicaId == instance.id {
+				// Our own divergence is dealt with once a quorum agrees on the checkpoint
+				continue
+			}
+			c := chkpt
+			msg, err := instance.signedMsg(&Message{Payload: &Message_Checkpoint{Checkpoint: &c}})
+			if err != nil {
+				logger.Warningf("Replica %d cannot prove that replica %d sent a conflicting checkpoint: %s", instance.id, chkpt.ReplicaId, err)
+				continue
+			}
+			instance.recordEvidence(chkpt.ReplicaId, evidenceCheckpoint, 0, seqNo,
+				fmt.Sprintf("replica sent checkpoint %s for seqNo=%d, but replicas %v sent %s", id, seqNo, weak.replicas(instance.f+1), weakID),
+				append([]*Message{msg}, proof...))
+		}
+	}
+}
+
+// collectedEvidence returns the evidence recorded so far, oldest first
+func (instance *pbftCore) collectedEvidence() []*pb.ConsensusEvidence {
+	var keys []string
+	byKey := make(map[string]*pb.ConsensusEvidence)
+	for key, evidence := range instance.evidence {
+		keys = append(keys, key.String())
+		byKey[key.String()] = evidence
+	}
+	sort.Strings(keys)
+	collected := make(evidenceByTime, len(keys))
+	for i, key := range keys {
+		collected[i] = byKey[key]
+	}
+	sort.Stable(collected)
+	return collected
+}
+
+type checkpointsByReplica []Checkpoint
+
+func (a checkpointsByReplica) Len() int           { return len(a) }
+func (a checkpointsByReplica) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a checkpointsByReplica) Less(i, j int) bool { return a[i].ReplicaId < a[j].ReplicaId }
+
+// replicas returns the senders of the first n checkpoints
+func (a checkpointsByReplica) replicas(n int) []uint64 {
+	var replicas []uint64
+	for _, chkpt := range a[:n] {
+		replicas = append(replicas, chkpt.ReplicaId)
+	}
+	return replicas
+}
+
+type evidenceByTime []*pb.ConsensusEvidence
+
+func (a evidenceByTime) Len() int      { return len(a) }
+func (a evidenceByTime) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a evidenceByTime) Less(i, j int) bool {
+	ti, tj := a[i].GetTimestamp(), a[j].GetTimestamp()
+	if ti == nil || tj == nil {
+		return ti == nil && tj != nil
+	}
+	return ti.Seconds < tj.Seconds || ti.Seconds == tj.Seconds && ti.Nanos < tj.Nanos
+}
@@ -0,0 +1,289 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+)
+
+// enableSecurity turns security on, without which no evidence is collected,
+// and returns a function restoring the previous setting
+func enableSecurity() func() {
+	security := viper.GetBool("security.enabled")
+	viper.Set("security.enabled", true)
+	return func() { viper.Set("security.enabled", security) }
+}
+
+// newEvidenceMock returns a stack whose signatures are the signed content itself,
+// it collects the state stored and the evidence reported
+func newEvidenceMock(stored map[string][]byte, reported *[]*pb.ConsensusEvidence) *omniProto {
+	return &omniProto{
+		broadcastImpl: func(msgPayload []byte) {},
+		signImpl:      func(msg []byte) ([]byte, error) { return msg, nil },
+		verifyImpl: func(senderID uint64, signature []byte, message []byte) error {
+			if !bytes.Equal(signature, message) {
+				return fmt.Errorf("bad signature")
+			}
+			return nil
+		},
+		StoreStateImpl: func(key string, value []byte) error {
+			stored[key] = value
+			return nil
+		},
+		DelStateImpl:        func(key string) { delete(stored, key) },
+		reportEvidenceImpl:  func(evidence *pb.ConsensusEvidence) { *reported = append(*reported, evidence) },
+		skipToImpl:          func(s uint64, id []byte, replicas []uint64) {},
+		invalidateStateImpl: func() {},
+	}
+}
+
+// signed returns a message carrying the payload, signed the way newEvidenceMock expects
+func signed(payload isMessage_Payload) *Message {
+	msg := &Message{Payload: payload}
+	msg.Signature, _ = authenticatedContent(msg)
+	return msg
+}
+
+func TestEquivocationEvidence(t *testing.T) {
+	defer enableSecurity()()
+	stored := make(map[string][]byte)
+	var reported []*pb.ConsensusEvidence
+	instance := newPbftCore(1, loadConfig(), newEvidenceMock(stored, &reported), &inertTimerFactory{})
+	defer instance.close()
+
+	for tag := int64(1); tag <= 2; tag++ {
+		reqBatch := createPbftReqBatch(tag, 1)
+		msg := signed(&Message_PrePrepare{PrePrepare: &PrePrepare{
+			View:           0,
+			SequenceNumber: 1,
+			BatchDigest:    hash(reqBatch),
+			RequestBatch:   reqBatch,
+			ReplicaId:      0,
+		}})
+		next, err := instance.recvMsg(msg, 0)
+		if err != nil {
+			t.Fatalf("Failed to receive pre-prepare: %s", err)
+		}
+		events.SendEvent(instance, next)
+	}
+
+	if len(reported) != 1 {
+		t.Fatalf("Expected one piece of evidence to be reported, got %d", len(reported))
+	}
+	evidence := reported[0]
+	if evidence.ReplicaId != 0 || evidence.Kind != evidenceEquivocation || evidence.Faulty.Name != "vp0" {
+		t.Errorf("Expected evidence of equivocation against replica 0, got %v", evidence)
+	}
+	if len(evidence.Messages) != 2 {
+		t.Fatalf("Expected both pre-prepares as evidence, got %d messages", len(evidence.Messages))
+	}
+	for _, raw := range evidence.Messages {
+		msg := &Message{}
+		if err := proto.Unmarshal(raw, msg); err != nil {
+			t.Fatalf("Could not unmarshal evidence: %s", err)
+		}
+		content, _ := authenticatedContent(msg)
+		if msg.GetPrePrepare() == nil || !bytes.Equal(msg.Signature, content) {
+			t.Errorf("Expected evidence to be a signed pre-prepare, got %v", msg)
+		}
+	}
+	if _, ok := stored["evidence.0.equivocation.0.1"]; !ok {
+		t.Errorf("Expected evidence to be persisted")
+	}
+	if instance.activeView {
+		t.Errorf("Expected replica to start a view change")
+	}
+}
+
+func TestConflictingCheckpointEvidence(t *testing.T) {
+	defer enableSecurity()()
+	stored := make(map[string][]byte)
+	var reported []*pb.ConsensusEvidence
+	instance := newPbftCore(1, loadConfig(), newEvidenceMock(stored, &reported), &inertTimerFactory{})
+	defer instance.close()
+
+	send := func(replica uint64, id string) {
+		msg := signed(&Message_Checkpoint{Checkpoint: &Checkpoint{SequenceNumber: 10, Id: id, ReplicaId: replica}})
+		next, err := instance.recvMsg(msg, replica)
+		if err != nil {
+			t.Fatalf("Failed to receive checkpoint: %s", err)
+		}
+		events.SendEvent(instance, next)
+	}
+
+	send(3, "WRONG")
+	if len(reported) != 0 {
+		t.Fatalf("Expected no evidence without a weak certificate, got %v", reported)
+	}
+	send(0, "CORRECT")
+	send(2, "CORRECT")
+
+	if len(reported) != 1 {
+		t.Fatalf("Expected one piece of evidence to be reported, got %d", len(reported))
+	}
+	evidence := reported[0]
+	if evidence.ReplicaId != 3 || evidence.Kind != evidenceCheckpoint {
+		t.Errorf("Expected evidence of a conflicting checkpoint against replica 3, got %v", evidence)
+	}
+	if len(evidence.Messages) != instance.f+2 {
+		t.Errorf("Expected the conflicting checkpoint and a weak certificate as evidence, got %d messages", len(evidence.Messages))
+	}
+
+	// A restarted replica restores the evidence it persisted
+	restarted := newPbftCore(1, loadConfig(), &omniProto{
+		ReadStateImpl: func(key string) ([]byte, error) { return nil, fmt.Errorf("not found") },
+		ReadStateSetImpl: func(prefix string) (map[string][]byte, error) {
+			set := make(map[string][]byte)
+			for key, value := range stored {
+				if strings.HasPrefix(key, prefix) {
+					set[key] = value
+				}
+			}
+			return set, nil
+		},
+	}, &inertTimerFactory{})
+	defer restarted.close()
+
+	collected := restarted.collectedEvidence()
+	if len(collected) != 1 || collected[0].ReplicaId != 3 || collected[0].Description != evidence.Description {
+		t.Errorf("Expected the evidence against replica 3 to be restored, got %v", collected)
+	}
+}
+
+func TestNoEvidenceWithoutSecurity(t *testing.T) {
+	stored := make(map[string][]byte)
+	var reported []*pb.ConsensusEvidence
+	instance := newPbftCore(1, loadConfig(), newEvidenceMock(stored, &reported), &inertTimerFactory{})
+	defer instance.close()
+
+	msg := &Message{Payload: &Message_Checkpoint{Checkpoint: &Checkpoint{SequenceNumber: 10, Id: "CORRECT", ReplicaId: 1}}}
+	if err := instance.innerBroadcast(msg); err != nil {
+		t.Fatalf("Failed to broadcast checkpoint: %s", err)
+	}
+	if msg.Signature != nil {
+		t.Errorf("Expected the checkpoint not to be signed without security")
+	}
+
+	for _, chkpt := range []*Checkpoint{{SequenceNumber: 10, Id: "WRONG", ReplicaId: 3}, {SequenceNumber: 10, Id: "CORRECT", ReplicaId: 0}, {SequenceNumber: 10, Id: "CORRECT", ReplicaId: 2}} {
+		next, err := instance.recvMsg(signed(&Message_Checkpoint{Checkpoint: chkpt}), chkpt.ReplicaId)
+		if err != nil {
+			t.Fatalf("Failed to receive checkpoint: %s", err)
+		}
+		events.SendEvent(instance, next)
+	}
+	if len(reported) != 0 || len(instance.signatures) != 0 {
+		t.Errorf("Expected no signatures nor evidence without security, got %d signatures and evidence %v", len(instance.signatures), reported)
+	}
+}
+
+func TestEvidenceRetention(t *testing.T) {
+	defer enableSecurity()()
+	stored := make(map[string][]byte)
+	var reported []*pb.ConsensusEvidence
+	config := loadConfig()
+	config.Set("general.evidence.retention", 2)
+	instance := newPbftCore(1, config, newEvidenceMock(stored, &reported), &inertTimerFactory{})
+	defer instance.close()
+
+	checkpoint := func(replica uint64, id string) *Message {
+		return signed(&Message_Checkpoint{Checkpoint: &Checkpoint{SequenceNumber: 10, Id: id, ReplicaId: replica}})
+	}
+	for _, id := range []string{"A", "B", "C"} {
+		instance.storeSignature(checkpoint(3, id))
+	}
+	forged := checkpoint(2, "A")
+	forged.Signature = []byte("forged")
+	instance.storeSignature(forged)
+	instance.storeSignature(checkpoint(7, "A"))
+
+	if sigs := instance.signatures[signedKey{0, 10, 3}]; len(sigs) != maxSignedDigests {
+		t.Errorf("Expected signatures of replica 3 for %d digests, got %d", maxSignedDigests, len(sigs))
+	}
+	if len(instance.signatures) != 1 {
+		t.Errorf("Expected no signatures of non-members nor invalid ones, got %v", instance.signatures)
+	}
+
+	instance.recordEvidence(3, evidenceCheckpoint, 0, 10, "test", nil)
+	if len(instance.evidence) != 1 || stored["evidence.3.checkpoint.0.10"] == nil {
+		t.Fatalf("Expected the evidence to be recorded")
+	}
+	instance.recordEvidence(3, evidenceCheckpoint, 0, instance.h+instance.L+1, "test", nil)
+	if len(instance.evidence) != 1 {
+		t.Errorf("Expected no evidence beyond the watermarks to be recorded")
+	}
+
+	// only the signatures are dropped with the watermarks
+	instance.moveWatermarks(10)
+	if len(instance.signatures) != 0 {
+		t.Errorf("Expected the signatures to be dropped with the watermarks, got %d", len(instance.signatures))
+	}
+	if len(instance.evidence) != 1 || stored["evidence.3.checkpoint.0.10"] == nil {
+		t.Errorf("Expected the evidence to be kept once the watermarks move past it")
+	}
+
+	// the oldest evidence is dropped beyond the retention, evidence is ordered by time
+	time.Sleep(time.Millisecond)
+	instance.recordEvidence(2, evidenceCheckpoint, 0, 20, "test", nil)
+	time.Sleep(time.Millisecond)
+	instance.recordEvidence(0, evidenceEquivocation, 1, 30, "test", nil)
+	if len(instance.evidence) != 2 {
+		t.Errorf("Expected 2 evidence records to be kept, got %d", len(instance.evidence))
+	}
+	if _, ok := stored["evidence.3.checkpoint.0.10"]; ok {
+		t.Errorf("Expected the oldest persisted evidence to be deleted")
+	}
+	if stored["evidence.2.checkpoint.0.20"] == nil || stored["evidence.0.equivocation.1.30"] == nil {
+		t.Errorf("Expected the most recent evidence to stay persisted")
+	}
+
+	// a replica restarted with a lower retention drops the oldest persisted evidence
+	config.Set("general.evidence.retention", 1)
+	restarted := newPbftCore(1, config, &omniProto{
+		ReadStateImpl: func(key string) ([]byte, error) { return nil, fmt.Errorf("not found") },
+		ReadStateSetImpl: func(prefix string) (map[string][]byte, error) {
+			set := make(map[string][]byte)
+			for key, value := range stored {
+				if strings.HasPrefix(key, prefix) {
+					set[key] = value
+				}
+			}
+			return set, nil
+		},
+		DelStateImpl: func(key string) { delete(stored, key) },
+	}, &inertTimerFactory{})
+	defer restarted.close()
+	if collected := restarted.collectedEvidence(); len(collected) != 1 || collected[0].ReplicaId != 0 {
+		t.Errorf("Expected only the most recent evidence to be restored, got %v", collected)
+	}
+	if _, ok := stored["evidence.2.checkpoint.0.20"]; ok {
+		t.Errorf("Expected the evidence beyond the retention to be deleted on restart")
+	}
+
+	if key, err := parseEvidenceKey("evidence.3.checkpoint.0.10"); err != nil || key != (evidenceKey{3, evidenceCheckpoint, 0, 10}) {
+		t.Errorf("Expected the persistence key to parse back, got %v, %v", key, err)
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package pbft
 
 import (
+	"fmt"
+
 	"github.com/hyperledger/fabric/consensus/util/events"
 	pb "github.com/hyperledger/fabric/protos"
 )
@@ -50,6 +52,21 @@ type committedEvent struct {
 // rolledBackEvent is sent when a requested rollback completes
 type rolledBackEvent struct{}
 
+// reconfigureEvent is sent when a new membership is requested
+type reconfigureEvent struct {
+	membership *Membership
+}
+
+// statusEvent is sent when a snapshot of the replica state is requested
+type statusEvent struct {
+	status chan *pb.ConsensusStatus
+}
+
+// evidenceEvent is sent when the evidence of misbehaving replicas is requested
+type evidenceEvent struct {
+	evidence chan []*pb.ConsensusEvidence
+}
+
 type externalEventReceiver struct {
 	manager events.Manager
 }
@@ -85,3 +102,35 @@ func (eer *externalEventReceiver) StateUpdated(tag interface{}, target *pb.Block
 		target: target,
 	}
 }
+
+// Status returns a snapshot of the replica state, it is taken on the event thread
+// so that it is consistent, and returns once the events queued before are processed
+func (eer *externalEventReceiver) Status() *pb.ConsensusStatus {
+	status := make(chan *pb.ConsensusStatus, 1)
+	eer.manager.Queue() <- statusEvent{status}
+	return <-status
+}
+
+// Evidence returns the evidence of misbehavior this replica has collected against others
+func (eer *externalEventReceiver) Evidence() []*pb.ConsensusEvidence {
+	evidence := make(chan []*pb.ConsensusEvidence, 1)
+	eer.manager.Queue() <- evidenceEvent{evidence}
+	return <-evidence
+}
+
+// Reconfigure requests that the network switch to a new set of replicas tolerating f byzantine faults,
+// the new membership takes effect at a checkpoint once a quorum of replicas has requested it
+func (eer *externalEventReceiver) Reconfigure(replicas []uint64, f int) error {
+	if f < 0 {
+		return fmt.Errorf("cannot tolerate a negative number of faults (%d)", f)
+	}
+	membership := &Membership{
+		Replicas: replicas,
+		F:        uint32(f),
+	}
+	if err := validateMembership(membership); err != nil {
+		return err
+	}
+	eer.manager.Queue() <- reconfigureEvent{membership}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+// fairQueue holds the requests the primary has yet to batch, one queue per
+// submitter. Batches are cut round-robin across submitters, so a client which
+// floods the primary delays its own requests rather than everyone else's.
+type fairQueue struct {
+	queues     map[string][]*Request
+	submitters []string // submitters with queued requests, the next to be served first
+	size       int
+}
+
+func newFairQueue() *fairQueue {
+	return &fairQueue{queues: make(map[string][]*Request)}
+}
+
+// Len returns the number of queued requests
+func (fq *fairQueue) Len() int {
+	return fq.size
+}
+
+// push queues a request behind the others of its submitter
+func (fq *fairQueue) push(req *Request) {
+	submitter := requestSubmitter(req)
+	queue, ok := fq.queues[submitter]
+	if !ok {
+		fq.submitters = append(fq.submitters, submitter)
+	}
+	fq.queues[submitter] = append(queue, req)
+	fq.size++
+}
+
+// pop removes up to n requests, taking one from each submitter in turn
+func (fq *fairQueue) pop(n int) (result []*Request) {
+	for len(result) < n && len(fq.submitters) > 0 {
+		submitter := fq.submitters[0]
+		fq.submitters = fq.submitters[1:]
+		queue := fq.queues[submitter]
+		result = append(result, queue[0])
+		fq.size--
+		if len(queue) > 1 {
+			fq.queues[submitter] = queue[1:]
+			fq.submitters = append(fq.submitters, submitter)
+		} else {
+			delete(fq.queues, submitter)
+		}
+	}
+	return result
+}
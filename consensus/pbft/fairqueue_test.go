@@ -0,0 +1,54 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import "testing"
+
+func TestFairQueue(t *testing.T) {
+	fq := newFairQueue()
+
+	// Requests from replica 0 come first, but the other submitters are served in turn
+	reqs := []*Request{
+		createPbftReq(1, 0),
+		createPbftReq(2, 0),
+		createPbftReq(3, 0),
+		createPbftReq(4, 1),
+		createPbftReq(5, 2),
+		createPbftReq(6, 1),
+	}
+	for _, req := range reqs {
+		fq.push(req)
+	}
+	if fq.Len() != len(reqs) {
+		t.Fatalf("Expected %d queued requests, got %d", len(reqs), fq.Len())
+	}
+
+	expected := []*Request{reqs[0], reqs[3], reqs[4], reqs[1], reqs[5], reqs[2]}
+	batch := fq.pop(4)
+	batch = append(batch, fq.pop(4)...)
+	if len(batch) != len(expected) {
+		t.Fatalf("Expected %d requests, got %d", len(expected), len(batch))
+	}
+	for i := range expected {
+		if batch[i] != expected[i] {
+			t.Errorf("Expected request %d to be %v, got %v", i, expected[i], batch[i])
+		}
+	}
+	if fq.Len() != 0 || len(fq.pop(1)) != 0 {
+		t.Errorf("Expected the queue to be empty")
+	}
+}
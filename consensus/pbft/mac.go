@@ -0,0 +1,110 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// authenticatedSender returns the replica claiming to have sent a pre-prepare, prepare,
+// commit or checkpoint, the messages which carry an authenticator
+func authenticatedSender(msg *Message) (uint64, bool) {
+	switch payload := msg.Payload.(type) {
+	case *Message_PrePrepare:
+		return payload.PrePrepare.ReplicaId, true
+	case *Message_Prepare:
+		return payload.Prepare.ReplicaId, true
+	case *Message_Commit:
+		return payload.Commit.ReplicaId, true
+	case *Message_Checkpoint:
+		return payload.Checkpoint.ReplicaId, true
+	}
+	return 0, false
+}
+
+// authenticatedContent is what the MACs of a message are computed over
+func authenticatedContent(msg *Message) ([]byte, error) {
+	return proto.Marshal(&Message{Payload: msg.Payload})
+}
+
+func computeMAC(key []byte, content []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(content)
+	return mac.Sum(nil)
+}
+
+// sessionKey returns the key shared with a replica, it is derived by the stack once and cached
+func (instance *pbftCore) sessionKey(id uint64) ([]byte, error) {
+	if key, ok := instance.sessionKeys[id]; ok {
+		return key, nil
+	}
+	key, err := instance.consumer.sessionKey(id)
+	if err != nil {
+		return nil, err
+	}
+	instance.sessionKeys[id] = key
+	return key, nil
+}
+
+// authenticate attaches an authenticator to a normal-case message: a MAC for every
+// other replica, so each of them can check who sent it, however it was relayed
+func (instance *pbftCore) authenticate(msg *Message) error {
+	if _, ok := authenticatedSender(msg); !ok {
+		return nil
+	}
+	content, err := authenticatedContent(msg)
+	if err != nil {
+		return err
+	}
+	msg.Authenticator = make(map[uint64][]byte)
+	for _, id := range instance.replicas {
+		if id == instance.id {
+			continue
+		}
+		key, err := instance.sessionKey(id)
+		if err != nil {
+			logger.Warningf("Replica %d has no session key for replica %d: %s", instance.id, id, err)
+			continue
+		}
+		msg.Authenticator[id] = computeMAC(key, content)
+	}
+	return nil
+}
+
+// verifyAuthenticator checks this replica's entry of the authenticator against the claimed sender
+func (instance *pbftCore) verifyAuthenticator(msg *Message, senderID uint64) error {
+	mac, ok := msg.Authenticator[instance.id]
+	if !ok {
+		return fmt.Errorf("Message from replica %d carries no MAC for replica %d", senderID, instance.id)
+	}
+	key, err := instance.sessionKey(senderID)
+	if err != nil {
+		return fmt.Errorf("No session key for replica %d: %s", senderID, err)
+	}
+	content, err := authenticatedContent(msg)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, computeMAC(key, content)) {
+		return fmt.Errorf("Invalid MAC on message from replica %d", senderID)
+	}
+	return nil
+}
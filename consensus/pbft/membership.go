@@ -0,0 +1,237 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"fmt"
+	"sort"
+)
+
+// =============================================================================
+// dynamic membership
+// =============================================================================
+
+// A reconfiguration is an ordinary request carrying a membership instead
+// of a transaction payload, so every replica executes it at the same
+// sequence number.  A single replica cannot change the membership: each
+// executed request only records the vote of the replica which submitted
+// it, and the membership is scheduled at the sequence number n where a
+// quorum of the current members has requested the same one.  The votes
+// are recorded with every block, so replicas catching up through state
+// transfer count them alike.  The new membership takes effect at the checkpoint
+// a = roundUp(n, K) + L: replicas which have not yet executed n have a low
+// watermark of at most n, and so cannot have accepted a pre-prepare beyond
+// a under the old membership.  No pre-prepare beyond a is sent or accepted
+// until the new membership is active, and the primary of the new membership
+// waits for checkpoint a to become stable before resuming.  Lest a quiet
+// network never reach a, the primary fills the sequence numbers up to it,
+// and up to the next checkpoint which joining replicas transfer state to,
+// with null requests once it has no request batch left to order.
+
+// validateMembership checks that a membership can tolerate its f byzantine faults
+func validateMembership(m *Membership) error {
+	if m == nil {
+		return fmt.Errorf("no membership supplied")
+	}
+	if len(m.Replicas) < 3*int(m.F)+1 {
+		return fmt.Errorf("need at least %d replicas to tolerate %d byzantine faults, but only %d replicas given", 3*m.F+1, m.F, len(m.Replicas))
+	}
+	seen := make(map[uint64]bool)
+	for _, id := range m.Replicas {
+		if seen[id] {
+			return fmt.Errorf("replica %d is listed more than once", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// isMember reports whether a replica is part of the current membership
+func (instance *pbftCore) isMember(id uint64) bool {
+	for _, r := range instance.replicas {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
+
+// membership returns the replica set currently in effect
+func (instance *pbftCore) membership() *Membership {
+	return &Membership{
+		Replicas:       instance.replicas,
+		F:              uint32(instance.f),
+		SequenceNumber: instance.membershipSeqNo,
+	}
+}
+
+// setMembership installs a replica set and recomputes N and f
+func (instance *pbftCore) setMembership(m *Membership) {
+	replicas := make([]uint64, len(m.Replicas))
+	copy(replicas, m.Replicas)
+	sort.Sort(sortableUint64Slice(replicas))
+
+	instance.replicas = replicas
+	instance.N = len(replicas)
+	instance.f = int(m.F)
+	instance.replicaCount = instance.N
+	instance.membershipSeqNo = m.SequenceNumber
+	instance.consumer.membershipChanged(instance.replicas, instance.f)
+
+	logger.Infof("Replica %d using membership %v (N=%d, f=%d) from seqNo %d",
+		instance.id, instance.replicas, instance.N, instance.f, instance.membershipSeqNo)
+}
+
+// sameMembership reports whether two requested memberships have the same replicas and f
+func sameMembership(a, b *Membership) bool {
+	if a.F != b.F || len(a.Replicas) != len(b.Replicas) {
+		return false
+	}
+	for i := range a.Replicas {
+		if a.Replicas[i] != b.Replicas[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reconfigurationVoteList returns the recorded votes ordered by replica,
+// as they are stored with each block
+func (instance *pbftCore) reconfigurationVoteList() []*ReconfigurationVote {
+	var votes []*ReconfigurationVote
+	for _, id := range instance.replicas {
+		if m, ok := instance.reconfigurationVotes[id]; ok {
+			votes = append(votes, &ReconfigurationVote{ReplicaId: id, Membership: m})
+		}
+	}
+	return votes
+}
+
+// reconfigure records the vote of requester for a new membership, and
+// schedules it once a quorum voted for it; it is invoked on the PBFT
+// thread when a reconfiguration request is executed at seqNo, and must
+// therefore decide deterministically
+func (instance *pbftCore) reconfigure(seqNo uint64, m *Membership, requester uint64) {
+	if !instance.isMember(requester) {
+		logger.Warningf("Replica %d ignoring reconfiguration at seqNo %d from replica %d, which is not a member", instance.id, seqNo, requester)
+		return
+	}
+	if instance.pendingMembership != nil {
+		logger.Warningf("Replica %d ignoring reconfiguration at seqNo %d, another one is pending for seqNo %d", instance.id, seqNo, instance.pendingMembership.SequenceNumber)
+		return
+	}
+	if m.SequenceNumber != instance.membershipSeqNo {
+		// A request of an older membership, possibly replayed, must not count
+		logger.Warningf("Replica %d ignoring reconfiguration at seqNo %d from replica %d, requested for the membership of seqNo %d, not %d",
+			instance.id, seqNo, requester, m.SequenceNumber, instance.membershipSeqNo)
+		return
+	}
+	if err := validateMembership(m); err != nil {
+		logger.Warningf("Replica %d ignoring invalid reconfiguration at seqNo %d: %s", instance.id, seqNo, err)
+		return
+	}
+
+	replicas := make([]uint64, len(m.Replicas))
+	copy(replicas, m.Replicas)
+	sort.Sort(sortableUint64Slice(replicas))
+	requested := &Membership{Replicas: replicas, F: m.F}
+	instance.reconfigurationVotes[requester] = requested // a newer request replaces the previous vote of the replica
+
+	votes := 0
+	for id, vote := range instance.reconfigurationVotes {
+		if instance.isMember(id) && sameMembership(vote, requested) {
+			votes++
+		}
+	}
+	if votes < instance.intersectionQuorum() {
+		logger.Infof("Replica %d recorded the request of replica %d for membership %v (f=%d) at seqNo %d, %d of %d requests",
+			instance.id, requester, replicas, m.F, seqNo, votes, instance.intersectionQuorum())
+		return
+	}
+
+	activation := (seqNo+instance.K-1)/instance.K*instance.K + instance.L
+	instance.pendingMembership = &Membership{
+		Replicas:       replicas,
+		F:              m.F,
+		SequenceNumber: activation,
+	}
+	instance.reconfigurationVotes = make(map[uint64]*Membership)
+	logger.Infof("Replica %d scheduled membership %v (f=%d) to take effect at seqNo %d", instance.id, replicas, m.F, activation)
+}
+
+// activatePendingMembership switches to the pending membership once its
+// checkpoint has been executed
+func (instance *pbftCore) activatePendingMembership() {
+	pending := instance.pendingMembership
+	if pending == nil || instance.lastExec < pending.SequenceNumber {
+		return
+	}
+
+	instance.pendingMembership = nil
+	instance.setMembership(pending)
+	if instance.seqNo < pending.SequenceNumber {
+		instance.seqNo = pending.SequenceNumber
+	}
+	if !instance.isMember(instance.id) {
+		logger.Warningf("Replica %d is not a member of the new membership", instance.id)
+	}
+}
+
+// advanceMembershipCheckpoint has the primary issue null requests up to the
+// checkpoint where the pending membership takes effect, and then up to the
+// next one, to which the replicas joining with the new membership transfer
+// state.  It does nothing while request batches wait to be executed, as they
+// drive the sequence number there
+func (instance *pbftCore) advanceMembershipCheckpoint() {
+	if !instance.activeView || instance.primary(instance.view) != instance.id || len(instance.outstandingReqBatches) > 0 {
+		return
+	}
+	target := instance.membershipSeqNo + instance.K
+	if pending := instance.pendingMembership; pending != nil {
+		target = pending.SequenceNumber
+	} else if instance.membershipSeqNo == 0 {
+		return // the initial membership
+	}
+	for instance.seqNo < target {
+		seqNo := instance.seqNo
+		logger.Debugf("Primary %d sending null request for seqNo=%d to reach membership checkpoint %d", instance.id, seqNo+1, target)
+		instance.sendPrePrepare(nil, "")
+		if instance.seqNo == seqNo {
+			// out of sequence numbers, resumed once the watermarks move
+			return
+		}
+	}
+}
+
+// restoreMembership reads the current and pending membership, and the
+// votes for a new one, recorded with the last executed request
+func (instance *pbftCore) restoreMembership() {
+	current, pending, votes, err := instance.consumer.getLastMembership()
+	if err != nil {
+		logger.Debugf("Replica %d could not restore membership, keeping %v: %s", instance.id, instance.replicas, err)
+		return
+	}
+	if current != nil {
+		instance.setMembership(current)
+	}
+	instance.pendingMembership = pending
+	instance.reconfigurationVotes = make(map[uint64]*Membership)
+	for _, vote := range votes {
+		instance.reconfigurationVotes[vote.ReplicaId] = vote.Membership
+	}
+	instance.activatePendingMembership()
+}
@@ -6,9 +6,11 @@
 Package pbft is a generated protocol buffer package.
 
 It is generated from these files:
+
 	messages.proto
 
 It has these top-level messages:
+
 	Message
 	Request
 	PrePrepare
@@ -23,6 +25,8 @@ It has these top-level messages:
 	RequestBatch
 	BatchMessage
 	Metadata
+	Membership
+	ReconfigurationVote
 */
 package pbft
 
@@ -48,15 +52,19 @@ type Message struct {
 	//	*Message_FetchRequestBatch
 	//	*Message_ReturnRequestBatch
 	Payload isMessage_Payload `protobuf_oneof:"payload"`
+	// MACs of pre-prepare, prepare, commit and checkpoint payloads, by receiving replica,
+	// each keyed with the session key the sender shares with that replica
+	Authenticator map[uint64][]byte `protobuf:"bytes,10,rep,name=authenticator" json:"authenticator,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Signature of the sender over the payload of pre-prepares and checkpoints,
+	// which makes them usable as evidence against the sender
+	Signature []byte `protobuf:"bytes,11,opt,name=signature,proto3" json:"signature,omitempty"`
 }
 
 func (m *Message) Reset()         { *m = Message{} }
 func (m *Message) String() string { return proto.CompactTextString(m) }
 func (*Message) ProtoMessage()    {}
 
-type isMessage_Payload interface {
-	isMessage_Payload()
-}
+type isMessage_Payload interface{ isMessage_Payload() }
 
 type Message_RequestBatch struct {
 	RequestBatch *RequestBatch `protobuf:"bytes,1,opt,name=request_batch,oneof"`
@@ -166,6 +174,13 @@ func (m *Message) GetReturnRequestBatch() *RequestBatch {
 	return nil
 }
 
+func (m *Message) GetAuthenticator() map[uint64][]byte {
+	if m != nil {
+		return m.Authenticator
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
@@ -318,10 +333,11 @@ func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer
 }
 
 type Request struct {
-	Timestamp *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=timestamp" json:"timestamp,omitempty"`
-	Payload   []byte                     `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
-	ReplicaId uint64                     `protobuf:"varint,3,opt,name=replica_id" json:"replica_id,omitempty"`
-	Signature []byte                     `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	Timestamp       *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=timestamp" json:"timestamp,omitempty"`
+	Payload         []byte                     `protobuf:"bytes,2,opt,name=payload,proto3" json:"payload,omitempty"`
+	ReplicaId       uint64                     `protobuf:"varint,3,opt,name=replica_id" json:"replica_id,omitempty"`
+	Signature       []byte                     `protobuf:"bytes,4,opt,name=signature,proto3" json:"signature,omitempty"`
+	Reconfiguration *Membership                `protobuf:"bytes,5,opt,name=reconfiguration" json:"reconfiguration,omitempty"`
 }
 
 func (m *Request) Reset()         { *m = Request{} }
@@ -335,6 +351,13 @@ func (m *Request) GetTimestamp() *google_protobuf.Timestamp {
 	return nil
 }
 
+func (m *Request) GetReconfiguration() *Membership {
+	if m != nil {
+		return m.Reconfiguration
+	}
+	return nil
+}
+
 type PrePrepare struct {
 	View           uint64        `protobuf:"varint,1,opt,name=view" json:"view,omitempty"`
 	SequenceNumber uint64        `protobuf:"varint,2,opt,name=sequence_number" json:"sequence_number,omitempty"`
@@ -527,9 +550,7 @@ func (m *BatchMessage) Reset()         { *m = BatchMessage{} }
 func (m *BatchMessage) String() string { return proto.CompactTextString(m) }
 func (*BatchMessage) ProtoMessage()    {}
 
-type isBatchMessage_Payload interface {
-	isBatchMessage_Payload()
-}
+type isBatchMessage_Payload interface{ isBatchMessage_Payload() }
 
 type BatchMessage_Request struct {
 	Request *Request `protobuf:"bytes,1,opt,name=request,oneof"`
@@ -663,9 +684,59 @@ func _BatchMessage_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.B
 }
 
 type Metadata struct {
-	SeqNo uint64 `protobuf:"varint,1,opt,name=seqNo" json:"seqNo,omitempty"`
+	SeqNo                uint64                 `protobuf:"varint,1,opt,name=seqNo" json:"seqNo,omitempty"`
+	Membership           *Membership            `protobuf:"bytes,2,opt,name=membership" json:"membership,omitempty"`
+	PendingMembership    *Membership            `protobuf:"bytes,3,opt,name=pending_membership" json:"pending_membership,omitempty"`
+	ReconfigurationVotes []*ReconfigurationVote `protobuf:"bytes,4,rep,name=reconfiguration_votes" json:"reconfiguration_votes,omitempty"`
 }
 
 func (m *Metadata) Reset()         { *m = Metadata{} }
 func (m *Metadata) String() string { return proto.CompactTextString(m) }
 func (*Metadata) ProtoMessage()    {}
+
+func (m *Metadata) GetMembership() *Membership {
+	if m != nil {
+		return m.Membership
+	}
+	return nil
+}
+
+func (m *Metadata) GetPendingMembership() *Membership {
+	if m != nil {
+		return m.PendingMembership
+	}
+	return nil
+}
+
+func (m *Metadata) GetReconfigurationVotes() []*ReconfigurationVote {
+	if m != nil {
+		return m.ReconfigurationVotes
+	}
+	return nil
+}
+
+type Membership struct {
+	Replicas       []uint64 `protobuf:"varint,1,rep,name=replicas" json:"replicas,omitempty"`
+	F              uint32   `protobuf:"varint,2,opt,name=f" json:"f,omitempty"`
+	SequenceNumber uint64   `protobuf:"varint,3,opt,name=sequence_number" json:"sequence_number,omitempty"`
+}
+
+func (m *Membership) Reset()         { *m = Membership{} }
+func (m *Membership) String() string { return proto.CompactTextString(m) }
+func (*Membership) ProtoMessage()    {}
+
+type ReconfigurationVote struct {
+	ReplicaId  uint64      `protobuf:"varint,1,opt,name=replica_id" json:"replica_id,omitempty"`
+	Membership *Membership `protobuf:"bytes,2,opt,name=membership" json:"membership,omitempty"`
+}
+
+func (m *ReconfigurationVote) Reset()         { *m = ReconfigurationVote{} }
+func (m *ReconfigurationVote) String() string { return proto.CompactTextString(m) }
+func (*ReconfigurationVote) ProtoMessage()    {}
+
+func (m *ReconfigurationVote) GetMembership() *Membership {
+	if m != nil {
+		return m.Membership
+	}
+	return nil
+}
@@ -81,6 +81,10 @@ func (cs *completeStack) InvalidateState() {}
 func (cs *completeStack) Start()           {}
 func (cs *completeStack) Halt()            {}
 
+func (cs *completeStack) RejectTransaction(tx *pb.Transaction, reason string) {}
+
+func (cs *completeStack) ReportEvidence(evidence *pb.ConsensusEvidence) {}
+
 func (cs *completeStack) UpdateState(tag interface{}, target *pb.BlockchainInfo, peers []*pb.PeerID) {
 	select {
 	// This guarantees the first SkipTo call is the one that's queued, whereas a mutex can be raced for
@@ -17,7 +17,13 @@ limitations under the License.
 package pbft
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"time"
 
@@ -54,6 +60,18 @@ func (ns *noopSecurity) Verify(peerID *pb.PeerID, signature []byte, message []by
 	return nil
 }
 
+func (ns *noopSecurity) SessionKey(peerID *pb.PeerID) ([]byte, error) {
+	return nil, nil
+}
+
+// testSessionKey is the key two test replicas share, the same in both directions
+func testSessionKey(a, b uint64) []byte {
+	if a > b {
+		a, b = b, a
+	}
+	return []byte(fmt.Sprintf("session key %d-%d", a, b))
+}
+
 type mockPersist struct {
 	store map[string][]byte
 }
@@ -113,6 +131,26 @@ func createTx(tag int64) (tx *pb.Transaction) {
 	return
 }
 
+// createCert creates a self-signed certificate with the given common name,
+// the enrollment ID of an ECert or utils.TCertSubjectCommonName for a TCert
+func createCert(commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("Error generating key: %s", err))
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(crand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("Error creating certificate: %s", err))
+	}
+	return cert
+}
+
 func marshalTx(tx *pb.Transaction) (txPacked []byte) {
 	txPacked, _ = proto.Marshal(tx)
 	return
@@ -166,6 +204,7 @@ type omniProto struct {
 	UnicastImpl                func(msg *pb.Message, receiverHandle *pb.PeerID) error
 	SignImpl                   func(msg []byte) ([]byte, error)
 	VerifyImpl                 func(peerID *pb.PeerID, signature []byte, message []byte) error
+	SessionKeyImpl             func(peerID *pb.PeerID) ([]byte, error)
 	GetBlockImpl               func(id uint64) (block *pb.Block, err error)
 	GetCurrentStateHashImpl    func() (stateHash []byte, err error)
 	GetBlockchainSizeImpl      func() uint64
@@ -197,19 +236,25 @@ type omniProto struct {
 	DelStateImpl               func(key string)
 	ValidateStateImpl          func()
 	InvalidateStateImpl        func()
+	RejectTransactionImpl      func(tx *pb.Transaction, reason string)
+	ReportEvidenceImpl         func(evidence *pb.ConsensusEvidence)
 
 	// Inner Stack methods
-	broadcastImpl       func(msgPayload []byte)
-	unicastImpl         func(msgPayload []byte, receiverID uint64) (err error)
-	executeImpl         func(seqNo uint64, reqBatch *RequestBatch)
-	getStateImpl        func() []byte
-	skipToImpl          func(seqNo uint64, snapshotID []byte, peers []uint64)
-	viewChangeImpl      func(curView uint64)
-	signImpl            func(msg []byte) ([]byte, error)
-	verifyImpl          func(senderID uint64, signature []byte, message []byte) error
-	getLastSeqNoImpl    func() (uint64, error)
-	validateStateImpl   func()
-	invalidateStateImpl func()
+	broadcastImpl         func(msgPayload []byte)
+	unicastImpl           func(msgPayload []byte, receiverID uint64) (err error)
+	executeImpl           func(seqNo uint64, reqBatch *RequestBatch)
+	getStateImpl          func() []byte
+	skipToImpl            func(seqNo uint64, snapshotID []byte, peers []uint64)
+	viewChangeImpl        func(curView uint64)
+	signImpl              func(msg []byte) ([]byte, error)
+	verifyImpl            func(senderID uint64, signature []byte, message []byte) error
+	sessionKeyImpl        func(replicaID uint64) ([]byte, error)
+	reportEvidenceImpl    func(evidence *pb.ConsensusEvidence)
+	getLastSeqNoImpl      func() (uint64, error)
+	getLastMembershipImpl func() (*Membership, *Membership, []*ReconfigurationVote, error)
+	membershipChangedImpl func(replicas []uint64, f int)
+	validateStateImpl     func()
+	invalidateStateImpl   func()
 
 	// Closable Consenter methods
 	RecvMsgImpl func(ocMsg *pb.Message, senderHandle *pb.PeerID) error
@@ -263,6 +308,13 @@ func (op *omniProto) Verify(peerID *pb.PeerID, signature []byte, message []byte)
 
 	panic("Unimplemented")
 }
+func (op *omniProto) SessionKey(peerID *pb.PeerID) ([]byte, error) {
+	if nil != op.SessionKeyImpl {
+		return op.SessionKeyImpl(peerID)
+	}
+
+	panic("Unimplemented")
+}
 func (op *omniProto) GetBlock(id uint64) (block *pb.Block, err error) {
 	if nil != op.GetBlockImpl {
 		return op.GetBlockImpl(id)
@@ -465,6 +517,23 @@ func (op *omniProto) verify(senderID uint64, signature []byte, message []byte) e
 	panic("Unimplemented")
 }
 
+func (op *omniProto) sessionKey(replicaID uint64) ([]byte, error) {
+	if nil != op.sessionKeyImpl {
+		return op.sessionKeyImpl(replicaID)
+	}
+
+	panic("Unimplemented")
+}
+
+func (op *omniProto) reportEvidence(evidence *pb.ConsensusEvidence) {
+	if nil != op.reportEvidenceImpl {
+		op.reportEvidenceImpl(evidence)
+		return
+	}
+
+	panic("Unimplemented")
+}
+
 func (op *omniProto) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
 	if nil != op.RecvMsgImpl {
 		return op.RecvMsgImpl(ocMsg, senderHandle)
@@ -481,6 +550,20 @@ func (op *omniProto) getLastSeqNo() (uint64, error) {
 	return 0, fmt.Errorf("getLastSeqNo is not implemented")
 }
 
+func (op *omniProto) getLastMembership() (*Membership, *Membership, []*ReconfigurationVote, error) {
+	if op.getLastMembershipImpl != nil {
+		return op.getLastMembershipImpl()
+	}
+
+	return nil, nil, nil, fmt.Errorf("getLastMembership is not implemented")
+}
+
+func (op *omniProto) membershipChanged(replicas []uint64, f int) {
+	if op.membershipChangedImpl != nil {
+		op.membershipChangedImpl(replicas, f)
+	}
+}
+
 func (op *omniProto) Close() {
 	if nil != op.CloseImpl {
 		op.CloseImpl()
@@ -567,6 +650,22 @@ func (op *omniProto) InvalidateState() {
 	panic("unimplemented")
 }
 
+func (op *omniProto) RejectTransaction(tx *pb.Transaction, reason string) {
+	if nil != op.RejectTransactionImpl {
+		op.RejectTransactionImpl(tx, reason)
+		return
+	}
+	panic("unimplemented")
+}
+
+func (op *omniProto) ReportEvidence(evidence *pb.ConsensusEvidence) {
+	if nil != op.ReportEvidenceImpl {
+		op.ReportEvidenceImpl(evidence)
+		return
+	}
+	panic("unimplemented")
+}
+
 func (op *omniProto) validateState() {
 	if nil != op.validateStateImpl {
 		op.validateStateImpl()
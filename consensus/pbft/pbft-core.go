@@ -27,6 +27,7 @@ import (
 	"github.com/hyperledger/fabric/consensus"
 	"github.com/hyperledger/fabric/consensus/util/events"
 	_ "github.com/hyperledger/fabric/core" // Needed for logging format init
+	pb "github.com/hyperledger/fabric/protos"
 	"github.com/op/go-logging"
 
 	"github.com/golang/protobuf/proto"
@@ -86,10 +87,14 @@ type innerStack interface {
 	execute(seqNo uint64, reqBatch *RequestBatch) // This is invoked on a separate thread
 	getState() []byte
 	getLastSeqNo() (uint64, error)
+	getLastMembership() (current *Membership, pending *Membership, votes []*ReconfigurationVote, err error)
+	membershipChanged(replicas []uint64, f int)
 	skipTo(seqNo uint64, snapshotID []byte, peers []uint64)
 
 	sign(msg []byte) ([]byte, error)
 	verify(senderID uint64, signature []byte, message []byte) error
+	sessionKey(replicaID uint64) ([]byte, error)
+	reportEvidence(evidence *pb.ConsensusEvidence)
 
 	invalidateState()
 	validateState()
@@ -135,12 +140,26 @@ type pbftCore struct {
 	L             uint64            // log size
 	lastExec      uint64            // last request we executed
 	replicaCount  int               // number of replicas; PBFT `|R|`
+	replicas      []uint64          // sorted IDs of the replicas in the current membership
 	seqNo         uint64            // PBFT "n", strictly monotonic increasing sequence number
 	view          uint64            // current view
 	chkpts        map[uint64]string // state checkpoints; map lastExec to global hash
 	pset          map[uint64]*ViewChange_PQ
 	qset          map[qidx]*ViewChange_PQ
 
+	membershipSeqNo   uint64      // checkpoint at which the current membership took effect
+	pendingMembership *Membership // scheduled reconfiguration, takes effect at its sequence number
+
+	reconfigurationVotes map[uint64]*Membership // membership requested by each replica, until a quorum requests the same one
+
+	macs        bool              // whether normal-case messages carry an authenticator
+	sessionKeys map[uint64][]byte // keys shared with the other replicas, for the authenticators
+
+	collectEvidence   bool                                  // whether pre-prepares and checkpoints are signed, which requires security
+	signatures        map[signedKey]map[string][]byte       // signatures of the pre-prepares and checkpoints within the watermarks, by digest
+	evidence          map[evidenceKey]*pb.ConsensusEvidence // evidence of misbehaving replicas, kept for operators
+	evidenceRetention int                                   // how many evidence records are kept, 0 keeps them all
+
 	skipInProgress    bool               // Set when we have detected a fall behind scenario until we pick a new starting point
 	stateTransferring bool               // Set when state transfer is executing
 	highStateTarget   *stateUpdateTarget // Set to the highest weak checkpoint cert we have observed
@@ -238,6 +257,10 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 	instance.viewChangePeriod = uint64(config.GetInt("general.viewchangeperiod"))
 
 	instance.byzantine = config.GetBool("general.byzantine")
+	instance.macs = config.GetBool("general.macs")
+	// without security, signatures are the signed message itself and prove nothing
+	instance.collectEvidence = viper.GetBool("security.enabled")
+	instance.evidenceRetention = config.GetInt("general.evidence.retention")
 
 	instance.requestTimeout, err = time.ParseDuration(config.GetString("general.timeout.request"))
 	if err != nil {
@@ -258,11 +281,16 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 
 	instance.activeView = true
 	instance.replicaCount = instance.N
+	instance.replicas = make([]uint64, instance.N)
+	for i := range instance.replicas {
+		instance.replicas[i] = uint64(i)
+	}
 
 	logger.Infof("PBFT type = %T", instance.consumer)
 	logger.Infof("PBFT Max number of validating peers (N) = %v", instance.N)
 	logger.Infof("PBFT Max number of failing peers (f) = %v", instance.f)
 	logger.Infof("PBFT byzantine flag = %v", instance.byzantine)
+	logger.Infof("PBFT message authenticators = %v", instance.macs)
 	logger.Infof("PBFT request timeout = %v", instance.requestTimeout)
 	logger.Infof("PBFT view change timeout = %v", instance.newViewTimeout)
 	logger.Infof("PBFT Checkpoint period (K) = %v", instance.K)
@@ -283,6 +311,10 @@ func newPbftCore(id uint64, config *viper.Viper, consumer innerStack, etf events
 	instance.certStore = make(map[msgID]*msgCert)
 	instance.reqBatchStore = make(map[string]*RequestBatch)
 	instance.checkpointStore = make(map[Checkpoint]bool)
+	instance.sessionKeys = make(map[uint64][]byte)
+	instance.signatures = make(map[signedKey]map[string][]byte)
+	instance.evidence = make(map[evidenceKey]*pb.ConsensusEvidence)
+	instance.reconfigurationVotes = make(map[uint64]*Membership)
 	instance.chkpts = make(map[uint64]string)
 	instance.viewChangeStore = make(map[vcidx]*ViewChange)
 	instance.pset = make(map[uint64]*ViewChange_PQ)
@@ -326,6 +358,10 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 	case pbftMessageEvent:
 		msg := et
 		logger.Debugf("Replica %d received incoming message from %v", instance.id, msg.sender)
+		if !instance.isMember(msg.sender) {
+			logger.Warningf("Replica %d ignoring message from replica %d, which is not a member", instance.id, msg.sender)
+			return nil
+		}
 		next, err := instance.recvMsg(msg.msg, msg.sender)
 		if err != nil {
 			break
@@ -372,6 +408,7 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 		logger.Infof("Replica %d application caught up via state transfer, lastExec now %d", instance.id, update.seqNo)
 		// XXX create checkpoint
 		instance.lastExec = update.seqNo
+		instance.restoreMembership()
 		instance.moveWatermarks(instance.lastExec) // The watermark movement handles moving this to a checkpoint boundary
 		instance.skipInProgress = false
 		instance.consumer.validateState()
@@ -387,6 +424,10 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 		instance.nullRequestHandler()
 	case workEvent:
 		et() // Used to allow the caller to steal use of the main thread, to be removed
+	case statusEvent:
+		et.status <- instance.status()
+	case evidenceEvent:
+		et.evidence <- instance.collectedEvidence()
 	case viewChangeQuorumEvent:
 		logger.Debugf("Replica %d received view change quorum, processing new view", instance.id)
 		if instance.primary(instance.view) == instance.id {
@@ -420,7 +461,7 @@ func (instance *pbftCore) ProcessEvent(e events.Event) events.Event {
 
 // Given a certain view n, what is the expected primary?
 func (instance *pbftCore) primary(n uint64) uint64 {
-	return n % uint64(instance.replicaCount)
+	return instance.replicas[n%uint64(instance.replicaCount)]
 }
 
 // Is the sequence number between watermarks?
@@ -558,6 +599,16 @@ func (instance *pbftCore) nullRequestHandler() {
 }
 
 func (instance *pbftCore) recvMsg(msg *Message, senderID uint64) (interface{}, error) {
+	if claimedID, ok := authenticatedSender(msg); ok && instance.macs {
+		if !instance.isMember(claimedID) {
+			return nil, fmt.Errorf("Message claims to be from replica %d, which is not a member", claimedID)
+		}
+		if err := instance.verifyAuthenticator(msg, claimedID); err != nil {
+			return nil, err
+		}
+		senderID = claimedID // authenticated, regardless of which replica relayed it
+	}
+	instance.storeSignature(msg)
 	if reqBatch := msg.GetRequestBatch(); reqBatch != nil {
 		return reqBatch, nil
 	} else if preprep := msg.GetPrePrepare(); preprep != nil {
@@ -634,13 +685,8 @@ func (instance *pbftCore) sendPrePrepare(reqBatch *RequestBatch, digest string)
 		}
 	}
 
-	if !instance.inWV(instance.view, n) || n > instance.h+instance.L/2 {
-		logger.Debugf("Replica %d is primary, not sending pre-prepare for request batch %s because it is out of sequence numbers", instance.id, digest)
-		return
-	}
-
-	if n > instance.viewChangeSeqNo {
-		logger.Info("Primary %d about to switch to next primary, not sending pre-prepare with seqno=%d", instance.id, n)
+	if reason := instance.seqNoUnavailable(n); reason != "" {
+		logger.Debugf("Primary %d not sending pre-prepare for request batch %s with seqNo=%d: %s", instance.id, digest, n, reason)
 		return
 	}
 
@@ -691,6 +737,24 @@ outer:
 	}
 }
 
+// seqNoUnavailable returns why the primary may not assign sequence number n
+// to a request batch yet, or the empty string if it may
+func (instance *pbftCore) seqNoUnavailable(n uint64) string {
+	if !instance.inWV(instance.view, n) || n > instance.h+instance.L/2 {
+		return "out of sequence numbers"
+	}
+	if n > instance.viewChangeSeqNo {
+		return "about to switch to the next primary"
+	}
+	if p := instance.pendingMembership; p != nil && n > p.SequenceNumber {
+		return fmt.Sprintf("about to switch membership at seqNo=%d", p.SequenceNumber)
+	}
+	if instance.h < instance.membershipSeqNo {
+		return fmt.Sprintf("waiting for checkpoint %d of the new membership", instance.membershipSeqNo)
+	}
+	return ""
+}
+
 func (instance *pbftCore) recvPrePrepare(preprep *PrePrepare) error {
 	logger.Debugf("Replica %d received pre-prepare from replica %d for view=%d/seqNo=%d",
 		instance.id, preprep.ReplicaId, preprep.View, preprep.SequenceNumber)
@@ -722,9 +786,17 @@ func (instance *pbftCore) recvPrePrepare(preprep *PrePrepare) error {
 		return nil
 	}
 
+	if p := instance.pendingMembership; p != nil && preprep.SequenceNumber > p.SequenceNumber {
+		logger.Warningf("Replica %d received pre-prepare for %d, beyond the membership switch at %d", instance.id, preprep.SequenceNumber, p.SequenceNumber)
+		return nil
+	}
+
 	cert := instance.getCert(preprep.View, preprep.SequenceNumber)
 	if cert.digest != "" && cert.digest != preprep.BatchDigest {
 		logger.Warningf("Pre-prepare found for same view/seqNo but different digest: received %s, stored %s", preprep.BatchDigest, cert.digest)
+		if cert.prePrepare != nil && cert.prePrepare.ReplicaId == preprep.ReplicaId {
+			instance.recordEquivocation(cert.prePrepare, preprep)
+		}
 		instance.sendViewChange()
 		return nil
 	}
@@ -798,7 +870,6 @@ func (instance *pbftCore) recvPrepare(prep *Prepare) error {
 	return instance.maybeSendCommit(prep.BatchDigest, prep.View, prep.SequenceNumber)
 }
 
-//
 func (instance *pbftCore) maybeSendCommit(digest string, v uint64, n uint64) error {
 	cert := instance.getCert(v, n)
 	if instance.prepared(digest, v, n) && !cert.sentCommit {
@@ -812,7 +883,7 @@ func (instance *pbftCore) maybeSendCommit(digest string, v uint64, n uint64) err
 		}
 		cert.sentCommit = true
 		instance.recvCommit(commit)
-		return instance.innerBroadcast(&Message{&Message_Commit{commit}})
+		return instance.innerBroadcast(&Message{Payload: &Message_Commit{Commit: commit}})
 	}
 	return nil
 }
@@ -941,7 +1012,9 @@ func (instance *pbftCore) executeOne(idx msgID) bool {
 		return false
 	}
 
-	// we have a commit certificate for this request batch
+	// we have a commit certificate for this request batch; batches execute
+	// one at a time, the ledger holds the uncommitted state of a single batch
+	// and cannot execute the next one before this one is committed
 	currentExec := idx.n
 	instance.currentExec = &currentExec
 
@@ -978,14 +1051,19 @@ func (instance *pbftCore) Checkpoint(seqNo uint64, id []byte) {
 	instance.chkpts[seqNo] = idAsString
 
 	instance.persistCheckpoint(seqNo, id)
+	msg := &Message{Payload: &Message_Checkpoint{Checkpoint: chkpt}}
+	if err := instance.signEvidence(msg); err != nil {
+		logger.Warningf("Replica %d could not sign checkpoint %d: %s", instance.id, seqNo, err)
+	}
 	instance.recvCheckpoint(chkpt)
-	instance.innerBroadcast(&Message{Payload: &Message_Checkpoint{Checkpoint: chkpt}})
+	instance.innerBroadcast(msg)
 }
 
 func (instance *pbftCore) execDoneSync() {
 	if instance.currentExec != nil {
 		logger.Infof("Replica %d finished execution %d, trying next", instance.id, *instance.currentExec)
 		instance.lastExec = *instance.currentExec
+		instance.activatePendingMembership()
 		if instance.lastExec%instance.K == 0 {
 			instance.Checkpoint(instance.lastExec, instance.consumer.getState())
 		}
@@ -998,6 +1076,7 @@ func (instance *pbftCore) execDoneSync() {
 	instance.currentExec = nil
 
 	instance.executeOutstanding()
+	instance.advanceMembershipCheckpoint()
 }
 
 func (instance *pbftCore) moveWatermarks(n uint64) {
@@ -1022,6 +1101,12 @@ func (instance *pbftCore) moveWatermarks(n uint64) {
 		}
 	}
 
+	for key := range instance.signatures {
+		if key.n <= h {
+			delete(instance.signatures, key)
+		}
+	}
+
 	for n := range instance.pset {
 		if n <= h {
 			delete(instance.pset, n)
@@ -1047,6 +1132,7 @@ func (instance *pbftCore) moveWatermarks(n uint64) {
 		instance.id, instance.h)
 
 	instance.resubmitRequestBatches()
+	instance.advanceMembershipCheckpoint()
 }
 
 func (instance *pbftCore) weakCheckpointSetOutOfRange(chkpt *Checkpoint) bool {
@@ -1152,6 +1238,7 @@ func (instance *pbftCore) recvCheckpoint(chkpt *Checkpoint) events.Event {
 	}
 
 	instance.checkpointStore[*chkpt] = true
+	instance.recordConflictingCheckpoints(chkpt.SequenceNumber)
 
 	matching := 0
 	for testChkpt := range instance.checkpointStore {
@@ -1261,6 +1348,14 @@ func (instance *pbftCore) recvReturnRequestBatch(reqBatch *RequestBatch) events.
 // Marshals a Message and hands it to the Stack. If toSelf is true,
 // the message is also dispatched to the local instance's RecvMsgSync.
 func (instance *pbftCore) innerBroadcast(msg *Message) error {
+	if err := instance.signEvidence(msg); err != nil {
+		return fmt.Errorf("Cannot sign message %s", err)
+	}
+	if instance.macs {
+		if err := instance.authenticate(msg); err != nil {
+			return fmt.Errorf("Cannot authenticate message %s", err)
+		}
+	}
 	msgRaw, err := proto.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("Cannot marshal message %s", err)
@@ -1279,11 +1374,11 @@ func (instance *pbftCore) innerBroadcast(msg *Message) error {
 	if doByzantine {
 		rand2 := rand.New(rand.NewSource(time.Now().UnixNano()))
 		ignoreidx := rand2.Intn(instance.N)
-		for i := 0; i < instance.N; i++ {
-			if i != ignoreidx && uint64(i) != instance.id { //Pick a random replica and do not send message
-				instance.consumer.unicast(msgRaw, uint64(i))
+		for i, id := range instance.replicas {
+			if i != ignoreidx && id != instance.id { //Pick a random replica and do not send message
+				instance.consumer.unicast(msgRaw, id)
 			} else {
-				logger.Debugf("PBFT byzantine: not broadcasting to replica %v", i)
+				logger.Debugf("PBFT byzantine: not broadcasting to replica %v", id)
 			}
 		}
 	} else {
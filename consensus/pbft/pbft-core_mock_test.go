@@ -106,9 +106,15 @@ func (sc *simpleConsumer) verify(senderID uint64, signature []byte, message []by
 	return nil
 }
 
+func (sc *simpleConsumer) sessionKey(replicaID uint64) ([]byte, error) {
+	return testSessionKey(sc.pe.id, replicaID), nil
+}
+
 func (sc *simpleConsumer) viewChange(curView uint64) {
 }
 
+func (sc *simpleConsumer) reportEvidence(evidence *pb.ConsensusEvidence) {}
+
 func (sc *simpleConsumer) invalidateState() {}
 func (sc *simpleConsumer) validateState()   {}
 
@@ -148,6 +154,12 @@ func (sc *simpleConsumer) getLastSeqNo() (uint64, error) {
 	return sc.lastSeqNo, nil
 }
 
+func (sc *simpleConsumer) getLastMembership() (*Membership, *Membership, []*ReconfigurationVote, error) {
+	return nil, nil, nil, fmt.Errorf("no membership recorded")
+}
+
+func (sc *simpleConsumer) membershipChanged(replicas []uint64, f int) {}
+
 func makePBFTNetwork(N int, config *viper.Viper) *pbftNetwork {
 	if config == nil {
 		config = loadConfig()
@@ -28,6 +28,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/op/go-logging"
+	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/consensus/util/events"
 )
@@ -112,6 +113,92 @@ func TestWrongReplicaID(t *testing.T) {
 	}
 }
 
+func TestRelayedAuthenticatedMessage(t *testing.T) {
+	config := loadConfig()
+	config.Set("general.macs", true)
+	newInstance := func(id uint64) *pbftCore {
+		mock := &omniProto{
+			sessionKeyImpl: func(replicaID uint64) ([]byte, error) {
+				return testSessionKey(id, replicaID), nil
+			},
+		}
+		return newPbftCore(id, config, mock, &inertTimerFactory{})
+	}
+	sender := newInstance(1)
+	defer sender.close()
+	receiver := newInstance(0)
+	defer receiver.close()
+
+	newPrepare := func() *Message {
+		msg := &Message{Payload: &Message_Prepare{Prepare: &Prepare{
+			View:           0,
+			SequenceNumber: 1,
+			BatchDigest:    "foo",
+			ReplicaId:      1,
+		}}}
+		if err := sender.authenticate(msg); err != nil {
+			t.Fatalf("Failed to authenticate message: %s", err)
+		}
+		return msg
+	}
+
+	// Replica 2 relays the prepare of replica 1
+	if next, err := receiver.recvMsg(newPrepare(), 2); err != nil || next == nil {
+		t.Fatalf("Expected relayed prepare with a valid authenticator to be accepted: %v", err)
+	}
+
+	forged := newPrepare()
+	forged.GetPrepare().BatchDigest = "bar"
+	if _, err := receiver.recvMsg(forged, 2); err == nil {
+		t.Fatalf("Expected prepare altered after authentication to be rejected")
+	}
+
+	unauthenticated := newPrepare()
+	unauthenticated.Authenticator = nil
+	if _, err := receiver.recvMsg(unauthenticated, 1); err == nil {
+		t.Fatalf("Expected prepare without authenticator to be rejected")
+	}
+}
+
+func TestMACsRequireSecurity(t *testing.T) {
+	macs, security := config.GetBool("general.macs"), viper.GetBool("security.enabled")
+	defer func() {
+		config.Set("general.macs", macs)
+		viper.Set("security.enabled", security)
+	}()
+	config.Set("general.macs", true)
+	viper.Set("security.enabled", false)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected authenticators to be refused without security")
+		}
+	}()
+	New(nil)
+}
+
+func TestNetworkWithMACs(t *testing.T) {
+	validatorCount := 4
+	config := loadConfig()
+	config.Set("general.macs", true)
+	net := makePBFTNetwork(validatorCount, config)
+	defer net.stop()
+
+	reqBatch := createPbftReqBatch(1, uint64(generateBroadcaster(validatorCount)))
+	net.pbftEndpoints[0].manager.Queue() <- reqBatch
+
+	err := net.process()
+	if err != nil {
+		t.Fatalf("Processing failed: %s", err)
+	}
+
+	for _, pep := range net.pbftEndpoints {
+		if pep.sc.executions != 1 {
+			t.Errorf("Instance %d executed %d requests instead of one", pep.id, pep.sc.executions)
+		}
+	}
+}
+
 func TestIncompletePayload(t *testing.T) {
 	mock := &omniProto{}
 	instance := newPbftCore(1, loadConfig(), mock, &inertTimerFactory{})
@@ -704,6 +791,7 @@ func TestSendQueueThrottling(t *testing.T) {
 		broadcastImpl: func(p []byte) {
 			prePreparesSent++
 		},
+		signImpl: func(msg []byte) ([]byte, error) { return msg, nil },
 	}
 	defer instance.close()
 
@@ -20,6 +20,8 @@ import (
 	"encoding/base64"
 	"fmt"
 
+	pb "github.com/hyperledger/fabric/protos"
+
 	"github.com/golang/protobuf/proto"
 )
 
@@ -100,6 +102,19 @@ func (instance *pbftCore) persistDelCheckpoint(seqNo uint64) {
 	instance.consumer.DelState(key)
 }
 
+func (instance *pbftCore) persistEvidence(key evidenceKey, evidence *pb.ConsensusEvidence) {
+	raw, err := proto.Marshal(evidence)
+	if err != nil {
+		logger.Warningf("Replica %d could not persist evidence %s: %s", instance.id, key, err)
+		return
+	}
+	instance.consumer.StoreState(key.String(), raw)
+}
+
+func (instance *pbftCore) persistDelEvidence(key evidenceKey) {
+	instance.consumer.DelState(key.String())
+}
+
 func (instance *pbftCore) restoreState() {
 	updateSeqView := func(set []*ViewChange_PQ) {
 		for _, e := range set {
@@ -160,10 +175,27 @@ func (instance *pbftCore) restoreState() {
 		logger.Warningf("Replica %d could not restore checkpoints: %s", instance.id, err)
 	}
 
+	evidence, err := instance.consumer.ReadStateSet("evidence.")
+	if err == nil {
+		for k, v := range evidence {
+			key, err := parseEvidenceKey(k)
+			e := &pb.ConsensusEvidence{}
+			if err != nil || proto.Unmarshal(v, e) != nil {
+				logger.Warningf("Replica %d could not restore evidence %s", instance.id, k)
+			} else {
+				instance.evidence[key] = e
+			}
+		}
+		instance.pruneEvidence()
+	} else {
+		logger.Warningf("Replica %d could not restore evidence: %s", instance.id, err)
+	}
+
 	instance.restoreLastSeqNo()
+	instance.restoreMembership()
 
-	logger.Infof("Replica %d restored state: view: %d, seqNo: %d, pset: %d, qset: %d, reqBatches: %d, chkpts: %d",
-		instance.id, instance.view, instance.seqNo, len(instance.pset), len(instance.qset), len(instance.reqBatchStore), len(instance.chkpts))
+	logger.Infof("Replica %d restored state: view: %d, seqNo: %d, pset: %d, qset: %d, reqBatches: %d, chkpts: %d, evidence: %d",
+		instance.id, instance.view, instance.seqNo, len(instance.pset), len(instance.qset), len(instance.reqBatchStore), len(instance.chkpts), len(instance.evidence))
 }
 
 func (instance *pbftCore) restoreLastSeqNo() {
@@ -18,8 +18,6 @@ package pbft
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -30,13 +28,14 @@ import (
 	"github.com/spf13/viper"
 )
 
-const configPrefix = "CORE_PBFT"
+const pluginName = "pbft"
 
 var pluginInstance consensus.Consenter // singleton service
 var config *viper.Viper
 
 func init() {
 	config = loadConfig()
+	consensus.RegisterPlugin(pluginName, GetPlugin)
 }
 
 // GetPlugin returns the handle to the Consenter singleton
@@ -50,6 +49,11 @@ func GetPlugin(c consensus.Stack) consensus.Consenter {
 // New creates a new Obc* instance that provides the Consenter interface.
 // Internally, it uses an opaque pbft-core instance.
 func New(stack consensus.Stack) consensus.Consenter {
+	if config.GetBool("general.macs") && !viper.GetBool("security.enabled") {
+		// Without security validators share no session keys to compute the MACs with
+		panic(fmt.Errorf("PBFT message authenticators (general.macs) require security to be enabled"))
+	}
+
 	handle, _, _ := stack.GetNetworkHandles()
 	id, _ := getValidatorID(handle)
 
@@ -62,28 +66,9 @@ func New(stack consensus.Stack) consensus.Consenter {
 }
 
 func loadConfig() (config *viper.Viper) {
-	config = viper.New()
-
-	// for environment variables
-	config.SetEnvPrefix(configPrefix)
-	config.AutomaticEnv()
-	replacer := strings.NewReplacer(".", "_")
-	config.SetEnvKeyReplacer(replacer)
-
-	config.SetConfigName("config")
-	config.AddConfigPath("./")
-	config.AddConfigPath("../consensus/pbft/")
-	config.AddConfigPath("../../consensus/pbft")
-	// Path to look for the config file in based on GOPATH
-	gopath := os.Getenv("GOPATH")
-	for _, p := range filepath.SplitList(gopath) {
-		pbftpath := filepath.Join(p, "src/github.com/hyperledger/fabric/consensus/pbft")
-		config.AddConfigPath(pbftpath)
-	}
-
-	err := config.ReadInConfig()
+	config, err := consensus.LoadPluginConfig(pluginName)
 	if err != nil {
-		panic(fmt.Errorf("Error reading %s plugin config: %s", configPrefix, err))
+		panic(err)
 	}
 	return
 }
@@ -136,6 +121,10 @@ func (op *obcGeneric) skipTo(seqNo uint64, id []byte, replicas []uint64) {
 	op.stack.UpdateState(&checkpointMessage{seqNo, id}, info, getValidatorHandles(replicas))
 }
 
+func (op *obcGeneric) reportEvidence(evidence *pb.ConsensusEvidence) {
+	op.stack.ReportEvidence(evidence)
+}
+
 func (op *obcGeneric) invalidateState() {
 	op.stack.InvalidateState()
 }
@@ -157,3 +146,15 @@ func (op *obcGeneric) getLastSeqNo() (uint64, error) {
 	proto.Unmarshal(raw, meta)
 	return meta.SeqNo, nil
 }
+
+func (op *obcGeneric) getLastMembership() (*Membership, *Membership, []*ReconfigurationVote, error) {
+	raw, err := op.stack.GetBlockHeadMetadata()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	meta := &Metadata{}
+	if err = proto.Unmarshal(raw, meta); err != nil {
+		return nil, nil, nil, err
+	}
+	return meta.Membership, meta.PendingMembership, meta.ReconfigurationVotes, nil
+}
@@ -16,16 +16,49 @@ limitations under the License.
 
 package pbft
 
-import "container/list"
+import (
+	"container/list"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/crypto/utils"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// requestSubmitter identifies the client which submitted a request by the
+// enrollment ID of the enrollment certificate its transaction carries.
+// Transaction certificates are unlinkable to their owner, so requests signed
+// with one, like requests without a certificate (submitted while security is
+// disabled, or reconfiguration requests), are attributed to the replica which
+// received them.
+func requestSubmitter(req *Request) string {
+	if enrollmentID := requestEnrollmentID(req); enrollmentID != "" {
+		return "enrollment " + enrollmentID
+	}
+	return fmt.Sprintf("replica %d", req.ReplicaId)
+}
+
+// requestEnrollmentID returns the enrollment ID of the enrollment certificate
+// the transaction of a request carries, or an empty string
+func requestEnrollmentID(req *Request) string {
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(req.Payload, tx); err != nil {
+		return ""
+	}
+	return utils.GetEnrollmentIDFromCert(tx.Cert)
+}
 
 type requestContainer struct {
-	key string
-	req *Request
+	key       string
+	submitter string
+	req       *Request
 }
 
 type orderedRequests struct {
-	order    list.List
-	presence map[string]*list.Element
+	order      list.List
+	presence   map[string]*list.Element
+	submitters map[string]int // number of requests from each submitter
 }
 
 func (a *orderedRequests) Len() int {
@@ -47,8 +80,10 @@ func (a *orderedRequests) has(key string) bool {
 func (a *orderedRequests) add(request *Request) {
 	rc := a.wrapRequest(request)
 	if !a.has(rc.key) {
+		rc.submitter = requestSubmitter(request)
 		e := a.order.PushBack(rc)
 		a.presence[rc.key] = e
+		a.submitters[rc.submitter]++
 	}
 }
 
@@ -66,6 +101,10 @@ func (a *orderedRequests) remove(request *Request) bool {
 	}
 	a.order.Remove(e)
 	delete(a.presence, rc.key)
+	submitter := e.Value.(requestContainer).submitter
+	if a.submitters[submitter]--; a.submitters[submitter] == 0 {
+		delete(a.submitters, submitter)
+	}
 	return true
 }
 
@@ -83,6 +122,7 @@ func (a *orderedRequests) removes(requests []*Request) bool {
 func (a *orderedRequests) empty() {
 	a.order.Init()
 	a.presence = make(map[string]*list.Element)
+	a.submitters = make(map[string]int)
 }
 
 type requestStore struct {
@@ -125,6 +165,11 @@ func (rs *requestStore) remove(request *Request) (outstanding, pending bool) {
 	return
 }
 
+// outstandingFrom returns how many outstanding requests a submitter has
+func (rs *requestStore) outstandingFrom(submitter string) int {
+	return rs.outstandingRequests.submitters[submitter]
+}
+
 // getNextNonPending returns up to the next n outstanding, but not pending requests
 func (rs *requestStore) hasNonPending() bool {
 	return rs.outstandingRequests.Len() > rs.pendingRequests.Len()
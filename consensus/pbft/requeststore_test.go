@@ -16,7 +16,11 @@ limitations under the License.
 
 package pbft
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/crypto/utils"
+)
 
 func TestOrderedRequests(t *testing.T) {
 	or := &orderedRequests{}
@@ -52,6 +56,37 @@ func TestOrderedRequests(t *testing.T) {
 	if or.order.Back().Value.(requestContainer).req != r3 {
 		t.Errorf("incorrect order")
 	}
+	if or.submitters[requestSubmitter(r1)] != 2 || or.submitters[requestSubmitter(r2)] != 1 {
+		t.Errorf("incorrect requests per submitter %v", or.submitters)
+	}
+	or.removes([]*Request{r1, r2})
+	if _, ok := or.submitters[requestSubmitter(r2)]; ok {
+		t.Errorf("should have forgotten the submitter")
+	}
+}
+
+func TestRequestSubmitter(t *testing.T) {
+	request := func(replica uint64, cert []byte) *Request {
+		tx := createTx(1)
+		tx.Cert = cert
+		return &Request{Timestamp: tx.Timestamp, Payload: marshalTx(tx), ReplicaId: replica}
+	}
+
+	if a, b := requestSubmitter(request(1, createCert("alice"))), requestSubmitter(request(2, createCert("alice"))); a != b {
+		t.Errorf("Expected the ECerts of one enrollment ID to share a submitter, got %s and %s", a, b)
+	}
+	if a, b := requestSubmitter(request(1, createCert("alice"))), requestSubmitter(request(1, createCert("bob"))); a == b {
+		t.Errorf("Expected distinct enrollment IDs to be distinct submitters, got %s", a)
+	}
+	if a, b := requestSubmitter(request(1, createCert(utils.TCertSubjectCommonName))), requestSubmitter(request(1, createCert(utils.TCertSubjectCommonName))); a != b {
+		t.Errorf("Expected the TCerts received by one replica to share a submitter, got %s and %s", a, b)
+	}
+	if a, b := requestSubmitter(request(1, createCert(utils.TCertSubjectCommonName))), requestSubmitter(request(2, createCert(utils.TCertSubjectCommonName))); a == b {
+		t.Errorf("Expected the TCerts received by distinct replicas to be distinct submitters, got %s", a)
+	}
+	if a, b := requestSubmitter(request(1, nil)), requestSubmitter(request(1, []byte("not a certificate"))); a != b {
+		t.Errorf("Expected requests without a valid certificate to be attributed to the replica, got %s and %s", a, b)
+	}
 }
 
 func BenchmarkOrderedRequests(b *testing.B) {
@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/simulator"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func init() {
+	simulator.RegisterBehavior("equivocate", equivocate)
+}
+
+// equivocate makes a primary send conflicting pre-prepares, the replicas with
+// an odd id receive a batch whose requests carry different timestamps
+func equivocate(src, dst uint64, msg *pb.Message) []*pb.Message {
+	unchanged := []*pb.Message{msg}
+	if dst%2 == 0 || msg.Type != pb.Message_CONSENSUS {
+		return unchanged
+	}
+	batchMsg := &BatchMessage{}
+	if err := proto.Unmarshal(msg.Payload, batchMsg); err != nil || batchMsg.GetPbftMessage() == nil {
+		return unchanged
+	}
+	pbftMsg := &Message{}
+	if err := proto.Unmarshal(batchMsg.GetPbftMessage(), pbftMsg); err != nil {
+		return unchanged
+	}
+	preprep := pbftMsg.GetPrePrepare()
+	if preprep == nil || preprep.RequestBatch == nil {
+		return unchanged
+	}
+
+	forged := proto.Clone(preprep).(*PrePrepare)
+	for _, req := range forged.RequestBatch.Batch {
+		req.Timestamp.Nanos++
+	}
+	forged.BatchDigest = hash(forged.RequestBatch)
+	forgedPayload, _ := proto.Marshal(&Message{Payload: &Message_PrePrepare{PrePrepare: forged}})
+	forgedBatchMsg, _ := proto.Marshal(&BatchMessage{Payload: &BatchMessage_PbftMessage{PbftMessage: forgedPayload}})
+	return []*pb.Message{{Type: pb.Message_CONSENSUS, Payload: forgedBatchMsg}}
+}
+
+// simulatedBatch creates the obcBatch replicas of a scenario
+func simulatedBatch(scenario *simulator.Scenario) simulator.Factory {
+	return func(id uint64, stack consensus.Stack, manager events.Manager, timers events.TimerFactory) consensus.Consenter {
+		config := loadConfig()
+		config.Set("general.N", scenario.Replicas)
+		config.Set("general.f", (scenario.Replicas-1)/3)
+		for key, value := range scenario.Config {
+			config.Set(key, value)
+		}
+		return newObcBatchWithEvents(id, config, stack, manager, timers, true)
+	}
+}
+
+func TestSimulatedScenarios(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping simulated scenarios")
+	}
+
+	paths, err := filepath.Glob("testdata/*.yaml")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("Could not find any scenarios: %v", err)
+	}
+	for _, path := range paths {
+		scenario, err := simulator.LoadScenario(path)
+		if err != nil {
+			t.Fatalf("Could not load scenario: %s", err)
+		}
+		if err = scenario.Run(simulatedBatch(scenario)); err != nil {
+			t.Errorf("Scenario %s failed: %s", path, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"sort"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// status takes a snapshot of the replica state, it must be called on the PBFT thread
+func (instance *pbftCore) status() *pb.ConsensusStatus {
+	status := &pb.ConsensusStatus{
+		Plugin:         "pbft",
+		ReplicaId:      instance.id,
+		Replicas:       append([]uint64(nil), instance.replicas...),
+		F:              uint32(instance.f),
+		View:           instance.view,
+		Primary:        instance.primary(instance.view),
+		ViewChange:     !instance.activeView,
+		StateTransfer:  instance.skipInProgress,
+		SequenceNumber: instance.seqNo,
+		LastExecuted:   instance.lastExec,
+		LowWatermark:   instance.h,
+		HighWatermark:  instance.h + instance.L,
+	}
+
+	for digest := range instance.outstandingReqBatches {
+		status.OutstandingRequestBatches = append(status.OutstandingRequestBatches, digest)
+	}
+	sort.Strings(status.OutstandingRequestBatches)
+
+	// Group the checkpoints we received by the state they vouch for
+	type certKey struct {
+		n  uint64
+		id string
+	}
+	certs := make(map[certKey]*pb.ConsensusStatus_Checkpoint)
+	for chkpt := range instance.checkpointStore {
+		key := certKey{chkpt.SequenceNumber, chkpt.Id}
+		cert, ok := certs[key]
+		if !ok {
+			cert = &pb.ConsensusStatus_Checkpoint{SequenceNumber: chkpt.SequenceNumber, Id: chkpt.Id}
+			certs[key] = cert
+			status.Checkpoints = append(status.Checkpoints, cert)
+		}
+		cert.Replicas = append(cert.Replicas, chkpt.ReplicaId)
+	}
+	for _, cert := range status.Checkpoints {
+		sort.Sort(sortableUint64Slice(cert.Replicas))
+	}
+	sort.Sort(checkpointCerts(status.Checkpoints))
+
+	return status
+}
+
+type checkpointCerts []*pb.ConsensusStatus_Checkpoint
+
+func (a checkpointCerts) Len() int {
+	return len(a)
+}
+
+func (a checkpointCerts) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a checkpointCerts) Less(i, j int) bool {
+	if a[i].SequenceNumber != a[j].SequenceNumber {
+		return a[i].SequenceNumber < a[j].SequenceNumber
+	}
+	return a[i].Id < a[j].Id
+}
@@ -0,0 +1,59 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pbft
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	b := newObcBatch(1, loadConfig(), &omniProto{})
+	defer b.Close()
+
+	b.manager.Queue() <- workEvent(func() {
+		b.pbft.view = 2
+		b.pbft.activeView = false
+		b.pbft.seqNo = 12
+		b.pbft.lastExec = 11
+		b.pbft.h = 10
+		b.pbft.outstandingReqBatches["b"] = &RequestBatch{}
+		b.pbft.outstandingReqBatches["a"] = &RequestBatch{}
+		for _, replica := range []uint64{2, 0, 1} {
+			b.pbft.checkpointStore[Checkpoint{SequenceNumber: 20, ReplicaId: replica, Id: "x"}] = true
+		}
+		b.pbft.checkpointStore[Checkpoint{SequenceNumber: 20, ReplicaId: 3, Id: "y"}] = true
+		b.pbft.checkpointStore[Checkpoint{SequenceNumber: 10, ReplicaId: 3, Id: "w"}] = true
+	})
+	status := b.Status()
+
+	if status.ReplicaId != 1 || status.View != 2 || status.Primary != 2 || !status.ViewChange {
+		t.Errorf("Expected replica 1 to be changing to view 2 with primary 2, got %v", status)
+	}
+	if status.SequenceNumber != 12 || status.LastExecuted != 11 || status.LowWatermark != 10 || status.HighWatermark != 10+b.pbft.L {
+		t.Errorf("Unexpected sequence numbers %v", status)
+	}
+	if !reflect.DeepEqual(status.OutstandingRequestBatches, []string{"a", "b"}) {
+		t.Errorf("Expected outstanding request batches a and b, got %v", status.OutstandingRequestBatches)
+	}
+	if len(status.Checkpoints) != 3 {
+		t.Fatalf("Expected 3 checkpoint certificates, got %v", status.Checkpoints)
+	}
+	if cert := status.Checkpoints[1]; cert.SequenceNumber != 20 || cert.Id != "x" || !reflect.DeepEqual(cert.Replicas, []uint64{0, 1, 2}) {
+		t.Errorf("Expected replicas 0, 1 and 2 to vouch for state x at 20, got %v", cert)
+	}
+}
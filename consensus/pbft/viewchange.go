@@ -512,6 +512,7 @@ func (instance *pbftCore) processNewView2(nv *NewView) events.Event {
 	} else {
 		logger.Debugf("Replica %d is now primary, attempting to resubmit requests", instance.id)
 		instance.resubmitRequestBatches()
+		instance.advanceMembershipCheckpoint()
 	}
 
 	instance.startTimerIfOutstandingRequests()
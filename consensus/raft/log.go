@@ -0,0 +1,230 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/consensus"
+
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	entryKeyPrefix = "raft.entry."
+	snapshotKey    = "raft.snapshot"
+	hardStateKey   = "raft.state"
+)
+
+// raftLog holds the log entries which have not been compacted yet, every
+// change is persisted before the log is used to answer other replicas
+type raftLog struct {
+	persistor consensus.StatePersistor
+
+	entries       []*Entry       // entries following the snapshot, entries[i].Index == snapshotIndex+1+i
+	snapshotIndex uint64         // index of the last entry compacted away
+	snapshotTerm  uint64         // term of the last entry compacted away
+	txs           map[string]int // number of entries holding each transaction
+}
+
+func newRaftLog(persistor consensus.StatePersistor) *raftLog {
+	l := &raftLog{persistor: persistor, txs: make(map[string]int)}
+	l.restore()
+	return l
+}
+
+func entryKey(index uint64) string {
+	return fmt.Sprintf("%s%d", entryKeyPrefix, index)
+}
+
+// restore reads the compaction point and the entries following it back from the persistor
+func (l *raftLog) restore() {
+	if raw, err := l.persistor.ReadState(snapshotKey); err == nil {
+		snapshot := &Metadata{}
+		if err = proto.Unmarshal(raw, snapshot); err != nil {
+			logger.Errorf("Could not unmarshal the log compaction point, local state is damaged: %s", err)
+		} else {
+			l.snapshotIndex = snapshot.Index
+			l.snapshotTerm = snapshot.Term
+		}
+	}
+
+	raw, err := l.persistor.ReadStateSet(entryKeyPrefix)
+	if err != nil {
+		logger.Debugf("No log entries to restore: %s", err)
+		return
+	}
+	var entries []*Entry
+	for key, value := range raw {
+		entry := &Entry{}
+		if err = proto.Unmarshal(value, entry); err != nil {
+			logger.Errorf("Could not unmarshal log entry %s, local state is damaged: %s", key, err)
+			continue
+		}
+		if entry.Index <= l.snapshotIndex {
+			l.persistor.DelState(key) // compacted, but not deleted before a crash
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Sort(entrySlice(entries))
+
+	// Only keep the contiguous prefix, anything after a gap was never acknowledged
+	for i, entry := range entries {
+		if entry.Index != l.snapshotIndex+1+uint64(i) {
+			logger.Warningf("Discarding log entries from index %d, as index %d is missing", entry.Index, l.snapshotIndex+1+uint64(i))
+			entries = entries[:i]
+			break
+		}
+	}
+	l.entries = entries
+	for _, entry := range l.entries {
+		l.addTxs(entry)
+	}
+	logger.Infof("Restored %d log entries following index %d", len(l.entries), l.snapshotIndex)
+}
+
+type entrySlice []*Entry
+
+func (s entrySlice) Len() int           { return len(s) }
+func (s entrySlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s entrySlice) Less(i, j int) bool { return s[i].Index < s[j].Index }
+
+func (l *raftLog) firstIndex() uint64 {
+	return l.snapshotIndex + 1
+}
+
+func (l *raftLog) lastIndex() uint64 {
+	return l.snapshotIndex + uint64(len(l.entries))
+}
+
+func (l *raftLog) lastTerm() uint64 {
+	term, _ := l.term(l.lastIndex())
+	return term
+}
+
+// term returns the term of the entry at index, if it is known
+func (l *raftLog) term(index uint64) (uint64, bool) {
+	if index == l.snapshotIndex {
+		return l.snapshotTerm, true
+	}
+	if entry := l.entry(index); entry != nil {
+		return entry.Term, true
+	}
+	return 0, false
+}
+
+// entry returns the entry at index, or nil if it was compacted or does not exist yet
+func (l *raftLog) entry(index uint64) *Entry {
+	if index < l.firstIndex() || index > l.lastIndex() {
+		return nil
+	}
+	return l.entries[index-l.firstIndex()]
+}
+
+// slice returns at most max entries starting at index from
+func (l *raftLog) slice(from uint64, max int) []*Entry {
+	if from < l.firstIndex() || from > l.lastIndex() {
+		return nil
+	}
+	entries := l.entries[from-l.firstIndex():]
+	if len(entries) > max {
+		entries = entries[:max]
+	}
+	return entries
+}
+
+// append adds an entry to the end of the log
+func (l *raftLog) append(entry *Entry) {
+	if entry.Index != l.lastIndex()+1 {
+		panic(fmt.Sprintf("appending entry %d to a log ending at %d", entry.Index, l.lastIndex()))
+	}
+	raw, err := proto.Marshal(entry)
+	if err != nil {
+		panic(fmt.Sprintf("could not marshal log entry %d: %s", entry.Index, err))
+	}
+	if err = l.persistor.StoreState(entryKey(entry.Index), raw); err != nil {
+		panic(fmt.Sprintf("could not persist log entry %d: %s", entry.Index, err))
+	}
+	l.entries = append(l.entries, entry)
+	l.addTxs(entry)
+}
+
+// truncate removes the entry at index and all entries following it
+func (l *raftLog) truncate(index uint64) {
+	for i := l.lastIndex(); i >= index && i >= l.firstIndex(); i-- {
+		l.persistor.DelState(entryKey(i))
+		l.removeTxs(l.entry(i))
+	}
+	if index < l.firstIndex() {
+		l.entries = nil
+		return
+	}
+	l.entries = l.entries[:index-l.firstIndex()]
+}
+
+// compact removes the entries up to and including index, which must have been applied
+func (l *raftLog) compact(index uint64) {
+	term, ok := l.term(index)
+	if !ok || index <= l.snapshotIndex {
+		return
+	}
+	remaining := l.entries[index-l.firstIndex()+1:]
+	l.persistSnapshot(index, term)
+	for i := l.firstIndex(); i <= index; i++ {
+		l.persistor.DelState(entryKey(i))
+		l.removeTxs(l.entry(i))
+	}
+	l.entries = remaining
+	l.snapshotIndex = index
+	l.snapshotTerm = term
+}
+
+// reset discards the whole log, as the state has been transferred up to index
+func (l *raftLog) reset(index uint64, term uint64) {
+	l.persistSnapshot(index, term)
+	l.truncate(l.firstIndex())
+	l.snapshotIndex = index
+	l.snapshotTerm = term
+}
+
+// contains reports whether an entry of the log holds the transaction
+func (l *raftLog) contains(tx []byte) bool {
+	return l.txs[string(tx)] > 0
+}
+
+func (l *raftLog) addTxs(entry *Entry) {
+	for _, tx := range entry.Transactions {
+		l.txs[string(tx)]++
+	}
+}
+
+func (l *raftLog) removeTxs(entry *Entry) {
+	for _, tx := range entry.Transactions {
+		if l.txs[string(tx)]--; l.txs[string(tx)] <= 0 {
+			delete(l.txs, string(tx))
+		}
+	}
+}
+
+func (l *raftLog) persistSnapshot(index uint64, term uint64) {
+	raw, _ := proto.Marshal(&Metadata{Index: index, Term: term})
+	if err := l.persistor.StoreState(snapshotKey, raw); err != nil {
+		panic(fmt.Sprintf("could not persist log compaction point %d: %s", index, err))
+	}
+}
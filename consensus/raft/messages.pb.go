@@ -0,0 +1,323 @@
+// Code generated by protoc-gen-go.
+// source: messages.proto
+// DO NOT EDIT!
+
+/*
+Package raft is a generated protocol buffer package.
+
+It is generated from these files:
+	messages.proto
+
+It has these top-level messages:
+	Message
+	Entry
+	RequestVote
+	Vote
+	AppendEntries
+	AppendResponse
+	InstallSnapshot
+	HardState
+	Metadata
+*/
+package raft
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type Message struct {
+	// Types that are valid to be assigned to Payload:
+	//	*Message_RequestVote
+	//	*Message_Vote
+	//	*Message_AppendEntries
+	//	*Message_AppendResponse
+	//	*Message_InstallSnapshot
+	//	*Message_Transaction
+	Payload isMessage_Payload `protobuf_oneof:"payload"`
+}
+
+func (m *Message) Reset()         { *m = Message{} }
+func (m *Message) String() string { return proto.CompactTextString(m) }
+func (*Message) ProtoMessage()    {}
+
+type isMessage_Payload interface{ isMessage_Payload() }
+
+type Message_RequestVote struct {
+	RequestVote *RequestVote `protobuf:"bytes,1,opt,name=request_vote,oneof"`
+}
+type Message_Vote struct {
+	Vote *Vote `protobuf:"bytes,2,opt,name=vote,oneof"`
+}
+type Message_AppendEntries struct {
+	AppendEntries *AppendEntries `protobuf:"bytes,3,opt,name=append_entries,oneof"`
+}
+type Message_AppendResponse struct {
+	AppendResponse *AppendResponse `protobuf:"bytes,4,opt,name=append_response,oneof"`
+}
+type Message_InstallSnapshot struct {
+	InstallSnapshot *InstallSnapshot `protobuf:"bytes,5,opt,name=install_snapshot,oneof"`
+}
+type Message_Transaction struct {
+	Transaction []byte `protobuf:"bytes,6,opt,name=transaction,proto3,oneof"`
+}
+
+func (*Message_RequestVote) isMessage_Payload()     {}
+func (*Message_Vote) isMessage_Payload()            {}
+func (*Message_AppendEntries) isMessage_Payload()   {}
+func (*Message_AppendResponse) isMessage_Payload()  {}
+func (*Message_InstallSnapshot) isMessage_Payload() {}
+func (*Message_Transaction) isMessage_Payload()     {}
+
+func (m *Message) GetPayload() isMessage_Payload {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *Message) GetRequestVote() *RequestVote {
+	if x, ok := m.GetPayload().(*Message_RequestVote); ok {
+		return x.RequestVote
+	}
+	return nil
+}
+
+func (m *Message) GetVote() *Vote {
+	if x, ok := m.GetPayload().(*Message_Vote); ok {
+		return x.Vote
+	}
+	return nil
+}
+
+func (m *Message) GetAppendEntries() *AppendEntries {
+	if x, ok := m.GetPayload().(*Message_AppendEntries); ok {
+		return x.AppendEntries
+	}
+	return nil
+}
+
+func (m *Message) GetAppendResponse() *AppendResponse {
+	if x, ok := m.GetPayload().(*Message_AppendResponse); ok {
+		return x.AppendResponse
+	}
+	return nil
+}
+
+func (m *Message) GetInstallSnapshot() *InstallSnapshot {
+	if x, ok := m.GetPayload().(*Message_InstallSnapshot); ok {
+		return x.InstallSnapshot
+	}
+	return nil
+}
+
+func (m *Message) GetTransaction() []byte {
+	if x, ok := m.GetPayload().(*Message_Transaction); ok {
+		return x.Transaction
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*Message) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
+	return _Message_OneofMarshaler, _Message_OneofUnmarshaler, []interface{}{
+		(*Message_RequestVote)(nil),
+		(*Message_Vote)(nil),
+		(*Message_AppendEntries)(nil),
+		(*Message_AppendResponse)(nil),
+		(*Message_InstallSnapshot)(nil),
+		(*Message_Transaction)(nil),
+	}
+}
+
+func _Message_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*Message)
+	// payload
+	switch x := m.Payload.(type) {
+	case *Message_RequestVote:
+		b.EncodeVarint(1<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.RequestVote); err != nil {
+			return err
+		}
+	case *Message_Vote:
+		b.EncodeVarint(2<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.Vote); err != nil {
+			return err
+		}
+	case *Message_AppendEntries:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.AppendEntries); err != nil {
+			return err
+		}
+	case *Message_AppendResponse:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.AppendResponse); err != nil {
+			return err
+		}
+	case *Message_InstallSnapshot:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.InstallSnapshot); err != nil {
+			return err
+		}
+	case *Message_Transaction:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		b.EncodeRawBytes(x.Transaction)
+	case nil:
+	default:
+		return fmt.Errorf("Message.Payload has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _Message_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*Message)
+	switch tag {
+	case 1: // payload.request_vote
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(RequestVote)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_RequestVote{msg}
+		return true, err
+	case 2: // payload.vote
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(Vote)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_Vote{msg}
+		return true, err
+	case 3: // payload.append_entries
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(AppendEntries)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_AppendEntries{msg}
+		return true, err
+	case 4: // payload.append_response
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(AppendResponse)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_AppendResponse{msg}
+		return true, err
+	case 5: // payload.install_snapshot
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(InstallSnapshot)
+		err := b.DecodeMessage(msg)
+		m.Payload = &Message_InstallSnapshot{msg}
+		return true, err
+	case 6: // payload.transaction
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		x, err := b.DecodeRawBytes(true)
+		m.Payload = &Message_Transaction{x}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+type Entry struct {
+	Term         uint64   `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	Index        uint64   `protobuf:"varint,2,opt,name=index" json:"index,omitempty"`
+	Transactions [][]byte `protobuf:"bytes,3,rep,name=transactions,proto3" json:"transactions,omitempty"`
+}
+
+func (m *Entry) Reset()         { *m = Entry{} }
+func (m *Entry) String() string { return proto.CompactTextString(m) }
+func (*Entry) ProtoMessage()    {}
+
+type RequestVote struct {
+	Term         uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	CandidateId  uint64 `protobuf:"varint,2,opt,name=candidate_id" json:"candidate_id,omitempty"`
+	LastLogIndex uint64 `protobuf:"varint,3,opt,name=last_log_index" json:"last_log_index,omitempty"`
+	LastLogTerm  uint64 `protobuf:"varint,4,opt,name=last_log_term" json:"last_log_term,omitempty"`
+}
+
+func (m *RequestVote) Reset()         { *m = RequestVote{} }
+func (m *RequestVote) String() string { return proto.CompactTextString(m) }
+func (*RequestVote) ProtoMessage()    {}
+
+type Vote struct {
+	Term      uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	ReplicaId uint64 `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+	Granted   bool   `protobuf:"varint,3,opt,name=granted" json:"granted,omitempty"`
+}
+
+func (m *Vote) Reset()         { *m = Vote{} }
+func (m *Vote) String() string { return proto.CompactTextString(m) }
+func (*Vote) ProtoMessage()    {}
+
+type AppendEntries struct {
+	Term         uint64   `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	LeaderId     uint64   `protobuf:"varint,2,opt,name=leader_id" json:"leader_id,omitempty"`
+	PrevLogIndex uint64   `protobuf:"varint,3,opt,name=prev_log_index" json:"prev_log_index,omitempty"`
+	PrevLogTerm  uint64   `protobuf:"varint,4,opt,name=prev_log_term" json:"prev_log_term,omitempty"`
+	Entries      []*Entry `protobuf:"bytes,5,rep,name=entries" json:"entries,omitempty"`
+	LeaderCommit uint64   `protobuf:"varint,6,opt,name=leader_commit" json:"leader_commit,omitempty"`
+}
+
+func (m *AppendEntries) Reset()         { *m = AppendEntries{} }
+func (m *AppendEntries) String() string { return proto.CompactTextString(m) }
+func (*AppendEntries) ProtoMessage()    {}
+
+func (m *AppendEntries) GetEntries() []*Entry {
+	if m != nil {
+		return m.Entries
+	}
+	return nil
+}
+
+type AppendResponse struct {
+	Term       uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	ReplicaId  uint64 `protobuf:"varint,2,opt,name=replica_id" json:"replica_id,omitempty"`
+	Success    bool   `protobuf:"varint,3,opt,name=success" json:"success,omitempty"`
+	MatchIndex uint64 `protobuf:"varint,4,opt,name=match_index" json:"match_index,omitempty"`
+}
+
+func (m *AppendResponse) Reset()         { *m = AppendResponse{} }
+func (m *AppendResponse) String() string { return proto.CompactTextString(m) }
+func (*AppendResponse) ProtoMessage()    {}
+
+// sent instead of append_entries when the leader has already compacted the entries a follower needs
+type InstallSnapshot struct {
+	Term           uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	LeaderId       uint64 `protobuf:"varint,2,opt,name=leader_id" json:"leader_id,omitempty"`
+	LastIndex      uint64 `protobuf:"varint,3,opt,name=last_index" json:"last_index,omitempty"`
+	LastTerm       uint64 `protobuf:"varint,4,opt,name=last_term" json:"last_term,omitempty"`
+	BlockchainInfo []byte `protobuf:"bytes,5,opt,name=blockchain_info,proto3" json:"blockchain_info,omitempty"`
+}
+
+func (m *InstallSnapshot) Reset()         { *m = InstallSnapshot{} }
+func (m *InstallSnapshot) String() string { return proto.CompactTextString(m) }
+func (*InstallSnapshot) ProtoMessage()    {}
+
+type HardState struct {
+	Term     uint64 `protobuf:"varint,1,opt,name=term" json:"term,omitempty"`
+	VotedFor uint64 `protobuf:"varint,2,opt,name=voted_for" json:"voted_for,omitempty"`
+	Voted    bool   `protobuf:"varint,3,opt,name=voted" json:"voted,omitempty"`
+}
+
+func (m *HardState) Reset()         { *m = HardState{} }
+func (m *HardState) String() string { return proto.CompactTextString(m) }
+func (*HardState) ProtoMessage()    {}
+
+type Metadata struct {
+	Index uint64 `protobuf:"varint,1,opt,name=index" json:"index,omitempty"`
+	Term  uint64 `protobuf:"varint,2,opt,name=term" json:"term,omitempty"`
+}
+
+func (m *Metadata) Reset()         { *m = Metadata{} }
+func (m *Metadata) String() string { return proto.CompactTextString(m) }
+func (*Metadata) ProtoMessage()    {}
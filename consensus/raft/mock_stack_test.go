@@ -0,0 +1,480 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+func testConfig(n int) *viper.Viper {
+	config := viper.New()
+	config.Set("general.N", n)
+	config.Set("general.batchsize", 3)
+	config.Set("general.logretention", 100)
+	config.Set("general.maxappend", 10)
+	config.Set("general.timeout.batch", "50ms")
+	config.Set("general.timeout.heartbeat", "30ms")
+	config.Set("general.timeout.election", "150ms")
+	return config
+}
+
+func createTxMsg(tag int64) *pb.Message {
+	raw, _ := proto.Marshal(&pb.Transaction{
+		Type:    pb.Transaction_CHAINCODE_INVOKE,
+		Uuid:    fmt.Sprint(tag),
+		Payload: []byte(fmt.Sprint(tag)),
+	})
+	return &pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: raw}
+}
+
+// testNetwork connects the replicas of a test, messages for which filter returns false are dropped
+type testNetwork struct {
+	t      *testing.T
+	config *viper.Viper
+	stacks []*testStack
+
+	mutex      sync.Mutex
+	filter     func(src, dst uint64) bool
+	leader     uint64
+	leaderTerm uint64
+}
+
+func newTestNetwork(t *testing.T, config *viper.Viper) *testNetwork {
+	net := &testNetwork{t: t, config: config}
+	for i := 0; i < config.GetInt("general.N"); i++ {
+		stack := &testStack{
+			id:        uint64(i),
+			net:       net,
+			blocks:    []*pb.Block{{}},
+			persisted: make(map[string][]byte),
+		}
+		net.stacks = append(net.stacks, stack)
+	}
+	for _, stack := range net.stacks {
+		stack.start()
+	}
+	return net
+}
+
+func (net *testNetwork) stop() {
+	for _, stack := range net.stacks {
+		stack.crash()
+	}
+}
+
+func (net *testNetwork) setFilter(filter func(src, dst uint64) bool) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	net.filter = filter
+}
+
+// isolate drops all messages to and from the given replica
+func (net *testNetwork) isolate(id uint64) {
+	net.setFilter(func(src, dst uint64) bool {
+		return src != id && dst != id
+	})
+}
+
+func (net *testNetwork) heal() {
+	net.setFilter(nil)
+}
+
+func (net *testNetwork) send(src, dst uint64, msg *pb.Message) {
+	net.mutex.Lock()
+	defer net.mutex.Unlock()
+	if net.filter != nil && !net.filter(src, dst) {
+		return
+	}
+	raftMsg := &Message{}
+	if proto.Unmarshal(msg.Payload, raftMsg) == nil {
+		if ae := raftMsg.GetAppendEntries(); ae != nil && ae.Term >= net.leaderTerm {
+			net.leader, net.leaderTerm = ae.LeaderId, ae.Term
+		}
+	}
+	net.stacks[dst].deliver(src, msg)
+}
+
+// currentLeader waits until a leader has contacted its followers
+func (net *testNetwork) currentLeader() uint64 {
+	var leader uint64
+	net.waitFor("a leader", func() bool {
+		net.mutex.Lock()
+		defer net.mutex.Unlock()
+		leader = net.leader
+		return net.leaderTerm > 0
+	})
+	return leader
+}
+
+func (net *testNetwork) waitFor(what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			net.t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForTxs waits until the given replicas have committed count transactions with identical blocks
+func (net *testNetwork) waitForTxs(count int, ids ...uint64) {
+	net.waitFor(fmt.Sprintf("%d transactions on replicas %v", count, ids), func() bool {
+		var reference []*pb.Block
+		for _, id := range ids {
+			blocks := net.stacks[id].chain()
+			txs := 0
+			for _, block := range blocks {
+				txs += len(block.Transactions)
+			}
+			if txs != count {
+				return false
+			}
+			if reference == nil {
+				reference = blocks
+			} else if !reflect.DeepEqual(reference, blocks) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// waitForTx waits until the given replicas have committed the transaction with identical blocks
+func (net *testNetwork) waitForTx(uuid string, ids ...uint64) {
+	net.waitFor(fmt.Sprintf("transaction %s on replicas %v", uuid, ids), func() bool {
+		var reference []*pb.Block
+		for _, id := range ids {
+			blocks := net.stacks[id].chain()
+			if net.stacks[id].executions()[uuid] == 0 {
+				return false
+			}
+			if reference == nil {
+				reference = blocks
+			} else if !reflect.DeepEqual(reference, blocks) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// testStack is the consensus.Stack of a single replica
+type testStack struct {
+	id  uint64
+	net *testNetwork
+
+	mutex        sync.Mutex
+	node         *obcRaft
+	inbox        chan testMessage
+	blocks       []*pb.Block
+	batch        []*pb.Transaction
+	persisted    map[string][]byte
+	stateUpdates int
+}
+
+type testMessage struct {
+	src uint64
+	msg *pb.Message
+}
+
+// start brings up a replica with the persisted state and ledger of the stack
+func (stack *testStack) start() {
+	node := newObcRaft(stack.id, stack.net.config, stack, stack)
+	inbox := make(chan testMessage, 10000)
+	stack.mutex.Lock()
+	stack.node = node
+	stack.inbox = inbox
+	stack.mutex.Unlock()
+
+	go func() {
+		for msg := range inbox {
+			node.RecvMsg(msg.msg, getValidatorHandle(msg.src))
+		}
+	}()
+}
+
+// crash stops the replica, keeping what it has persisted and committed
+func (stack *testStack) crash() {
+	stack.mutex.Lock()
+	node := stack.node
+	if stack.inbox != nil {
+		close(stack.inbox)
+	}
+	stack.node = nil
+	stack.inbox = nil
+	stack.mutex.Unlock()
+	if node != nil {
+		node.Close()
+	}
+}
+
+func (stack *testStack) deliver(src uint64, msg *pb.Message) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	if stack.inbox == nil {
+		return
+	}
+	select {
+	case stack.inbox <- testMessage{src, msg}:
+	default:
+	}
+}
+
+func (stack *testStack) submit(tag int64) {
+	stack.deliver(stack.id, createTxMsg(tag))
+}
+
+func (stack *testStack) chain() []*pb.Block {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	return append([]*pb.Block(nil), stack.blocks...)
+}
+
+// executions counts the committed executions of every transaction
+func (stack *testStack) executions() map[string]int {
+	counts := make(map[string]int)
+	for _, block := range stack.chain() {
+		for _, tx := range block.Transactions {
+			counts[tx.Uuid]++
+		}
+	}
+	return counts
+}
+
+func (stack *testStack) GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error) {
+	return nil, nil, fmt.Errorf("not implemented")
+}
+
+func (stack *testStack) GetNetworkHandles() (self *pb.PeerID, network []*pb.PeerID, err error) {
+	for i := range stack.net.stacks {
+		network = append(network, getValidatorHandle(uint64(i)))
+	}
+	return getValidatorHandle(stack.id), network, nil
+}
+
+func (stack *testStack) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	for i := range stack.net.stacks {
+		if uint64(i) != stack.id {
+			stack.net.send(stack.id, uint64(i), msg)
+		}
+	}
+	return nil
+}
+
+func (stack *testStack) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	id, err := getValidatorID(receiverHandle)
+	if err != nil {
+		return err
+	}
+	stack.net.send(stack.id, id, msg)
+	return nil
+}
+
+func (stack *testStack) Sign(msg []byte) ([]byte, error) {
+	return msg, nil
+}
+
+func (stack *testStack) Verify(peerID *pb.PeerID, signature []byte, message []byte) error {
+	return nil
+}
+
+func (stack *testStack) SessionKey(peerID *pb.PeerID) ([]byte, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (stack *testStack) Start() {}
+
+func (stack *testStack) Halt() {}
+
+func (stack *testStack) Execute(tag interface{}, txs []*pb.Transaction) {
+	stack.mutex.Lock()
+	stack.batch = append(stack.batch, txs...)
+	node := stack.node
+	stack.mutex.Unlock()
+	go node.Executed(tag)
+}
+
+func (stack *testStack) Commit(tag interface{}, metadata []byte) {
+	block, _ := stack.CommitTxBatch(nil, metadata)
+	stack.mutex.Lock()
+	node := stack.node
+	info := stack.blockchainInfo()
+	stack.mutex.Unlock()
+	if block != nil {
+		go node.Committed(tag, info)
+	}
+}
+
+func (stack *testStack) Rollback(tag interface{}) {
+	stack.RollbackTxBatch(nil)
+}
+
+// UpdateState copies the missing blocks from the first of the given peers
+func (stack *testStack) UpdateState(tag interface{}, target *pb.BlockchainInfo, peers []*pb.PeerID) {
+	id, _ := getValidatorID(peers[0])
+	source := stack.net.stacks[id].chain()
+
+	stack.mutex.Lock()
+	node := stack.node
+	stack.stateUpdates++
+	if uint64(len(source)) < target.Height {
+		stack.mutex.Unlock()
+		go node.StateUpdated(tag, nil)
+		return
+	}
+	stack.batch = nil
+	stack.blocks = append([]*pb.Block(nil), source[:target.Height]...)
+	info := stack.blockchainInfo()
+	stack.mutex.Unlock()
+	go node.StateUpdated(tag, info)
+}
+
+func (stack *testStack) BeginTxBatch(id interface{}) error {
+	return nil
+}
+
+func (stack *testStack) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	stack.batch = append(stack.batch, txs...)
+	return nil, nil
+}
+
+func (stack *testStack) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	previousHash, _ := stack.blocks[len(stack.blocks)-1].GetHash()
+	block := &pb.Block{
+		Transactions:      stack.batch,
+		ConsensusMetadata: metadata,
+		PreviousBlockHash: previousHash,
+	}
+	stack.blocks = append(stack.blocks, block)
+	stack.batch = nil
+	return block, nil
+}
+
+func (stack *testStack) RollbackTxBatch(id interface{}) error {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	stack.batch = nil
+	return nil
+}
+
+func (stack *testStack) PreviewCommitTxBatch(id interface{}, metadata []byte) ([]byte, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (stack *testStack) InvalidateState() {}
+
+func (stack *testStack) RejectTransaction(tx *pb.Transaction, reason string) {}
+
+func (stack *testStack) ReportEvidence(evidence *pb.ConsensusEvidence) {}
+
+func (stack *testStack) ValidateState() {}
+
+func (stack *testStack) GetBlock(id uint64) (*pb.Block, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	if id >= uint64(len(stack.blocks)) {
+		return nil, fmt.Errorf("block %d not found", id)
+	}
+	return stack.blocks[id], nil
+}
+
+func (stack *testStack) GetBlockchainSize() uint64 {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	return uint64(len(stack.blocks))
+}
+
+func (stack *testStack) GetBlockchainInfo() *pb.BlockchainInfo {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	return stack.blockchainInfo()
+}
+
+func (stack *testStack) blockchainInfo() *pb.BlockchainInfo {
+	hash, _ := stack.blocks[len(stack.blocks)-1].GetHash()
+	return &pb.BlockchainInfo{Height: uint64(len(stack.blocks)), CurrentBlockHash: hash}
+}
+
+func (stack *testStack) GetBlockchainInfoBlob() []byte {
+	raw, _ := proto.Marshal(stack.GetBlockchainInfo())
+	return raw
+}
+
+func (stack *testStack) GetBlockHeadMetadata() ([]byte, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	return stack.blocks[len(stack.blocks)-1].ConsensusMetadata, nil
+}
+
+func (stack *testStack) GetTransactionResultByUUID(txUUID string) (*pb.TransactionResult, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	for _, block := range stack.blocks {
+		for _, tx := range block.Transactions {
+			if tx.Uuid == txUUID {
+				return &pb.TransactionResult{Uuid: txUUID}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("transaction %s not found", txUUID)
+}
+
+func (stack *testStack) StoreState(key string, value []byte) error {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	stack.persisted[key] = value
+	return nil
+}
+
+func (stack *testStack) ReadState(key string) ([]byte, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	if value, ok := stack.persisted[key]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("cannot find key %s", key)
+}
+
+func (stack *testStack) ReadStateSet(prefix string) (map[string][]byte, error) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	set := make(map[string][]byte)
+	for key, value := range stack.persisted {
+		if len(key) >= len(prefix) && key[:len(prefix)] == prefix {
+			set[key] = value
+		}
+	}
+	return set, nil
+}
+
+func (stack *testStack) DelState(key string) {
+	stack.mutex.Lock()
+	defer stack.mutex.Unlock()
+	delete(stack.persisted, key)
+}
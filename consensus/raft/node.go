@@ -0,0 +1,769 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/spf13/viper"
+)
+
+type role int
+
+const (
+	follower role = iota
+	candidate
+	leader
+)
+
+func (r role) String() string {
+	switch r {
+	case follower:
+		return "follower"
+	case candidate:
+		return "candidate"
+	default:
+		return "leader"
+	}
+}
+
+// raftLedger is the part of the ledger Raft reads to detect transactions ordered twice
+type raftLedger interface {
+	GetTransactionResultByUUID(txUUID string) (*pb.TransactionResult, error)
+}
+
+// obcRaft orders transactions by replicating batches of them through a Raft log,
+// every committed log entry containing transactions becomes a block
+type obcRaft struct {
+	externalEventReceiver
+
+	stack  consensus.Stack
+	ledger raftLedger
+	id     uint64
+	N      int
+
+	batchSize         int
+	logRetention      uint64
+	maxAppend         int
+	batchTimeout      time.Duration
+	heartbeatInterval time.Duration
+	electionTimeout   time.Duration
+
+	batchTimer       events.Timer
+	batchTimerActive bool
+	heartbeatTimer   events.Timer
+	electionTimer    events.Timer
+	random           *rand.Rand
+
+	// Persisted
+	term     uint64
+	votedFor *uint64
+	log      *raftLog
+
+	role         role
+	leader       *uint64         // the leader of the current term, if known
+	votes        map[uint64]bool // votes received while a candidate
+	nextIndex    map[uint64]uint64
+	matchIndex   map[uint64]uint64
+	commitIndex  uint64
+	lastApplied  uint64
+	applying     *Entry // the entry handed to the executor, if any
+	transferring bool   // whether state transfer to a snapshot is in progress
+
+	batchStore  [][]byte          // transactions the leader has yet to append
+	pending     [][]byte          // transactions waiting for a leader to be known
+	outstanding map[string][]byte // transactions forwarded to the leader but not yet seen in its log
+}
+
+func newObcRaft(id uint64, config *viper.Viper, stack consensus.Stack, ledger raftLedger) *obcRaft {
+	var err error
+
+	op := &obcRaft{
+		stack:  stack,
+		ledger: ledger,
+		id:     id,
+		N:      config.GetInt("general.N"),
+
+		outstanding: make(map[string][]byte),
+	}
+	if op.id >= uint64(op.N) {
+		panic(fmt.Errorf("Replica ID %d is not below the number of replicas %d", op.id, op.N))
+	}
+
+	op.batchSize = config.GetInt("general.batchsize")
+	op.logRetention = uint64(config.GetInt("general.logretention"))
+	op.maxAppend = config.GetInt("general.maxappend")
+	if op.maxAppend < 1 {
+		op.maxAppend = 1
+	}
+	if op.batchTimeout, err = time.ParseDuration(config.GetString("general.timeout.batch")); err != nil {
+		panic(fmt.Errorf("Cannot parse batch timeout: %s", err))
+	}
+	if op.heartbeatInterval, err = time.ParseDuration(config.GetString("general.timeout.heartbeat")); err != nil {
+		panic(fmt.Errorf("Cannot parse heartbeat timeout: %s", err))
+	}
+	if op.electionTimeout, err = time.ParseDuration(config.GetString("general.timeout.election")); err != nil {
+		panic(fmt.Errorf("Cannot parse election timeout: %s", err))
+	}
+	if op.electionTimeout <= op.heartbeatInterval {
+		op.electionTimeout = 3 * op.heartbeatInterval
+		logger.Warningf("Configured election timeout must be greater than heartbeat interval, setting to %v", op.electionTimeout)
+	}
+	logger.Infof("Raft replica %d of %d, batch size = %d, batch timeout = %v, election timeout = %v",
+		op.id, op.N, op.batchSize, op.batchTimeout, op.electionTimeout)
+
+	op.random = rand.New(rand.NewSource(time.Now().UnixNano() + int64(id)))
+	op.restoreState()
+
+	op.manager = events.NewManagerImpl()
+	op.manager.SetReceiver(op)
+	etf := events.NewTimerFactoryImpl(op.manager)
+	op.batchTimer = etf.CreateTimer()
+	op.heartbeatTimer = etf.CreateTimer()
+	op.electionTimer = etf.CreateTimer()
+	op.manager.Start()
+	op.resetElectionTimer()
+
+	return op
+}
+
+// restoreState recovers the term, vote and log from the persistor and the last applied entry from the ledger
+func (op *obcRaft) restoreState() {
+	op.log = newRaftLog(op.stack)
+
+	if raw, err := op.stack.ReadState(hardStateKey); err == nil {
+		state := &HardState{}
+		if err = proto.Unmarshal(raw, state); err != nil {
+			logger.Errorf("Could not unmarshal the persisted term and vote, local state is damaged: %s", err)
+		} else {
+			op.term = state.Term
+			if state.Voted {
+				votedFor := state.VotedFor
+				op.votedFor = &votedFor
+			}
+		}
+	}
+
+	if raw, err := op.stack.GetBlockHeadMetadata(); err == nil {
+		meta := &Metadata{}
+		if err = proto.Unmarshal(raw, meta); err != nil {
+			logger.Warningf("Could not unmarshal the metadata of the last block: %s", err)
+		}
+		op.lastApplied = meta.Index
+	}
+	if op.lastApplied < op.log.snapshotIndex {
+		op.lastApplied = op.log.snapshotIndex
+	}
+	op.commitIndex = op.lastApplied
+
+	logger.Infof("Replica %d restored term %d, last applied entry %d, log ending at %d", op.id, op.term, op.lastApplied, op.log.lastIndex())
+}
+
+func (op *obcRaft) persistHardState() {
+	state := &HardState{Term: op.term}
+	if op.votedFor != nil {
+		state.VotedFor = *op.votedFor
+		state.Voted = true
+	}
+	raw, _ := proto.Marshal(state)
+	if err := op.stack.StoreState(hardStateKey, raw); err != nil {
+		panic(fmt.Sprintf("could not persist term %d: %s", op.term, err))
+	}
+}
+
+// Close tells us to release resources we are holding
+func (op *obcRaft) Close() {
+	op.batchTimer.Halt()
+	op.heartbeatTimer.Halt()
+	op.electionTimer.Halt()
+	op.manager.Halt()
+}
+
+// ProcessEvent is the main event loop of the replica, all protocol state is only touched from here
+func (op *obcRaft) ProcessEvent(event events.Event) events.Event {
+	switch et := event.(type) {
+	case messageEvent:
+		op.processMessage(et.msg, et.sender)
+	case batchTimerEvent:
+		op.batchTimerActive = false
+		if op.role == leader && len(op.batchStore) > 0 {
+			op.appendBatch()
+		}
+	case heartbeatTimerEvent:
+		if op.role == leader {
+			op.sendAppends()
+			op.heartbeatTimer.Reset(op.heartbeatInterval, heartbeatTimerEvent{})
+		}
+	case electionTimerEvent:
+		op.startElection()
+	case executedEvent:
+		entry := et.tag.(*Entry)
+		raw, _ := proto.Marshal(&Metadata{Index: entry.Index, Term: entry.Term})
+		op.stack.Commit(entry, raw)
+	case committedEvent:
+		op.entryApplied(et.tag.(*Entry))
+	case stateUpdatedEvent:
+		op.stateUpdated(et.tag.(*Metadata), et.target)
+	default:
+		logger.Warningf("Replica %d received an unknown event type %T", op.id, et)
+	}
+	return nil
+}
+
+func (op *obcRaft) processMessage(ocMsg *pb.Message, senderHandle *pb.PeerID) {
+	if ocMsg.Type == pb.Message_CHAIN_TRANSACTION {
+		op.submit(ocMsg.Payload)
+		return
+	}
+	if ocMsg.Type != pb.Message_CONSENSUS {
+		logger.Errorf("Unexpected message type: %s", ocMsg.Type)
+		return
+	}
+
+	msg := &Message{}
+	if err := proto.Unmarshal(ocMsg.Payload, msg); err != nil {
+		logger.Errorf("Error unmarshaling message: %s", err)
+		return
+	}
+	if _, err := getValidatorID(senderHandle); err != nil {
+		logger.Warningf("Dropping message from %v: %s", senderHandle, err)
+		return
+	}
+
+	switch payload := msg.Payload.(type) {
+	case *Message_Transaction:
+		op.submit(payload.Transaction)
+	case *Message_RequestVote:
+		op.recvRequestVote(payload.RequestVote)
+	case *Message_Vote:
+		op.recvVote(payload.Vote)
+	case *Message_AppendEntries:
+		op.recvAppendEntries(payload.AppendEntries)
+	case *Message_AppendResponse:
+		op.recvAppendResponse(payload.AppendResponse)
+	case *Message_InstallSnapshot:
+		op.recvInstallSnapshot(payload.InstallSnapshot)
+	default:
+		logger.Warningf("Replica %d received an empty message", op.id)
+	}
+}
+
+func (op *obcRaft) wrap(msg *Message) *pb.Message {
+	raw, err := proto.Marshal(msg)
+	if err != nil {
+		panic(fmt.Sprintf("could not marshal message: %s", err))
+	}
+	return &pb.Message{Type: pb.Message_CONSENSUS, Payload: raw}
+}
+
+func (op *obcRaft) unicast(msg *Message, receiver uint64) {
+	if err := op.stack.Unicast(op.wrap(msg), getValidatorHandle(receiver)); err != nil {
+		logger.Debugf("Replica %d could not send message to replica %d: %s", op.id, receiver, err)
+	}
+}
+
+func (op *obcRaft) broadcast(msg *Message) {
+	if err := op.stack.Broadcast(op.wrap(msg), pb.PeerEndpoint_VALIDATOR); err != nil {
+		logger.Debugf("Replica %d could not broadcast message: %s", op.id, err)
+	}
+}
+
+// =============================================================================
+// transactions
+// =============================================================================
+
+// submit queues a transaction on the leader, or forwards it there
+func (op *obcRaft) submit(tx []byte) {
+	switch {
+	case op.role == leader:
+		if op.isOrdered(tx) {
+			logger.Debugf("Leader %d dropping a transaction which was already ordered", op.id)
+			return
+		}
+		op.batchStore = append(op.batchStore, tx)
+		if len(op.batchStore) >= op.batchSize {
+			op.appendBatch()
+		} else if !op.batchTimerActive {
+			op.batchTimer.Reset(op.batchTimeout, batchTimerEvent{})
+			op.batchTimerActive = true
+		}
+	case op.leader != nil:
+		op.outstanding[string(tx)] = tx
+		op.unicast(&Message{Payload: &Message_Transaction{Transaction: tx}}, *op.leader)
+	default:
+		logger.Debugf("Replica %d does not know the leader of term %d, holding transaction", op.id, op.term)
+		op.pending = append(op.pending, tx)
+	}
+}
+
+// submitPending submits the transactions held while no leader was known, and those
+// reclaimed from a previous leader which the log does not show to be ordered
+func (op *obcRaft) submitPending() {
+	pending := op.pending
+	op.pending = nil
+	for _, tx := range pending {
+		if op.isOrdered(tx) {
+			continue
+		}
+		op.submit(tx)
+	}
+}
+
+// isOrdered reports whether the transaction is queued by the leader, held by an entry
+// of the log or was applied, a transaction forwarded to a leader which failed may
+// have been replicated before it failed
+func (op *obcRaft) isOrdered(raw []byte) bool {
+	if op.log.contains(raw) {
+		return true
+	}
+	for _, tx := range op.batchStore {
+		if bytes.Equal(tx, raw) {
+			return true
+		}
+	}
+	tx := &pb.Transaction{}
+	if err := proto.Unmarshal(raw, tx); err != nil {
+		return false
+	}
+	return op.isApplied(tx.Uuid)
+}
+
+// isApplied reports whether the ledger holds the result of the transaction
+func (op *obcRaft) isApplied(uuid string) bool {
+	_, err := op.ledger.GetTransactionResultByUUID(uuid)
+	return err == nil
+}
+
+func (op *obcRaft) appendBatch() {
+	op.batchTimer.Stop()
+	op.batchTimerActive = false
+	logger.Debugf("Leader %d appending a batch of %d transactions", op.id, len(op.batchStore))
+	op.appendEntry(op.batchStore)
+	op.batchStore = nil
+	op.sendAppends()
+}
+
+func (op *obcRaft) appendEntry(txs [][]byte) {
+	op.log.append(&Entry{
+		Term:         op.term,
+		Index:        op.log.lastIndex() + 1,
+		Transactions: txs,
+	})
+	op.maybeCommit()
+}
+
+// =============================================================================
+// elections
+// =============================================================================
+
+func (op *obcRaft) resetElectionTimer() {
+	timeout := op.electionTimeout + time.Duration(op.random.Int63n(int64(op.electionTimeout)))
+	op.electionTimer.Reset(timeout, electionTimerEvent{})
+}
+
+// becomeFollower moves to the given term, following the given leader if it is known
+func (op *obcRaft) becomeFollower(term uint64, leaderID *uint64) {
+	if term > op.term {
+		op.term = term
+		op.votedFor = nil
+		op.persistHardState()
+	}
+	if op.role == leader {
+		logger.Infof("Leader %d stepping down in term %d", op.id, op.term)
+		op.heartbeatTimer.Stop()
+		op.batchTimer.Stop()
+		op.batchTimerActive = false
+		op.pending = append(op.pending, op.batchStore...)
+		op.batchStore = nil
+	}
+	newLeader := leaderID != nil && (op.leader == nil || *op.leader != *leaderID)
+	op.role = follower
+	op.leader = leaderID
+	op.resetElectionTimer()
+	if newLeader {
+		// The previous leader may have failed before appending what was forwarded to it,
+		// this is resubmitted once the entries of the new leader are handled
+		op.reclaimOutstanding()
+	}
+}
+
+func (op *obcRaft) reclaimOutstanding() {
+	for key, tx := range op.outstanding {
+		op.pending = append(op.pending, tx)
+		delete(op.outstanding, key)
+	}
+}
+
+func (op *obcRaft) startElection() {
+	if op.role == leader {
+		return
+	}
+	op.term++
+	op.role = candidate
+	op.leader = nil
+	op.votedFor = &op.id
+	op.persistHardState()
+	op.votes = map[uint64]bool{op.id: true}
+	op.resetElectionTimer()
+
+	logger.Infof("Replica %d starting election for term %d", op.id, op.term)
+	if len(op.votes) > op.N/2 {
+		op.becomeLeader()
+		return
+	}
+	op.broadcast(&Message{Payload: &Message_RequestVote{RequestVote: &RequestVote{
+		Term:         op.term,
+		CandidateId:  op.id,
+		LastLogIndex: op.log.lastIndex(),
+		LastLogTerm:  op.log.lastTerm(),
+	}}})
+}
+
+func (op *obcRaft) recvRequestVote(rv *RequestVote) {
+	if rv.Term > op.term {
+		op.becomeFollower(rv.Term, nil)
+	}
+
+	// A vote is only granted to a candidate whose log holds every committed entry
+	upToDate := rv.LastLogTerm > op.log.lastTerm() ||
+		(rv.LastLogTerm == op.log.lastTerm() && rv.LastLogIndex >= op.log.lastIndex())
+	granted := rv.Term == op.term && upToDate && (op.votedFor == nil || *op.votedFor == rv.CandidateId)
+	if granted {
+		candidateID := rv.CandidateId
+		op.votedFor = &candidateID
+		op.persistHardState()
+		op.resetElectionTimer()
+	}
+	logger.Debugf("Replica %d vote for replica %d in term %d: %v", op.id, rv.CandidateId, op.term, granted)
+
+	op.unicast(&Message{Payload: &Message_Vote{Vote: &Vote{
+		Term:      op.term,
+		ReplicaId: op.id,
+		Granted:   granted,
+	}}}, rv.CandidateId)
+}
+
+func (op *obcRaft) recvVote(v *Vote) {
+	if v.Term > op.term {
+		op.becomeFollower(v.Term, nil)
+		return
+	}
+	if op.role != candidate || v.Term != op.term || !v.Granted {
+		return
+	}
+	op.votes[v.ReplicaId] = true
+	if len(op.votes) > op.N/2 {
+		op.becomeLeader()
+	}
+}
+
+func (op *obcRaft) becomeLeader() {
+	logger.Infof("Replica %d became leader for term %d", op.id, op.term)
+	op.role = leader
+	op.leader = &op.id
+	op.electionTimer.Stop()
+
+	op.nextIndex = make(map[uint64]uint64)
+	op.matchIndex = make(map[uint64]uint64)
+	for r := uint64(0); r < uint64(op.N); r++ {
+		if r != op.id {
+			op.nextIndex[r] = op.log.lastIndex() + 1
+			op.matchIndex[r] = 0
+		}
+	}
+
+	// Entries from earlier terms only commit along with an entry of the current term
+	op.appendEntry(nil)
+	op.reclaimOutstanding()
+	op.submitPending()
+	op.sendAppends()
+	op.heartbeatTimer.Reset(op.heartbeatInterval, heartbeatTimerEvent{})
+}
+
+// =============================================================================
+// replication
+// =============================================================================
+
+func (op *obcRaft) sendAppends() {
+	for r := range op.nextIndex {
+		op.sendAppend(r)
+	}
+}
+
+func (op *obcRaft) sendAppend(r uint64) {
+	prevIndex := op.nextIndex[r] - 1
+	prevTerm, ok := op.log.term(prevIndex)
+	if !ok {
+		op.sendSnapshot(r)
+		return
+	}
+	op.unicast(&Message{Payload: &Message_AppendEntries{AppendEntries: &AppendEntries{
+		Term:         op.term,
+		LeaderId:     op.id,
+		PrevLogIndex: prevIndex,
+		PrevLogTerm:  prevTerm,
+		Entries:      op.log.slice(op.nextIndex[r], op.maxAppend),
+		LeaderCommit: op.commitIndex,
+	}}}, r)
+}
+
+// sendSnapshot points a follower which needs compacted entries at the state of the leader's ledger
+func (op *obcRaft) sendSnapshot(r uint64) {
+	term, _ := op.log.term(op.lastApplied)
+	logger.Debugf("Leader %d sending snapshot at entry %d to replica %d", op.id, op.lastApplied, r)
+	op.unicast(&Message{Payload: &Message_InstallSnapshot{InstallSnapshot: &InstallSnapshot{
+		Term:           op.term,
+		LeaderId:       op.id,
+		LastIndex:      op.lastApplied,
+		LastTerm:       term,
+		BlockchainInfo: op.stack.GetBlockchainInfoBlob(),
+	}}}, r)
+}
+
+// acceptLeader handles the term of a message from a leader, it reports whether the message is current
+func (op *obcRaft) acceptLeader(term uint64, leaderID uint64) bool {
+	if term < op.term {
+		return false
+	}
+	if term > op.term || op.role != follower || op.leader == nil || *op.leader != leaderID {
+		op.becomeFollower(term, &leaderID)
+	} else {
+		op.resetElectionTimer()
+	}
+	return true
+}
+
+func (op *obcRaft) respond(leaderID uint64, success bool, matchIndex uint64) {
+	op.unicast(&Message{Payload: &Message_AppendResponse{AppendResponse: &AppendResponse{
+		Term:       op.term,
+		ReplicaId:  op.id,
+		Success:    success,
+		MatchIndex: matchIndex,
+	}}}, leaderID)
+}
+
+// matches reports whether the local log holds the entry at index with the given term,
+// compacted entries were applied, so they are the same on every replica
+func (op *obcRaft) matches(index uint64, term uint64) bool {
+	if t, ok := op.log.term(index); ok {
+		return t == term
+	}
+	return index < op.log.firstIndex()
+}
+
+func (op *obcRaft) recvAppendEntries(ae *AppendEntries) {
+	if !op.acceptLeader(ae.Term, ae.LeaderId) {
+		op.respond(ae.LeaderId, false, op.log.lastIndex())
+		return
+	}
+	defer op.submitPending()
+	if op.transferring {
+		return
+	}
+	if ae.PrevLogIndex > op.log.lastIndex() {
+		op.respond(ae.LeaderId, false, op.log.lastIndex())
+		return
+	}
+	if !op.matches(ae.PrevLogIndex, ae.PrevLogTerm) {
+		op.respond(ae.LeaderId, false, ae.PrevLogIndex-1)
+		return
+	}
+
+	for _, entry := range ae.Entries {
+		if entry.Index < op.log.firstIndex() {
+			continue
+		}
+		if term, ok := op.log.term(entry.Index); ok {
+			if term == entry.Term {
+				continue
+			}
+			logger.Infof("Replica %d discarding conflicting log entries from index %d", op.id, entry.Index)
+			op.log.truncate(entry.Index)
+		}
+		op.log.append(entry)
+		for _, tx := range entry.Transactions {
+			delete(op.outstanding, string(tx))
+		}
+	}
+
+	last := ae.PrevLogIndex + uint64(len(ae.Entries))
+	commit := ae.LeaderCommit
+	if commit > last {
+		commit = last
+	}
+	if commit > op.commitIndex {
+		op.commitIndex = commit
+		op.applyCommitted()
+	}
+	op.respond(ae.LeaderId, true, last)
+}
+
+func (op *obcRaft) recvAppendResponse(ar *AppendResponse) {
+	if ar.Term > op.term {
+		op.becomeFollower(ar.Term, nil)
+		return
+	}
+	if op.role != leader || ar.Term != op.term {
+		return
+	}
+	r := ar.ReplicaId
+	if _, ok := op.nextIndex[r]; !ok {
+		return
+	}
+
+	if !ar.Success {
+		if ar.MatchIndex+1 < op.nextIndex[r] {
+			op.nextIndex[r] = ar.MatchIndex + 1
+		} else if op.nextIndex[r] > 1 {
+			op.nextIndex[r]--
+		}
+		op.sendAppend(r)
+		return
+	}
+
+	if ar.MatchIndex > op.matchIndex[r] {
+		op.matchIndex[r] = ar.MatchIndex
+	}
+	if op.matchIndex[r]+1 > op.nextIndex[r] {
+		op.nextIndex[r] = op.matchIndex[r] + 1
+	}
+	op.maybeCommit()
+	if op.nextIndex[r] <= op.log.lastIndex() {
+		op.sendAppend(r)
+	}
+}
+
+// maybeCommit advances the commit index to the last entry of the current term held by a majority
+func (op *obcRaft) maybeCommit() {
+	for n := op.log.lastIndex(); n > op.commitIndex; n-- {
+		if term, _ := op.log.term(n); term != op.term {
+			return
+		}
+		count := 1
+		for _, match := range op.matchIndex {
+			if match >= n {
+				count++
+			}
+		}
+		if count > op.N/2 {
+			op.commitIndex = n
+			op.applyCommitted()
+			return
+		}
+	}
+}
+
+func (op *obcRaft) recvInstallSnapshot(is *InstallSnapshot) {
+	if !op.acceptLeader(is.Term, is.LeaderId) {
+		op.respond(is.LeaderId, false, op.log.lastIndex())
+		return
+	}
+	defer op.submitPending()
+	if op.transferring || op.applying != nil {
+		return // the leader will send the snapshot again
+	}
+	if is.LastIndex <= op.lastApplied {
+		op.respond(is.LeaderId, true, is.LastIndex)
+		return
+	}
+
+	info := &pb.BlockchainInfo{}
+	if err := proto.Unmarshal(is.BlockchainInfo, info); err != nil {
+		logger.Errorf("Replica %d could not unmarshal snapshot from leader %d: %s", op.id, is.LeaderId, err)
+		return
+	}
+	logger.Infof("Replica %d transferring state to entry %d from leader %d", op.id, is.LastIndex, is.LeaderId)
+	op.transferring = true
+	op.stack.InvalidateState()
+	op.stack.UpdateState(&Metadata{Index: is.LastIndex, Term: is.LastTerm}, info, []*pb.PeerID{getValidatorHandle(is.LeaderId)})
+}
+
+func (op *obcRaft) stateUpdated(snapshot *Metadata, target *pb.BlockchainInfo) {
+	op.transferring = false
+	if target == nil {
+		logger.Warningf("Replica %d could not transfer state to entry %d, awaiting another snapshot", op.id, snapshot.Index)
+		return
+	}
+	logger.Infof("Replica %d transferred state to entry %d", op.id, snapshot.Index)
+	op.stack.ValidateState()
+
+	op.log.reset(snapshot.Index, snapshot.Term)
+	op.lastApplied = snapshot.Index
+	if op.commitIndex < snapshot.Index {
+		op.commitIndex = snapshot.Index
+	}
+	if op.leader != nil {
+		op.respond(*op.leader, true, snapshot.Index)
+	}
+}
+
+// =============================================================================
+// execution
+// =============================================================================
+
+// applyCommitted hands the next committed entry to the executor, entries are applied one at a time
+func (op *obcRaft) applyCommitted() {
+	for op.applying == nil && !op.transferring && op.lastApplied < op.commitIndex {
+		entry := op.log.entry(op.lastApplied + 1)
+		if entry == nil {
+			logger.Errorf("Replica %d is missing committed entry %d", op.id, op.lastApplied+1)
+			return
+		}
+		// A transaction resubmitted after a failover may be ordered twice, it is only
+		// executed the first time; every replica applies the same entries on the same
+		// ledger, so every replica skips the same transactions
+		var txs []*pb.Transaction
+		uuids := make(map[string]bool)
+		for _, raw := range entry.Transactions {
+			tx := &pb.Transaction{}
+			if err := proto.Unmarshal(raw, tx); err != nil {
+				logger.Warningf("Replica %d skipping malformed transaction in entry %d: %s", op.id, entry.Index, err)
+				continue
+			}
+			if uuids[tx.Uuid] || op.isApplied(tx.Uuid) {
+				logger.Warningf("Replica %d skipping transaction %s in entry %d, which was already executed", op.id, tx.Uuid, entry.Index)
+				continue
+			}
+			uuids[tx.Uuid] = true
+			txs = append(txs, tx)
+		}
+		if len(txs) == 0 {
+			op.lastApplied = entry.Index // nothing to execute, no block is created
+			continue
+		}
+		logger.Debugf("Replica %d executing entry %d with %d transactions", op.id, entry.Index, len(txs))
+		op.applying = entry
+		op.stack.Execute(entry, txs)
+	}
+}
+
+func (op *obcRaft) entryApplied(entry *Entry) {
+	op.applying = nil
+	op.lastApplied = entry.Index
+	if op.lastApplied > op.log.snapshotIndex+op.logRetention {
+		op.log.compact(op.lastApplied - op.logRetention)
+	}
+	op.applyCommitted()
+}
@@ -0,0 +1,158 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	"github.com/hyperledger/fabric/core/ledger"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+const pluginName = "raft"
+
+var logger *logging.Logger // package-level logger
+
+var pluginInstance consensus.Consenter // singleton service
+
+func init() {
+	logger = logging.MustGetLogger("consensus/raft")
+	consensus.RegisterPlugin(pluginName, GetPlugin)
+}
+
+// GetPlugin returns the handle to the Consenter singleton
+func GetPlugin(c consensus.Stack) consensus.Consenter {
+	if pluginInstance == nil {
+		pluginInstance = New(c)
+	}
+	return pluginInstance
+}
+
+// New creates a Raft replica on top of the given stack, it is identified by the
+// number in its vpX peer ID
+func New(stack consensus.Stack) consensus.Consenter {
+	handle, _, _ := stack.GetNetworkHandles()
+	id, err := getValidatorID(handle)
+	if err != nil {
+		panic(err)
+	}
+	l, err := ledger.GetLedger()
+	if err != nil {
+		panic(fmt.Errorf("Cannot get the ledger: %s", err))
+	}
+	return newObcRaft(id, loadConfig(), stack, l)
+}
+
+func loadConfig() (config *viper.Viper) {
+	config, err := consensus.LoadPluginConfig(pluginName)
+	if err != nil {
+		panic(err)
+	}
+	return
+}
+
+// Returns the uint64 ID corresponding to a peer handle
+func getValidatorID(handle *pb.PeerID) (uint64, error) {
+	if !strings.HasPrefix(handle.Name, "vp") {
+		return 0, fmt.Errorf("Raft requires the validators' peer.id to be vpX, where X is a unique integer between 0 and N-1, not \"%s\"", handle.Name)
+	}
+	id, err := strconv.ParseUint(handle.Name[2:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Error extracting ID from \"%s\" handle: %v", handle.Name, err)
+	}
+	return id, nil
+}
+
+// Returns the peer handle that corresponds to a validator ID
+func getValidatorHandle(id uint64) *pb.PeerID {
+	return &pb.PeerID{Name: "vp" + strconv.FormatUint(id, 10)}
+}
+
+// Event types
+
+// messageEvent is sent when a message is received from the network
+type messageEvent struct {
+	msg    *pb.Message
+	sender *pb.PeerID
+}
+
+// executedEvent is sent when the execution of a log entry completes
+type executedEvent struct {
+	tag interface{}
+}
+
+// committedEvent is sent when the commit of a log entry completes
+type committedEvent struct {
+	tag    interface{}
+	target *pb.BlockchainInfo
+}
+
+// stateUpdatedEvent is sent when state transfer completes
+type stateUpdatedEvent struct {
+	tag    interface{}
+	target *pb.BlockchainInfo
+}
+
+// batchTimerEvent is sent when the batch timer expires
+type batchTimerEvent struct{}
+
+// heartbeatTimerEvent is sent when the leader should contact its followers
+type heartbeatTimerEvent struct{}
+
+// electionTimerEvent is sent when a follower has not heard from a leader for too long
+type electionTimerEvent struct{}
+
+// externalEventReceiver turns the callbacks of the stack into events processed by the replica
+type externalEventReceiver struct {
+	manager events.Manager
+}
+
+// RecvMsg is called by the stack when a new message is received
+func (eer *externalEventReceiver) RecvMsg(ocMsg *pb.Message, senderHandle *pb.PeerID) error {
+	eer.manager.Queue() <- messageEvent{
+		msg:    ocMsg,
+		sender: senderHandle,
+	}
+	return nil
+}
+
+// Executed is called whenever Execute completes
+func (eer *externalEventReceiver) Executed(tag interface{}) {
+	eer.manager.Queue() <- executedEvent{tag}
+}
+
+// Committed is called whenever Commit completes
+func (eer *externalEventReceiver) Committed(tag interface{}, target *pb.BlockchainInfo) {
+	eer.manager.Queue() <- committedEvent{tag, target}
+}
+
+// RolledBack is called whenever a Rollback completes, Raft never rolls back applied entries
+func (eer *externalEventReceiver) RolledBack(tag interface{}) {
+	logger.Warningf("Unexpected rollback completed")
+}
+
+// StateUpdated is a signal from the stack that it has fast-forwarded its state
+func (eer *externalEventReceiver) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {
+	eer.manager.Queue() <- stateUpdatedEvent{tag, target}
+}
@@ -0,0 +1,194 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package raft
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func TestGetValidatorID(t *testing.T) {
+	if id, err := getValidatorID(&pb.PeerID{Name: "vp3"}); err != nil || id != 3 {
+		t.Errorf("Expected ID 3 for vp3, got %d (%v)", id, err)
+	}
+	if _, err := getValidatorID(&pb.PeerID{Name: "peer3"}); err == nil {
+		t.Error("Expected an error for a peer ID not of the form vpX")
+	}
+}
+
+func TestReplication(t *testing.T) {
+	net := newTestNetwork(t, testConfig(3))
+	defer net.stop()
+
+	for i := 0; i < 10; i++ {
+		net.stacks[i%3].submit(int64(i))
+	}
+	net.waitForTxs(10, 0, 1, 2)
+}
+
+func TestSingleReplica(t *testing.T) {
+	net := newTestNetwork(t, testConfig(1))
+	defer net.stop()
+
+	for i := 0; i < 4; i++ {
+		net.stacks[0].submit(int64(i))
+	}
+	net.waitForTxs(4, 0)
+}
+
+func TestLeaderFailover(t *testing.T) {
+	net := newTestNetwork(t, testConfig(3))
+	defer net.stop()
+
+	net.stacks[0].submit(0)
+	net.waitForTxs(1, 0, 1, 2)
+
+	oldLeader := net.currentLeader()
+	net.isolate(oldLeader)
+	others := []uint64{}
+	for id := uint64(0); id < 3; id++ {
+		if id != oldLeader {
+			others = append(others, id)
+		}
+	}
+
+	// The transaction submitted to the deposed leader is never committed, those forwarded
+	// to it by the others are resubmitted to the new leader
+	net.stacks[oldLeader].submit(100)
+	for i := 1; i < 5; i++ {
+		net.stacks[others[i%2]].submit(int64(i))
+	}
+	net.waitForTxs(5, others...)
+	if leader := net.currentLeader(); leader == oldLeader {
+		t.Fatalf("Expected a new leader to be elected, replica %d is still leading", leader)
+	}
+
+	net.heal()
+	net.waitForTxs(5, 0, 1, 2)
+}
+
+func TestFailoverExecutesOnce(t *testing.T) {
+	net := newTestNetwork(t, testConfig(3))
+	defer net.stop()
+
+	net.stacks[0].submit(0)
+	net.waitForTxs(1, 0, 1, 2)
+
+	// The leader replicates a transaction forwarded by a follower to the other
+	// follower only, then fails
+	oldLeader := net.currentLeader()
+	forwarder, other := (oldLeader+1)%3, (oldLeader+2)%3
+	net.setFilter(func(src, dst uint64) bool {
+		return src != oldLeader || dst != forwarder
+	})
+	net.stacks[forwarder].submit(1)
+	net.waitForTx("1", oldLeader, other)
+	net.isolate(oldLeader)
+
+	// The forwarder resubmits the transaction to the new leader, which already holds it
+	net.stacks[forwarder].submit(2)
+	net.waitForTx("2", forwarder, other)
+
+	net.heal()
+	net.waitForTx("2", 0, 1, 2)
+	for id := uint64(0); id < 3; id++ {
+		for uuid, count := range net.stacks[id].executions() {
+			if count != 1 {
+				t.Errorf("Expected transaction %s to be executed once on replica %d, it was executed %d times", uuid, id, count)
+			}
+		}
+	}
+}
+
+func TestStateTransfer(t *testing.T) {
+	config := testConfig(3)
+	config.Set("general.batchsize", 1)
+	config.Set("general.logretention", 2)
+	config.Set("general.maxappend", 1)
+	net := newTestNetwork(t, config)
+	defer net.stop()
+
+	net.stacks[0].submit(0)
+	net.waitForTxs(1, 0, 1, 2)
+
+	leader := net.currentLeader()
+	lagging := (leader + 1) % 3
+	net.isolate(lagging)
+	for i := 1; i < 10; i++ {
+		net.stacks[leader].submit(int64(i))
+		net.waitForTxs(i+1, leader)
+	}
+
+	net.heal()
+	net.waitForTxs(10, 0, 1, 2)
+	net.stacks[lagging].mutex.Lock()
+	defer net.stacks[lagging].mutex.Unlock()
+	if net.stacks[lagging].stateUpdates == 0 {
+		t.Errorf("Expected replica %d to catch up through state transfer, as the leader compacted its log", lagging)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	net := newTestNetwork(t, testConfig(3))
+	defer net.stop()
+
+	for i := 0; i < 3; i++ {
+		net.stacks[0].submit(int64(i))
+	}
+	net.waitForTxs(3, 0, 1, 2)
+
+	leader := net.currentLeader()
+	restarted := (leader + 1) % 3
+	net.stacks[restarted].crash()
+	for i := 3; i < 6; i++ {
+		net.stacks[leader].submit(int64(i))
+	}
+	net.waitForTxs(6, leader)
+
+	net.stacks[restarted].start()
+	if term := net.stacks[restarted].node.term; term == 0 {
+		t.Errorf("Expected replica %d to restore its term", restarted)
+	}
+	net.waitForTxs(6, 0, 1, 2)
+}
+
+func TestLogRestore(t *testing.T) {
+	net := &testNetwork{}
+	stack := &testStack{net: net, persisted: make(map[string][]byte)}
+
+	log := newRaftLog(stack)
+	for i := uint64(1); i <= 5; i++ {
+		log.append(&Entry{Term: 1, Index: i})
+	}
+	log.append(&Entry{Term: 2, Index: 6})
+	log.compact(2)
+	log.truncate(5)
+	log.append(&Entry{Term: 3, Index: 5})
+
+	restored := newRaftLog(stack)
+	if restored.firstIndex() != 3 || restored.lastIndex() != 5 || restored.lastTerm() != 3 {
+		t.Fatalf("Expected restored log to hold entries 3 to 5 ending in term 3, got %d to %d ending in term %d",
+			restored.firstIndex(), restored.lastIndex(), restored.lastTerm())
+	}
+	if term, ok := restored.term(2); !ok || term != 1 {
+		t.Errorf("Expected the term of the compacted entry 2 to be known, got %d (%v)", term, ok)
+	}
+	if restored.entry(2) != nil {
+		t.Error("Expected compacted entry 2 to be gone")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consensus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// PluginFactory creates the Consenter of a consensus plugin on top of the given stack
+type PluginFactory func(stack Stack) Consenter
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]PluginFactory
+}{factories: make(map[string]PluginFactory)}
+
+// RegisterPlugin makes a consensus plugin available under the given (case-insensitive) name,
+// it is intended to be called from the init function of the plugin package
+func RegisterPlugin(name string, factory PluginFactory) {
+	name = strings.ToLower(name)
+	if factory == nil {
+		panic(fmt.Errorf("Consensus plugin %s registered without a factory", name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.factories[name]; ok {
+		panic(fmt.Errorf("Consensus plugin %s registered twice", name))
+	}
+	registry.factories[name] = factory
+}
+
+// GetPluginFactory returns the factory of the consensus plugin registered under the given name
+func GetPluginFactory(name string) (PluginFactory, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	factory, ok := registry.factories[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("Unknown consensus plugin %q, registered plugins are %v", name, registeredPlugins())
+	}
+	return factory, nil
+}
+
+// RegisteredPlugins returns the sorted names of all registered consensus plugins
+func RegisteredPlugins() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registeredPlugins()
+}
+
+func registeredPlugins() []string {
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadPluginConfig reads the configuration namespace of a consensus plugin: the config.yaml
+// file of consensus/<name>, whose keys may be overridden by CORE_<NAME>_ environment variables
+func LoadPluginConfig(name string) (*viper.Viper, error) {
+	name = strings.ToLower(name)
+	config := viper.New()
+
+	// for environment variables
+	config.SetEnvPrefix("CORE_" + strings.ToUpper(name))
+	config.AutomaticEnv()
+	replacer := strings.NewReplacer(".", "_")
+	config.SetEnvKeyReplacer(replacer)
+
+	config.SetConfigName("config")
+	config.AddConfigPath("./")
+	config.AddConfigPath(filepath.Join("../consensus", name))
+	config.AddConfigPath(filepath.Join("../../consensus", name))
+	// Path to look for the config file in based on GOPATH
+	gopath := os.Getenv("GOPATH")
+	for _, p := range filepath.SplitList(gopath) {
+		config.AddConfigPath(filepath.Join(p, "src/github.com/hyperledger/fabric/consensus", name))
+	}
+
+	if err := config.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("Error reading %s plugin config: %s", name, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consensus
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+type testConsenter struct{}
+
+func (tc *testConsenter) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error  { return nil }
+func (tc *testConsenter) Executed(tag interface{})                                {}
+func (tc *testConsenter) Committed(tag interface{}, target *pb.BlockchainInfo)    {}
+func (tc *testConsenter) RolledBack(tag interface{})                              {}
+func (tc *testConsenter) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {}
+
+func TestRegisterPlugin(t *testing.T) {
+	consenter := &testConsenter{}
+	RegisterPlugin("TestPlugin", func(stack Stack) Consenter { return consenter })
+
+	factory, err := GetPluginFactory("testplugin")
+	if err != nil {
+		t.Fatalf("Registered plugin was not found: %s", err)
+	}
+	if c := factory(nil); c != consenter {
+		t.Fatalf("Factory returned %v instead of the registered consenter", c)
+	}
+
+	if _, err = GetPluginFactory("unknown"); err == nil {
+		t.Fatalf("Expected an error for an unknown plugin")
+	}
+
+	found := false
+	for _, name := range RegisteredPlugins() {
+		if name == "testplugin" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Registered plugin missing from %v", RegisteredPlugins())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected registering the same name twice to panic")
+		}
+	}()
+	RegisterPlugin("testplugin", func(stack Stack) Consenter { return consenter })
+}
@@ -0,0 +1,203 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus/util/events"
+)
+
+// ------------------------------------------------------------
+//
+// Virtual clock
+//
+// ------------------------------------------------------------
+
+// scheduled is an action which runs once the virtual clock reaches its time
+type scheduled struct {
+	at  time.Duration
+	seq uint64 // breaks ties between actions scheduled for the same time, in scheduling order
+	fn  func()
+}
+
+type schedule []*scheduled
+
+func (s schedule) Len() int { return len(s) }
+func (s schedule) Less(i, j int) bool {
+	if s[i].at == s[j].at {
+		return s[i].seq < s[j].seq
+	}
+	return s[i].at < s[j].at
+}
+func (s schedule) Swap(i, j int)       { s[i], s[j] = s[j], s[i] }
+func (s *schedule) Push(x interface{}) { *s = append(*s, x.(*scheduled)) }
+func (s *schedule) Pop() interface{} {
+	old := *s
+	item := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return item
+}
+
+// clock is a virtual clock, time only advances when the next scheduled action runs
+type clock struct {
+	now     time.Duration
+	seq     uint64
+	pending schedule
+}
+
+// at schedules fn to run at virtual time t, or now if t has already passed
+func (c *clock) at(t time.Duration, fn func()) {
+	if t < c.now {
+		t = c.now
+	}
+	c.seq++
+	heap.Push(&c.pending, &scheduled{at: t, seq: c.seq, fn: fn})
+}
+
+// after schedules fn to run once d has elapsed
+func (c *clock) after(d time.Duration, fn func()) {
+	c.at(c.now+d, fn)
+}
+
+// step advances the clock to the next scheduled action, as long as it is not
+// later than until, and runs it; it returns false if there was none
+func (c *clock) step(until time.Duration) bool {
+	if len(c.pending) == 0 || c.pending[0].at > until {
+		return false
+	}
+	next := heap.Pop(&c.pending).(*scheduled)
+	c.now = next.at
+	next.fn()
+	return true
+}
+
+// ------------------------------------------------------------
+//
+// Event manager and timers
+//
+// ------------------------------------------------------------
+
+// managerQueueSize bounds the events a consenter may queue while handling
+// a single action, the simulator delivers them before running the next one
+const managerQueueSize = 1000
+
+// manager implements events.Manager without a thread of its own, queued
+// events are delivered by the simulator between scheduled actions
+type manager struct {
+	receiver events.Receiver
+	queue    chan events.Event
+	halted   bool
+}
+
+func newManager() *manager {
+	return &manager{queue: make(chan events.Event, managerQueueSize)}
+}
+
+// Inject delivers an event to the receiver immediately, unless the manager was halted
+func (m *manager) Inject(event events.Event) {
+	if m.halted || m.receiver == nil {
+		return
+	}
+	events.SendEvent(m.receiver, event)
+}
+
+// Queue returns the queue which is drained by the simulator
+func (m *manager) Queue() chan<- events.Event {
+	return m.queue
+}
+
+// SetReceiver sets the destination for events
+func (m *manager) SetReceiver(receiver events.Receiver) {
+	m.receiver = receiver
+}
+
+// Start is a no-op, events are delivered by the simulator
+func (m *manager) Start() {}
+
+// Halt discards all further events
+func (m *manager) Halt() {
+	m.halted = true
+}
+
+// drain delivers the queued events, it returns false if there were none
+func (m *manager) drain() bool {
+	drained := false
+	for {
+		select {
+		case event := <-m.queue:
+			drained = true
+			m.Inject(event)
+		default:
+			return drained
+		}
+	}
+}
+
+// timerFactory creates timers which count down on the virtual clock
+type timerFactory struct {
+	clock   *clock
+	manager *manager
+}
+
+// CreateTimer creates a stopped timer
+func (tf *timerFactory) CreateTimer() events.Timer {
+	return &timer{clock: tf.clock, manager: tf.manager}
+}
+
+// timer implements events.Timer on the virtual clock, each start or stop
+// bumps the generation so that a superseded countdown delivers nothing
+type timer struct {
+	clock      *clock
+	manager    *manager
+	generation uint64
+	running    bool
+}
+
+// SoftReset starts a new countdown, only if one is not already started
+func (t *timer) SoftReset(timeout time.Duration, event events.Event) {
+	if t.running {
+		return
+	}
+	t.Reset(timeout, event)
+}
+
+// Reset starts a new countdown, discarding the current one
+func (t *timer) Reset(timeout time.Duration, event events.Event) {
+	t.generation++
+	t.running = true
+	generation := t.generation
+	t.clock.after(timeout, func() {
+		if t.generation != generation {
+			return
+		}
+		t.running = false
+		t.manager.Inject(event)
+	})
+}
+
+// Stop discards the current countdown
+func (t *timer) Stop() {
+	t.generation++
+	t.running = false
+}
+
+// Halt discards the current countdown, the timer has no thread to stop
+func (t *timer) Halt() {
+	t.Stop()
+}
@@ -0,0 +1,188 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// LinkRule describes how the simulated network treats the messages sent
+// from one replica to another
+type LinkRule struct {
+	Delay     time.Duration // Latency of every message
+	Jitter    time.Duration // Additional random latency of up to this much, messages may overtake each other
+	Drop      float64       // Probability that a message is lost
+	Duplicate float64       // Probability that a message is delivered twice
+	Reorder   float64       // Probability that a message is held back for another Delay+Jitter, behind the messages sent after it
+}
+
+// Behavior lets a Byzantine replica tamper with its outgoing messages, it is
+// called for every message src sends to dst and returns the messages which are
+// sent instead; nil drops the message, several messages are all delivered
+type Behavior func(src, dst uint64, msg *pb.Message) []*pb.Message
+
+var behaviors = struct {
+	sync.RWMutex
+	registered map[string]Behavior
+}{registered: map[string]Behavior{
+	"silent": func(src, dst uint64, msg *pb.Message) []*pb.Message { return nil },
+}}
+
+// RegisterBehavior makes a Byzantine behavior available to scenarios under the
+// given (case-insensitive) name, behaviors which understand the messages of a
+// particular consensus plugin are expected to be registered by its tests
+func RegisterBehavior(name string, behavior Behavior) {
+	name = strings.ToLower(name)
+	if behavior == nil {
+		panic(fmt.Errorf("Behavior %s registered without a function", name))
+	}
+
+	behaviors.Lock()
+	defer behaviors.Unlock()
+	if _, ok := behaviors.registered[name]; ok {
+		panic(fmt.Errorf("Behavior %s registered twice", name))
+	}
+	behaviors.registered[name] = behavior
+}
+
+// GetBehavior returns the Byzantine behavior registered under the given name
+func GetBehavior(name string) (Behavior, error) {
+	behaviors.RLock()
+	defer behaviors.RUnlock()
+	behavior, ok := behaviors.registered[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(behaviors.registered))
+		for name := range behaviors.registered {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Unknown behavior %q, registered behaviors are %v", name, names)
+	}
+	return behavior, nil
+}
+
+// link is a directed connection between two replicas
+type link struct {
+	src, dst uint64
+}
+
+// network carries messages between the simulated replicas
+type network struct {
+	sim         *Simulator
+	seed        int64
+	defaultRule LinkRule
+	rules       map[link]LinkRule
+	cut         map[link]bool
+	rngs        map[link]*rand.Rand
+}
+
+func newNetwork(sim *Simulator, seed int64) *network {
+	return &network{
+		sim:   sim,
+		seed:  seed,
+		rules: make(map[link]LinkRule),
+		cut:   make(map[link]bool),
+		rngs:  make(map[link]*rand.Rand),
+	}
+}
+
+// rng returns the random source of a link, each link has its own so that
+// changing the traffic or rules of one link leaves the others unaffected
+func (n *network) rng(l link) *rand.Rand {
+	r, ok := n.rngs[l]
+	if !ok {
+		r = rand.New(rand.NewSource(n.seed ^ int64(l.src<<32|l.dst)))
+		n.rngs[l] = r
+	}
+	return r
+}
+
+func (n *network) rule(l link) LinkRule {
+	if rule, ok := n.rules[l]; ok {
+		return rule
+	}
+	return n.defaultRule
+}
+
+// send passes a message from src to dst through the Byzantine behavior of
+// src, if any, and the rule of the link
+func (n *network) send(src, dst uint64, msg *pb.Message) {
+	msgs := []*pb.Message{msg}
+	if behavior := n.sim.replicas[src].behavior; behavior != nil {
+		msgs = behavior(src, dst, msg)
+	}
+
+	l := link{src, dst}
+	if n.cut[l] {
+		logger.Debugf("Dropping message from replica %d to %d, the link is cut", src, dst)
+		return
+	}
+
+	rule := n.rule(l)
+	rng := n.rng(l)
+	for _, m := range msgs {
+		if rng.Float64() < rule.Drop {
+			logger.Debugf("Dropping message from replica %d to %d", src, dst)
+			continue
+		}
+		copies := 1
+		if rng.Float64() < rule.Duplicate {
+			copies = 2
+		}
+		for i := 0; i < copies; i++ {
+			delay := rule.Delay
+			if rule.Jitter > 0 {
+				delay += time.Duration(rng.Int63n(int64(rule.Jitter)))
+			}
+			if rng.Float64() < rule.Reorder {
+				delay += rule.Delay + rule.Jitter
+			}
+			m := m
+			n.sim.clock.after(delay, func() {
+				n.sim.replicas[dst].deliver(m, src)
+			})
+		}
+	}
+}
+
+// links returns all links from a replica in from to a different replica in to,
+// an empty list stands for all replicas
+func (n *network) links(from, to []uint64) []link {
+	all := n.sim.ids()
+	if len(from) == 0 {
+		from = all
+	}
+	if len(to) == 0 {
+		to = all
+	}
+	var links []link
+	for _, src := range from {
+		for _, dst := range to {
+			if src != dst {
+				links = append(links, link{src, dst})
+			}
+		}
+	}
+	return links
+}
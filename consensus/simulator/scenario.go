@@ -0,0 +1,249 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Scenario is a scripted simulation, usually read from a YAML file such as
+//
+//	replicas: 4
+//	seed: 7
+//	duration: 2m
+//	links: {delay: 10ms, jitter: 5ms}
+//	config:
+//	  general:
+//	    timeout: {request: 2s}
+//	steps:
+//	  - {at: 0s, submit: 10, to: 0}
+//	  - {at: 1s, isolate: [2]}
+//	  - {at: 31s, heal: true}
+//	  - {at: 31s, byzantine: equivocate, replicas: [0]}
+//	  - {at: 32s, submit: 10, to: 1}
+//
+// The transactions submitted by the steps must all be committed by the
+// correct replicas by the end of the run, unless liveness is set to false.
+type Scenario struct {
+	Replicas int           // Number of replicas, vp0 to vp(N-1)
+	Seed     int64         // Seed of all random choices made by the network
+	Duration time.Duration // Virtual time the scenario runs for
+	Liveness bool          // Whether to check liveness at the end of the run, true unless specified
+	Links    LinkRule      // Default rule for all links
+	Steps    []Step        // Actions, in any order, they are run at their time
+
+	// Configuration overrides for the consensus plugin, for the factory to
+	// apply; nested keys are flattened into the dotted form viper.Set accepts
+	Config map[string]interface{} `mapstructure:"-"`
+}
+
+// Step is a scripted action of a scenario, it may combine several actions,
+// which are run in the order of the fields
+type Step struct {
+	At        time.Duration // Virtual time of the step
+	Heal      bool          // Restore all cut links
+	Isolate   []uint64      // Cut the links between these replicas and the others
+	Partition [][]uint64    // Cut the links between these groups of replicas
+	Link      *LinkStep     // Change the rule of some links
+	Byzantine string        // Registered behavior the Replicas adopt
+	Replicas  []uint64      // Replicas which become Byzantine
+	Crash     []uint64      // Replicas which crash
+	Restart   []uint64      // Crashed replicas which restart
+	Submit    int           // Number of transactions to submit
+	To        uint64        // Replica the transactions are submitted to
+}
+
+// LinkStep changes the rule of the links from replicas in From to replicas
+// in To, empty lists stand for all replicas
+type LinkStep struct {
+	From     []uint64
+	To       []uint64
+	LinkRule `mapstructure:",squash"`
+}
+
+// LoadScenario reads a scenario from a YAML file
+func LoadScenario(path string) (*Scenario, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading scenario: %s", err)
+	}
+	defer file.Close()
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err = v.ReadConfig(file); err != nil {
+		return nil, fmt.Errorf("Error reading scenario %s: %s", path, err)
+	}
+
+	scenario := &Scenario{Liveness: true}
+	settings := v.AllSettings()
+	config := settings["config"]
+	delete(settings, "config")
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       mapstructure.StringToTimeDurationHookFunc(),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           scenario,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = decoder.Decode(settings); err != nil {
+		return nil, fmt.Errorf("Error decoding scenario %s: %s", path, err)
+	}
+
+	scenario.Config = make(map[string]interface{})
+	flatten("", config, scenario.Config)
+
+	if err = scenario.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid scenario %s: %s", path, err)
+	}
+	return scenario, nil
+}
+
+// flatten stores the leaves of nested maps under their dotted keys
+func flatten(prefix string, value interface{}, flat map[string]interface{}) {
+	switch nested := value.(type) {
+	case map[string]interface{}:
+		for key, v := range nested {
+			flatten(prefix+key+".", v, flat)
+		}
+	case map[interface{}]interface{}:
+		for key, v := range nested {
+			flatten(fmt.Sprintf("%s%v.", prefix, key), v, flat)
+		}
+	case nil:
+	default:
+		flat[prefix[:len(prefix)-1]] = value
+	}
+}
+
+func (s *Scenario) validate() error {
+	if s.Replicas <= 0 {
+		return fmt.Errorf("there must be at least one replica")
+	}
+	if s.Duration <= 0 {
+		return fmt.Errorf("the duration must be positive")
+	}
+	valid := func(ids []uint64) error {
+		for _, id := range ids {
+			if id >= uint64(s.Replicas) {
+				return fmt.Errorf("there is no replica %d in a network of %d", id, s.Replicas)
+			}
+		}
+		return nil
+	}
+	for i, step := range s.Steps {
+		lists := [][]uint64{step.Isolate, step.Replicas, step.Crash, step.Restart, {step.To}}
+		lists = append(lists, step.Partition...)
+		if step.Link != nil {
+			lists = append(lists, step.Link.From, step.Link.To)
+		}
+		for _, ids := range lists {
+			if err := valid(ids); err != nil {
+				return fmt.Errorf("step %d: %s", i, err)
+			}
+		}
+		if step.Byzantine != "" {
+			if _, err := GetBehavior(step.Byzantine); err != nil {
+				return fmt.Errorf("step %d: %s", i, err)
+			}
+		} else if len(step.Replicas) > 0 {
+			return fmt.Errorf("step %d: replicas are given without a byzantine behavior", i)
+		}
+	}
+	return nil
+}
+
+// Run simulates the scenario with the consenters created by factory, it
+// returns the first safety or liveness violation
+func (s *Scenario) Run(factory Factory) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	sim := New(s.Replicas, s.Seed, factory)
+	sim.SetDefaultLinkRule(s.Links)
+
+	// Steps scheduled for the same time run in the order of the scenario
+	var stepErr error
+	for i := range s.Steps {
+		step := s.Steps[i]
+		sim.At(step.At, func() {
+			if err := sim.runStep(&step); err != nil && stepErr == nil {
+				stepErr = fmt.Errorf("step at %v: %s", step.At, err)
+			}
+		})
+	}
+
+	if err := sim.RunFor(s.Duration); err != nil {
+		return err
+	}
+	if stepErr != nil {
+		return stepErr
+	}
+	if s.Liveness {
+		return sim.CheckLiveness()
+	}
+	return nil
+}
+
+func (sim *Simulator) runStep(step *Step) error {
+	if step.Heal {
+		sim.Heal()
+	}
+	if len(step.Isolate) > 0 {
+		sim.Isolate(step.Isolate...)
+	}
+	if len(step.Partition) > 0 {
+		sim.Partition(step.Partition...)
+	}
+	if step.Link != nil {
+		sim.SetLinkRule(step.Link.From, step.Link.To, step.Link.LinkRule)
+	}
+	if step.Byzantine != "" {
+		behavior, err := GetBehavior(step.Byzantine)
+		if err != nil {
+			return err
+		}
+		for _, id := range step.Replicas {
+			logger.Infof("Replica %d turns %s at %v", id, step.Byzantine, sim.Now())
+			if err := sim.SetBehavior(id, behavior); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range step.Crash {
+		if err := sim.Crash(id); err != nil {
+			return err
+		}
+	}
+	for _, id := range step.Restart {
+		if err := sim.Restart(id); err != nil {
+			return err
+		}
+	}
+	if step.Submit > 0 {
+		return sim.Submit(step.To, step.Submit)
+	}
+	return nil
+}
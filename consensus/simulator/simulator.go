@@ -0,0 +1,335 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package simulator runs the replicas of a consensus plugin on a simulated
+// network and ledger, driven by a virtual clock. Everything happens on the
+// calling goroutine, so a run is reproducible from its seed as long as the
+// consenter itself is deterministic. Faults are injected by cutting links,
+// by per-link drop, delay, reorder and duplicate rules, by crashing and
+// restarting replicas and by Byzantine behaviors which tamper with the
+// messages of a replica. Safety is checked on every commit, liveness once
+// the run is over.
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	gp "google/protobuf"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/op/go-logging"
+)
+
+var logger *logging.Logger // package-level logger
+
+func init() {
+	logger = logging.MustGetLogger("consensus/simulator")
+}
+
+// Factory creates the consenter of the simulated replica id on top of the
+// given stack. The consenter must process its events through manager and
+// create its timers from timers, rather than starting threads of its own;
+// it may implement Close() to release its resources when the replica crashes.
+type Factory func(id uint64, stack consensus.Stack, manager events.Manager, timers events.TimerFactory) consensus.Consenter
+
+// Simulator is a simulated network of replicas
+type Simulator struct {
+	ExecutionDelay     time.Duration // How long the simulated ledger takes to execute, commit or roll back
+	StateTransferDelay time.Duration // How long the simulated ledger takes to transfer state
+
+	factory  Factory
+	clock    *clock
+	network  *network
+	replicas []*replica
+
+	heights   map[uint64]committedBlock // the first block committed at every height by a correct replica
+	violation error                     // the first safety violation
+	submitted []string                  // the UUIDs of all submitted transactions
+	rejected  map[string]string         // the reasons replicas gave for rejecting transactions, by UUID
+	evidence  []*pb.ConsensusEvidence   // the evidence of misbehavior replicas reported
+}
+
+type committedBlock struct {
+	hash    []byte
+	replica uint64
+}
+
+// New creates a network of n replicas running the consenters created by
+// factory, the seed determines all random choices of the network
+func New(n int, seed int64, factory Factory) *Simulator {
+	sim := &Simulator{
+		ExecutionDelay:     time.Millisecond,
+		StateTransferDelay: 100 * time.Millisecond,
+		factory:            factory,
+		clock:              &clock{},
+		heights:            make(map[uint64]committedBlock),
+		rejected:           make(map[string]string),
+	}
+	sim.network = newNetwork(sim, seed)
+	for i := 0; i < n; i++ {
+		sim.replicas = append(sim.replicas, newReplica(sim, uint64(i)))
+	}
+	for _, r := range sim.replicas {
+		r.start()
+	}
+	sim.drain()
+	return sim
+}
+
+func (sim *Simulator) ids() []uint64 {
+	ids := make([]uint64, len(sim.replicas))
+	for i := range ids {
+		ids[i] = uint64(i)
+	}
+	return ids
+}
+
+func (sim *Simulator) replica(id uint64) (*replica, error) {
+	if id >= uint64(len(sim.replicas)) {
+		return nil, fmt.Errorf("there is no replica %d in a network of %d", id, len(sim.replicas))
+	}
+	return sim.replicas[id], nil
+}
+
+// Now returns the virtual time elapsed since the simulator was created
+func (sim *Simulator) Now() time.Duration {
+	return sim.clock.now
+}
+
+// At schedules an action, such as injecting a fault, at virtual time t
+func (sim *Simulator) At(t time.Duration, action func()) {
+	sim.clock.at(t, action)
+}
+
+// RunFor advances the virtual clock by d, running everything scheduled in the
+// meantime; it stops early, and returns the violation, if safety is violated
+func (sim *Simulator) RunFor(d time.Duration) error {
+	until := sim.clock.now + d
+	for sim.violation == nil && sim.clock.step(until) {
+		sim.drain()
+	}
+	if sim.violation == nil {
+		sim.clock.now = until
+	}
+	return sim.violation
+}
+
+// drain delivers the events the consenters queued, in replica order, until there are none left
+func (sim *Simulator) drain() {
+	for drained := true; drained; {
+		drained = false
+		for _, r := range sim.replicas {
+			if r.manager.drain() {
+				drained = true
+			}
+		}
+	}
+}
+
+// --------------------------------------------------------------
+//
+// Fault injection
+//
+// --------------------------------------------------------------
+
+// SetLinkRule applies a rule to the links from every replica in from to every
+// replica in to, an empty list stands for all replicas
+func (sim *Simulator) SetLinkRule(from, to []uint64, rule LinkRule) {
+	for _, l := range sim.network.links(from, to) {
+		sim.network.rules[l] = rule
+	}
+}
+
+// SetDefaultLinkRule applies a rule to all links which have no rule of their own
+func (sim *Simulator) SetDefaultLinkRule(rule LinkRule) {
+	sim.network.defaultRule = rule
+}
+
+// Isolate cuts all links between the given replicas and the others
+func (sim *Simulator) Isolate(ids ...uint64) {
+	isolated := make(map[uint64]bool)
+	for _, id := range ids {
+		isolated[id] = true
+	}
+	for _, l := range sim.network.links(nil, nil) {
+		if isolated[l.src] != isolated[l.dst] {
+			sim.network.cut[l] = true
+		}
+	}
+}
+
+// Partition cuts all links between replicas in different groups, replicas
+// which are in no group are cut off from all others
+func (sim *Simulator) Partition(groups ...[]uint64) {
+	group := make(map[uint64]int)
+	for i, ids := range groups {
+		for _, id := range ids {
+			group[id] = i + 1
+		}
+	}
+	for _, l := range sim.network.links(nil, nil) {
+		if group[l.src] == 0 || group[l.src] != group[l.dst] {
+			sim.network.cut[l] = true
+		}
+	}
+}
+
+// Heal restores all cut links, link rules stay in place
+func (sim *Simulator) Heal() {
+	sim.network.cut = make(map[link]bool)
+}
+
+// SetBehavior makes a replica Byzantine, from now on its outgoing messages
+// pass through behavior, and it is exempt from the safety and liveness checks
+func (sim *Simulator) SetBehavior(id uint64, behavior Behavior) error {
+	r, err := sim.replica(id)
+	if err != nil {
+		return err
+	}
+	r.behavior = behavior
+	r.byzantine = true
+	return nil
+}
+
+// Crash stops a replica, it loses everything its consenter did not persist
+func (sim *Simulator) Crash(id uint64) error {
+	r, err := sim.replica(id)
+	if err != nil {
+		return err
+	}
+	if r.crashed {
+		return fmt.Errorf("replica %d has already crashed", id)
+	}
+	logger.Infof("Crashing replica %d at %v", id, sim.Now())
+	r.crash()
+	return nil
+}
+
+// Restart creates a new consenter for a crashed replica
+func (sim *Simulator) Restart(id uint64) error {
+	r, err := sim.replica(id)
+	if err != nil {
+		return err
+	}
+	if !r.crashed {
+		return fmt.Errorf("replica %d has not crashed", id)
+	}
+	logger.Infof("Restarting replica %d at %v", id, sim.Now())
+	r.start()
+	sim.drain()
+	return nil
+}
+
+// Submit sends count new transactions to a replica, as a client would
+func (sim *Simulator) Submit(id uint64, count int) error {
+	r, err := sim.replica(id)
+	if err != nil {
+		return err
+	}
+	if r.crashed {
+		return fmt.Errorf("cannot submit to replica %d, it has crashed", id)
+	}
+	for i := 0; i < count; i++ {
+		now := sim.Now()
+		tx := &pb.Transaction{
+			Type:      pb.Transaction_CHAINCODE_INVOKE,
+			Uuid:      fmt.Sprintf("tx%d", len(sim.submitted)),
+			Timestamp: &gp.Timestamp{Seconds: int64(now / time.Second), Nanos: int32(now % time.Second)},
+		}
+		tx.Payload = []byte(tx.Uuid)
+		txPacked, err := proto.Marshal(tx)
+		if err != nil {
+			return err
+		}
+		sim.submitted = append(sim.submitted, tx.Uuid)
+		r.deliver(&pb.Message{Type: pb.Message_CHAIN_TRANSACTION, Payload: txPacked}, id)
+		sim.drain()
+	}
+	return nil
+}
+
+// --------------------------------------------------------------
+//
+// Checks
+//
+// --------------------------------------------------------------
+
+// committed records the hash of a block committed by a replica, correct
+// replicas must all commit the same block at every height
+func (sim *Simulator) committed(r *replica, height uint64, hash []byte) {
+	if r.byzantine || sim.violation != nil {
+		return
+	}
+	first, ok := sim.heights[height]
+	if !ok {
+		sim.heights[height] = committedBlock{hash, r.id}
+		return
+	}
+	if !bytes.Equal(first.hash, hash) {
+		sim.violation = fmt.Errorf("safety violated at %v: replica %d committed block %d with hash %x, but replica %d committed %x",
+			sim.Now(), r.id, height, hash, first.replica, first.hash)
+		logger.Error(sim.violation.Error())
+	}
+}
+
+// CheckSafety returns the first safety violation, if any
+func (sim *Simulator) CheckSafety() error {
+	return sim.violation
+}
+
+// CheckLiveness returns an error unless every correct replica which is
+// running has committed all submitted transactions which were not rejected
+func (sim *Simulator) CheckLiveness() error {
+	var accepted []string
+	for _, uuid := range sim.submitted {
+		if _, ok := sim.rejected[uuid]; !ok {
+			accepted = append(accepted, uuid)
+		}
+	}
+	var stuck []string
+	for _, r := range sim.replicas {
+		if !r.correct() {
+			continue
+		}
+		if missing := r.missing(accepted); len(missing) > 0 {
+			stuck = append(stuck, fmt.Sprintf("replica %d is missing %d (%s...)", r.id, len(missing), missing[0]))
+		}
+	}
+	if len(stuck) > 0 {
+		return fmt.Errorf("liveness violated at %v, of %d submitted transactions %v", sim.Now(), len(sim.submitted), stuck)
+	}
+	return nil
+}
+
+// Rejected returns the reasons replicas gave for rejecting transactions, by UUID
+func (sim *Simulator) Rejected() map[string]string {
+	return sim.rejected
+}
+
+// Evidence returns the evidence of misbehavior the replicas reported, in the order they reported it
+func (sim *Simulator) Evidence() []*pb.ConsensusEvidence {
+	return sim.evidence
+}
+
+// Height returns the number of blocks in the ledger of a replica, including the genesis block
+func (sim *Simulator) Height(id uint64) uint64 {
+	return sim.replicas[id].height()
+}
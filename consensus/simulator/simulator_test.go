@@ -0,0 +1,332 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/consensus/util/events"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// sequencer is a minimal consenter, replica 0 numbers every transaction and
+// broadcasts it, all replicas apply the transactions in the order of their
+// numbers; there are no retransmissions, a lost message stalls the replica
+type sequencer struct {
+	id      uint64
+	stack   consensus.Stack
+	manager events.Manager
+	next    uint64            // number of the next transaction to apply
+	pending map[uint64][]byte // transactions received ahead of their turn
+}
+
+func newSequencer(id uint64, stack consensus.Stack, manager events.Manager, timers events.TimerFactory) consensus.Consenter {
+	s := &sequencer{id: id, stack: stack, manager: manager, pending: make(map[uint64][]byte)}
+	manager.SetReceiver(s)
+	return s
+}
+
+func (s *sequencer) RecvMsg(msg *pb.Message, senderHandle *pb.PeerID) error {
+	s.manager.Queue() <- msg
+	return nil
+}
+
+func (s *sequencer) ProcessEvent(event events.Event) events.Event {
+	msg := event.(*pb.Message)
+	if msg.Type == pb.Message_CHAIN_TRANSACTION {
+		if s.id != 0 {
+			s.stack.Unicast(msg, &pb.PeerID{Name: "vp0"})
+			return nil
+		}
+		numbered := make([]byte, 8, 8+len(msg.Payload))
+		binary.BigEndian.PutUint64(numbered, s.next+uint64(len(s.pending)))
+		msg = &pb.Message{Type: pb.Message_CONSENSUS, Payload: append(numbered, msg.Payload...)}
+		s.stack.Broadcast(msg, pb.PeerEndpoint_VALIDATOR)
+	}
+	if n := binary.BigEndian.Uint64(msg.Payload); n >= s.next {
+		s.pending[n] = msg.Payload[8:]
+	}
+	for txRaw, ok := s.pending[s.next]; ok; txRaw, ok = s.pending[s.next] {
+		delete(s.pending, s.next)
+		s.next++
+		tx := &pb.Transaction{}
+		proto.Unmarshal(txRaw, tx)
+		s.stack.ExecTxs(nil, []*pb.Transaction{tx})
+		s.stack.CommitTxBatch(nil, nil)
+	}
+	return nil
+}
+
+func (s *sequencer) Executed(tag interface{})                                {}
+func (s *sequencer) Committed(tag interface{}, target *pb.BlockchainInfo)    {}
+func (s *sequencer) RolledBack(tag interface{})                              {}
+func (s *sequencer) StateUpdated(tag interface{}, target *pb.BlockchainInfo) {}
+
+type recorder struct {
+	events []events.Event
+}
+
+func (r *recorder) ProcessEvent(event events.Event) events.Event {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestClock(t *testing.T) {
+	c := &clock{}
+	var order []int
+	c.at(2*time.Second, func() { order = append(order, 3) })
+	c.at(time.Second, func() { order = append(order, 1) })
+	c.at(time.Second, func() {
+		order = append(order, 2)
+		c.after(0, func() { order = append(order, 4) })
+	})
+
+	for c.step(time.Second) {
+	}
+	if !reflect.DeepEqual(order, []int{1, 2, 4}) || c.now != time.Second {
+		t.Fatalf("Expected actions 1, 2 and 4 to run by 1s, ran %v by %v", order, c.now)
+	}
+	for c.step(time.Minute) {
+	}
+	if !reflect.DeepEqual(order, []int{1, 2, 4, 3}) || c.now != 2*time.Second {
+		t.Fatalf("Expected action 3 to run at 2s, ran %v by %v", order, c.now)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	c := &clock{}
+	m := newManager()
+	r := &recorder{}
+	m.SetReceiver(r)
+	timer := (&timerFactory{clock: c, manager: m}).CreateTimer()
+
+	timer.Reset(time.Second, "first")
+	timer.SoftReset(time.Millisecond, "ignored")
+	timer.Reset(2*time.Second, "second")
+	for c.step(time.Minute) {
+	}
+	if !reflect.DeepEqual(r.events, []events.Event{"second"}) || c.now != 2*time.Second {
+		t.Fatalf("Expected only the reset countdown to fire at 2s, got %v at %v", r.events, c.now)
+	}
+
+	timer.SoftReset(time.Second, "stopped")
+	timer.Stop()
+	timer.SoftReset(time.Second, "third")
+	for c.step(time.Minute) {
+	}
+	if len(r.events) != 2 || r.events[1] != "third" {
+		t.Fatalf("Expected the stopped countdown to be discarded, got %v", r.events)
+	}
+
+	m.Halt()
+	timer.Reset(time.Second, "halted")
+	for c.step(time.Minute) {
+	}
+	if len(r.events) != 2 {
+		t.Fatalf("Expected no events after the manager halted, got %v", r.events)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	sim := New(4, 1, newSequencer)
+	sim.SetDefaultLinkRule(LinkRule{Delay: 10 * time.Millisecond, Jitter: 10 * time.Millisecond, Duplicate: 0.5, Reorder: 0.5})
+	sim.Submit(0, 3)
+	sim.Submit(2, 3)
+
+	if err := sim.RunFor(time.Second); err != nil {
+		t.Fatalf("Unexpected safety violation: %s", err)
+	}
+	if err := sim.CheckLiveness(); err != nil {
+		t.Fatalf("Expected all transactions to be committed: %s", err)
+	}
+	for id := uint64(0); id < 4; id++ {
+		if h := sim.Height(id); h != 7 {
+			t.Errorf("Expected replica %d to have 7 blocks, has %d", id, h)
+		}
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	run := func(seed int64) [][][]byte {
+		sim := New(4, seed, newSequencer)
+		sim.SetDefaultLinkRule(LinkRule{Delay: 10 * time.Millisecond, Jitter: 50 * time.Millisecond, Drop: 0.05, Duplicate: 0.2, Reorder: 0.2})
+		for i := 0; i < 20; i++ {
+			sim.At(time.Duration(i)*time.Millisecond, func() { sim.Submit(1, 1) })
+		}
+		sim.RunFor(time.Second)
+		var hashes [][][]byte
+		for _, r := range sim.replicas {
+			hashes = append(hashes, r.hashes)
+		}
+		return hashes
+	}
+
+	first := run(42)
+	if second := run(42); !reflect.DeepEqual(first, second) {
+		t.Fatalf("Expected two runs with the same seed to commit the same blocks")
+	}
+	if other := run(43); reflect.DeepEqual(first, other) {
+		t.Fatalf("Expected runs with different seeds to commit different blocks")
+	}
+}
+
+func TestIsolateAndHeal(t *testing.T) {
+	sim := New(3, 1, newSequencer)
+	sim.Isolate(2)
+	sim.Submit(0, 1)
+	sim.RunFor(time.Second)
+	if err := sim.CheckLiveness(); err == nil {
+		t.Fatalf("Expected replica 2 to miss the transaction while isolated")
+	}
+
+	sim.Heal()
+	sim.Submit(2, 1)
+	sim.RunFor(time.Second)
+	if sim.Height(2) != 1 || sim.Height(1) != 3 {
+		t.Fatalf("Expected replica 2 to stall on the transaction it missed, heights are %d and %d", sim.Height(2), sim.Height(1))
+	}
+}
+
+func TestSafetyViolation(t *testing.T) {
+	sim := New(3, 1, newSequencer)
+	sim.SetBehavior(0, func(src, dst uint64, msg *pb.Message) []*pb.Message {
+		if dst != 2 {
+			return []*pb.Message{msg}
+		}
+		tx := &pb.Transaction{}
+		proto.Unmarshal(msg.Payload[8:], tx)
+		tx.Uuid = "forged"
+		forged, _ := proto.Marshal(tx)
+		return []*pb.Message{{Type: msg.Type, Payload: append(msg.Payload[:8:8], forged...)}}
+	})
+	sim.Submit(0, 1)
+
+	err := sim.RunFor(time.Second)
+	if err == nil || err != sim.CheckSafety() {
+		t.Fatalf("Expected replicas 1 and 2 to commit diverging blocks")
+	}
+}
+
+func TestCrashRestart(t *testing.T) {
+	sim := New(3, 1, newSequencer)
+	sim.Submit(0, 1)
+	sim.RunFor(time.Second)
+
+	if err := sim.Crash(1); err != nil {
+		t.Fatalf("Could not crash replica 1: %s", err)
+	}
+	if err := sim.Submit(1, 1); err == nil {
+		t.Fatalf("Expected submitting to a crashed replica to fail")
+	}
+	sim.Submit(0, 1)
+	sim.RunFor(time.Second)
+	if err := sim.CheckLiveness(); err != nil {
+		t.Fatalf("Expected the crashed replica to be exempt from the liveness check: %s", err)
+	}
+
+	if err := sim.Restart(1); err != nil {
+		t.Fatalf("Could not restart replica 1: %s", err)
+	}
+	if sim.Height(1) != 2 {
+		t.Fatalf("Expected replica 1 to keep its ledger across the crash, it has %d blocks", sim.Height(1))
+	}
+	if err := sim.CheckLiveness(); err == nil {
+		t.Fatalf("Expected replica 1 to miss the transaction submitted while it was down")
+	}
+}
+
+func TestStateTransfer(t *testing.T) {
+	sim := New(3, 1, newSequencer)
+	sim.Isolate(2)
+	sim.Submit(0, 2)
+	sim.RunFor(time.Second)
+	target := sim.replicas[0].GetBlockchainInfo()
+
+	sim.replicas[2].UpdateState(nil, target, []*pb.PeerID{{Name: "vp1"}})
+	sim.RunFor(time.Second)
+	if sim.Height(2) != 1 {
+		t.Fatalf("Expected the state transfer to fail while replica 2 is isolated")
+	}
+
+	sim.Heal()
+	sim.replicas[2].UpdateState(nil, target, []*pb.PeerID{{Name: "vp1"}})
+	sim.RunFor(time.Second)
+	if !bytes.Equal(sim.replicas[2].GetBlockchainInfo().CurrentBlockHash, target.CurrentBlockHash) {
+		t.Fatalf("Expected replica 2 to transfer state up to height %d, it is at %d", target.Height, sim.Height(2))
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	file, err := ioutil.TempFile("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`
+replicas: 4
+seed: 3
+duration: 1m
+links: {delay: 10ms, drop: 0.1}
+config:
+    general:
+        timeout: {request: 2s}
+steps:
+    - {at: 500ms, submit: 2, to: 1}
+    - {at: 1s, partition: [[0, 1], [2, 3]]}
+    - {at: 2s, heal: true, link: {from: [1], delay: 1s}}
+    - {at: 3s, byzantine: silent, replicas: [3]}
+`)
+	file.Close()
+
+	scenario, err := LoadScenario(file.Name())
+	if err != nil {
+		t.Fatalf("Could not load scenario: %s", err)
+	}
+	if scenario.Replicas != 4 || scenario.Seed != 3 || scenario.Duration != time.Minute || !scenario.Liveness {
+		t.Errorf("Scenario settings were not loaded: %+v", scenario)
+	}
+	if scenario.Links != (LinkRule{Delay: 10 * time.Millisecond, Drop: 0.1}) {
+		t.Errorf("Default link rule was not loaded: %+v", scenario.Links)
+	}
+	if scenario.Config["general.timeout.request"] != "2s" {
+		t.Errorf("Configuration overrides were not flattened: %v", scenario.Config)
+	}
+	if len(scenario.Steps) != 4 || scenario.Steps[0].At != 500*time.Millisecond || scenario.Steps[0].To != 1 ||
+		!reflect.DeepEqual(scenario.Steps[1].Partition, [][]uint64{{0, 1}, {2, 3}}) ||
+		!scenario.Steps[2].Heal || scenario.Steps[2].Link.Delay != time.Second || !reflect.DeepEqual(scenario.Steps[2].Link.From, []uint64{1}) ||
+		scenario.Steps[3].Byzantine != "silent" {
+		t.Errorf("Steps were not loaded: %+v", scenario.Steps)
+	}
+
+	if err = scenario.Run(newSequencer); err != nil {
+		t.Errorf("Expected the scenario to succeed: %s", err)
+	}
+
+	scenario.Steps = append(scenario.Steps, Step{Crash: []uint64{4}})
+	if err = scenario.Run(newSequencer); err == nil {
+		t.Errorf("Expected a step naming an unknown replica to be rejected")
+	}
+}
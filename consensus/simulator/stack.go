@@ -0,0 +1,433 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+                 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/consensus"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// replica is a simulated validating peer, it implements the consensus.Stack
+// of its consenter on top of the simulated network and an in-memory ledger
+type replica struct {
+	sim    *Simulator
+	id     uint64
+	handle *pb.PeerID
+
+	consenter consensus.Consenter
+	manager   *manager
+	crashed   bool
+	epoch     uint64 // incremented on every crash, to discard the callbacks of the previous incarnation
+
+	behavior  Behavior // nil unless the replica is Byzantine
+	byzantine bool
+
+	blocks    []*pb.Block // the committed blocks, survive crashes
+	hashes    [][]byte
+	executing []*pb.Transaction // executed but not yet committed, lost on crash
+	persisted map[string][]byte // consensus state, survives crashes
+}
+
+func newReplica(sim *Simulator, id uint64) *replica {
+	r := &replica{
+		sim:       sim,
+		id:        id,
+		handle:    replicaHandle(id),
+		persisted: make(map[string][]byte),
+	}
+	r.appendBlock(pb.NewBlock(nil, nil)) // genesis
+	return r
+}
+
+func replicaHandle(id uint64) *pb.PeerID {
+	return &pb.PeerID{Name: "vp" + strconv.FormatUint(id, 10)}
+}
+
+func (r *replica) replicaID(handle *pb.PeerID) (uint64, error) {
+	if handle != nil && strings.HasPrefix(handle.Name, "vp") {
+		if id, err := strconv.ParseUint(handle.Name[2:], 10, 64); err == nil && id < uint64(len(r.sim.replicas)) {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("replica %d: unknown peer %v", r.id, handle)
+}
+
+// start creates a new incarnation of the consenter, on top of the ledger and
+// persisted state left by the previous one, if any
+func (r *replica) start() {
+	r.crashed = false
+	r.manager = newManager()
+	r.consenter = r.sim.factory(r.id, r, r.manager, &timerFactory{clock: r.sim.clock, manager: r.manager})
+	r.manager.Start()
+}
+
+// crash stops the consenter, losing everything it did not persist
+func (r *replica) crash() {
+	if closer, ok := r.consenter.(interface {
+		Close()
+	}); ok {
+		closer.Close()
+	}
+	r.manager.Halt()
+	r.crashed = true
+	r.epoch++
+	r.executing = nil
+}
+
+// after schedules a callback of the stack to the consenter, it is discarded
+// if the replica crashes in the meantime
+func (r *replica) after(d time.Duration, fn func()) {
+	epoch := r.epoch
+	r.sim.clock.after(d, func() {
+		if r.crashed || r.epoch != epoch {
+			return
+		}
+		fn()
+	})
+}
+
+// deliver hands a message from the network to the consenter
+func (r *replica) deliver(msg *pb.Message, src uint64) {
+	if r.crashed {
+		return
+	}
+	if err := r.consenter.RecvMsg(msg, replicaHandle(src)); err != nil {
+		logger.Warningf("Replica %d could not receive message from replica %d: %s", r.id, src, err)
+	}
+}
+
+// correct returns whether the replica is expected to satisfy safety and liveness
+func (r *replica) correct() bool {
+	return !r.byzantine && !r.crashed
+}
+
+// --------------------------------------------------------------
+//
+// Ledger
+//
+// --------------------------------------------------------------
+
+func (r *replica) height() uint64 {
+	return uint64(len(r.blocks))
+}
+
+func (r *replica) appendBlock(block *pb.Block) {
+	hash, err := block.GetHash()
+	if err != nil {
+		panic(fmt.Errorf("replica %d cannot hash block: %s", r.id, err))
+	}
+	r.blocks = append(r.blocks, block)
+	r.hashes = append(r.hashes, hash)
+	if len(r.blocks) > 1 {
+		r.sim.committed(r, r.height()-1, hash)
+	}
+}
+
+// nextBlock builds the block which committing the executed transactions would append
+func (r *replica) nextBlock(metadata []byte) *pb.Block {
+	last := r.blocks[len(r.blocks)-1]
+	stateHash := last.StateHash
+	for _, tx := range r.executing {
+		stateHash = util.ComputeCryptoHash(append(append([]byte{}, stateHash...), tx.Uuid...))
+	}
+	block := pb.NewBlock(r.executing, metadata)
+	block.PreviousBlockHash = r.hashes[len(r.hashes)-1]
+	block.StateHash = stateHash
+	return block
+}
+
+func (r *replica) commit(metadata []byte) *pb.Block {
+	block := r.nextBlock(metadata)
+	r.executing = nil
+	r.appendBlock(block)
+	return block
+}
+
+// missing returns the transactions from uuids which the ledger does not contain
+func (r *replica) missing(uuids []string) []string {
+	found := make(map[string]bool)
+	for _, block := range r.blocks {
+		for _, tx := range block.Transactions {
+			found[tx.Uuid] = true
+		}
+	}
+	var missing []string
+	for _, uuid := range uuids {
+		if !found[uuid] {
+			missing = append(missing, uuid)
+		}
+	}
+	return missing
+}
+
+// --------------------------------------------------------------
+//
+// consensus.Stack
+//
+// --------------------------------------------------------------
+
+// GetNetworkInfo returns the endpoints of this replica and of all replicas
+func (r *replica) GetNetworkInfo() (self *pb.PeerEndpoint, network []*pb.PeerEndpoint, err error) {
+	selfHandle, handles, _ := r.GetNetworkHandles()
+	self = &pb.PeerEndpoint{ID: selfHandle, Type: pb.PeerEndpoint_VALIDATOR}
+	for _, handle := range handles {
+		network = append(network, &pb.PeerEndpoint{ID: handle, Type: pb.PeerEndpoint_VALIDATOR})
+	}
+	return
+}
+
+// GetNetworkHandles returns the handles of this replica and of all replicas
+func (r *replica) GetNetworkHandles() (self *pb.PeerID, network []*pb.PeerID, err error) {
+	for _, id := range r.sim.ids() {
+		network = append(network, replicaHandle(id))
+	}
+	return r.handle, network, nil
+}
+
+// Broadcast sends a message to all other replicas, in replica order
+func (r *replica) Broadcast(msg *pb.Message, peerType pb.PeerEndpoint_Type) error {
+	if r.crashed {
+		return fmt.Errorf("replica %d has crashed", r.id)
+	}
+	for _, id := range r.sim.ids() {
+		if id != r.id {
+			r.sim.network.send(r.id, id, msg)
+		}
+	}
+	return nil
+}
+
+// Unicast sends a message to another replica
+func (r *replica) Unicast(msg *pb.Message, receiverHandle *pb.PeerID) error {
+	if r.crashed {
+		return fmt.Errorf("replica %d has crashed", r.id)
+	}
+	dst, err := r.replicaID(receiverHandle)
+	if err != nil {
+		return err
+	}
+	r.sim.network.send(r.id, dst, msg)
+	return nil
+}
+
+// Sign returns a signature which Verify only accepts as coming from this replica
+func (r *replica) Sign(msg []byte) ([]byte, error) {
+	return signature(r.handle, msg), nil
+}
+
+// Verify checks a signature returned by Sign
+func (r *replica) Verify(peerID *pb.PeerID, sig []byte, msg []byte) error {
+	if !bytes.Equal(sig, signature(peerID, msg)) {
+		return fmt.Errorf("replica %d: invalid signature from %v", r.id, peerID)
+	}
+	return nil
+}
+
+func signature(peerID *pb.PeerID, msg []byte) []byte {
+	return util.ComputeCryptoHash(append([]byte(peerID.Name+":"), msg...))
+}
+
+// SessionKey returns a key only known to this replica and the given one
+func (r *replica) SessionKey(peerID *pb.PeerID) ([]byte, error) {
+	names := []string{r.handle.Name, peerID.Name}
+	sort.Strings(names)
+	return util.ComputeCryptoHash([]byte(strings.Join(names, ":"))), nil
+}
+
+// RejectTransaction records that the consenter refused to order a transaction
+func (r *replica) RejectTransaction(tx *pb.Transaction, reason string) {
+	logger.Infof("Replica %d rejected transaction %s: %s", r.id, tx.Uuid, reason)
+	r.sim.rejected[tx.Uuid] = reason
+}
+
+// ReportEvidence records the evidence of a misbehaving replica found by the consenter
+func (r *replica) ReportEvidence(evidence *pb.ConsensusEvidence) {
+	logger.Infof("Replica %d found evidence against replica %d: %s", r.id, evidence.ReplicaId, evidence.Description)
+	r.sim.evidence = append(r.sim.evidence, evidence)
+}
+
+// Start is a no-op, the simulated executor needs no resources
+func (r *replica) Start() {}
+
+// Halt is a no-op, the simulated executor needs no resources
+func (r *replica) Halt() {}
+
+// Execute executes the transactions, and calls back after the execution delay
+func (r *replica) Execute(tag interface{}, txs []*pb.Transaction) {
+	r.executing = append(r.executing, txs...)
+	r.after(r.sim.ExecutionDelay, func() {
+		r.consenter.Executed(tag)
+	})
+}
+
+// Commit appends the executed transactions to the ledger as a block
+func (r *replica) Commit(tag interface{}, metadata []byte) {
+	r.commit(metadata)
+	info := r.GetBlockchainInfo()
+	r.after(r.sim.ExecutionDelay, func() {
+		r.consenter.Committed(tag, info)
+	})
+}
+
+// Rollback discards the executed transactions
+func (r *replica) Rollback(tag interface{}) {
+	r.executing = nil
+	r.after(r.sim.ExecutionDelay, func() {
+		r.consenter.RolledBack(tag)
+	})
+}
+
+// UpdateState copies the blocks up to the target from the first of the peers
+// which is reachable and has them, it reports a nil target if there is none
+func (r *replica) UpdateState(tag interface{}, target *pb.BlockchainInfo, peers []*pb.PeerID) {
+	r.executing = nil
+	r.after(r.sim.StateTransferDelay, func() {
+		for _, peer := range peers {
+			id, err := r.replicaID(peer)
+			if err != nil || id == r.id {
+				continue
+			}
+			src := r.sim.replicas[id]
+			if src.crashed || r.sim.network.cut[link{id, r.id}] || src.height() < target.Height || target.Height == 0 {
+				continue
+			}
+			if !bytes.Equal(src.hashes[target.Height-1], target.CurrentBlockHash) {
+				continue
+			}
+			logger.Debugf("Replica %d transferring state to height %d from replica %d", r.id, target.Height, id)
+			keep := uint64(1)
+			for keep < r.height() && keep < target.Height && bytes.Equal(r.hashes[keep], src.hashes[keep]) {
+				keep++
+			}
+			r.blocks, r.hashes = r.blocks[:keep], r.hashes[:keep]
+			for i := r.height(); i < target.Height; i++ {
+				r.appendBlock(src.blocks[i])
+			}
+			r.consenter.StateUpdated(tag, r.GetBlockchainInfo())
+			return
+		}
+		logger.Warningf("Replica %d found no peer to transfer state to height %d from", r.id, target.Height)
+		r.consenter.StateUpdated(tag, nil)
+	})
+}
+
+// BeginTxBatch is a no-op
+func (r *replica) BeginTxBatch(id interface{}) error {
+	return nil
+}
+
+// ExecTxs executes the transactions synchronously
+func (r *replica) ExecTxs(id interface{}, txs []*pb.Transaction) ([]byte, error) {
+	r.executing = append(r.executing, txs...)
+	return r.nextBlock(nil).StateHash, nil
+}
+
+// CommitTxBatch appends the executed transactions to the ledger as a block
+func (r *replica) CommitTxBatch(id interface{}, metadata []byte) (*pb.Block, error) {
+	return r.commit(metadata), nil
+}
+
+// RollbackTxBatch discards the executed transactions
+func (r *replica) RollbackTxBatch(id interface{}) error {
+	r.executing = nil
+	return nil
+}
+
+// PreviewCommitTxBatch returns the block which CommitTxBatch would append
+func (r *replica) PreviewCommitTxBatch(id interface{}, metadata []byte) ([]byte, error) {
+	return r.nextBlock(metadata).Bytes()
+}
+
+// InvalidateState is a no-op
+func (r *replica) InvalidateState() {}
+
+// ValidateState is a no-op
+func (r *replica) ValidateState() {}
+
+// GetBlock returns a committed block
+func (r *replica) GetBlock(id uint64) (*pb.Block, error) {
+	if id >= r.height() {
+		return nil, fmt.Errorf("replica %d has no block %d", r.id, id)
+	}
+	return r.blocks[id], nil
+}
+
+// GetBlockchainSize returns the number of blocks, including the genesis block
+func (r *replica) GetBlockchainSize() uint64 {
+	return r.height()
+}
+
+// GetBlockchainInfo describes the head of the ledger
+func (r *replica) GetBlockchainInfo() *pb.BlockchainInfo {
+	return &pb.BlockchainInfo{
+		Height:            r.height(),
+		CurrentBlockHash:  r.hashes[len(r.hashes)-1],
+		PreviousBlockHash: r.blocks[len(r.blocks)-1].PreviousBlockHash,
+	}
+}
+
+// GetBlockchainInfoBlob returns the marshaled description of the head of the ledger
+func (r *replica) GetBlockchainInfoBlob() []byte {
+	blob, _ := proto.Marshal(r.GetBlockchainInfo())
+	return blob
+}
+
+// GetBlockHeadMetadata returns the consensus metadata of the last block
+func (r *replica) GetBlockHeadMetadata() ([]byte, error) {
+	return r.blocks[len(r.blocks)-1].ConsensusMetadata, nil
+}
+
+// StoreState persists consensus state
+func (r *replica) StoreState(key string, value []byte) error {
+	r.persisted[key] = value
+	return nil
+}
+
+// ReadState reads persisted consensus state
+func (r *replica) ReadState(key string) ([]byte, error) {
+	value, ok := r.persisted[key]
+	if !ok {
+		return nil, fmt.Errorf("replica %d has no state for key %s", r.id, key)
+	}
+	return value, nil
+}
+
+// ReadStateSet reads all persisted consensus state under a prefix
+func (r *replica) ReadStateSet(prefix string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	for key, value := range r.persisted {
+		if strings.HasPrefix(key, prefix) {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// DelState deletes persisted consensus state
+func (r *replica) DelState(key string) {
+	delete(r.persisted, key)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package core
 
 import (
+	"fmt"
 	"os"
 	"runtime"
 
@@ -37,8 +38,24 @@ func NewAdminServer() *ServerAdmin {
 	return s
 }
 
+// NewAdminServerWithConsensus creates an Admin service instance which also
+// reports the state of the consensus plugin of a validating peer.
+func NewAdminServerWithConsensus(consensus ConsensusStatusReporter) *ServerAdmin {
+	s := new(ServerAdmin)
+	s.consensus = consensus
+	return s
+}
+
+// ConsensusStatusReporter defines API to the state of the consensus plugin
+type ConsensusStatusReporter interface {
+	GetConsensusStatus() (*pb.ConsensusStatus, error)
+	GetConsensusEvidence() ([]*pb.ConsensusEvidence, error)
+	ReconfigureConsensus(replicas []uint64, f int) error
+}
+
 // ServerAdmin implementation of the Admin service for the Peer
 type ServerAdmin struct {
+	consensus ConsensusStatusReporter
 }
 
 func worker(id int, die chan struct{}) {
@@ -79,3 +96,41 @@ func (*ServerAdmin) StopServer(context.Context, *google_protobuf.Empty) (*pb.Ser
 	defer os.Exit(0)
 	return status, nil
 }
+
+// GetConsensusStatus reports the state of the consensus plugin
+func (s *ServerAdmin) GetConsensusStatus(context.Context, *google_protobuf.Empty) (*pb.ConsensusStatus, error) {
+	if s.consensus == nil {
+		return nil, fmt.Errorf("This peer does not report the status of consensus")
+	}
+	status, err := s.consensus.GetConsensusStatus()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("returning consensus status: %s", status)
+	return status, nil
+}
+
+// GetConsensusEvidence reports the evidence of misbehaving validators the consensus plugin collected
+func (s *ServerAdmin) GetConsensusEvidence(context.Context, *google_protobuf.Empty) (*pb.ConsensusEvidenceList, error) {
+	if s.consensus == nil {
+		return nil, fmt.Errorf("This peer does not report the evidence collected by consensus")
+	}
+	evidence, err := s.consensus.GetConsensusEvidence()
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("returning %d pieces of consensus evidence", len(evidence))
+	return &pb.ConsensusEvidenceList{Evidence: evidence}, nil
+}
+
+// ReconfigureConsensus asks the consensus plugin to switch the network to a new replica set
+func (s *ServerAdmin) ReconfigureConsensus(ctx context.Context, reconfiguration *pb.ConsensusReconfiguration) (*google_protobuf.Empty, error) {
+	if s.consensus == nil {
+		return nil, fmt.Errorf("This peer does not support consensus reconfiguration")
+	}
+	if err := s.consensus.ReconfigureConsensus(reconfiguration.Replicas, int(reconfiguration.F)); err != nil {
+		return nil, err
+	}
+	log.Infof("requested consensus reconfiguration to replicas %v (f=%d)", reconfiguration.Replicas, reconfiguration.F)
+	return &google_protobuf.Empty{}, nil
+}
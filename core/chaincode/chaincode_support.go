@@ -97,7 +97,7 @@ func NewChaincodeSupport(chainname ChainName, getPeerEndpoint func() (*pb.PeerEn
 	pnid := viper.GetString("peer.networkId")
 	pid := viper.GetString("peer.id")
 
-	s := &ChaincodeSupport{name: chainname, runningChaincodes: &runningChaincodes{chaincodeMap: make(map[string]*chaincodeRTEnv)}, secHelper: secHelper, peerNetworkID: pnid, peerID: pid}
+	s := &ChaincodeSupport{name: chainname, runningChaincodes: &runningChaincodes{chaincodeMap: make(map[string]*chaincodeRTEnv)}, secHelper: secHelper, peerNetworkID: pnid, peerID: pid, txBudgets: make(map[string]*txBudget)}
 
 	//initialize global chain
 	chains[chainname] = s
@@ -132,6 +132,13 @@ func NewChaincodeSupport(chainname ChainName, getPeerEndpoint func() (*pb.PeerEn
 		s.peerTLSSvrHostOrd = viper.GetString("peer.tls.serverhostoverride")
 	}
 
+	s.txLimits = getTxLimits()
+
+	s.vmType = container.DOCKER
+	if vmtype := viper.GetString("vm.type"); vmtype != "" {
+		s.vmType = vmtype
+	}
+
 	kadef := 0
 	if ka := viper.GetString("chaincode.keepalive"); ka == "" {
 		s.keepalive = time.Duration(kadef) * time.Second
@@ -172,6 +179,12 @@ type ChaincodeSupport struct {
 	peerTLSKeyFile       string
 	peerTLSSvrHostOrd    string
 	keepalive            time.Duration
+	vmType               string
+
+	// resources a transaction may use, and the budgets of the running transactions
+	txLimits      txLimits
+	txBudgetsLock sync.Mutex
+	txBudgets     map[string]*txBudget
 }
 
 // DuplicateChaincodeHandlerError returned if attempt to register same chaincodeID while a stream already exists.
@@ -315,6 +328,11 @@ func (chaincodeSupport *ChaincodeSupport) launchAndWaitForRegister(ctxt context.
 		return false, fmt.Errorf("chaincode name not set")
 	}
 
+	vmtype, err := chaincodeSupport.getVMType(cds)
+	if err != nil {
+		return false, err
+	}
+
 	chaincodeSupport.runningChaincodes.Lock()
 	var ok bool
 	//if its in the map, there must be a connected stream...nothing to do
@@ -337,8 +355,6 @@ func (chaincodeSupport *ChaincodeSupport) launchAndWaitForRegister(ctxt context.
 
 	chaincodeLogger.Debugf("start container: %s(networkid:%s,peerid:%s)", chaincode, chaincodeSupport.peerNetworkID, chaincodeSupport.peerID)
 
-	vmtype, _ := chaincodeSupport.getVMType(cds)
-
 	sir := container.StartImageReq{CCID: ccintf.CCID{ChaincodeSpec: cds.ChaincodeSpec, NetworkID: chaincodeSupport.peerNetworkID, PeerID: chaincodeSupport.peerID}, Reader: targz, Args: args, Env: env}
 
 	ipcCtxt := context.WithValue(ctxt, ccintf.GetCCHandlerKey(), chaincodeSupport)
@@ -416,8 +432,9 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 	var initargs []string
 
 	cds := &pb.ChaincodeDeploymentSpec{}
-	if t.Type == pb.Transaction_CHAINCODE_DEPLOY {
-		err := proto.Unmarshal(t.Payload, cds)
+	if t.Type == pb.Transaction_CHAINCODE_DEPLOY || t.Type == pb.Transaction_CHAINCODE_UPGRADE {
+		var err error
+		cds, err = getTransactionDeploymentSpec(t)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -434,6 +451,11 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 		}
 		cID = ci.ChaincodeSpec.ChaincodeID
 		cMsg = ci.ChaincodeSpec.CtorMsg
+		//a terminated chaincode may still be running on a peer that has not
+		//executed the terminate transaction, so check before looking it up
+		if err = checkChaincodeActive(cID.Name, t.Type == pb.Transaction_CHAINCODE_QUERY); err != nil {
+			return cID, cMsg, err
+		}
 	} else {
 		chaincodeSupport.runningChaincodes.Unlock()
 		return nil, nil, fmt.Errorf("invalid transaction type: %d", t.Type)
@@ -474,7 +496,7 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 	//         5) query successfully retrives committed tx and calls sendInitOrReady
 	// See issue #710
 
-	if t.Type != pb.Transaction_CHAINCODE_DEPLOY {
+	if t.Type != pb.Transaction_CHAINCODE_DEPLOY && t.Type != pb.Transaction_CHAINCODE_UPGRADE {
 		ledger, ledgerErr := ledger.GetLedger()
 
 		if chaincodeSupport.userRunsCC {
@@ -501,8 +523,8 @@ func (chaincodeSupport *ChaincodeSupport) Launch(context context.Context, t *pb.
 				return cID, cMsg, fmt.Errorf("failed tx preexecution%s - %s", chaincode, err)
 			}
 		}
-		//Get lang from original deployment
-		err := proto.Unmarshal(depTx.Payload, cds)
+		//Get lang from original deployment, which may be an upgrade
+		cds, err = getTransactionDeploymentSpec(depTx)
 		if err != nil {
 			return cID, cMsg, fmt.Errorf("failed to unmarshal deployment transactions for %s - %s", chaincode, err)
 		}
@@ -546,27 +568,36 @@ func (chaincodeSupport *ChaincodeSupport) getSecHelper() crypto.Peer {
 }
 
 //getVMType - just returns a string for now. Another possibility is to use a factory method to
-//return a VM executor
+//return a VM executor. System chaincodes always run in process, others run in
+//the VM configured with vm.type
 func (chaincodeSupport *ChaincodeSupport) getVMType(cds *pb.ChaincodeDeploymentSpec) (string, error) {
 	if cds.ExecEnv == pb.ChaincodeDeploymentSpec_SYSTEM {
 		return container.SYSTEM, nil
 	}
-	return container.DOCKER, nil
+	switch {
+	case strings.EqualFold(chaincodeSupport.vmType, container.DOCKER):
+		return container.DOCKER, nil
+	case strings.EqualFold(chaincodeSupport.vmType, container.EXEC):
+		if cds.ChaincodeSpec == nil || cds.ChaincodeSpec.Type != pb.ChaincodeSpec_GOLANG {
+			return "", fmt.Errorf("Only Go chaincodes can run in the %s VM", container.EXEC)
+		}
+		return container.EXEC, nil
+	}
+	return "", fmt.Errorf("Unknown VM type %s", chaincodeSupport.vmType)
 }
 
 // Deploy deploys the chaincode if not in development mode where user is running the chaincode.
 func (chaincodeSupport *ChaincodeSupport) Deploy(context context.Context, t *pb.Transaction) (*pb.ChaincodeDeploymentSpec, error) {
 	//build the chaincode
-	cds := &pb.ChaincodeDeploymentSpec{}
-	err := proto.Unmarshal(t.Payload, cds)
+	cds, err := getTransactionDeploymentSpec(t)
 	if err != nil {
 		return nil, err
 	}
 	cID := cds.ChaincodeSpec.ChaincodeID
 	cLang := cds.ChaincodeSpec.Type
 	chaincode := cID.Name
-	if err != nil {
-		return cds, err
+	if chaincode == lifecycleNamespace {
+		return cds, fmt.Errorf("chaincode name %s is reserved", chaincode)
 	}
 
 	if chaincodeSupport.userRunsCC {
@@ -591,7 +622,10 @@ func (chaincodeSupport *ChaincodeSupport) Deploy(context context.Context, t *pb.
 	var targz io.Reader = bytes.NewBuffer(cds.CodePackage)
 	cir := &container.CreateImageReq{CCID: ccintf.CCID{ChaincodeSpec: cds.ChaincodeSpec, NetworkID: chaincodeSupport.peerNetworkID, PeerID: chaincodeSupport.peerID}, Args: args, Reader: targz, Env: envs}
 
-	vmtype, _ := chaincodeSupport.getVMType(cds)
+	vmtype, err := chaincodeSupport.getVMType(cds)
+	if err != nil {
+		return cds, err
+	}
 
 	chaincodeLogger.Debugf("deploying chaincode %s(networkid:%s,peerid:%s)", chaincode, chaincodeSupport.peerNetworkID, chaincodeSupport.peerID)
 
@@ -645,6 +679,10 @@ func (chaincodeSupport *ChaincodeSupport) Execute(ctxt context.Context, chaincod
 	}
 	chaincodeSupport.runningChaincodes.Unlock()
 
+	//the transaction may not run past the time it is given
+	budget := chaincodeSupport.getTxBudget(msg.Uuid)
+	timeout = budget.timeout(timeout)
+
 	var notfy chan *pb.ChaincodeMessage
 	var err error
 	if notfy, err = chrte.handler.sendExecuteMessage(msg, tx); err != nil {
@@ -656,7 +694,9 @@ func (chaincodeSupport *ChaincodeSupport) Execute(ctxt context.Context, chaincod
 		//response is sent to user or calling chaincode. ChaincodeMessage_ERROR and ChaincodeMessage_QUERY_ERROR
 		//are typically treated as error
 	case <-time.After(timeout):
-		err = fmt.Errorf("Timeout expired while executing transaction")
+		if err = budget.check(); err == nil {
+			err = fmt.Errorf("Timeout expired while executing transaction")
+		}
 	}
 
 	//our responsibility to delete transaction context if sendExecuteMessage succeeded
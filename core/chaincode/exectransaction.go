@@ -29,8 +29,9 @@ import (
 	pb "github.com/hyperledger/fabric/protos"
 )
 
-//Execute - execute transaction or a query
-func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) ([]byte, *pb.ChaincodeEvent, error) {
+//Execute - execute transaction or a query. The events set by the chaincode
+//are returned in the order they were set
+func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) ([]byte, []*pb.ChaincodeEvent, error) {
 	var err error
 
 	// get a handle to ledger to mark the begin/finish of a tx
@@ -48,6 +49,10 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 		}
 	}
 
+	// Track the resources used by the transaction, including the chaincodes it invokes
+	budget := chain.beginTxBudget(t.Uuid)
+	defer chain.endTxBudget(t.Uuid)
+
 	if t.Type == pb.Transaction_CHAINCODE_DEPLOY {
 		_, err := chain.Deploy(ctxt, t)
 		if err != nil {
@@ -57,11 +62,23 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 		//launch and wait for ready
 		markTxBegin(ledger, t)
 		_, _, err = chain.Launch(ctxt, t)
+		if limitErr := budget.err(); limitErr != nil {
+			markTxFinish(ledger, t, false)
+			return nil, nil, limitErr
+		}
 		if err != nil {
 			markTxFinish(ledger, t, false)
 			return nil, nil, fmt.Errorf("%s", err)
 		}
 		markTxFinish(ledger, t, true)
+	} else if t.Type == pb.Transaction_CHAINCODE_UPGRADE {
+		if err := executeUpgrade(ctxt, chain, ledger, t); err != nil {
+			return nil, nil, err
+		}
+	} else if t.Type == pb.Transaction_CHAINCODE_TERMINATE {
+		if err := executeTerminate(ctxt, chain, ledger, t); err != nil {
+			return nil, nil, err
+		}
 	} else if t.Type == pb.Transaction_CHAINCODE_INVOKE || t.Type == pb.Transaction_CHAINCODE_QUERY {
 		//will launch if necessary (and wait for ready)
 		cID, cMsg, err := chain.Launch(ctxt, t)
@@ -99,7 +116,11 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 
 		markTxBegin(ledger, t)
 		resp, err := chain.Execute(ctxt, chaincode, ccMsg, timeout, t)
-		if err != nil {
+		if limitErr := budget.err(); limitErr != nil {
+			// Abort the transaction, even if the chaincode ignored the error
+			markTxFinish(ledger, t, false)
+			return nil, nil, limitErr
+		} else if err != nil {
 			// Rollback transaction
 			markTxFinish(ledger, t, false)
 			return nil, nil, fmt.Errorf("Failed to execute transaction or query(%s)", err)
@@ -108,19 +129,20 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 			markTxFinish(ledger, t, false)
 			return nil, nil, fmt.Errorf("Failed to receive a response for (%s)", t.Uuid)
 		} else {
-			if resp.ChaincodeEvent != nil {
-				resp.ChaincodeEvent.ChaincodeID = chaincode
-				resp.ChaincodeEvent.TxID = t.Uuid
+			ccevents := getChaincodeEvents(resp)
+			for _, ccevent := range ccevents {
+				ccevent.ChaincodeID = chaincode
+				ccevent.TxID = t.Uuid
 			}
 
 			if resp.Type == pb.ChaincodeMessage_COMPLETED || resp.Type == pb.ChaincodeMessage_QUERY_COMPLETED {
 				// Success
 				markTxFinish(ledger, t, true)
-				return resp.Payload, resp.ChaincodeEvent, nil
+				return resp.Payload, ccevents, nil
 			} else if resp.Type == pb.ChaincodeMessage_ERROR || resp.Type == pb.ChaincodeMessage_QUERY_ERROR {
 				// Rollback transaction
 				markTxFinish(ledger, t, false)
-				return nil, resp.ChaincodeEvent, fmt.Errorf("Transaction or query returned with failure: %s", string(resp.Payload))
+				return nil, ccevents, fmt.Errorf("Transaction or query returned with failure: %s", string(resp.Payload))
 			}
 			markTxFinish(ledger, t, false)
 			return resp.Payload, nil, fmt.Errorf("receive a response for (%s) but in invalid state(%d)", t.Uuid, resp.Type)
@@ -132,26 +154,51 @@ func Execute(ctxt context.Context, chain *ChaincodeSupport, t *pb.Transaction) (
 	return nil, nil, err
 }
 
+//getChaincodeEvents returns the events of the chaincode response. Chaincodes
+//built with an older shim only send a single event
+func getChaincodeEvents(resp *pb.ChaincodeMessage) []*pb.ChaincodeEvent {
+	if len(resp.ChaincodeEvents) == 0 && resp.ChaincodeEvent != nil {
+		return []*pb.ChaincodeEvent{resp.ChaincodeEvent}
+	}
+	return resp.ChaincodeEvents
+}
+
+//lastChaincodeEvent returns the last of the events, which is set as the single
+//event of a transaction result for the consumers expecting one
+func lastChaincodeEvent(ccevents []*pb.ChaincodeEvent) *pb.ChaincodeEvent {
+	if len(ccevents) == 0 {
+		return nil
+	}
+	return ccevents[len(ccevents)-1]
+}
+
 //ExecuteTransactions - will execute transactions on the array one by one
-//will return an array of errors one for each transaction. If the execution
-//succeeded, array element will be nil. returns []byte of state hash or
+//will return an array of results one for each transaction. If the execution
+//failed, the error code of the result is set. returns []byte of state hash or
 //error
-func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Transaction) (succeededTXs []*pb.Transaction, stateHash []byte, ccevents []*pb.ChaincodeEvent, txerrs []error, err error) {
+func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Transaction) (succeededTXs []*pb.Transaction, stateHash []byte, txresults []*pb.TransactionResult, err error) {
 	var chain = GetChain(cname)
 	if chain == nil {
 		// TODO: We should never get here, but otherwise a good reminder to better handle
 		panic(fmt.Sprintf("[ExecuteTransactions]Chain %s not found\n", cname))
 	}
 
-	txerrs = make([]error, len(xacts))
-	ccevents = make([]*pb.ChaincodeEvent, len(xacts))
+	txresults = make([]*pb.TransactionResult, len(xacts))
 	var succeededTxs = make([]*pb.Transaction, 0)
 	for i, t := range xacts {
-		_, ccevents[i], txerrs[i] = Execute(ctxt, chain, t)
-		if txerrs[i] == nil {
+		result, ccevents, txerr := Execute(ctxt, chain, t)
+		//NOTE- it'll be nice if we can have error values. For now success == 0, error == 1,
+		//and a transaction exceeding its resource limits == 2
+		if txerr == nil {
+			txresults[i] = &pb.TransactionResult{Uuid: t.Uuid, Result: result, ChaincodeEvent: lastChaincodeEvent(ccevents), ChaincodeEvents: ccevents}
 			succeededTxs = append(succeededTxs, t)
 		} else {
-			sendTxRejectedEvent(xacts[i], txerrs[i].Error())
+			errorCode := TxErrorCodeFailed
+			if _, ok := txerr.(*LimitExceededError); ok {
+				errorCode = TxErrorCodeLimitExceeded
+			}
+			txresults[i] = &pb.TransactionResult{Uuid: t.Uuid, Error: txerr.Error(), ErrorCode: errorCode, ChaincodeEvent: lastChaincodeEvent(ccevents), ChaincodeEvents: ccevents}
+			sendTxRejectedEvent(xacts[i], txerr.Error())
 		}
 	}
 
@@ -161,7 +208,7 @@ func ExecuteTransactions(ctxt context.Context, cname ChainName, xacts []*pb.Tran
 		stateHash, err = lgr.GetTempStateHash()
 	}
 
-	return succeededTxs, stateHash, ccevents, txerrs, err
+	return succeededTxs, stateHash, txresults, err
 }
 
 // GetSecureContext returns the security context from the context object or error
@@ -259,7 +259,7 @@ func deploy2(ctx context.Context, chaincodeDeploymentSpec *pb.ChaincodeDeploymen
 }
 
 // Invoke or query a chaincode.
-func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type) (*pb.ChaincodeEvent, string, []byte, error) {
+func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type) ([]*pb.ChaincodeEvent, string, []byte, error) {
 	chaincodeInvocationSpec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: spec}
 
 	// Now create the Transactions message and send to Peer.
@@ -278,7 +278,7 @@ func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type
 
 	var retval []byte
 	var execErr error
-	var ccevt *pb.ChaincodeEvent
+	var ccevt []*pb.ChaincodeEvent
 	if typ == pb.Transaction_CHAINCODE_QUERY {
 		retval, ccevt, execErr = Execute(ctx, GetChain(DefaultChain), transaction)
 	} else {
@@ -294,6 +294,51 @@ func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type
 	return ccevt, uuid, retval, execErr
 }
 
+// Upgrade a chaincode to the chaincode of spec.
+func upgrade(ctx context.Context, spec *pb.ChaincodeSpec, previous string, carryState bool) ([]byte, error) {
+	chaincodeDeploymentSpec, err := getDeploymentSpec(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	tid := chaincodeDeploymentSpec.ChaincodeSpec.ChaincodeID.Name
+	upgradeSpec := &pb.ChaincodeUpgradeSpec{ChaincodeDeploymentSpec: chaincodeDeploymentSpec, PreviousChaincodeID: &pb.ChaincodeID{Name: previous}, CarryState: carryState}
+	transaction, err := pb.NewChaincodeUpgradeTransaction(upgradeSpec, tid)
+	if err != nil {
+		return nil, fmt.Errorf("Error upgrading chaincode: %s ", err)
+	}
+
+	ledger, _ := ledger.GetLedger()
+	ledger.BeginTxBatch("1")
+	b, _, err := Execute(ctx, GetChain(DefaultChain), transaction)
+	if err != nil {
+		ledger.RollbackTxBatch("1")
+		return nil, fmt.Errorf("Error upgrading chaincode: %s", err)
+	}
+	ledger.CommitTxBatch("1", []*pb.Transaction{transaction}, nil, nil)
+
+	return b, err
+}
+
+// Terminate a chaincode.
+func terminate(ctx context.Context, spec *pb.ChaincodeSpec) error {
+	transaction, err := pb.NewChaincodeExecute(&pb.ChaincodeInvocationSpec{ChaincodeSpec: spec}, util.GenerateUUID(), pb.Transaction_CHAINCODE_TERMINATE)
+	if err != nil {
+		return fmt.Errorf("Error terminating chaincode: %s ", err)
+	}
+
+	ledger, _ := ledger.GetLedger()
+	ledger.BeginTxBatch("1")
+	_, _, err = Execute(ctx, GetChain(DefaultChain), transaction)
+	if err != nil {
+		ledger.RollbackTxBatch("1")
+		return fmt.Errorf("Error terminating chaincode: %s", err)
+	}
+	ledger.CommitTxBatch("1", []*pb.Transaction{transaction}, nil, nil)
+
+	return nil
+}
+
 func closeListenerAndSleep(l net.Listener) {
 	if l != nil {
 		l.Close()
@@ -1351,6 +1396,116 @@ func TestRangeQuery(t *testing.T) {
 	closeListenerAndSleep(lis)
 }
 
+func TestUpgradeAndTerminate(t *testing.T) {
+	var opts []grpc.ServerOption
+	if viper.GetBool("peer.tls.enabled") {
+		creds, err := credentials.NewServerTLSFromFile(viper.GetString("peer.tls.cert.file"), viper.GetString("peer.tls.key.file"))
+		if err != nil {
+			grpclog.Fatalf("Failed to generate credentials %v", err)
+		}
+		opts = []grpc.ServerOption{grpc.Creds(creds)}
+	}
+	grpcServer := grpc.NewServer(opts...)
+	viper.Set("peer.fileSystemPath", "/var/hyperledger/test/tmpdb")
+
+	//use a different address than what we usually use for "peer"
+	//we override the peerAddress set in chaincode_support.go
+	peerAddress := "0.0.0.0:21212"
+
+	lis, err := net.Listen("tcp", peerAddress)
+	if err != nil {
+		t.Fail()
+		t.Logf("Error starting peer listener %s", err)
+		return
+	}
+
+	getPeerEndpoint := func() (*pb.PeerEndpoint, error) {
+		return &pb.PeerEndpoint{ID: &pb.PeerID{Name: "testpeer"}, Address: peerAddress}, nil
+	}
+
+	ccStartupTimeout := time.Duration(chaincodeStartupTimeoutDefault) * time.Millisecond
+	pb.RegisterChaincodeSupportServer(grpcServer, NewChaincodeSupport(DefaultChain, getPeerEndpoint, false, ccStartupTimeout, nil))
+
+	go grpcServer.Serve(lis)
+
+	var ctxt = context.Background()
+
+	url := "github.com/hyperledger/fabric/examples/chaincode/go/map"
+	cID := &pb.ChaincodeID{Path: url}
+	spec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: cID, CtorMsg: &pb.ChaincodeInput{Function: "init", Args: []string{}}}
+
+	_, err = deploy(ctxt, spec)
+	chaincodeID := spec.ChaincodeID.Name
+	if err != nil {
+		t.Fail()
+		t.Logf("Error initializing chaincode %s(%s)", chaincodeID, err)
+		GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec})
+		closeListenerAndSleep(lis)
+		return
+	}
+
+	putSpec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Name: chaincodeID}, CtorMsg: &pb.ChaincodeInput{Function: "put", Args: []string{"a", "100"}}}
+	_, _, _, err = invoke(ctxt, putSpec, pb.Transaction_CHAINCODE_INVOKE)
+	if err != nil {
+		t.Fail()
+		t.Logf("Error invoking <%s>: %s", chaincodeID, err)
+		GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec})
+		closeListenerAndSleep(lis)
+		return
+	}
+
+	// Upgrade to the same chaincode with a different constructor, which gives it a new name
+	newSpec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Path: url}, CtorMsg: &pb.ChaincodeInput{Function: "init", Args: []string{"v2"}}}
+	_, err = upgrade(ctxt, newSpec, chaincodeID, true)
+	newChaincodeID := newSpec.ChaincodeID.Name
+	if err != nil {
+		t.Fail()
+		t.Logf("Error upgrading chaincode %s(%s)", chaincodeID, err)
+		GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec})
+		GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: newSpec})
+		closeListenerAndSleep(lis)
+		return
+	}
+
+	ledger, _ := ledger.GetLedger()
+	lifecycle, err := getChaincodeLifecycle(ledger, newChaincodeID, true)
+	if err != nil || lifecycle.Version != 2 || lifecycle.PreviousChaincodeID != chaincodeID {
+		t.Fail()
+		t.Logf("Expected version 2 upgraded from %s, got %v (%v)", chaincodeID, lifecycle, err)
+	}
+
+	// The state has been carried to the new chaincode
+	getSpec := &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Name: newChaincodeID}, CtorMsg: &pb.ChaincodeInput{Function: "get", Args: []string{"a"}}}
+	_, _, retval, err := invoke(ctxt, getSpec, pb.Transaction_CHAINCODE_QUERY)
+	if err != nil || string(retval) != "100" {
+		t.Fail()
+		t.Logf("Expected the state of %s to be carried, got %s (%v)", chaincodeID, retval, err)
+	}
+
+	// The upgraded chaincode cannot be invoked any more
+	_, _, _, err = invoke(ctxt, putSpec, pb.Transaction_CHAINCODE_INVOKE)
+	if err == nil {
+		t.Fail()
+		t.Logf("Expected invoking the upgraded chaincode %s to fail", chaincodeID)
+	}
+
+	err = terminate(ctxt, &pb.ChaincodeSpec{Type: 1, ChaincodeID: &pb.ChaincodeID{Name: newChaincodeID}})
+	if err != nil {
+		t.Fail()
+		t.Logf("Error terminating chaincode %s(%s)", newChaincodeID, err)
+	}
+
+	_, _, _, err = invoke(ctxt, getSpec, pb.Transaction_CHAINCODE_QUERY)
+	if err == nil {
+		t.Fail()
+		t.Logf("Expected querying the terminated chaincode %s to fail", newChaincodeID)
+	}
+
+	GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec})
+	GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: newSpec})
+	closeListenerAndSleep(lis)
+}
+
 func TestGetEvent(t *testing.T) {
 	var opts []grpc.ServerOption
 	if viper.GetBool("peer.tls.enabled") {
@@ -1406,18 +1561,22 @@ func TestGetEvent(t *testing.T) {
 
 	spec = &pb.ChaincodeSpec{Type: 1, ChaincodeID: cID, CtorMsg: &pb.ChaincodeInput{Function: "", Args: args}}
 
-	var ccevt *pb.ChaincodeEvent
-	ccevt, _, _, err = invoke(ctxt, spec, pb.Transaction_CHAINCODE_INVOKE)
+	var ccevts []*pb.ChaincodeEvent
+	ccevts, _, _, err = invoke(ctxt, spec, pb.Transaction_CHAINCODE_INVOKE)
 
 	if err != nil {
 		t.Logf("Error invoking chaincode %s(%s)", chaincodeID, err)
 		t.Fail()
 	}
 
-	if ccevt == nil {
-		t.Logf("Error ccevt is nil %s(%s)", chaincodeID, err)
+	if len(ccevts) != 1 {
 		t.Fail()
+		t.Logf("Error expected one event from %s, got %d", chaincodeID, len(ccevts))
+		GetChain(DefaultChain).Stop(ctxt, &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec})
+		closeListenerAndSleep(lis)
+		return
 	}
+	ccevt := ccevts[0]
 
 	if ccevt.ChaincodeID != chaincodeID {
 		t.Logf("Error ccevt id(%s) != cid(%s)", ccevt.ChaincodeID, chaincodeID)
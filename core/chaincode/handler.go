@@ -61,6 +61,11 @@ type transactionContext struct {
 
 	// tracks open iterators used for range queries
 	rangeQueryIteratorMap map[string]statemgmt.RangeScanIterator
+
+	// set once the transaction has run a rich query or read the history of a
+	// key, whose results are not deterministic; the state can then no longer
+	// be updated
+	nonDeterministic bool
 }
 
 type nextStateInfo struct {
@@ -155,6 +160,19 @@ func (handler *Handler) getRangeQueryIterator(txContext *transactionContext, uui
 	return txContext.rangeQueryIteratorMap[uuid]
 }
 
+func (handler *Handler) markNonDeterministic(txContext *transactionContext) {
+	handler.Lock()
+	defer handler.Unlock()
+	txContext.nonDeterministic = true
+}
+
+func (handler *Handler) isNonDeterministic(uuid string) bool {
+	handler.Lock()
+	defer handler.Unlock()
+	txContext := handler.txCtxs[uuid]
+	return txContext != nil && txContext.nonDeterministic
+}
+
 func (handler *Handler) deleteRangeQueryIterator(txContext *transactionContext, uuid string) {
 	handler.Lock()
 	defer handler.Unlock()
@@ -416,6 +434,16 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(), Src: []string{transactionstate}, Dst: transactionstate},
 			{Name: pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_GET_HISTORY_FOR_KEY.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_GET_HISTORY_FOR_KEY.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_GET_HISTORY_FOR_KEY.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_GET_HISTORY_FOR_KEY.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_GET_HISTORY_FOR_KEY.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY.String(), Src: []string{readystate}, Dst: readystate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY.String(), Src: []string{initstate}, Dst: initstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY.String(), Src: []string{busyinitstate}, Dst: busyinitstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY.String(), Src: []string{transactionstate}, Dst: transactionstate},
+			{Name: pb.ChaincodeMessage_EXECUTE_QUERY.String(), Src: []string{busyxactstate}, Dst: busyxactstate},
 			{Name: pb.ChaincodeMessage_ERROR.String(), Src: []string{initstate}, Dst: endstate},
 			{Name: pb.ChaincodeMessage_ERROR.String(), Src: []string{transactionstate}, Dst: readystate},
 			{Name: pb.ChaincodeMessage_ERROR.String(), Src: []string{busyinitstate}, Dst: initstate},
@@ -431,6 +459,8 @@ func newChaincodeSupportHandler(chaincodeSupport *ChaincodeSupport, peerChatStre
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE.String():       func(e *fsm.Event) { v.afterRangeQueryState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE_NEXT.String():  func(e *fsm.Event) { v.afterRangeQueryStateNext(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_RANGE_QUERY_STATE_CLOSE.String(): func(e *fsm.Event) { v.afterRangeQueryStateClose(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_GET_HISTORY_FOR_KEY.String():     func(e *fsm.Event) { v.afterGetHistoryForKey(e, v.FSM.Current()) },
+			"after_" + pb.ChaincodeMessage_EXECUTE_QUERY.String():           func(e *fsm.Event) { v.afterExecuteQuery(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_PUT_STATE.String():               func(e *fsm.Event) { v.afterPutState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_DEL_STATE.String():               func(e *fsm.Event) { v.afterDelState(e, v.FSM.Current()) },
 			"after_" + pb.ChaincodeMessage_INVOKE_CHAINCODE.String():        func(e *fsm.Event) { v.afterInvokeChaincode(e, v.FSM.Current()) },
@@ -699,8 +729,6 @@ func (handler *Handler) handleRangeQueryState(msg *pb.ChaincodeMessage) {
 			return
 		}
 
-		hasNext := true
-
 		ledger, ledgerErr := ledger.GetLedger()
 		if ledgerErr != nil {
 			// Send error msg back to chaincode. GetState will not trigger event
@@ -722,55 +750,271 @@ func (handler *Handler) handleRangeQueryState(msg *pb.ChaincodeMessage) {
 			return
 		}
 
-		iterID := util.GenerateUUID()
-		txContext := handler.getTxContext(msg.Uuid)
-		handler.putRangeQueryIterator(txContext, iterID, rangeIter)
+		serialSendMsg = handler.getRangeQueryResponse(msg, rangeIter)
+	}()
+}
+
+// getRangeQueryResponse keeps rangeIter open for the RANGE_QUERY_STATE_NEXT requests of the
+// chaincode and returns the response to msg with the first key-values of rangeIter
+func (handler *Handler) getRangeQueryResponse(msg *pb.ChaincodeMessage, rangeIter statemgmt.RangeScanIterator) *pb.ChaincodeMessage {
+	iterID := util.GenerateUUID()
+	txContext := handler.getTxContext(msg.Uuid)
+	handler.putRangeQueryIterator(txContext, iterID, rangeIter)
+
+	hasNext := rangeIter.Next()
+
+	// The page holds no more keys than the transaction may still read
+	budget := handler.chaincodeSupport.getTxBudget(msg.Uuid)
+	pageLimit := uint32(maxRangeQueryStateLimit)
+	if hasNext {
+		var limitErr error
+		if pageLimit, limitErr = budget.rangeResultsPage(pageLimit); limitErr != nil {
+			chaincodeLogger.Errorf("[%s]Range query exceeded the transaction limits. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+
+			rangeIter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+
+			return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(limitErr.Error()), Uuid: msg.Uuid}
+		}
+	}
+
+	var keysAndValues []*pb.RangeQueryStateKeyValue
+	var i = uint32(0)
+	for ; hasNext && i < pageLimit; i++ {
+		key, value := rangeIter.GetKeyValue()
+		// Decrypt the data if the confidential is enabled
+		decryptedValue, decryptErr := handler.decrypt(msg.Uuid, value)
+		if decryptErr != nil {
+			payload := []byte(decryptErr.Error())
+			chaincodeLogger.Errorf("Failed decrypt value. Sending %s", pb.ChaincodeMessage_ERROR)
+
+			rangeIter.Close()
+			handler.deleteRangeQueryIterator(txContext, iterID)
+
+			return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+		}
+		keyAndValue := pb.RangeQueryStateKeyValue{Key: key, Value: decryptedValue}
+		keysAndValues = append(keysAndValues, &keyAndValue)
 
 		hasNext = rangeIter.Next()
+	}
+	budget.addRangeResults(int(i))
 
-		var keysAndValues []*pb.RangeQueryStateKeyValue
-		var i = uint32(0)
-		for ; hasNext && i < maxRangeQueryStateLimit; i++ {
-			key, value := rangeIter.GetKeyValue()
+	if !hasNext {
+		rangeIter.Close()
+		handler.deleteRangeQueryIterator(txContext, iterID)
+	}
+
+	payload := &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, HasMore: hasNext, ID: iterID}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		rangeIter.Close()
+		handler.deleteRangeQueryIterator(txContext, iterID)
+
+		// Send error msg back to chaincode. GetState will not trigger event
+		payload := []byte(err.Error())
+		chaincodeLogger.Errorf("Failed marshall resopnse. Sending %s", pb.ChaincodeMessage_ERROR)
+		return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+	}
+
+	chaincodeLogger.Debugf("Got keys and values. Sending %s", pb.ChaincodeMessage_RESPONSE)
+	return &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: payloadBytes, Uuid: msg.Uuid}
+}
+
+// afterExecuteQuery handles an EXECUTE_QUERY request from the chaincode.
+func (handler *Handler) afterExecuteQuery(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("[%s]Received %s, invoking rich query on ledger", shortuuid(msg.Uuid), pb.ChaincodeMessage_EXECUTE_QUERY)
+
+	// Query ledger for the matching state
+	handler.handleExecuteQuery(msg)
+}
+
+// Handles rich query to ledger. The results are returned like those of a range query.
+func (handler *Handler) handleExecuteQuery(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterExecuteQuery function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode uuid
+		uniqueReq := handler.createUUIDEntry(msg.Uuid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Uuid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteUUIDEntry(msg.Uuid)
+			chaincodeLogger.Debugf("[%s]handleExecuteQuery serial send %s", shortuuid(serialSendMsg.Uuid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		executeQuery := &pb.ExecuteQuery{}
+		unmarshalErr := proto.Unmarshal(msg.Payload, executeQuery)
+		if unmarshalErr != nil {
+			payload := []byte(unmarshalErr.Error())
+			chaincodeLogger.Errorf("Failed to unmarshall rich query request. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		// The ledger cannot evaluate queries over encrypted values
+		txContext := handler.getTxContext(msg.Uuid)
+		if handler.chaincodeSupport.getSecHelper() != nil && txContext.transactionSecContext != nil &&
+			txContext.transactionSecContext.ConfidentialityLevel == pb.ConfidentialityLevel_CONFIDENTIAL {
+			payload := []byte("Rich queries are not supported for confidential transactions")
+			chaincodeLogger.Errorf("[%s]Rich query in confidential transaction. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		ledgerObj, ledgerErr := ledger.GetLedger()
+		if ledgerErr != nil {
+			payload := []byte(ledgerErr.Error())
+			chaincodeLogger.Errorf("Failed to get ledger. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		chaincodeID := handler.ChaincodeID.Name
+
+		isTransaction := handler.getIsTransaction(msg.Uuid)
+		rangeIter, err := ledgerObj.ExecuteQuery(chaincodeID, executeQuery.Query, !isTransaction)
+		if err != nil {
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("[%s]Failed to execute rich query(%s). Sending %s", shortuuid(msg.Uuid), err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		// Validators may see different results, which must not drive state updates
+		if isTransaction {
+			handler.markNonDeterministic(txContext)
+		}
+
+		serialSendMsg = handler.getRangeQueryResponse(msg, rangeIter)
+	}()
+}
+
+// afterGetHistoryForKey handles a GET_HISTORY_FOR_KEY request from the chaincode.
+func (handler *Handler) afterGetHistoryForKey(e *fsm.Event, state string) {
+	msg, ok := e.Args[0].(*pb.ChaincodeMessage)
+	if !ok {
+		e.Cancel(fmt.Errorf("Received unexpected message type"))
+		return
+	}
+	chaincodeLogger.Debugf("[%s]Received %s, invoking get state history from ledger", shortuuid(msg.Uuid), pb.ChaincodeMessage_GET_HISTORY_FOR_KEY)
+
+	// Query ledger for the history of the key
+	handler.handleGetHistoryForKey(msg)
+}
+
+// Handles query to ledger to get the history of a key
+func (handler *Handler) handleGetHistoryForKey(msg *pb.ChaincodeMessage) {
+	// The defer followed by triggering a go routine dance is needed to ensure that the previous state transition
+	// is completed before the next one is triggered. The previous state transition is deemed complete only when
+	// the afterGetHistoryForKey function is exited.
+	go func() {
+		// Check if this is the unique state request from this chaincode uuid
+		uniqueReq := handler.createUUIDEntry(msg.Uuid)
+		if !uniqueReq {
+			// Drop this request
+			chaincodeLogger.Error("Another state request pending for this Uuid. Cannot process.")
+			return
+		}
+
+		var serialSendMsg *pb.ChaincodeMessage
+
+		defer func() {
+			handler.deleteUUIDEntry(msg.Uuid)
+			chaincodeLogger.Debugf("[%s]handleGetHistoryForKey serial send %s", shortuuid(serialSendMsg.Uuid), serialSendMsg.Type)
+			handler.serialSend(serialSendMsg)
+		}()
+
+		getHistoryForKey := &pb.GetHistoryForKey{}
+		unmarshalErr := proto.Unmarshal(msg.Payload, getHistoryForKey)
+		if unmarshalErr != nil {
+			payload := []byte(unmarshalErr.Error())
+			chaincodeLogger.Errorf("Failed to unmarshall get history request. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		ledgerObj, ledgerErr := ledger.GetLedger()
+		if ledgerErr != nil {
+			payload := []byte(ledgerErr.Error())
+			chaincodeLogger.Errorf("Failed to get ledger. Sending %s", pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+
+		chaincodeID := handler.ChaincodeID.Name
+
+		// The history is kept by each peer and is not rebuilt by state transfer,
+		// validators may see different histories which must not drive state updates
+		if handler.getIsTransaction(msg.Uuid) {
+			handler.markNonDeterministic(handler.getTxContext(msg.Uuid))
+		}
+
+		// The page holds no more modifications than the transaction may still read
+		budget := handler.chaincodeSupport.getTxBudget(msg.Uuid)
+		pageLimit, limitErr := budget.rangeResultsPage(maxRangeQueryStateLimit)
+		if limitErr != nil {
+			chaincodeLogger.Errorf("[%s]State history exceeded the transaction limits. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(limitErr.Error()), Uuid: msg.Uuid}
+			return
+		}
+
+		// The history is paged by block number and sequence within the block, so that
+		// no iterator is kept open between the pages
+		history := &ledger.StateHistoryPage{}
+		var err error
+		if size := ledgerObj.GetBlockchainSize(); size > 0 {
+			history, err = ledgerObj.GetStateHistoryPage(chaincodeID, getHistoryForKey.Key, getHistoryForKey.FromBlock, getHistoryForKey.FromSequence, size-1, int(pageLimit))
+		}
+		if err != nil {
+			payload := []byte(err.Error())
+			chaincodeLogger.Errorf("[%s]Failed to get state history(%s). Sending %s", shortuuid(msg.Uuid), err, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			return
+		}
+		budget.addRangeResults(len(history.Modifications))
+
+		// Deletions are returned with IsDelete set, they have no value to decrypt
+		for _, modification := range history.Modifications {
+			if modification.IsDelete {
+				continue
+			}
 			// Decrypt the data if the confidential is enabled
-			decryptedValue, decryptErr := handler.decrypt(msg.Uuid, value)
+			decryptedValue, decryptErr := handler.decrypt(msg.Uuid, modification.Value)
 			if decryptErr != nil {
 				payload := []byte(decryptErr.Error())
 				chaincodeLogger.Errorf("Failed decrypt value. Sending %s", pb.ChaincodeMessage_ERROR)
 				serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
-
-				rangeIter.Close()
-				handler.deleteRangeQueryIterator(txContext, iterID)
-
 				return
 			}
-			keyAndValue := pb.RangeQueryStateKeyValue{Key: key, Value: decryptedValue}
-			keysAndValues = append(keysAndValues, &keyAndValue)
-
-			hasNext = rangeIter.Next()
-		}
-
-		if !hasNext {
-			rangeIter.Close()
-			handler.deleteRangeQueryIterator(txContext, iterID)
+			modification.Value = decryptedValue
 		}
 
-		payload := &pb.RangeQueryStateResponse{KeysAndValues: keysAndValues, HasMore: hasNext, ID: iterID}
+		payload := &pb.GetHistoryForKeyResponse{Modifications: history.Modifications, HasMore: history.HasMore,
+			NextBlockNumber: history.NextBlockNumber, NextSequence: history.NextSequence}
 		payloadBytes, err := proto.Marshal(payload)
 		if err != nil {
-			rangeIter.Close()
-			handler.deleteRangeQueryIterator(txContext, iterID)
-
-			// Send error msg back to chaincode. GetState will not trigger event
 			payload := []byte(err.Error())
-			chaincodeLogger.Errorf("Failed marshall resopnse. Sending %s", pb.ChaincodeMessage_ERROR)
+			chaincodeLogger.Errorf("Failed marshall response. Sending %s", pb.ChaincodeMessage_ERROR)
 			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
 			return
 		}
 
-		chaincodeLogger.Debugf("Got keys and values. Sending %s", pb.ChaincodeMessage_RESPONSE)
+		chaincodeLogger.Debugf("[%s]Got state history. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_RESPONSE)
 		serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_RESPONSE, Payload: payloadBytes, Uuid: msg.Uuid}
-
 	}()
 }
 
@@ -829,10 +1073,23 @@ func (handler *Handler) handleRangeQueryStateNext(msg *pb.ChaincodeMessage) {
 			return
 		}
 
+		// The page holds no more keys than the transaction may still read
+		budget := handler.chaincodeSupport.getTxBudget(msg.Uuid)
+		pageLimit, limitErr := budget.rangeResultsPage(maxRangeQueryStateLimit)
+		if limitErr != nil {
+			chaincodeLogger.Errorf("[%s]Range query exceeded the transaction limits. Sending %s", shortuuid(msg.Uuid), pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(limitErr.Error()), Uuid: msg.Uuid}
+
+			rangeIter.Close()
+			handler.deleteRangeQueryIterator(txContext, rangeQueryStateNext.ID)
+
+			return
+		}
+
 		var keysAndValues []*pb.RangeQueryStateKeyValue
 		var i = uint32(0)
 		hasNext := true
-		for ; hasNext && i < maxRangeQueryStateLimit; i++ {
+		for ; hasNext && i < pageLimit; i++ {
 			key, value := rangeIter.GetKeyValue()
 			// Decrypt the data if the confidential is enabled
 			decryptedValue, decryptErr := handler.decrypt(msg.Uuid, value)
@@ -851,6 +1108,7 @@ func (handler *Handler) handleRangeQueryStateNext(msg *pb.ChaincodeMessage) {
 
 			hasNext = rangeIter.Next()
 		}
+		budget.addRangeResults(int(i))
 
 		if !hasNext {
 			rangeIter.Close()
@@ -994,6 +1252,15 @@ func (handler *Handler) enterBusyState(e *fsm.Event, state string) {
 			return
 		}
 
+		// The state cannot be updated once the transaction has seen non-deterministic data
+		if handler.isNonDeterministic(msg.Uuid) {
+			payload := []byte(fmt.Sprintf("Cannot handle %s after a rich query or a history read in the same transaction", msg.Type.String()))
+			chaincodeLogger.Errorf("[%s]Cannot handle %s after a non-deterministic read. Sending %s", shortuuid(msg.Uuid), msg.Type.String(), pb.ChaincodeMessage_ERROR)
+			errMsg := &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: payload, Uuid: msg.Uuid}
+			handler.triggerNextState(errMsg, true)
+			return
+		}
+
 		chaincodeLogger.Debugf("[%s]state is %s", shortuuid(msg.Uuid), state)
 		// Check if this is the unique request from this chaincode uuid
 		uniqueReq := handler.createUUIDEntry(msg.Uuid)
@@ -1020,6 +1287,14 @@ func (handler *Handler) enterBusyState(e *fsm.Event, state string) {
 			return
 		}
 
+		// The transaction may not use more than its budget
+		budget := handler.chaincodeSupport.getTxBudget(msg.Uuid)
+		if limitErr := budget.check(); limitErr != nil {
+			chaincodeLogger.Errorf("[%s]Cannot handle %s (%s). Sending %s", shortuuid(msg.Uuid), msg.Type.String(), limitErr, pb.ChaincodeMessage_ERROR)
+			triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(limitErr.Error()), Uuid: msg.Uuid}
+			return
+		}
+
 		chaincodeID := handler.ChaincodeID.Name
 		var err error
 		var res []byte
@@ -1035,20 +1310,31 @@ func (handler *Handler) enterBusyState(e *fsm.Event, state string) {
 			}
 
 			var pVal []byte
-			// Encrypt the data if the confidential is enabled
-			if pVal, err = handler.encrypt(msg.Uuid, putStateInfo.Value); err == nil {
-				// Invoke ledger to put state
-				err = ledgerObj.SetState(chaincodeID, putStateInfo.Key, pVal)
+			// Charge the write to the transaction budget
+			if err = budget.addWrite(chaincodeID, putStateInfo.Key, len(putStateInfo.Value)); err == nil {
+				// Encrypt the data if the confidential is enabled
+				if pVal, err = handler.encrypt(msg.Uuid, putStateInfo.Value); err == nil {
+					// Invoke ledger to put state
+					err = ledgerObj.SetState(chaincodeID, putStateInfo.Key, pVal)
+				}
 			}
 		} else if msg.Type.String() == pb.ChaincodeMessage_DEL_STATE.String() {
 			// Invoke ledger to delete state
 			key := string(msg.Payload)
-			err = ledgerObj.DeleteState(chaincodeID, key)
+			if err = budget.addWrite(chaincodeID, key, 0); err == nil {
+				err = ledgerObj.DeleteState(chaincodeID, key)
+			}
 		} else if msg.Type.String() == pb.ChaincodeMessage_INVOKE_CHAINCODE.String() {
 			//check and prohibit C-call-C for CONFIDENTIAL txs
 			if triggerNextStateMsg = handler.canCallChaincode(msg.Uuid); triggerNextStateMsg != nil {
 				return
 			}
+			if limitErr := budget.enterCall(); limitErr != nil {
+				chaincodeLogger.Errorf("[%s]Cannot invoke chaincode (%s). Sending %s", shortuuid(msg.Uuid), limitErr, pb.ChaincodeMessage_ERROR)
+				triggerNextStateMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(limitErr.Error()), Uuid: msg.Uuid}
+				return
+			}
+			defer budget.exitCall()
 			chaincodeSpec := &pb.ChaincodeSpec{}
 			unmarshalErr := proto.Unmarshal(msg.Payload, chaincodeSpec)
 			if unmarshalErr != nil {
@@ -1327,6 +1613,14 @@ func (handler *Handler) handleQueryChaincode(msg *pb.ChaincodeMessage) {
 			return
 		}
 
+		budget := handler.chaincodeSupport.getTxBudget(msg.Uuid)
+		if limitErr := budget.enterCall(); limitErr != nil {
+			chaincodeLogger.Errorf("[%s]Cannot query chaincode (%s). Sending %s", shortuuid(msg.Uuid), limitErr, pb.ChaincodeMessage_ERROR)
+			serialSendMsg = &pb.ChaincodeMessage{Type: pb.ChaincodeMessage_ERROR, Payload: []byte(limitErr.Error()), Uuid: msg.Uuid}
+			return
+		}
+		defer budget.exitCall()
+
 		chaincodeSpec := &pb.ChaincodeSpec{}
 		unmarshalErr := proto.Unmarshal(msg.Payload, chaincodeSpec)
 		if unmarshalErr != nil {
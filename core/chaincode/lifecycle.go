@@ -0,0 +1,291 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/crypto/utils"
+	"github.com/hyperledger/fabric/core/ledger"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// The lifecycle of a chaincode is written to the state of the ledger by the
+// transactions that terminate or upgrade it, so that every validator agrees on
+// which chaincodes can still be invoked. Lifecycles are kept under the name of
+// the chaincode in a namespace that no chaincode can be deployed with.
+// A deployed chaincode without a lifecycle is active and at version 1.
+const lifecycleNamespace = "__lifecycle"
+
+func getChaincodeLifecycle(ledger *ledger.Ledger, chaincode string, committed bool) (*pb.ChaincodeLifecycle, error) {
+	lifecycleBytes, err := ledger.GetState(lifecycleNamespace, chaincode, committed)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get the lifecycle of chaincode %s (%s)", chaincode, err)
+	}
+	lifecycle := &pb.ChaincodeLifecycle{Status: pb.ChaincodeLifecycle_ACTIVE, Version: 1}
+	if lifecycleBytes == nil {
+		return lifecycle, nil
+	}
+	if err = proto.Unmarshal(lifecycleBytes, lifecycle); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal the lifecycle of chaincode %s (%s)", chaincode, err)
+	}
+	return lifecycle, nil
+}
+
+func putChaincodeLifecycle(ledger *ledger.Ledger, chaincode string, lifecycle *pb.ChaincodeLifecycle) error {
+	lifecycleBytes, err := proto.Marshal(lifecycle)
+	if err != nil {
+		return err
+	}
+	return ledger.SetState(lifecycleNamespace, chaincode, lifecycleBytes)
+}
+
+// checkChaincodeActive returns an error if the chaincode has been terminated
+// or upgraded
+func checkChaincodeActive(chaincode string, committed bool) error {
+	ledger, err := ledger.GetLedger()
+	if err != nil {
+		return fmt.Errorf("Failed to get handle to ledger (%s)", err)
+	}
+	lifecycle, err := getChaincodeLifecycle(ledger, chaincode, committed)
+	if err != nil {
+		return err
+	}
+	if lifecycle.Status == pb.ChaincodeLifecycle_TERMINATED {
+		if lifecycle.UpgradedChaincodeID != "" {
+			return fmt.Errorf("chaincode %s has been upgraded to %s", chaincode, lifecycle.UpgradedChaincodeID)
+		}
+		return fmt.Errorf("chaincode %s has been terminated", chaincode)
+	}
+	return nil
+}
+
+// getTransactionDeploymentSpec returns the chaincode deployed by a deploy or
+// an upgrade transaction
+func getTransactionDeploymentSpec(t *pb.Transaction) (*pb.ChaincodeDeploymentSpec, error) {
+	switch t.Type {
+	case pb.Transaction_CHAINCODE_DEPLOY:
+		cds := &pb.ChaincodeDeploymentSpec{}
+		if err := proto.Unmarshal(t.Payload, cds); err != nil {
+			return nil, err
+		}
+		return cds, nil
+	case pb.Transaction_CHAINCODE_UPGRADE:
+		cus := &pb.ChaincodeUpgradeSpec{}
+		if err := proto.Unmarshal(t.Payload, cus); err != nil {
+			return nil, err
+		}
+		if cus.ChaincodeDeploymentSpec == nil {
+			return nil, fmt.Errorf("upgrade transaction %s has no deployment spec", t.Uuid)
+		}
+		return cus.ChaincodeDeploymentSpec, nil
+	}
+	return nil, fmt.Errorf("transaction %s of type %s does not deploy a chaincode", t.Uuid, t.Type)
+}
+
+// getTxEnrollmentID returns the enrollment ID of the enrollment certificate
+// that signed a transaction, or an empty string if the transaction is signed
+// with a transaction certificate or carries no certificate
+func getTxEnrollmentID(t *pb.Transaction) string {
+	return utils.GetEnrollmentIDFromCert(t.Cert)
+}
+
+// checkChaincodeAdministrator returns an error unless the transaction is
+// signed with the enrollment certificate of an administrator of the deployed
+// chaincode. Without security transactions carry no identity, so anyone
+// can terminate and upgrade chaincodes.
+func (chaincodeSupport *ChaincodeSupport) checkChaincodeAdministrator(cds *pb.ChaincodeDeploymentSpec, t *pb.Transaction) error {
+	if chaincodeSupport.secHelper == nil {
+		return nil
+	}
+	chaincode := cds.ChaincodeSpec.ChaincodeID.Name
+	caller := getTxEnrollmentID(t)
+	if caller == "" {
+		return fmt.Errorf("transaction %s on chaincode %s is not signed with an enrollment certificate", t.Uuid, chaincode)
+	}
+	for _, administrator := range cds.Administrators {
+		if administrator == caller {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an administrator of chaincode %s", caller, chaincode)
+}
+
+// getDeployedChaincode returns the deployment spec and the lifecycle of a
+// deployed chaincode. A chaincode deployed without administrators is
+// administered by the enrollment ID that signed its deployment, if any.
+func (chaincodeSupport *ChaincodeSupport) getDeployedChaincode(ledger *ledger.Ledger, chaincode string) (*pb.ChaincodeDeploymentSpec, *pb.ChaincodeLifecycle, error) {
+	depTx, err := ledger.GetTransactionByUUID(chaincode)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not get deployment transaction for %s - %s", chaincode, err)
+	}
+	if depTx == nil {
+		return nil, nil, fmt.Errorf("deployment transaction does not exist for %s", chaincode)
+	}
+	if nil != chaincodeSupport.secHelper {
+		depTx, err = chaincodeSupport.secHelper.TransactionPreExecution(depTx)
+		if nil != err {
+			return nil, nil, fmt.Errorf("failed tx preexecution%s - %s", chaincode, err)
+		}
+	}
+	cds, err := getTransactionDeploymentSpec(depTx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal deployment transactions for %s - %s", chaincode, err)
+	}
+	if cds.ChaincodeSpec == nil || cds.ChaincodeSpec.ChaincodeID == nil {
+		return nil, nil, fmt.Errorf("deployment transaction for %s has no chaincode spec", chaincode)
+	}
+	if len(cds.Administrators) == 0 {
+		if deployer := getTxEnrollmentID(depTx); deployer != "" {
+			cds.Administrators = []string{deployer}
+		}
+	}
+	lifecycle, err := getChaincodeLifecycle(ledger, chaincode, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cds, lifecycle, nil
+}
+
+// stopDeployedChaincode stops the container of a chaincode that can no longer
+// be invoked. The chaincode is out of the transaction at this point, so
+// failures are only logged.
+func (chaincodeSupport *ChaincodeSupport) stopDeployedChaincode(ctxt context.Context, cds *pb.ChaincodeDeploymentSpec) {
+	if chaincodeSupport.userRunsCC && cds.ExecEnv != pb.ChaincodeDeploymentSpec_SYSTEM {
+		chaincodeLogger.Infof("user runs chaincode, chaincode %s must be stopped by the user", cds.ChaincodeSpec.ChaincodeID.Name)
+		return
+	}
+	if err := chaincodeSupport.Stop(ctxt, cds); err != nil {
+		chaincodeLogger.Warningf("Failed to stop chaincode %s (%s)", cds.ChaincodeSpec.ChaincodeID.Name, err)
+	}
+}
+
+// executeTerminate marks the chaincode of a terminate transaction as
+// terminated and stops it
+func executeTerminate(ctxt context.Context, chain *ChaincodeSupport, ledger *ledger.Ledger, t *pb.Transaction) error {
+	if t.ConfidentialityLevel != pb.ConfidentialityLevel_PUBLIC {
+		return fmt.Errorf("terminate transactions must be public")
+	}
+	ci := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(t.Payload, ci); err != nil {
+		return err
+	}
+	if ci.ChaincodeSpec == nil || ci.ChaincodeSpec.ChaincodeID == nil || ci.ChaincodeSpec.ChaincodeID.Name == "" {
+		return fmt.Errorf("terminate transaction %s does not name a chaincode", t.Uuid)
+	}
+	chaincode := ci.ChaincodeSpec.ChaincodeID.Name
+
+	cds, lifecycle, err := chain.getDeployedChaincode(ledger, chaincode)
+	if err != nil {
+		return err
+	}
+	if lifecycle.Status == pb.ChaincodeLifecycle_TERMINATED {
+		return fmt.Errorf("chaincode %s is already terminated", chaincode)
+	}
+	if err = chain.checkChaincodeAdministrator(cds, t); err != nil {
+		return err
+	}
+
+	markTxBegin(ledger, t)
+	lifecycle.Status = pb.ChaincodeLifecycle_TERMINATED
+	if err = putChaincodeLifecycle(ledger, chaincode, lifecycle); err != nil {
+		markTxFinish(ledger, t, false)
+		return fmt.Errorf("Failed to terminate chaincode %s (%s)", chaincode, err)
+	}
+	markTxFinish(ledger, t, true)
+
+	chain.stopDeployedChaincode(ctxt, cds)
+	return nil
+}
+
+// executeUpgrade deploys the chaincode of an upgrade transaction, optionally
+// with the state of the chaincode it replaces, and terminates the latter
+func executeUpgrade(ctxt context.Context, chain *ChaincodeSupport, ledger *ledger.Ledger, t *pb.Transaction) error {
+	if t.ConfidentialityLevel != pb.ConfidentialityLevel_PUBLIC {
+		return fmt.Errorf("upgrade transactions must be public")
+	}
+	cus := &pb.ChaincodeUpgradeSpec{}
+	if err := proto.Unmarshal(t.Payload, cus); err != nil {
+		return err
+	}
+	cds := cus.ChaincodeDeploymentSpec
+	if cds == nil || cds.ChaincodeSpec == nil || cds.ChaincodeSpec.ChaincodeID == nil {
+		return fmt.Errorf("upgrade transaction %s has no deployment spec", t.Uuid)
+	}
+	if cus.PreviousChaincodeID == nil || cus.PreviousChaincodeID.Name == "" {
+		return fmt.Errorf("upgrade transaction %s does not name the chaincode to upgrade", t.Uuid)
+	}
+	chaincode := cds.ChaincodeSpec.ChaincodeID.Name
+	previous := cus.PreviousChaincodeID.Name
+	if chaincode == previous {
+		return fmt.Errorf("chaincode %s cannot be upgraded to itself", chaincode)
+	}
+
+	previousCds, previousLifecycle, err := chain.getDeployedChaincode(ledger, previous)
+	if err != nil {
+		return err
+	}
+	if previousLifecycle.Status == pb.ChaincodeLifecycle_TERMINATED {
+		return fmt.Errorf("chaincode %s is terminated and cannot be upgraded", previous)
+	}
+	if previousCds.ChaincodeSpec.ConfidentialityLevel != pb.ConfidentialityLevel_PUBLIC {
+		return fmt.Errorf("confidential chaincode %s cannot be upgraded", previous)
+	}
+	if err = chain.checkChaincodeAdministrator(previousCds, t); err != nil {
+		return err
+	}
+
+	if _, err = chain.Deploy(ctxt, t); err != nil {
+		return fmt.Errorf("Failed to deploy chaincode spec(%s)", err)
+	}
+
+	//the state and the lifecycles are updated before launching the new
+	//chaincode so that its Init function runs against the carried state
+	markTxBegin(ledger, t)
+	if cus.CarryState {
+		if err = ledger.CopyState(previous, chaincode); err != nil {
+			markTxFinish(ledger, t, false)
+			return fmt.Errorf("Failed to copy the state of chaincode %s (%s)", previous, err)
+		}
+	}
+	lifecycle := &pb.ChaincodeLifecycle{Status: pb.ChaincodeLifecycle_ACTIVE, Version: previousLifecycle.Version + 1, PreviousChaincodeID: previous}
+	previousLifecycle.Status = pb.ChaincodeLifecycle_TERMINATED
+	previousLifecycle.UpgradedChaincodeID = chaincode
+	if err = putChaincodeLifecycle(ledger, chaincode, lifecycle); err == nil {
+		err = putChaincodeLifecycle(ledger, previous, previousLifecycle)
+	}
+	if err != nil {
+		markTxFinish(ledger, t, false)
+		return fmt.Errorf("Failed to upgrade chaincode %s (%s)", previous, err)
+	}
+	_, _, err = chain.Launch(ctxt, t)
+	if limitErr := chain.getTxBudget(t.Uuid).err(); limitErr != nil {
+		markTxFinish(ledger, t, false)
+		return limitErr
+	}
+	if err != nil {
+		markTxFinish(ledger, t, false)
+		return fmt.Errorf("%s", err)
+	}
+	markTxFinish(ledger, t, true)
+
+	chain.stopDeployedChaincode(ctxt, previousCds)
+	return nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/crypto"
+	"github.com/hyperledger/fabric/core/crypto/utils"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// lifecycleTestPeer stands in for the security helper of a validator whose
+// transactions are already decrypted
+type lifecycleTestPeer struct {
+	crypto.Peer
+}
+
+func (p *lifecycleTestPeer) TransactionPreExecution(tx *pb.Transaction) (*pb.Transaction, error) {
+	return tx, nil
+}
+
+func buildLifecycleTestCert(t *testing.T, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %s", err)
+	}
+	return cert
+}
+
+func newLifecycleTestChain() *ChaincodeSupport {
+	return &ChaincodeSupport{secHelper: &lifecycleTestPeer{}, userRunsCC: true, txBudgets: make(map[string]*txBudget)}
+}
+
+// commitLifecycleTestDeploy commits the deployment of a chaincode signed with
+// the given certificate and returns the name of the chaincode
+func commitLifecycleTestDeploy(t *testing.T, lgr *ledger.Ledger, administrators []string, cert []byte) string {
+	chaincode := util.GenerateUUID()
+	cds := &pb.ChaincodeDeploymentSpec{
+		ChaincodeSpec:  &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincode}},
+		ExecEnv:        pb.ChaincodeDeploymentSpec_DOCKER,
+		Administrators: administrators,
+	}
+	depTx, err := pb.NewChaincodeDeployTransaction(cds, chaincode)
+	if err != nil {
+		t.Fatalf("Error creating deploy transaction: %s", err)
+	}
+	depTx.Cert = cert
+	commitLifecycleTestTxs(t, lgr, depTx)
+	return chaincode
+}
+
+func commitLifecycleTestTxs(t *testing.T, lgr *ledger.Ledger, txs ...*pb.Transaction) {
+	if err := lgr.BeginTxBatch(1); err != nil {
+		t.Fatalf("Error beginning batch: %s", err)
+	}
+	if err := lgr.CommitTxBatch(1, txs, nil, nil); err != nil {
+		t.Fatalf("Error committing batch: %s", err)
+	}
+}
+
+func newLifecycleTestTerminate(t *testing.T, chaincode string, cert []byte) *pb.Transaction {
+	spec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincode}}}
+	tx, err := pb.NewChaincodeExecute(spec, util.GenerateUUID(), pb.Transaction_CHAINCODE_TERMINATE)
+	if err != nil {
+		t.Fatalf("Error creating terminate transaction: %s", err)
+	}
+	tx.Cert = cert
+	return tx
+}
+
+func newLifecycleTestUpgrade(t *testing.T, previous string, cert []byte) *pb.Transaction {
+	chaincode := util.GenerateUUID()
+	cus := &pb.ChaincodeUpgradeSpec{
+		ChaincodeDeploymentSpec: &pb.ChaincodeDeploymentSpec{
+			ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincode}},
+			ExecEnv:       pb.ChaincodeDeploymentSpec_DOCKER,
+		},
+		PreviousChaincodeID: &pb.ChaincodeID{Name: previous},
+	}
+	tx, err := pb.NewChaincodeUpgradeTransaction(cus, chaincode)
+	if err != nil {
+		t.Fatalf("Error creating upgrade transaction: %s", err)
+	}
+	tx.Cert = cert
+	return tx
+}
+
+func expectChaincodeActive(t *testing.T, lgr *ledger.Ledger, chaincode string) {
+	lifecycle, err := getChaincodeLifecycle(lgr, chaincode, true)
+	if err != nil {
+		t.Fatalf("Error getting lifecycle: %s", err)
+	}
+	if lifecycle.Status != pb.ChaincodeLifecycle_ACTIVE {
+		t.Fatalf("Expected chaincode %s to be active, got %s", chaincode, lifecycle.Status)
+	}
+}
+
+func TestGetTxEnrollmentID(t *testing.T) {
+	tx := &pb.Transaction{}
+	if id := getTxEnrollmentID(tx); id != "" {
+		t.Fatalf("Expected no enrollment ID without a certificate, got %s", id)
+	}
+	tx.Cert = []byte("not a certificate")
+	if id := getTxEnrollmentID(tx); id != "" {
+		t.Fatalf("Expected no enrollment ID for an invalid certificate, got %s", id)
+	}
+	tx.Cert = buildLifecycleTestCert(t, utils.TCertSubjectCommonName)
+	if id := getTxEnrollmentID(tx); id != "" {
+		t.Fatalf("Expected no enrollment ID for a TCert, got %s", id)
+	}
+	tx.Cert = buildLifecycleTestCert(t, "alice")
+	if id := getTxEnrollmentID(tx); id != "alice" {
+		t.Fatalf("Expected enrollment ID alice, got %s", id)
+	}
+}
+
+func TestCheckChaincodeAdministrator(t *testing.T) {
+	cds := &pb.ChaincodeDeploymentSpec{
+		ChaincodeSpec:  &pb.ChaincodeSpec{ChaincodeID: &pb.ChaincodeID{Name: "mycc"}},
+		Administrators: []string{"alice", "bob"},
+	}
+	chain := newLifecycleTestChain()
+
+	for _, admin := range []string{"alice", "bob"} {
+		tx := &pb.Transaction{Uuid: "tx", Cert: buildLifecycleTestCert(t, admin)}
+		if err := chain.checkChaincodeAdministrator(cds, tx); err != nil {
+			t.Fatalf("Expected %s to administer the chaincode, got %s", admin, err)
+		}
+	}
+	rejected := map[string]*pb.Transaction{
+		"another user":   {Uuid: "tx", Cert: buildLifecycleTestCert(t, "carol")},
+		"a TCert":        {Uuid: "tx", Cert: buildLifecycleTestCert(t, utils.TCertSubjectCommonName)},
+		"no certificate": {Uuid: "tx"},
+	}
+	for name, tx := range rejected {
+		if err := chain.checkChaincodeAdministrator(cds, tx); err == nil {
+			t.Fatalf("Expected a transaction signed with %s to be rejected", name)
+		}
+	}
+
+	// without security transactions carry no identity and are not checked
+	chain.secHelper = nil
+	if err := chain.checkChaincodeAdministrator(cds, &pb.Transaction{Uuid: "tx"}); err != nil {
+		t.Fatalf("Expected no check without security, got %s", err)
+	}
+}
+
+func TestTerminateAndUpgradeByNonAdministrator(t *testing.T) {
+	viper.Set("peer.fileSystemPath", "/var/hyperledger/test/tmpdb")
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		t.Fatalf("Error getting ledger: %s", err)
+	}
+	ctxt := context.Background()
+	chain := newLifecycleTestChain()
+	alice := buildLifecycleTestCert(t, "alice")
+	bob := buildLifecycleTestCert(t, "bob")
+
+	chaincode := commitLifecycleTestDeploy(t, lgr, []string{"alice"}, buildLifecycleTestCert(t, utils.TCertSubjectCommonName))
+
+	// bob neither deployed nor administers the chaincode
+	if err = executeTerminate(ctxt, chain, lgr, newLifecycleTestTerminate(t, chaincode, bob)); err == nil {
+		t.Fatalf("Expected the terminate transaction of a non-administrator to be rejected")
+	}
+	if err = executeUpgrade(ctxt, chain, lgr, newLifecycleTestUpgrade(t, chaincode, bob)); err == nil {
+		t.Fatalf("Expected the upgrade transaction of a non-administrator to be rejected")
+	}
+	// a TCert of alice cannot be linked to her
+	if err = executeTerminate(ctxt, chain, lgr, newLifecycleTestTerminate(t, chaincode, buildLifecycleTestCert(t, utils.TCertSubjectCommonName))); err == nil {
+		t.Fatalf("Expected a terminate transaction signed with a TCert to be rejected")
+	}
+	expectChaincodeActive(t, lgr, chaincode)
+
+	terminateTx := newLifecycleTestTerminate(t, chaincode, alice)
+	if err = lgr.BeginTxBatch(1); err != nil {
+		t.Fatalf("Error beginning batch: %s", err)
+	}
+	if err = executeTerminate(ctxt, chain, lgr, terminateTx); err != nil {
+		t.Fatalf("Expected the administrator to terminate the chaincode, got %s", err)
+	}
+	if err = lgr.CommitTxBatch(1, []*pb.Transaction{terminateTx}, nil, nil); err != nil {
+		t.Fatalf("Error committing batch: %s", err)
+	}
+	if err = checkChaincodeActive(chaincode, true); err == nil {
+		t.Fatalf("Expected chaincode %s to be terminated", chaincode)
+	}
+}
+
+func TestTerminateByDeployer(t *testing.T) {
+	viper.Set("peer.fileSystemPath", "/var/hyperledger/test/tmpdb")
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		t.Fatalf("Error getting ledger: %s", err)
+	}
+	ctxt := context.Background()
+	chain := newLifecycleTestChain()
+
+	// without administrators, the enrollment ID that signed the deployment
+	// administers the chaincode
+	chaincode := commitLifecycleTestDeploy(t, lgr, nil, buildLifecycleTestCert(t, "carol"))
+	if err = executeUpgrade(ctxt, chain, lgr, newLifecycleTestUpgrade(t, chaincode, buildLifecycleTestCert(t, "bob"))); err == nil {
+		t.Fatalf("Expected the upgrade transaction of a non-deployer to be rejected")
+	}
+	expectChaincodeActive(t, lgr, chaincode)
+
+	terminateTx := newLifecycleTestTerminate(t, chaincode, buildLifecycleTestCert(t, "carol"))
+	if err = lgr.BeginTxBatch(1); err != nil {
+		t.Fatalf("Error beginning batch: %s", err)
+	}
+	if err = executeTerminate(ctxt, chain, lgr, terminateTx); err != nil {
+		t.Fatalf("Expected the deployer to terminate the chaincode, got %s", err)
+	}
+	if err = lgr.CommitTxBatch(1, []*pb.Transaction{terminateTx}, nil, nil); err != nil {
+		t.Fatalf("Error committing batch: %s", err)
+	}
+	if err = checkChaincodeActive(chaincode, true); err == nil {
+		t.Fatalf("Expected chaincode %s to be terminated", chaincode)
+	}
+
+	// a chaincode deployed with a TCert and no administrators has none
+	chaincode = commitLifecycleTestDeploy(t, lgr, nil, buildLifecycleTestCert(t, utils.TCertSubjectCommonName))
+	if err = executeTerminate(ctxt, chain, lgr, newLifecycleTestTerminate(t, chaincode, buildLifecycleTestCert(t, "carol"))); err == nil {
+		t.Fatalf("Expected the chaincode to have no administrator")
+	}
+	expectChaincodeActive(t, lgr, chaincode)
+}
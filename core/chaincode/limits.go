@@ -0,0 +1,278 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Error codes of the results of the transactions which failed
+const (
+	// TxErrorCodeFailed is set when the chaincode or the peer failed to execute the transaction
+	TxErrorCodeFailed uint32 = 1
+	// TxErrorCodeLimitExceeded is set when the transaction exceeded one of its resource limits
+	TxErrorCodeLimitExceeded uint32 = 2
+)
+
+// Names of the resource limits, as reported by LimitExceededError
+const (
+	limitKeysWritten  = "keys written"
+	limitBytesWritten = "bytes written"
+	limitRangeResults = "range query results"
+	limitCallDepth    = "call depth"
+	limitTime         = "execution time"
+)
+
+// LimitExceededError is returned when a transaction exceeds one of its resource
+// limits. The transaction is then aborted, whatever the chaincode returns.
+type LimitExceededError struct {
+	UUID  string
+	Limit string
+	Max   int64
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("Transaction %s exceeded its limit of %d %s", e.UUID, e.Max, e.Limit)
+}
+
+// txLimits are the resources a transaction may use, including the chaincodes
+// it invokes. Zero means unlimited
+type txLimits struct {
+	maxKeysWritten  int
+	maxBytesWritten int
+	maxRangeResults int
+	maxCallDepth    int
+	maxTime         time.Duration
+}
+
+// getTxLimits reads the limits from chaincode.limits
+func getTxLimits() txLimits {
+	return txLimits{
+		maxKeysWritten:  viper.GetInt("chaincode.limits.maxKeysWritten"),
+		maxBytesWritten: viper.GetInt("chaincode.limits.maxBytesWritten"),
+		maxRangeResults: viper.GetInt("chaincode.limits.maxRangeResults"),
+		maxCallDepth:    viper.GetInt("chaincode.limits.maxCallDepth"),
+		maxTime:         time.Duration(viper.GetInt("chaincode.limits.maxTime")) * time.Millisecond,
+	}
+}
+
+func (limits txLimits) unlimited() bool {
+	return limits == txLimits{}
+}
+
+// txBudget tracks the resources used by a transaction against its limits. It is
+// shared by the handlers of the chaincodes the transaction invokes. A nil budget
+// is unlimited
+type txBudget struct {
+	sync.Mutex
+	uuid     string
+	limits   txLimits
+	deadline time.Time
+
+	keysWritten  map[string]bool // keys written, by chaincode and key
+	bytesWritten int
+	rangeResults int
+	callDepth    int
+
+	// the first limit exceeded, the transaction is aborted once it is set
+	exceeded *LimitExceededError
+}
+
+func newTxBudget(uuid string, limits txLimits) *txBudget {
+	budget := &txBudget{uuid: uuid, limits: limits, keysWritten: make(map[string]bool)}
+	if limits.maxTime > 0 {
+		budget.deadline = time.Now().Add(limits.maxTime)
+	}
+	return budget
+}
+
+// exceed records that the limit was exceeded, and returns the first limit
+// exceeded by the transaction. The budget must be locked
+func (budget *txBudget) exceed(limit string, max int64) error {
+	if budget.exceeded == nil {
+		chaincodeLogger.Warningf("[%s]Transaction exceeded its limit of %d %s", shortuuid(budget.uuid), max, limit)
+		budget.exceeded = &LimitExceededError{UUID: budget.uuid, Limit: limit, Max: max}
+	}
+	return budget.exceeded
+}
+
+// checkLocked returns an error if a limit was exceeded or the transaction ran
+// out of time. The budget must be locked
+func (budget *txBudget) checkLocked() error {
+	if budget.exceeded != nil {
+		return budget.exceeded
+	}
+	if !budget.deadline.IsZero() && time.Now().After(budget.deadline) {
+		return budget.exceed(limitTime, int64(budget.limits.maxTime/time.Millisecond))
+	}
+	return nil
+}
+
+// check returns an error if a limit was exceeded or the transaction ran out of time
+func (budget *txBudget) check() error {
+	if budget == nil {
+		return nil
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	return budget.checkLocked()
+}
+
+// err returns the first limit exceeded by the transaction, if any
+func (budget *txBudget) err() error {
+	if budget == nil {
+		return nil
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	if budget.exceeded == nil {
+		return nil
+	}
+	return budget.exceeded
+}
+
+// timeout returns the time left to the transaction, if less than timeout
+func (budget *txBudget) timeout(timeout time.Duration) time.Duration {
+	if budget == nil || budget.deadline.IsZero() {
+		return timeout
+	}
+	if left := budget.deadline.Sub(time.Now()); left < timeout {
+		return left
+	}
+	return timeout
+}
+
+// addWrite charges the write of size bytes to the key of the chaincode, deletes
+// writing no bytes
+func (budget *txBudget) addWrite(chaincodeID string, key string, size int) error {
+	if budget == nil {
+		return nil
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	if err := budget.checkLocked(); err != nil {
+		return err
+	}
+	qualifiedKey := chaincodeID + "\x00" + key
+	if !budget.keysWritten[qualifiedKey] {
+		if max := budget.limits.maxKeysWritten; max > 0 && len(budget.keysWritten) >= max {
+			return budget.exceed(limitKeysWritten, int64(max))
+		}
+		budget.keysWritten[qualifiedKey] = true
+	}
+	if max := budget.limits.maxBytesWritten; max > 0 && budget.bytesWritten+size > max {
+		return budget.exceed(limitBytesWritten, int64(max))
+	}
+	budget.bytesWritten += size
+	return nil
+}
+
+// rangeResultsPage returns how many keys, up to page, the next page of a range
+// or rich query may return, so the chaincode is only charged for the keys it is
+// sent. It returns an error if the transaction has none left; the keys sent must
+// then be charged with addRangeResults
+func (budget *txBudget) rangeResultsPage(page uint32) (uint32, error) {
+	if budget == nil {
+		return page, nil
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	if err := budget.checkLocked(); err != nil {
+		return 0, err
+	}
+	max := budget.limits.maxRangeResults
+	if max <= 0 {
+		return page, nil
+	}
+	left := max - budget.rangeResults
+	if left <= 0 {
+		return 0, budget.exceed(limitRangeResults, int64(max))
+	}
+	if uint32(left) < page {
+		return uint32(left), nil
+	}
+	return page, nil
+}
+
+// addRangeResults charges the keys sent in a page of a range or rich query
+func (budget *txBudget) addRangeResults(n int) {
+	if budget == nil {
+		return
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	budget.rangeResults += n
+}
+
+// enterCall charges a call to another chaincode, which must be followed by
+// exitCall if it succeeds
+func (budget *txBudget) enterCall() error {
+	if budget == nil {
+		return nil
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	if err := budget.checkLocked(); err != nil {
+		return err
+	}
+	if max := budget.limits.maxCallDepth; max > 0 && budget.callDepth >= max {
+		return budget.exceed(limitCallDepth, int64(max))
+	}
+	budget.callDepth++
+	return nil
+}
+
+// exitCall returns from a call to another chaincode
+func (budget *txBudget) exitCall() {
+	if budget == nil {
+		return
+	}
+	budget.Lock()
+	defer budget.Unlock()
+	budget.callDepth--
+}
+
+// beginTxBudget starts tracking the resources used by the transaction, it
+// returns nil if no limits are configured
+func (chaincodeSupport *ChaincodeSupport) beginTxBudget(uuid string) *txBudget {
+	if chaincodeSupport.txLimits.unlimited() {
+		return nil
+	}
+	budget := newTxBudget(uuid, chaincodeSupport.txLimits)
+	chaincodeSupport.txBudgetsLock.Lock()
+	defer chaincodeSupport.txBudgetsLock.Unlock()
+	chaincodeSupport.txBudgets[uuid] = budget
+	return budget
+}
+
+// getTxBudget returns the budget of the transaction, nil if it is unlimited
+func (chaincodeSupport *ChaincodeSupport) getTxBudget(uuid string) *txBudget {
+	chaincodeSupport.txBudgetsLock.Lock()
+	defer chaincodeSupport.txBudgetsLock.Unlock()
+	return chaincodeSupport.txBudgets[uuid]
+}
+
+// endTxBudget stops tracking the resources used by the transaction
+func (chaincodeSupport *ChaincodeSupport) endTxBudget(uuid string) {
+	chaincodeSupport.txBudgetsLock.Lock()
+	defer chaincodeSupport.txBudgetsLock.Unlock()
+	delete(chaincodeSupport.txBudgets, uuid)
+}
@@ -0,0 +1,248 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chaincode
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/container/inproccontroller"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/util"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+func expectLimitExceeded(t *testing.T, err error, limit string) {
+	limitErr, ok := err.(*LimitExceededError)
+	if !ok {
+		t.Fatalf("Expected the %s limit to be exceeded, got %v", limit, err)
+	}
+	if limitErr.Limit != limit {
+		t.Fatalf("Expected the %s limit to be exceeded, got the %s limit", limit, limitErr.Limit)
+	}
+}
+
+func TestTxBudgetWrites(t *testing.T) {
+	budget := newTxBudget("tx1", txLimits{maxKeysWritten: 2, maxBytesWritten: 10})
+
+	if err := budget.addWrite("cc1", "a", 4); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// writing the same key again does not count as another key
+	if err := budget.addWrite("cc1", "a", 4); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	// the same key of another chaincode is another key
+	if err := budget.addWrite("cc2", "a", 0); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expectLimitExceeded(t, budget.addWrite("cc1", "b", 0), limitKeysWritten)
+
+	// once a limit is exceeded, the transaction is aborted
+	expectLimitExceeded(t, budget.addWrite("cc1", "a", 0), limitKeysWritten)
+	expectLimitExceeded(t, budget.err(), limitKeysWritten)
+
+	budget = newTxBudget("tx2", txLimits{maxBytesWritten: 10})
+	if err := budget.addWrite("cc1", "a", 10); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expectLimitExceeded(t, budget.addWrite("cc1", "a", 1), limitBytesWritten)
+}
+
+func TestTxBudgetRangeResultsAndCalls(t *testing.T) {
+	budget := newTxBudget("tx1", txLimits{maxRangeResults: 150, maxCallDepth: 1})
+
+	// pages are clamped to the keys the transaction may still read
+	if page, err := budget.rangeResultsPage(100); err != nil || page != 100 {
+		t.Fatalf("Expected a full page, got %d (%v)", page, err)
+	}
+	budget.addRangeResults(100)
+	if page, err := budget.rangeResultsPage(100); err != nil || page != 50 {
+		t.Fatalf("Expected a page of the 50 keys left, got %d (%v)", page, err)
+	}
+	budget.addRangeResults(50)
+	_, err := budget.rangeResultsPage(100)
+	expectLimitExceeded(t, err, limitRangeResults)
+
+	budget = newTxBudget("tx2", txLimits{maxCallDepth: 1})
+	if err := budget.enterCall(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	budget.exitCall()
+	// sequential calls do not nest
+	if err := budget.enterCall(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expectLimitExceeded(t, budget.enterCall(), limitCallDepth)
+}
+
+func TestTxBudgetTime(t *testing.T) {
+	budget := newTxBudget("tx1", txLimits{maxTime: 50 * time.Millisecond})
+	if timeout := budget.timeout(time.Minute); timeout > 50*time.Millisecond {
+		t.Errorf("Expected the timeout to be bounded by the time limit, got %s", timeout)
+	}
+	if err := budget.check(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	expectLimitExceeded(t, budget.check(), limitTime)
+	expectLimitExceeded(t, budget.addWrite("cc1", "a", 0), limitTime)
+}
+
+func TestTxBudgetUnlimited(t *testing.T) {
+	var budget *txBudget
+	if budget.addWrite("cc1", "a", 1<<20) != nil || budget.enterCall() != nil || budget.err() != nil {
+		t.Errorf("Expected a nil budget to be unlimited")
+	}
+	if page, err := budget.rangeResultsPage(100); err != nil || page != 100 {
+		t.Errorf("Expected a nil budget not to clamp range query pages, got %d", page)
+	}
+	budget.addRangeResults(100)
+	budget.exitCall()
+	if timeout := budget.timeout(time.Minute); timeout != time.Minute {
+		t.Errorf("Expected a nil budget not to bound the timeout, got %s", timeout)
+	}
+
+	chain := &ChaincodeSupport{txBudgets: make(map[string]*txBudget)}
+	if chain.beginTxBudget("tx1") != nil || chain.getTxBudget("tx1") != nil {
+		t.Errorf("Expected no budget without limits")
+	}
+	chain.txLimits = txLimits{maxCallDepth: 1}
+	budget = chain.beginTxBudget("tx1")
+	if budget == nil || chain.getTxBudget("tx1") != budget {
+		t.Fatalf("Expected the budget of the transaction to be tracked")
+	}
+	chain.endTxBudget("tx1")
+	if chain.getTxBudget("tx1") != nil {
+		t.Errorf("Expected the budget of the transaction to be released")
+	}
+}
+
+// limitsTestChaincode runs in-process and ignores the errors returned when it
+// exceeds the limits of the transaction
+type limitsTestChaincode struct{}
+
+func (cc *limitsTestChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, nil
+}
+
+// Invoke "put" writes its arguments as keys, "range" reads as many keys of the
+// range from its first to its second argument as its third argument
+func (cc *limitsTestChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	switch function {
+	case "put":
+		for _, key := range args {
+			stub.PutState(key, []byte(key))
+		}
+	case "range":
+		n, _ := strconv.Atoi(args[2])
+		iter, err := stub.RangeQueryState(args[0], args[1])
+		if err != nil {
+			return nil, nil
+		}
+		defer iter.Close()
+		for i := 0; i < n && iter.HasNext(); i++ {
+			if _, _, err = iter.Next(); err != nil {
+				break
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (cc *limitsTestChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, nil
+}
+
+// executeLimitsTestTx executes the transaction in a batch of its own, which is
+// committed, and returns its result
+func executeLimitsTestTx(t *testing.T, lgr *ledger.Ledger, tx *pb.Transaction) *pb.TransactionResult {
+	if err := lgr.BeginTxBatch(1); err != nil {
+		t.Fatalf("Error beginning batch: %s", err)
+	}
+	succeeded, _, results, err := ExecuteTransactions(context.Background(), DefaultChain, []*pb.Transaction{tx})
+	if err != nil {
+		t.Fatalf("Error executing transaction: %s", err)
+	}
+	if err = lgr.CommitTxBatch(1, succeeded, results, nil); err != nil {
+		t.Fatalf("Error committing batch: %s", err)
+	}
+	return results[0]
+}
+
+func TestLimitsAbortTransaction(t *testing.T) {
+	viper.Set("peer.fileSystemPath", "/var/hyperledger/test/tmpdb")
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		t.Fatalf("Error getting ledger: %s", err)
+	}
+	getPeerEndpoint := func() (*pb.PeerEndpoint, error) {
+		return &pb.PeerEndpoint{ID: &pb.PeerID{Name: "testpeer"}, Address: "0.0.0.0:21727"}, nil
+	}
+	chain := NewChaincodeSupport(DefaultChain, getPeerEndpoint, false, 5*time.Second, nil)
+
+	path := "github.com/hyperledger/fabric/core/chaincode/limits_test"
+	if err = inproccontroller.Register(path, &limitsTestChaincode{}); err != nil {
+		t.Fatalf("Error registering chaincode: %s", err)
+	}
+	chaincode := "limits_" + util.GenerateUUID()
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincode, Path: path}, CtorMsg: &pb.ChaincodeInput{}}
+	cds := &pb.ChaincodeDeploymentSpec{ExecEnv: pb.ChaincodeDeploymentSpec_SYSTEM, ChaincodeSpec: spec}
+	depTx, err := pb.NewChaincodeDeployTransaction(cds, chaincode)
+	if err != nil {
+		t.Fatalf("Error creating deploy transaction: %s", err)
+	}
+	if result := executeLimitsTestTx(t, lgr, depTx); result.ErrorCode != 0 {
+		t.Fatalf("Error deploying chaincode: %s", result.Error)
+	}
+	defer chain.Stop(context.Background(), cds)
+
+	invoke := func(function string, args ...string) *pb.TransactionResult {
+		invocation := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Name: chaincode, Path: path}, CtorMsg: &pb.ChaincodeInput{Function: function, Args: args}}}
+		tx, err := pb.NewChaincodeExecute(invocation, util.GenerateUUID(), pb.Transaction_CHAINCODE_INVOKE)
+		if err != nil {
+			t.Fatalf("Error creating invoke transaction: %s", err)
+		}
+		return executeLimitsTestTx(t, lgr, tx)
+	}
+	expectErrorCode := func(result *pb.TransactionResult, code uint32) {
+		if result.ErrorCode != code {
+			t.Fatalf("Expected error code %d, got %d (%s)", code, result.ErrorCode, result.Error)
+		}
+	}
+
+	expectErrorCode(invoke("put", "k1", "k2", "k3", "k4", "k5"), 0)
+
+	// the chaincode ignores the error of its third write, the transaction
+	// is aborted with its first two writes
+	chain.txLimits = txLimits{maxKeysWritten: 2}
+	expectErrorCode(invoke("put", "x", "y", "z"), TxErrorCodeLimitExceeded)
+	if value, err := lgr.GetState(chaincode, "x", true); err != nil || value != nil {
+		t.Fatalf("Expected the writes of the aborted transaction to be discarded, got %s (%v)", value, err)
+	}
+
+	// the keys a chaincode reads within its budget are not charged for the
+	// rest of the page
+	chain.txLimits = txLimits{maxRangeResults: 3}
+	expectErrorCode(invoke("range", "k1", "k9", "3"), 0)
+	expectErrorCode(invoke("range", "k1", "k9", "5"), TxErrorCodeLimitExceeded)
+}
@@ -20,6 +20,7 @@ package shim
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
@@ -68,7 +69,24 @@ type Chaincode interface {
 type ChaincodeStub struct {
 	UUID            string
 	securityContext *pb.ChaincodeSecurityContext
-	chaincodeEvent  *pb.ChaincodeEvent
+	chaincodeEvents []*pb.ChaincodeEvent
+	handler         stubHandler
+}
+
+// stubHandler serves the state and chaincode calls of a ChaincodeStub. It is
+// implemented by the Handler which talks to the validating peer, and by the
+// MockStub used to unit test chaincodes.
+type stubHandler interface {
+	handleGetState(key string, uuid string) ([]byte, error)
+	handlePutState(key string, value []byte, uuid string) error
+	handleDelState(key string, uuid string) error
+	handleRangeQueryState(startKey, endKey string, uuid string) (*pb.RangeQueryStateResponse, error)
+	handleExecuteQuery(query string, uuid string) (*pb.RangeQueryStateResponse, error)
+	handleRangeQueryStateNext(id, uuid string) (*pb.RangeQueryStateResponse, error)
+	handleRangeQueryStateClose(id, uuid string) (*pb.RangeQueryStateResponse, error)
+	handleGetHistoryForKey(key string, fromBlock uint64, fromSequence uint64, uuid string) (*pb.GetHistoryForKeyResponse, error)
+	handleInvokeChaincode(chaincodeName string, function string, args []string, uuid string) ([]byte, error)
+	handleQueryChaincode(chaincodeName string, function string, args []string, uuid string) ([]byte, error)
 }
 
 // Peer address derived from command line or env var
@@ -244,7 +262,8 @@ func chatWithPeer(chaincodename string, stream PeerChaincodeStream, cc Chaincode
 }
 
 // -- init stub ---
-func (stub *ChaincodeStub) init(uuid string, secContext *pb.ChaincodeSecurityContext) {
+func (stub *ChaincodeStub) init(handler stubHandler, uuid string, secContext *pb.ChaincodeSecurityContext) {
+	stub.handler = handler
 	stub.UUID = uuid
 	stub.securityContext = secContext
 }
@@ -258,38 +277,38 @@ func (stub *ChaincodeStub) init(uuid string, secContext *pb.ChaincodeSecurityCon
 // same transaction context; that is, chaincode calling chaincode doesn't
 // create a new transaction message.
 func (stub *ChaincodeStub) InvokeChaincode(chaincodeName string, function string, args []string) ([]byte, error) {
-	return handler.handleInvokeChaincode(chaincodeName, function, args, stub.UUID)
+	return stub.handler.handleInvokeChaincode(chaincodeName, function, args, stub.UUID)
 }
 
 // QueryChaincode locally calls the specified chaincode `Query` using the
 // same transaction context; that is, chaincode calling chaincode doesn't
 // create a new transaction message.
 func (stub *ChaincodeStub) QueryChaincode(chaincodeName string, function string, args []string) ([]byte, error) {
-	return handler.handleQueryChaincode(chaincodeName, function, args, stub.UUID)
+	return stub.handler.handleQueryChaincode(chaincodeName, function, args, stub.UUID)
 }
 
 // --------- State functions ----------
 
 // GetState returns the byte array value specified by the `key`.
 func (stub *ChaincodeStub) GetState(key string) ([]byte, error) {
-	return handler.handleGetState(key, stub.UUID)
+	return stub.handler.handleGetState(key, stub.UUID)
 }
 
 // PutState writes the specified `value` and `key` into the ledger.
 func (stub *ChaincodeStub) PutState(key string, value []byte) error {
-	return handler.handlePutState(key, value, stub.UUID)
+	return stub.handler.handlePutState(key, value, stub.UUID)
 }
 
 // DelState removes the specified `key` and its value from the ledger.
 func (stub *ChaincodeStub) DelState(key string) error {
-	return handler.handleDelState(key, stub.UUID)
+	return stub.handler.handleDelState(key, stub.UUID)
 }
 
 //ReadCertAttribute is used to read an specific attribute from the transaction certificate, *attributeName* is passed as input parameter to this function.
 // Example:
 //  attrValue,error:=stub.ReadCertAttribute("position")
 func (stub *ChaincodeStub) ReadCertAttribute(attributeName string) ([]byte, error) {
-	attributesHandler, err := attr.NewAttributesHandlerImpl(stub)
+	attributesHandler, err := stub.attributesHandler()
 	if err != nil {
 		return nil, err
 	}
@@ -300,7 +319,7 @@ func (stub *ChaincodeStub) ReadCertAttribute(attributeName string) ([]byte, erro
 //Example:
 //    containsAttr, error := stub.VerifyAttribute("position", "Software Engineer")
 func (stub *ChaincodeStub) VerifyAttribute(attributeName string, attributeValue []byte) (bool, error) {
-	attributesHandler, err := attr.NewAttributesHandlerImpl(stub)
+	attributesHandler, err := stub.attributesHandler()
 	if err != nil {
 		return false, err
 	}
@@ -311,17 +330,31 @@ func (stub *ChaincodeStub) VerifyAttribute(attributeName string, attributeValue
 // Example:
 //    containsAttrs, error:= stub.VerifyAttributes(&attr.Attribute{"position",  "Software Engineer"}, &attr.Attribute{"company", "ACompany"})
 func (stub *ChaincodeStub) VerifyAttributes(attrs ...*attr.Attribute) (bool, error) {
-	attributesHandler, err := attr.NewAttributesHandlerImpl(stub)
+	attributesHandler, err := stub.attributesHandler()
 	if err != nil {
 		return false, err
 	}
 	return attributesHandler.VerifyAttributes(attrs...)
 }
 
+// attributesSource is implemented by stub handlers which provide the
+// attributes of the caller themselves, instead of reading them from the
+// caller certificate
+type attributesSource interface {
+	attributesHandler() (attr.AttributesHandler, error)
+}
+
+func (stub *ChaincodeStub) attributesHandler() (attr.AttributesHandler, error) {
+	if source, ok := stub.handler.(attributesSource); ok {
+		return source.attributesHandler()
+	}
+	return attr.NewAttributesHandlerImpl(stub)
+}
+
 // StateRangeQueryIterator allows a chaincode to iterate over a range of
 // key/value pairs in the state.
 type StateRangeQueryIterator struct {
-	handler    *Handler
+	handler    stubHandler
 	uuid       string
 	response   *pb.RangeQueryStateResponse
 	currentLoc int
@@ -333,11 +366,26 @@ type StateRangeQueryIterator struct {
 // between the startKey and endKey, inclusive. The order in which keys are
 // returned by the iterator is random.
 func (stub *ChaincodeStub) RangeQueryState(startKey, endKey string) (*StateRangeQueryIterator, error) {
-	response, err := handler.handleRangeQueryState(startKey, endKey, stub.UUID)
+	response, err := stub.handler.handleRangeQueryState(startKey, endKey, stub.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return &StateRangeQueryIterator{stub.handler, stub.UUID, response, 0}, nil
+}
+
+// ExecuteQuery function can be invoked by a chaincode to run a rich query
+// over its state values that are JSON objects. The query selects values by
+// field equality and ranges, and can sort and limit the results, e.g.
+//  {"selector": {"owner": "alice", "size": {"$gt": 10}}, "sort": ["size"], "limit": 5}
+// The validating peer must have rich queries enabled. The results depend on
+// the state of the peer that runs the query and are not deterministic, so a
+// transaction cannot update the state after it has called ExecuteQuery.
+func (stub *ChaincodeStub) ExecuteQuery(query string) (*StateRangeQueryIterator, error) {
+	response, err := stub.handler.handleExecuteQuery(query, stub.UUID)
 	if err != nil {
 		return nil, err
 	}
-	return &StateRangeQueryIterator{handler, stub.UUID, response, 0}, nil
+	return &StateRangeQueryIterator{stub.handler, stub.UUID, response, 0}, nil
 }
 
 // HasNext returns true if the range query iterator contains additional keys
@@ -380,6 +428,62 @@ func (iter *StateRangeQueryIterator) Close() error {
 	return err
 }
 
+// HistoryQueryIterator allows a chaincode to iterate over the committed
+// modifications of a key.
+type HistoryQueryIterator struct {
+	handler    stubHandler
+	uuid       string
+	key        string
+	response   *pb.GetHistoryForKeyResponse
+	currentLoc int
+}
+
+// GetHistoryForKey function can be invoked by a chaincode to retrieve the
+// committed modifications of a key, ordered by block number and by position
+// within the block. Only modifications made by committed transactions are
+// returned; changes made by the current transaction are not included. A
+// deletion of the key is returned with IsDelete set and no value. The
+// modifications are fetched from the validating peer a page at a time.
+// The validating peer must have the ledger history enabled, and an error is
+// returned if its history does not cover the whole blockchain (e.g. it was
+// enabled later, or blocks were received through state transfer). The history
+// is kept by each peer and may differ between validators, so a transaction
+// cannot update the state after it has called GetHistoryForKey.
+func (stub *ChaincodeStub) GetHistoryForKey(key string) (*HistoryQueryIterator, error) {
+	response, err := stub.handler.handleGetHistoryForKey(key, 0, 0, stub.UUID)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryQueryIterator{stub.handler, stub.UUID, key, response, 0}, nil
+}
+
+// HasNext returns true if the history query iterator contains additional
+// modifications.
+func (iter *HistoryQueryIterator) HasNext() bool {
+	return iter.currentLoc < len(iter.response.Modifications) || iter.response.HasMore
+}
+
+// Next returns the next modification in the history query iterator.
+func (iter *HistoryQueryIterator) Next() (*pb.KeyModification, error) {
+	if iter.currentLoc >= len(iter.response.Modifications) {
+		if !iter.response.HasMore {
+			return nil, errors.New("No such modification")
+		}
+		response, err := iter.handler.handleGetHistoryForKey(iter.key, iter.response.NextBlockNumber, iter.response.NextSequence, iter.uuid)
+		if err != nil {
+			return nil, err
+		}
+		if len(response.Modifications) == 0 {
+			return nil, errors.New("No such modification")
+		}
+		iter.currentLoc = 0
+		iter.response = response
+	}
+	modification := iter.response.Modifications[iter.currentLoc]
+	iter.currentLoc++
+	return modification, nil
+}
+
 // TABLE FUNCTIONALITY
 // TODO More comments here with documentation
 
@@ -435,6 +539,9 @@ func (stub *ChaincodeStub) CreateTable(name string, columnDefinitions []*ColumnD
 
 		if definition.Key {
 			hasKey = true
+			if definition.Indexed {
+				return fmt.Errorf("Column definition %s is invalid. Key columns cannot be indexed.", definition.Name)
+			}
 		}
 	}
 
@@ -488,6 +595,23 @@ func (stub *ChaincodeStub) DeleteTable(tableName string) error {
 		}
 	}
 
+	// Delete index entries
+	indexIter, err := stub.RangeQueryState(tableNameKey+indexKeySeparator, tableNameKey+indexKeyEnd)
+	if err != nil {
+		return fmt.Errorf("Error deleting table: %s", err)
+	}
+	defer indexIter.Close()
+	for indexIter.HasNext() {
+		key, _, err := indexIter.Next()
+		if err != nil {
+			return fmt.Errorf("Error deleting table: %s", err)
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return fmt.Errorf("Error deleting table: %s", err)
+		}
+	}
+
 	return stub.DelState(tableNameKey)
 }
 
@@ -599,14 +723,110 @@ func (stub *ChaincodeStub) GetRows(tableName string, key []Column) (<-chan Row,
 
 }
 
+// GetRowsByIndex returns the rows of the specified table whose indexed column
+// columnName has the given value. For example, given table
+// | A | B | C |
+// where A is the key and C is indexed, GetRowsByIndex can be called with C
+// and a value to return all rows that have this value for C, whatever their
+// key. The rows are returned in the order of their keys, each key column
+// comparing as its type (numbers numerically, strings and bytes lexically).
+// The rows are read from the state as they are received from the channel, so
+// the channel must be drained before other functions of the stub are called.
+func (stub *ChaincodeStub) GetRowsByIndex(tableName string, columnName string, value Column) (<-chan Row, error) {
+
+	table, err := stub.getTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	columnIndex := getColumnIndex(table, columnName)
+	if columnIndex < 0 {
+		return nil, fmt.Errorf("Table '%s' does not have a column '%s'.", tableName, columnName)
+	}
+	definition := table.ColumnDefinitions[columnIndex]
+	if !definition.Indexed {
+		return nil, fmt.Errorf("Column '%s' of table '%s' is not indexed.", columnName, tableName)
+	}
+	if !columnHasType(value, definition.Type) {
+		return nil, fmt.Errorf("The type for table '%s', column '%s' is '%s', but the value does not match.",
+			tableName, columnName, definition.Type)
+	}
+
+	indexKeyPrefix, err := buildIndexKeyPrefix(tableName, columnName, value)
+	if err != nil {
+		return nil, err
+	}
+
+	iter, err := stub.RangeQueryState(indexKeyPrefix, indexKeyPrefix+indexKeyRowsEnd)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching rows by index: %s", err)
+	}
+
+	// The index entries of a value are ordered by the keys of their rows, so
+	// the rows are streamed as the entries are iterated. Only the rows which
+	// still have the value are returned, as a safeguard against stale or
+	// mismatching index entries
+	encodedValue := encodeIndexColumn(value)
+	rows := make(chan Row)
+	go func() {
+		defer close(rows)
+		defer iter.Close()
+		for iter.HasNext() {
+			_, rowKey, err := iter.Next()
+			if err != nil {
+				chaincodeLogger.Errorf("Error fetching rows by index: %s", err)
+				return
+			}
+			rowBytes, err := stub.GetState(string(rowKey))
+			if err != nil {
+				chaincodeLogger.Errorf("Error fetching row from DB: %s", err)
+				return
+			}
+			if rowBytes == nil {
+				continue
+			}
+			var row Row
+			err = proto.Unmarshal(rowBytes, &row)
+			if err != nil {
+				chaincodeLogger.Errorf("Error unmarshalling row: %s", err)
+				return
+			}
+			if columnIndex >= len(row.Columns) || encodeIndexColumn(*row.Columns[columnIndex]) != encodedValue {
+				continue
+			}
+			rows <- row
+		}
+	}()
+
+	return rows, nil
+}
+
 // DeleteRow deletes the row for the given key from the specified table.
 func (stub *ChaincodeStub) DeleteRow(tableName string, key []Column) error {
 
+	table, err := stub.getTable(tableName)
+	if err != nil {
+		return err
+	}
+
 	keyString, err := buildKeyString(tableName, key)
 	if err != nil {
 		return err
 	}
 
+	if hasIndexedColumns(table) {
+		rowBytes, err := stub.GetState(keyString)
+		if err != nil {
+			return fmt.Errorf("DeleteRow operation error. Error fetching row: %s", err)
+		}
+		if rowBytes != nil {
+			err = stub.updateIndexes(table, keyString, rowBytes, nil)
+			if err != nil {
+				return fmt.Errorf("DeleteRow operation error. %s", err)
+			}
+		}
+	}
+
 	err = stub.DelState(keyString)
 	if err != nil {
 		return fmt.Errorf("DeleteRow operation error. Error deleting row: %s", err)
@@ -705,35 +925,192 @@ func buildKeyString(tableName string, keys []Column) (string, error) {
 	keyBuffer.WriteString(tableNameKey)
 
 	for _, key := range keys {
+		keyBuffer.WriteString(encodeColumn(key))
+	}
 
-		var keyString string
-		switch key.Value.(type) {
-		case *Column_String_:
-			keyString = key.GetString_()
-		case *Column_Int32:
-			// b := make([]byte, 4)
-			// binary.LittleEndian.PutUint32(b, uint32(key.GetInt32()))
-			// keyBuffer.Write(b)
-			keyString = strconv.FormatInt(int64(key.GetInt32()), 10)
-		case *Column_Int64:
-			keyString = strconv.FormatInt(key.GetInt64(), 10)
-		case *Column_Uint32:
-			keyString = strconv.FormatUint(uint64(key.GetUint32()), 10)
-		case *Column_Uint64:
-			keyString = strconv.FormatUint(key.GetUint64(), 10)
-		case *Column_Bytes:
-			keyString = string(key.GetBytes())
-		case *Column_Bool:
-			keyString = strconv.FormatBool(key.GetBool())
-		}
+	return keyBuffer.String(), nil
+}
+
+func encodeColumn(column Column) string {
+
+	var columnString string
+	switch column.Value.(type) {
+	case *Column_String_:
+		columnString = column.GetString_()
+	case *Column_Int32:
+		// b := make([]byte, 4)
+		// binary.LittleEndian.PutUint32(b, uint32(key.GetInt32()))
+		// keyBuffer.Write(b)
+		columnString = strconv.FormatInt(int64(column.GetInt32()), 10)
+	case *Column_Int64:
+		columnString = strconv.FormatInt(column.GetInt64(), 10)
+	case *Column_Uint32:
+		columnString = strconv.FormatUint(uint64(column.GetUint32()), 10)
+	case *Column_Uint64:
+		columnString = strconv.FormatUint(column.GetUint64(), 10)
+	case *Column_Bytes:
+		columnString = string(column.GetBytes())
+	case *Column_Bool:
+		columnString = strconv.FormatBool(column.GetBool())
+	}
+
+	return strconv.Itoa(len(columnString)) + columnString
+}
+
+// Index entries are stored after the table name key followed by
+// indexKeySeparator, which sorts before the digits that start the row keys,
+// so that range queries over the rows do not return index entries.
+// An index entry key is made of the column name, the column value and the
+// key columns of the row, and its value is the state key of the row. They are
+// all encoded by encodeIndexColumn, so that no encoded value is the prefix of
+// another and the entries of a value follow it, in the order of the row keys.
+// indexKeyRowsEnd sorts after all the characters of the encoded row keys.
+const (
+	indexKeySeparator  = "#"
+	indexKeyEnd        = "$"
+	indexKeyTerminator = "."
+	indexKeyRowsEnd    = "g"
+)
 
-		keyBuffer.WriteString(strconv.Itoa(len(keyString)))
-		keyBuffer.WriteString(keyString)
+func buildIndexKeyPrefix(tableName string, columnName string, value Column) (string, error) {
+	tableNameKey, err := getTableNameKey(tableName)
+	if err != nil {
+		return "", err
 	}
+	return tableNameKey + indexKeySeparator + encodeIndexString([]byte(columnName)) + encodeIndexColumn(value), nil
+}
+
+// encodeIndexString encodes variable length values in hex followed by
+// indexKeyTerminator, which sorts before all the hex digits, so that the
+// encoding is prefix-free and preserves the order of the values
+func encodeIndexString(value []byte) string {
+	return hex.EncodeToString(value) + indexKeyTerminator
+}
 
+// encodeIndexColumn encodes the value of an indexed column. Numbers are encoded
+// in fixed width hex, with the sign bit of signed numbers flipped so that they
+// keep their order
+func encodeIndexColumn(column Column) string {
+	switch column.Value.(type) {
+	case *Column_String_:
+		return encodeIndexString([]byte(column.GetString_()))
+	case *Column_Int32:
+		return fmt.Sprintf("%016x", uint64(int64(column.GetInt32()))^(1<<63))
+	case *Column_Int64:
+		return fmt.Sprintf("%016x", uint64(column.GetInt64())^(1<<63))
+	case *Column_Uint32:
+		return fmt.Sprintf("%016x", uint64(column.GetUint32()))
+	case *Column_Uint64:
+		return fmt.Sprintf("%016x", column.GetUint64())
+	case *Column_Bytes:
+		return encodeIndexString(column.GetBytes())
+	case *Column_Bool:
+		if column.GetBool() {
+			return "1"
+		}
+		return "0"
+	}
+	return ""
+}
+
+func buildIndexKeyString(table *Table, columnName string, value Column, row *Row) (string, error) {
+	indexKeyPrefix, err := buildIndexKeyPrefix(table.Name, columnName, value)
+	if err != nil {
+		return "", err
+	}
+	var keyBuffer bytes.Buffer
+	keyBuffer.WriteString(indexKeyPrefix)
+	for i, definition := range table.ColumnDefinitions {
+		if definition.Key && i < len(row.Columns) {
+			keyBuffer.WriteString(encodeIndexColumn(*row.Columns[i]))
+		}
+	}
 	return keyBuffer.String(), nil
 }
 
+func getColumnIndex(table *Table, columnName string) int {
+	for i, definition := range table.ColumnDefinitions {
+		if definition.Name == columnName {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasIndexedColumns(table *Table) bool {
+	for _, definition := range table.ColumnDefinitions {
+		if definition.Indexed {
+			return true
+		}
+	}
+	return false
+}
+
+func columnHasType(column Column, columnType ColumnDefinition_Type) bool {
+	switch column.Value.(type) {
+	case *Column_String_:
+		return columnType == ColumnDefinition_STRING
+	case *Column_Int32:
+		return columnType == ColumnDefinition_INT32
+	case *Column_Int64:
+		return columnType == ColumnDefinition_INT64
+	case *Column_Uint32:
+		return columnType == ColumnDefinition_UINT32
+	case *Column_Uint64:
+		return columnType == ColumnDefinition_UINT64
+	case *Column_Bytes:
+		return columnType == ColumnDefinition_BYTES
+	case *Column_Bool:
+		return columnType == ColumnDefinition_BOOL
+	default:
+		return false
+	}
+}
+
+// updateIndexes replaces the index entries of the old row, if any, by those of
+// the new row, if any. The rows are passed marshalled, as stored in the state.
+// As all the changes of a transaction are applied together, the indexes are
+// always consistent with the rows.
+func (stub *ChaincodeStub) updateIndexes(table *Table, rowKeyString string, oldRowBytes []byte, newRow *Row) error {
+
+	var oldRow *Row
+	if oldRowBytes != nil {
+		oldRow = &Row{}
+		err := proto.Unmarshal(oldRowBytes, oldRow)
+		if err != nil {
+			return fmt.Errorf("Error unmarshalling row: %s", err)
+		}
+	}
+
+	for i, definition := range table.ColumnDefinitions {
+		if !definition.Indexed {
+			continue
+		}
+		if oldRow != nil && i < len(oldRow.Columns) {
+			indexKey, err := buildIndexKeyString(table, definition.Name, *oldRow.Columns[i], oldRow)
+			if err != nil {
+				return err
+			}
+			err = stub.DelState(indexKey)
+			if err != nil {
+				return fmt.Errorf("Error deleting index entry: %s", err)
+			}
+		}
+		if newRow != nil {
+			indexKey, err := buildIndexKeyString(table, definition.Name, *newRow.Columns[i], newRow)
+			if err != nil {
+				return err
+			}
+			err = stub.PutState(indexKey, []byte(rowKeyString))
+			if err != nil {
+				return fmt.Errorf("Error inserting index entry: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func getKeyAndVerifyRow(table Table, row Row) ([]Column, error) {
 
 	var keys []Column
@@ -746,26 +1123,7 @@ func getKeyAndVerifyRow(table Table, row Row) ([]Column, error) {
 	for i, column := range row.Columns {
 
 		// Check types
-		var expectedType bool
-		switch column.Value.(type) {
-		case *Column_String_:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_STRING
-		case *Column_Int32:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_INT32
-		case *Column_Int64:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_INT64
-		case *Column_Uint32:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_UINT32
-		case *Column_Uint64:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_UINT64
-		case *Column_Bytes:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_BYTES
-		case *Column_Bool:
-			expectedType = table.ColumnDefinitions[i].Type == ColumnDefinition_BOOL
-		default:
-			expectedType = false
-		}
-		if !expectedType {
+		if !columnHasType(*column, table.ColumnDefinitions[i].Type) {
 			return keys, fmt.Errorf("The type for table '%s', column '%s' is '%s', but the column in the row does not match.",
 				table.Name, table.ColumnDefinitions[i].Name, table.ColumnDefinitions[i].Type)
 		}
@@ -779,21 +1137,6 @@ func getKeyAndVerifyRow(table Table, row Row) ([]Column, error) {
 	return keys, nil
 }
 
-func (stub *ChaincodeStub) isRowPrsent(tableName string, key []Column) (bool, error) {
-	keyString, err := buildKeyString(tableName, key)
-	if err != nil {
-		return false, err
-	}
-	rowBytes, err := stub.GetState(keyString)
-	if err != nil {
-		return false, fmt.Errorf("Error fetching row for key %s: %s", keyString, err)
-	}
-	if rowBytes != nil {
-		return true, nil
-	}
-	return false, nil
-}
-
 // insertRowInternal inserts a new row into the specified table.
 // Returns -
 // true and no error if the row is successfully inserted.
@@ -812,10 +1155,15 @@ func (stub *ChaincodeStub) insertRowInternal(tableName string, row Row, update b
 		return false, err
 	}
 
-	present, err := stub.isRowPrsent(tableName, key)
+	keyString, err := buildKeyString(tableName, key)
 	if err != nil {
 		return false, err
 	}
+	oldRowBytes, err := stub.GetState(keyString)
+	if err != nil {
+		return false, fmt.Errorf("Error fetching row for key %s: %s", keyString, err)
+	}
+	present := oldRowBytes != nil
 	if (present && !update) || (!present && update) {
 		return false, nil
 	}
@@ -825,26 +1173,39 @@ func (stub *ChaincodeStub) insertRowInternal(tableName string, row Row, update b
 		return false, fmt.Errorf("Error marshalling row: %s", err)
 	}
 
-	keyString, err := buildKeyString(tableName, key)
-	if err != nil {
-		return false, err
-	}
 	err = stub.PutState(keyString, rowBytes)
 	if err != nil {
 		return false, fmt.Errorf("Error inserting row in table %s: %s", tableName, err)
 	}
 
+	if hasIndexedColumns(table) {
+		err = stub.updateIndexes(table, keyString, oldRowBytes, &row)
+		if err != nil {
+			return false, fmt.Errorf("Error updating indexes of table %s: %s", tableName, err)
+		}
+	}
+
 	return true, nil
 }
 
 // ------------- ChaincodeEvent API ----------------------
 
-// SetEvent saves the event to be sent when a transaction is made part of a block
+// SetEvent saves the event to be sent when a transaction is made part of a block.
+// A transaction may set several events, they are sent in the order they were set
 func (stub *ChaincodeStub) SetEvent(name string, payload []byte) error {
-	stub.chaincodeEvent = &pb.ChaincodeEvent{EventName: name, Payload: payload}
+	stub.chaincodeEvents = append(stub.chaincodeEvents, &pb.ChaincodeEvent{EventName: name, Payload: payload})
 	return nil
 }
 
+// lastChaincodeEvent returns the last event set, which is also sent on its own
+// for the peers expecting a single event per transaction
+func (stub *ChaincodeStub) lastChaincodeEvent() *pb.ChaincodeEvent {
+	if len(stub.chaincodeEvents) == 0 {
+		return nil
+	}
+	return stub.chaincodeEvents[len(stub.chaincodeEvents)-1]
+}
+
 // ------------- Logging Control and Chaincode Loggers ---------------
 
 // As independent programs, Go language chaincodes can use any logging
@@ -64,6 +64,9 @@ type ColumnDefinition struct {
 	Name string                `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
 	Type ColumnDefinition_Type `protobuf:"varint,2,opt,name=type,enum=shim.ColumnDefinition_Type" json:"type,omitempty"`
 	Key  bool                  `protobuf:"varint,3,opt,name=key" json:"key,omitempty"`
+	// indexed columns can be queried with GetRowsByIndex. Key columns
+	// cannot be indexed.
+	Indexed bool `protobuf:"varint,4,opt,name=indexed" json:"indexed,omitempty"`
 }
 
 func (m *ColumnDefinition) Reset()         { *m = ColumnDefinition{} }
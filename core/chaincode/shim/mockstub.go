@@ -0,0 +1,373 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	gp "google/protobuf"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim/crypto/attr"
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// MockStub runs a chaincode over an in-memory state, without a validating
+// peer, so that chaincodes can be unit tested with plain `go test` suites.
+// The chaincode is passed the embedded ChaincodeStub, whose state, table,
+// event and chaincode calls are served by the MockStub. For example:
+//
+//	stub := shim.NewMockStub("mycc", new(MyChaincode))
+//	stub.MockInit("tx1", "init", []string{"a", "100"})
+//	stub.MockInvoke("tx2", "transfer", []string{"a", "b", "10"})
+//	value, err := stub.GetState("b")
+//
+// As on a validating peer, the changes of a transaction are only committed
+// if the chaincode returns no error, and queries cannot change the state.
+type MockStub struct {
+	*ChaincodeStub
+
+	// Name of the chaincode, used by other mocks to invoke it
+	Name string
+
+	// State of the chaincode, as committed by the mock transactions
+	State map[string][]byte
+
+	cc         Chaincode
+	invokables map[string]*MockStub             // chaincodes callable with InvokeChaincode and QueryChaincode, by name
+	history    map[string][]*pb.KeyModification // committed modifications, by key
+	height     uint64                           // number of committed transactions, used as block number
+
+	txTimestamp *gp.Timestamp     // timestamp of the transactions, the current time if nil
+	attributes  map[string][]byte // attributes of the caller, read from the caller certificate if nil
+
+	inTx        bool              // set while a transaction is running
+	query       bool              // set while a query is running
+	historyRead bool              // set once the running transaction has read the history of a key
+	pending     map[string][]byte // changes of the running transaction, deleted keys map to nil
+	called      []*MockStub       // chaincodes invoked by the running transaction
+}
+
+// NewMockStub returns a MockStub running the chaincode cc with an empty state
+func NewMockStub(name string, cc Chaincode) *MockStub {
+	stub := &MockStub{
+		Name:       name,
+		State:      make(map[string][]byte),
+		cc:         cc,
+		invokables: make(map[string]*MockStub),
+		history:    make(map[string][]*pb.KeyModification),
+	}
+	stub.ChaincodeStub = &ChaincodeStub{}
+	stub.ChaincodeStub.init(stub, "", &pb.ChaincodeSecurityContext{})
+	return stub
+}
+
+// MockPeerChaincode makes the chaincode run by other callable by name from the
+// chaincode of this stub, through InvokeChaincode and QueryChaincode
+func (stub *MockStub) MockPeerChaincode(name string, other *MockStub) {
+	stub.invokables[name] = other
+}
+
+// SetCallerCertificate sets the certificate of the caller of the transactions
+func (stub *MockStub) SetCallerCertificate(cert []byte) {
+	stub.securityContext.CallerCert = cert
+}
+
+// SetCallerMetadata sets the metadata of the transactions
+func (stub *MockStub) SetCallerMetadata(metadata []byte) {
+	stub.securityContext.Metadata = metadata
+}
+
+// SetBinding sets the binding of the transactions
+func (stub *MockStub) SetBinding(binding []byte) {
+	stub.securityContext.Binding = binding
+}
+
+// SetPayload sets the payload of the transactions
+func (stub *MockStub) SetPayload(payload []byte) {
+	stub.securityContext.Payload = payload
+}
+
+// SetTxTimestamp sets the timestamp of the transactions, which is otherwise
+// the time each transaction starts
+func (stub *MockStub) SetTxTimestamp(timestamp *gp.Timestamp) {
+	stub.txTimestamp = timestamp
+}
+
+// SetCallerAttributes sets the attributes of the caller, which are then used by
+// ReadCertAttribute and VerifyAttribute instead of the caller certificate.
+// A nil map reverts to reading the attributes from the caller certificate.
+func (stub *MockStub) SetCallerAttributes(attributes map[string][]byte) {
+	stub.attributes = attributes
+}
+
+// MockTransactionStart starts a transaction with the given UUID, the
+// chaincode can then be called directly with the embedded ChaincodeStub
+func (stub *MockStub) MockTransactionStart(uuid string) {
+	stub.UUID = uuid
+	stub.chaincodeEvents = nil
+	stub.inTx = true
+	stub.historyRead = false
+	stub.pending = make(map[string][]byte)
+	stub.called = nil
+	if stub.txTimestamp != nil {
+		stub.securityContext.TxTimestamp = stub.txTimestamp
+	} else {
+		now := time.Now()
+		stub.securityContext.TxTimestamp = &gp.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}
+	}
+}
+
+// MockTransactionEnd ends the running transaction, along with those of the
+// chaincodes it invoked. Their changes are committed if commit is set, and
+// discarded otherwise.
+func (stub *MockStub) MockTransactionEnd(uuid string, commit bool) {
+	if !stub.inTx || stub.UUID != uuid {
+		return
+	}
+	for _, other := range stub.called {
+		other.MockTransactionEnd(uuid, commit)
+	}
+	if commit {
+		stub.commit()
+	}
+	stub.inTx = false
+	stub.pending = nil
+	stub.called = nil
+}
+
+// MockInit runs the Init function of the chaincode in a transaction
+func (stub *MockStub) MockInit(uuid string, function string, args []string) ([]byte, error) {
+	stub.MockTransactionStart(uuid)
+	result, err := stub.cc.Init(stub.ChaincodeStub, function, args)
+	stub.MockTransactionEnd(uuid, err == nil)
+	return result, err
+}
+
+// MockInvoke runs the Invoke function of the chaincode in a transaction
+func (stub *MockStub) MockInvoke(uuid string, function string, args []string) ([]byte, error) {
+	stub.MockTransactionStart(uuid)
+	result, err := stub.cc.Invoke(stub.ChaincodeStub, function, args)
+	stub.MockTransactionEnd(uuid, err == nil)
+	return result, err
+}
+
+// MockQuery runs the Query function of the chaincode, which cannot change the state
+func (stub *MockStub) MockQuery(function string, args []string) ([]byte, error) {
+	stub.query = true
+	defer func() { stub.query = false }()
+	return stub.cc.Query(stub.ChaincodeStub, function, args)
+}
+
+// ChaincodeEvent returns the last event set by the last transaction, if any
+func (stub *MockStub) ChaincodeEvent() *pb.ChaincodeEvent {
+	return stub.lastChaincodeEvent()
+}
+
+// ChaincodeEvents returns the events set by the last transaction, in order
+func (stub *MockStub) ChaincodeEvents() []*pb.ChaincodeEvent {
+	return stub.chaincodeEvents
+}
+
+func (stub *MockStub) commit() {
+	if len(stub.pending) == 0 {
+		return
+	}
+	stub.height++
+	keys := make([]string, 0, len(stub.pending))
+	for key := range stub.pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := stub.pending[key]
+		if value == nil {
+			delete(stub.State, key)
+		} else {
+			stub.State[key] = value
+		}
+		stub.history[key] = append(stub.history[key], &pb.KeyModification{Uuid: stub.UUID, BlockNumber: stub.height, Value: value, IsDelete: value == nil})
+	}
+}
+
+// checkWritable returns an error if the state cannot be changed, with the
+// messages of the validating peer
+func (stub *MockStub) checkWritable(operation string) error {
+	if stub.query || !stub.inTx {
+		return fmt.Errorf("Cannot %s state in query context", operation)
+	}
+	if stub.historyRead {
+		return fmt.Errorf("Cannot %s state after a history read in the same transaction", operation)
+	}
+	return nil
+}
+
+func (stub *MockStub) handleGetState(key string, uuid string) ([]byte, error) {
+	if stub.inTx {
+		if value, ok := stub.pending[key]; ok {
+			return value, nil
+		}
+	}
+	return stub.State[key], nil
+}
+
+func (stub *MockStub) handlePutState(key string, value []byte, uuid string) error {
+	if err := stub.checkWritable("put"); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	stub.pending[key] = value
+	return nil
+}
+
+func (stub *MockStub) handleDelState(key string, uuid string) error {
+	if err := stub.checkWritable("del"); err != nil {
+		return err
+	}
+	stub.pending[key] = nil
+	return nil
+}
+
+// handleRangeQueryState returns the keys between startKey and endKey, inclusive,
+// with the changes of the running transaction, all at once and in order
+func (stub *MockStub) handleRangeQueryState(startKey, endKey string, uuid string) (*pb.RangeQueryStateResponse, error) {
+	inRange := func(key string) bool {
+		return key >= startKey && (endKey == "" || key <= endKey)
+	}
+	values := make(map[string][]byte)
+	for key, value := range stub.State {
+		if inRange(key) {
+			values[key] = value
+		}
+	}
+	if stub.inTx {
+		for key, value := range stub.pending {
+			if !inRange(key) {
+				continue
+			}
+			if value == nil {
+				delete(values, key)
+			} else {
+				values[key] = value
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	response := &pb.RangeQueryStateResponse{HasMore: false, ID: uuid}
+	for _, key := range keys {
+		response.KeysAndValues = append(response.KeysAndValues, &pb.RangeQueryStateKeyValue{Key: key, Value: values[key]})
+	}
+	return response, nil
+}
+
+func (stub *MockStub) handleExecuteQuery(query string, uuid string) (*pb.RangeQueryStateResponse, error) {
+	return nil, errors.New("Rich queries are not supported by MockStub")
+}
+
+func (stub *MockStub) handleRangeQueryStateNext(id, uuid string) (*pb.RangeQueryStateResponse, error) {
+	return nil, errors.New("No more keys in range query")
+}
+
+func (stub *MockStub) handleRangeQueryStateClose(id, uuid string) (*pb.RangeQueryStateResponse, error) {
+	return &pb.RangeQueryStateResponse{ID: id}, nil
+}
+
+// handleGetHistoryForKey returns the committed modifications of the key, each
+// committed transaction counting as a block, in a single page from fromBlock.
+// As on a validating peer, the running transaction can then no longer update
+// the state
+func (stub *MockStub) handleGetHistoryForKey(key string, fromBlock uint64, fromSequence uint64, uuid string) (*pb.GetHistoryForKeyResponse, error) {
+	if stub.inTx && !stub.query {
+		stub.historyRead = true
+	}
+	response := &pb.GetHistoryForKeyResponse{}
+	for _, modification := range stub.history[key] {
+		if modification.BlockNumber >= fromBlock {
+			response.Modifications = append(response.Modifications, modification)
+		}
+	}
+	return response, nil
+}
+
+func (stub *MockStub) handleInvokeChaincode(chaincodeName string, function string, args []string, uuid string) ([]byte, error) {
+	if stub.query || !stub.inTx {
+		return nil, errors.New("Cannot invoke chaincode in query context")
+	}
+	other, ok := stub.invokables[chaincodeName]
+	if !ok {
+		return nil, fmt.Errorf("Chaincode %s is not registered with MockPeerChaincode", chaincodeName)
+	}
+	if !other.inTx || other.UUID != uuid {
+		other.MockTransactionStart(uuid)
+		stub.called = append(stub.called, other)
+	}
+	return other.cc.Invoke(other.ChaincodeStub, function, args)
+}
+
+func (stub *MockStub) handleQueryChaincode(chaincodeName string, function string, args []string, uuid string) ([]byte, error) {
+	other, ok := stub.invokables[chaincodeName]
+	if !ok {
+		return nil, fmt.Errorf("Chaincode %s is not registered with MockPeerChaincode", chaincodeName)
+	}
+	return other.MockQuery(function, args)
+}
+
+func (stub *MockStub) attributesHandler() (attr.AttributesHandler, error) {
+	if stub.attributes == nil {
+		return attr.NewAttributesHandlerImpl(stub.ChaincodeStub)
+	}
+	return mockAttributesHandler(stub.attributes), nil
+}
+
+// mockAttributesHandler serves the attributes set with SetCallerAttributes
+type mockAttributesHandler map[string][]byte
+
+func (attributes mockAttributesHandler) GetValue(attributeName string) ([]byte, error) {
+	value, ok := attributes[attributeName]
+	if !ok {
+		return nil, fmt.Errorf("Caller has no attribute '%s'", attributeName)
+	}
+	return value, nil
+}
+
+func (attributes mockAttributesHandler) VerifyAttribute(attributeName string, attributeValue []byte) (bool, error) {
+	value, err := attributes.GetValue(attributeName)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(value, attributeValue), nil
+}
+
+func (attributes mockAttributesHandler) VerifyAttributes(attrs ...*attr.Attribute) (bool, error) {
+	for _, attribute := range attrs {
+		ok, err := attributes.VerifyAttribute(attribute.Name, attribute.Value)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
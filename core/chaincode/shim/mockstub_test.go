@@ -0,0 +1,210 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shim
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	gp "google/protobuf"
+
+	pb "github.com/hyperledger/fabric/protos"
+)
+
+// counterChaincode keeps counters in the state, and in a table of the
+// counters with their owners
+type counterChaincode struct{}
+
+func (cc *counterChaincode) Init(stub *ChaincodeStub, function string, args []string) ([]byte, error) {
+	return nil, stub.CreateTable("counters", []*ColumnDefinition{
+		{Name: "name", Type: ColumnDefinition_STRING, Key: true},
+		{Name: "owner", Type: ColumnDefinition_STRING, Indexed: true},
+	})
+}
+
+func (cc *counterChaincode) Invoke(stub *ChaincodeStub, function string, args []string) ([]byte, error) {
+	switch function {
+	case "create":
+		ok, err := stub.InsertRow("counters", Row{Columns: []*Column{
+			{Value: &Column_String_{String_: args[0]}},
+			{Value: &Column_String_{String_: args[1]}},
+		}})
+		if err != nil || !ok {
+			return nil, errors.New("counter exists")
+		}
+		return nil, stub.PutState(args[0], []byte("0"))
+	case "increment":
+		value, err := stub.GetState(args[0])
+		if err != nil || value == nil {
+			return nil, errors.New("no such counter")
+		}
+		n, _ := strconv.Atoi(string(value))
+		if err = stub.PutState(args[0], []byte(strconv.Itoa(n+1))); err != nil {
+			return nil, err
+		}
+		if len(args) > 1 {
+			return stub.InvokeChaincode(args[1], "increment", args[2:])
+		}
+		stub.SetEvent("incremented", []byte(args[0]))
+		return nil, stub.SetEvent("value", []byte(strconv.Itoa(n+1)))
+	case "fail":
+		stub.PutState(args[0], []byte("failed"))
+		return nil, errors.New("failed")
+	}
+	return nil, errors.New("unknown function")
+}
+
+func (cc *counterChaincode) Query(stub *ChaincodeStub, function string, args []string) ([]byte, error) {
+	if function == "increment" {
+		return cc.Invoke(stub, function, args)
+	}
+	return stub.GetState(args[0])
+}
+
+func TestMockStubState(t *testing.T) {
+	stub := NewMockStub("counters", new(counterChaincode))
+	if _, err := stub.MockInit("1", "init", nil); err != nil {
+		t.Fatalf("Init failed: %s", err)
+	}
+	for i, name := range []string{"b", "a", "c"} {
+		if _, err := stub.MockInvoke(strconv.Itoa(i+2), "create", []string{name, "alice"}); err != nil {
+			t.Fatalf("Create failed: %s", err)
+		}
+	}
+	if _, err := stub.MockInvoke("5", "increment", []string{"a"}); err != nil {
+		t.Fatalf("Increment failed: %s", err)
+	}
+	if events := stub.ChaincodeEvents(); len(events) != 2 || events[0].EventName != "incremented" || events[1].EventName != "value" {
+		t.Errorf("Expected an incremented event followed by a value event, got %v", events)
+	}
+	if event := stub.ChaincodeEvent(); event == nil || string(event.Payload) != "1" {
+		t.Errorf("Expected the last event to be the value event, got %v", event)
+	}
+
+	if _, err := stub.MockInvoke("6", "fail", []string{"a"}); err == nil {
+		t.Fatalf("Expected the transaction to fail")
+	}
+	if value, _ := stub.MockQuery("get", []string{"a"}); string(value) != "1" {
+		t.Errorf("Expected the failed transaction to be rolled back, got %s", value)
+	}
+	if _, err := stub.MockQuery("increment", []string{"a"}); err == nil {
+		t.Errorf("Expected a query to be unable to change the state")
+	}
+
+	iter, err := stub.RangeQueryState("a", "c")
+	if err != nil {
+		t.Fatalf("Range query failed: %s", err)
+	}
+	var keys []string
+	for iter.HasNext() {
+		key, _, _ := iter.Next()
+		keys = append(keys, key)
+	}
+	iter.Close()
+	if len(keys) != 3 || keys[0] != "a" || keys[2] != "c" {
+		t.Errorf("Expected the keys a, b and c in order, got %v", keys)
+	}
+
+	rows, err := stub.GetRowsByIndex("counters", "owner", Column{Value: &Column_String_{String_: "alice"}})
+	if err != nil {
+		t.Fatalf("GetRowsByIndex failed: %s", err)
+	}
+	count := 0
+	for range rows {
+		count++
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 counters owned by alice, got %d", count)
+	}
+
+	historyIter, err := stub.GetHistoryForKey("a")
+	if err != nil {
+		t.Fatalf("GetHistoryForKey failed: %s", err)
+	}
+	var history []*pb.KeyModification
+	for historyIter.HasNext() {
+		modification, err := historyIter.Next()
+		if err != nil {
+			t.Fatalf("Iterating over the history failed: %s", err)
+		}
+		history = append(history, modification)
+	}
+	if len(history) != 2 || history[1].Uuid != "5" {
+		t.Errorf("Expected the creation and the increment of a in its history, got %v", history)
+	}
+
+	// the history is not deterministic across validators
+	stub.MockTransactionStart("6")
+	defer stub.MockTransactionEnd("6", false)
+	if _, err := stub.GetHistoryForKey("a"); err != nil {
+		t.Fatalf("GetHistoryForKey failed: %s", err)
+	}
+	if err := stub.PutState("a", []byte("2")); err == nil {
+		t.Errorf("Expected a transaction to be unable to change the state after a history read")
+	}
+}
+
+func TestMockStubInvokeChaincode(t *testing.T) {
+	first := NewMockStub("first", new(counterChaincode))
+	second := NewMockStub("second", new(counterChaincode))
+	first.MockPeerChaincode("second", second)
+	for _, stub := range []*MockStub{first, second} {
+		stub.MockInit("0", "init", nil)
+	}
+	first.MockInvoke("1", "create", []string{"x", "alice"})
+	second.MockInvoke("1", "create", []string{"y", "bob"})
+
+	if _, err := first.MockInvoke("2", "increment", []string{"x", "second", "y"}); err != nil {
+		t.Fatalf("Invoke failed: %s", err)
+	}
+	if string(first.State["x"]) != "1" || string(second.State["y"]) != "1" {
+		t.Errorf("Expected both counters to be incremented, got %s and %s", first.State["x"], second.State["y"])
+	}
+
+	if _, err := first.MockInvoke("3", "increment", []string{"x", "second", "missing"}); err == nil {
+		t.Fatalf("Expected the invoke of the second chaincode to fail")
+	}
+	if string(first.State["x"]) != "1" {
+		t.Errorf("Expected the changes of the failed transaction to be discarded, got %s", first.State["x"])
+	}
+}
+
+func TestMockStubSecurityContext(t *testing.T) {
+	stub := NewMockStub("counters", new(counterChaincode))
+	stub.SetCallerCertificate([]byte("cert"))
+	stub.SetTxTimestamp(&gp.Timestamp{Seconds: 42})
+	stub.SetCallerAttributes(map[string][]byte{"role": []byte("admin")})
+	stub.MockTransactionStart("1")
+	defer stub.MockTransactionEnd("1", false)
+
+	if cert, _ := stub.GetCallerCertificate(); string(cert) != "cert" {
+		t.Errorf("Expected the caller certificate to be set, got %s", cert)
+	}
+	if timestamp, _ := stub.GetTxTimestamp(); timestamp.Seconds != 42 {
+		t.Errorf("Expected the transaction timestamp to be set, got %v", timestamp)
+	}
+	if ok, err := stub.VerifyAttribute("role", []byte("admin")); !ok || err != nil {
+		t.Errorf("Expected the caller to have the admin role: %v", err)
+	}
+	if ok, _ := stub.VerifyAttribute("role", []byte("user")); ok {
+		t.Errorf("Expected the caller not to have the user role")
+	}
+	if _, err := stub.ReadCertAttribute("company"); err == nil {
+		t.Errorf("Expected the caller to have no company attribute")
+	}
+}
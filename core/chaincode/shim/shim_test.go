@@ -18,6 +18,7 @@ package shim
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/op/go-logging"
@@ -134,3 +135,128 @@ func TestChaincodeLogging(t *testing.T) {
 		t.Errorf("'bar' should be enabled for LogCritical")
 	}
 }
+
+// newIndexedTable starts a transaction on a new MockStub with a table of a key
+// column and an indexed column of the given types
+func newIndexedTable(t *testing.T, keyType ColumnDefinition_Type, valueType ColumnDefinition_Type) *MockStub {
+	stub := NewMockStub("indexes", nil)
+	stub.MockTransactionStart("1")
+	err := stub.CreateTable("t", []*ColumnDefinition{
+		{Name: "k", Type: keyType, Key: true},
+		{Name: "v", Type: valueType, Indexed: true},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable failed: %s", err)
+	}
+	return stub
+}
+
+func insertIndexedRow(t *testing.T, stub *MockStub, key *Column, value *Column) {
+	if ok, err := stub.InsertRow("t", Row{Columns: []*Column{key, value}}); err != nil || !ok {
+		t.Fatalf("InsertRow failed: %v %s", ok, err)
+	}
+}
+
+func getRowKeysByIndex(t *testing.T, stub *MockStub, value *Column) []string {
+	rows, err := stub.GetRowsByIndex("t", "v", *value)
+	if err != nil {
+		t.Fatalf("GetRowsByIndex failed: %s", err)
+	}
+	var keys []string
+	for row := range rows {
+		keys = append(keys, encodeColumn(*row.Columns[0]))
+	}
+	return keys
+}
+
+func int64Column(v int64) *Column   { return &Column{Value: &Column_Int64{Int64: v}} }
+func stringColumn(v string) *Column { return &Column{Value: &Column_String_{String_: v}} }
+
+// TestGetRowsByIndexDistinctValues tests that a lookup only returns the rows
+// with the value, whatever the other values indexed
+func TestGetRowsByIndexDistinctValues(t *testing.T) {
+	stub := newIndexedTable(t, ColumnDefinition_STRING, ColumnDefinition_INT64)
+	defer stub.MockTransactionEnd("1", false)
+	for key, value := range map[string]int64{"a": 0, "b": 1000000000, "c": -1, "d": 10, "e": 1} {
+		insertIndexedRow(t, stub, stringColumn(key), int64Column(value))
+	}
+	for value, expected := range map[int64]string{0: "1a", 1000000000: "1b", -1: "1c", 10: "1d", 1: "1e"} {
+		keys := getRowKeysByIndex(t, stub, int64Column(value))
+		if len(keys) != 1 || keys[0] != expected {
+			t.Errorf("Expected only the row %s for the value %d, got %v", expected, value, keys)
+		}
+	}
+
+	stub = newIndexedTable(t, ColumnDefinition_STRING, ColumnDefinition_STRING)
+	defer stub.MockTransactionEnd("1", false)
+	for key, value := range map[string]string{"a": "1", "b": "abcdefghijk", "c": "", "d": "1a"} {
+		insertIndexedRow(t, stub, stringColumn(key), stringColumn(value))
+	}
+	for value, expected := range map[string]string{"1": "1a", "abcdefghijk": "1b", "": "1c", "1a": "1d"} {
+		keys := getRowKeysByIndex(t, stub, stringColumn(value))
+		if len(keys) != 1 || keys[0] != expected {
+			t.Errorf("Expected only the row %s for the value %q, got %v", expected, value, keys)
+		}
+	}
+
+	// the index entries are outside of the range of keys scanned for the rows
+	tableNameKey, _ := getTableNameKey("t")
+	iter, err := stub.RangeQueryState(tableNameKey+"1", tableNameKey+":")
+	if err != nil {
+		t.Fatalf("RangeQueryState failed: %s", err)
+	}
+	defer iter.Close()
+	count := 0
+	for iter.HasNext() {
+		iter.Next()
+		count++
+	}
+	if count != 4 {
+		t.Errorf("Expected the 4 rows in the range of the row keys, got %d keys", count)
+	}
+}
+
+// TestGetRowsByIndexOrder tests that the rows are returned in the order of
+// their keys, and that updates move the rows between values
+func TestGetRowsByIndexOrder(t *testing.T) {
+	stub := newIndexedTable(t, ColumnDefinition_INT64, ColumnDefinition_STRING)
+	defer stub.MockTransactionEnd("1", false)
+	for _, key := range []int64{10, 9, -5, 100, 2} {
+		insertIndexedRow(t, stub, int64Column(key), stringColumn("alice"))
+	}
+	keys := getRowKeysByIndex(t, stub, stringColumn("alice"))
+	expected := []string{"2-5", "12", "19", "210", "3100"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the rows in the order of their keys %v, got %v", expected, keys)
+	}
+
+	if ok, err := stub.ReplaceRow("t", Row{Columns: []*Column{int64Column(9), stringColumn("bob")}}); err != nil || !ok {
+		t.Fatalf("ReplaceRow failed: %v %s", ok, err)
+	}
+	if err := stub.DeleteRow("t", []Column{*int64Column(100)}); err != nil {
+		t.Fatalf("DeleteRow failed: %s", err)
+	}
+	keys = getRowKeysByIndex(t, stub, stringColumn("alice"))
+	if strings.Join(keys, ",") != "2-5,12,210" {
+		t.Errorf("Expected the rows -5, 2 and 10, got %v", keys)
+	}
+	if keys = getRowKeysByIndex(t, stub, stringColumn("bob")); len(keys) != 1 || keys[0] != "19" {
+		t.Errorf("Expected the row 9, got %v", keys)
+	}
+}
+
+// TestGetRowsByIndexStringKeys tests that the rows are returned in the order
+// of their string keys, including the empty key
+func TestGetRowsByIndexStringKeys(t *testing.T) {
+	stub := newIndexedTable(t, ColumnDefinition_STRING, ColumnDefinition_STRING)
+	defer stub.MockTransactionEnd("1", false)
+	for _, key := range []string{"zz", "", "b", "ab", "a"} {
+		insertIndexedRow(t, stub, stringColumn(key), stringColumn("alice"))
+	}
+	insertIndexedRow(t, stub, stringColumn("c"), stringColumn("alice2"))
+	keys := getRowKeysByIndex(t, stub, stringColumn("alice"))
+	expected := []string{"0", "1a", "2ab", "1b", "2zz"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected the rows in the order of their keys %v, got %v", expected, keys)
+	}
+}
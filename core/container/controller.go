@@ -25,6 +25,7 @@ import (
 
 	"github.com/hyperledger/fabric/core/container/ccintf"
 	"github.com/hyperledger/fabric/core/container/dockercontroller"
+	"github.com/hyperledger/fabric/core/container/execcontroller"
 	"github.com/hyperledger/fabric/core/container/inproccontroller"
 )
 
@@ -59,6 +60,7 @@ var vmcontroller *VMController
 const (
 	DOCKER = "Docker"
 	SYSTEM = "System"
+	EXEC   = "Exec"
 )
 
 //NewVMController - creates/returns singleton
@@ -77,8 +79,8 @@ func (vmc *VMController) newVM(typ string) vm {
 		v = &dockercontroller.DockerVM{}
 	case SYSTEM:
 		v = &inproccontroller.InprocVM{}
-	default:
-		v = &dockercontroller.DockerVM{}
+	case EXEC:
+		v = &execcontroller.ExecVM{}
 	}
 	return v
 }
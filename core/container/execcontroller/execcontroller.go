@@ -0,0 +1,436 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package execcontroller
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger/fabric/core/container/ccintf"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+var (
+	execLogger = logging.MustGetLogger("execcontroller")
+
+	processesLock sync.Mutex
+	processes     = make(map[string]*process)
+)
+
+// Files and directories of a chaincode sandbox
+const (
+	binDir  = "bin"
+	srcDir  = "src"
+	logFile = "chaincode.log"
+)
+
+// process is a chaincode process supervised by the peer
+type process struct {
+	id       string
+	cmd      *exec.Cmd
+	log      *os.File
+	stopping bool          // set once the process is asked to stop, so that it is not restarted
+	restarts int           // number of times the process was restarted after it exited on its own
+	done     chan struct{} // closed when the process has exited for good
+}
+
+//ExecVM is a vm which builds Go chaincodes with the local toolchain and runs
+//them as child processes of the peer. It is identified by a sandbox directory
+type ExecVM struct {
+	id string
+}
+
+// sandboxRoot returns the directory holding the sandboxes of the chaincodes
+func sandboxRoot() string {
+	if root := viper.GetString("vm.exec.sandbox"); root != "" {
+		return root
+	}
+	return filepath.Join(viper.GetString("peer.fileSystemPath"), "chaincodes")
+}
+
+func (vm *ExecVM) sandbox(ccid ccintf.CCID) string {
+	id, _ := vm.GetVMName(ccid)
+	return filepath.Join(sandboxRoot(), id)
+}
+
+// importPath returns the Go import path of the chaincode, the path of its
+// sources within the package
+func importPath(ccid ccintf.CCID) (string, error) {
+	path := ccid.ChaincodeSpec.ChaincodeID.Path
+	if strings.HasPrefix(path, "http://") {
+		path = path[7:]
+	} else if strings.HasPrefix(path, "https://") {
+		path = path[8:]
+	}
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		return "", fmt.Errorf("empty chaincode path")
+	}
+	return path, nil
+}
+
+// extract writes the sources of a chaincode package, a gzipped tar as built
+// for Docker, to the sandbox. The Dockerfile and anything outside src are skipped.
+func extract(reader io.Reader, sandbox string) error {
+	buffered := bufio.NewReader(reader)
+	if magic, err := buffered.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("Error reading chaincode package: %s", err)
+		}
+		defer gz.Close()
+		reader = gz
+	} else {
+		reader = buffered
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading chaincode package: %s", err)
+		}
+
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || strings.HasPrefix(name, "..") {
+			return fmt.Errorf("Chaincode package contains invalid path %s", header.Name)
+		}
+		if !strings.HasPrefix(name, srcDir+string(filepath.Separator)) || header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			execLogger.Debugf("Skipping %s of type %c in chaincode package", header.Name, header.Typeflag)
+			continue
+		}
+
+		target := filepath.Join(sandbox, name)
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, tr)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("Error extracting %s: %s", header.Name, err)
+		}
+	}
+}
+
+// wait waits for cmd to exit, it kills cmd if the context is done first
+func wait(ctxt context.Context, cmd *exec.Cmd) error {
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctxt.Done():
+		cmd.Process.Kill()
+		<-done
+		return ctxt.Err()
+	}
+}
+
+// build compiles the chaincode in the sandbox, whose src directory is used
+// as the only GOPATH entry
+func (vm *ExecVM) build(ctxt context.Context, ccid ccintf.CCID, sandbox string) error {
+	path, err := importPath(ccid)
+	if err != nil {
+		return err
+	}
+	binary := filepath.Join(sandbox, binDir, ccid.ChaincodeSpec.ChaincodeID.Name)
+
+	goTool := viper.GetString("vm.exec.go")
+	if goTool == "" {
+		goTool = "go"
+	}
+	cmd := exec.Command(goTool, "build", "-o", binary, path)
+	cmd.Dir = sandbox
+	cmd.Env = append(os.Environ(), "GOPATH="+sandbox, "GO111MODULE=off", "CGO_ENABLED=0")
+	output := bytes.NewBuffer(nil)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	execLogger.Debugf("Building chaincode %s in %s", path, sandbox)
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("Error starting go build: %s", err)
+	}
+	if err = wait(ctxt, cmd); err != nil {
+		execLogger.Errorf("Error building chaincode %s: %s", path, err)
+		execLogger.Errorf("Build output:\n********************\n%s\n********************", output.String())
+		return fmt.Errorf("Error building chaincode %s: %s", path, err)
+	}
+	execLogger.Debugf("Built chaincode %s", binary)
+	return nil
+}
+
+//Deploy extracts the chaincode package to a fresh sandbox and builds the
+//chaincode executable in it
+func (vm *ExecVM) Deploy(ctxt context.Context, ccid ccintf.CCID, args []string, env []string, attachstdin bool, attachstdout bool, reader io.Reader) error {
+	if reader == nil {
+		return fmt.Errorf("no chaincode package to deploy")
+	}
+	sandbox := vm.sandbox(ccid)
+	if err := os.RemoveAll(sandbox); err != nil {
+		return fmt.Errorf("Error cleaning sandbox %s: %s", sandbox, err)
+	}
+	if err := os.MkdirAll(sandbox, 0755); err != nil {
+		return fmt.Errorf("Error creating sandbox %s: %s", sandbox, err)
+	}
+	if err := extract(reader, sandbox); err != nil {
+		return err
+	}
+	return vm.build(ctxt, ccid, sandbox)
+}
+
+//Start runs the chaincode executable of the sandbox, building it first from
+//the package if it has not been deployed. The first argument, the executable
+//path within a container, is replaced by the executable of the sandbox
+func (vm *ExecVM) Start(ctxt context.Context, ccid ccintf.CCID, args []string, env []string, attachstdin bool, attachstdout bool, reader io.Reader) error {
+	id, _ := vm.GetVMName(ccid)
+	sandbox := vm.sandbox(ccid)
+	binary := filepath.Join(sandbox, binDir, ccid.ChaincodeSpec.ChaincodeID.Name)
+
+	//stop if necessary
+	vm.stopInternal(id, 0, false)
+
+	if _, err := os.Stat(binary); err != nil {
+		if reader == nil {
+			execLogger.Errorf("start-could not find chaincode executable %s", binary)
+			return fmt.Errorf("chaincode %s is not deployed", id)
+		}
+		execLogger.Debugf("start-could not find executable ...attempt to rebuild %s", binary)
+		if err = vm.Deploy(ctxt, ccid, args, env, attachstdin, attachstdout, reader); err != nil {
+			return err
+		}
+	}
+
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	log, err := os.OpenFile(filepath.Join(sandbox, logFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("Error opening chaincode log: %s", err)
+	}
+	p := &process{id: id, log: log, done: make(chan struct{})}
+	if err = p.start(sandbox, binary, args, env); err != nil {
+		log.Close()
+		execLogger.Errorf("start-could not start chaincode %s: %s", id, err)
+		return err
+	}
+
+	processesLock.Lock()
+	processes[id] = p
+	processesLock.Unlock()
+
+	go p.supervise(sandbox, binary, args, env)
+
+	execLogger.Debugf("Started chaincode %s (pid %d)", id, p.cmd.Process.Pid)
+	return nil
+}
+
+// errStopping is returned by start when the process was asked to stop
+var errStopping = fmt.Errorf("chaincode is stopping")
+
+// start starts the chaincode executable, with its output going to the log. It
+// does not start it once the process is asked to stop, so that stop always
+// signals the last executable started
+func (p *process) start(sandbox string, binary string, args []string, env []string) error {
+	output := io.MultiWriter(p.log, &lineLogger{id: p.id})
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = sandbox
+	cmd.Env = env
+	cmd.Stdout = output
+	cmd.Stderr = output
+	processesLock.Lock()
+	defer processesLock.Unlock()
+	if p.stopping {
+		return errStopping
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.cmd = cmd
+	return nil
+}
+
+// signal sends sig to the executable currently running
+func (p *process) signal(sig os.Signal) error {
+	processesLock.Lock()
+	cmd := p.cmd
+	processesLock.Unlock()
+	return cmd.Process.Signal(sig)
+}
+
+// supervise waits for the chaincode process to exit, and restarts it when it
+// exits without being stopped, up to vm.exec.restarts times
+func (p *process) supervise(sandbox string, binary string, args []string, env []string) {
+	defer close(p.done)
+	defer p.log.Close()
+
+	maxRestarts := viper.GetInt("vm.exec.restarts")
+	for {
+		processesLock.Lock()
+		cmd := p.cmd
+		processesLock.Unlock()
+
+		err := cmd.Wait()
+
+		processesLock.Lock()
+		stopping := p.stopping
+		processesLock.Unlock()
+		if stopping {
+			execLogger.Debugf("Chaincode %s stopped", p.id)
+			return
+		}
+		if p.restarts >= maxRestarts {
+			execLogger.Errorf("Chaincode %s exited (%v), giving up after %d restarts", p.id, err, p.restarts)
+			processesLock.Lock()
+			if processes[p.id] == p {
+				delete(processes, p.id)
+			}
+			processesLock.Unlock()
+			return
+		}
+		p.restarts++
+		execLogger.Warningf("Chaincode %s exited (%v), restarting it (%d/%d)", p.id, err, p.restarts, maxRestarts)
+		time.Sleep(time.Second)
+		if err = p.start(sandbox, binary, args, env); err == errStopping {
+			execLogger.Debugf("Chaincode %s stopped before it was restarted", p.id)
+			return
+		} else if err != nil {
+			execLogger.Errorf("Could not restart chaincode %s: %s", p.id, err)
+			processesLock.Lock()
+			if processes[p.id] == p {
+				delete(processes, p.id)
+			}
+			processesLock.Unlock()
+			return
+		}
+	}
+}
+
+//Stop stops a running chaincode. It is sent SIGTERM and, unless dontkill is
+//set, killed if it is still running after timeout seconds. There is no
+//container to remove, so dontremove is ignored
+func (vm *ExecVM) Stop(ctxt context.Context, ccid ccintf.CCID, timeout uint, dontkill bool, dontremove bool) error {
+	id, _ := vm.GetVMName(ccid)
+	return vm.stopInternal(id, timeout, dontkill)
+}
+
+func (vm *ExecVM) stopInternal(id string, timeout uint, dontkill bool) error {
+	processesLock.Lock()
+	p, ok := processes[id]
+	if !ok {
+		processesLock.Unlock()
+		return fmt.Errorf("%s not running", id)
+	}
+	delete(processes, id)
+	p.stopping = true
+	processesLock.Unlock()
+
+	if err := p.signal(syscall.SIGTERM); err != nil {
+		execLogger.Debugf("Stop chaincode %s(%s)", id, err)
+	}
+	if dontkill {
+		execLogger.Debugf("Stopping chaincode %s", id)
+		return nil
+	}
+	select {
+	case <-p.done:
+		execLogger.Debugf("Stopped chaincode %s", id)
+	case <-time.After(time.Duration(timeout) * time.Second):
+		if err := p.signal(os.Kill); err != nil {
+			execLogger.Debugf("Kill chaincode %s (%s)", id, err)
+		}
+		<-p.done
+		execLogger.Debugf("Killed chaincode %s", id)
+	}
+	return nil
+}
+
+//Destroy removes the sandbox of a chaincode, it fails if the chaincode is
+//running unless force is set
+func (vm *ExecVM) Destroy(ctxt context.Context, ccid ccintf.CCID, force bool, noprune bool) error {
+	id, _ := vm.GetVMName(ccid)
+
+	processesLock.Lock()
+	_, running := processes[id]
+	processesLock.Unlock()
+	if running {
+		if !force {
+			return fmt.Errorf("chaincode %s is running", id)
+		}
+		vm.stopInternal(id, 0, false)
+	}
+
+	err := os.RemoveAll(vm.sandbox(ccid))
+	if err != nil {
+		execLogger.Errorf("error while destroying sandbox: %s", err)
+	} else {
+		execLogger.Debugf("Destroyed sandbox %s", id)
+	}
+	return err
+}
+
+//GetVMName generates the sandbox name from peer information given the hashcode,
+//so that peers sharing a host do not share sandboxes
+func (vm *ExecVM) GetVMName(ccid ccintf.CCID) (string, error) {
+	if ccid.NetworkID != "" {
+		return fmt.Sprintf("%s-%s-%s", ccid.NetworkID, ccid.PeerID, ccid.ChaincodeSpec.ChaincodeID.Name), nil
+	} else if ccid.PeerID != "" {
+		return fmt.Sprintf("%s-%s", ccid.PeerID, ccid.ChaincodeSpec.ChaincodeID.Name), nil
+	} else {
+		return ccid.ChaincodeSpec.ChaincodeID.Name, nil
+	}
+}
+
+// lineLogger logs the output of a chaincode line by line
+type lineLogger struct {
+	id      string
+	pending []byte
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.pending = append(l.pending, p...)
+	for {
+		i := bytes.IndexByte(l.pending, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		execLogger.Debugf("[%s] %s", l.id, l.pending[:i])
+		l.pending = l.pending[i+1:]
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package execcontroller
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/container/ccintf"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+// sleeper prints its arguments and waits to be stopped
+const sleeper = `package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	fmt.Println("started", os.Args[1:], os.Getenv("CORE_CHAINCODE_ID_NAME"))
+	time.Sleep(time.Hour)
+}
+`
+
+// crasher exits the first time it runs, and waits to be stopped once restarted
+const crasher = `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+func main() {
+	if _, err := os.Stat("crashed"); err != nil {
+		ioutil.WriteFile("crashed", nil, 0644)
+		os.Exit(1)
+	}
+	fmt.Println("restarted")
+	time.Sleep(time.Hour)
+}
+`
+
+// newPackage returns a gzipped tar with the given files, as built for Docker
+func newPackage(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("Error writing package: %s", err)
+		}
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+	return buf
+}
+
+func newCCID(name string) ccintf.CCID {
+	return ccintf.CCID{
+		ChaincodeSpec: &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_GOLANG, ChaincodeID: &pb.ChaincodeID{Path: "https://example.com/sleeper/", Name: name}},
+		NetworkID:     "dev",
+		PeerID:        "vp0",
+	}
+}
+
+func setupSandbox(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "execcontroller")
+	if err != nil {
+		t.Fatalf("Error creating sandbox root: %s", err)
+	}
+	viper.Set("vm.exec.sandbox", dir)
+	return dir
+}
+
+func TestExecVMLifecycle(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	root := setupSandbox(t)
+	defer os.RemoveAll(root)
+
+	vm := &ExecVM{}
+	ccid := newCCID("sleeper")
+	pkg := newPackage(t, map[string]string{
+		"Dockerfile":                      "FROM scratch",
+		"src/example.com/sleeper/main.go": sleeper,
+	})
+	args := []string{"/opt/gopath/bin/sleeper", "-peer.address=localhost:30303"}
+	env := []string{"CORE_CHAINCODE_ID_NAME=sleeper"}
+
+	ctxt := context.Background()
+	if err := vm.Start(ctxt, ccid, args, env, false, false, pkg); err != nil {
+		t.Fatalf("Error starting chaincode: %s", err)
+	}
+	sandbox := filepath.Join(root, "dev-vp0-sleeper")
+	if _, err := os.Stat(filepath.Join(sandbox, "Dockerfile")); err == nil {
+		t.Errorf("Expected only the sources to be extracted")
+	}
+
+	var log []byte
+	for i := 0; i < 50 && !bytes.Contains(log, []byte("started")); i++ {
+		time.Sleep(100 * time.Millisecond)
+		log, _ = ioutil.ReadFile(filepath.Join(sandbox, logFile))
+	}
+	if !strings.Contains(string(log), "started [-peer.address=localhost:30303] sleeper") {
+		t.Errorf("Expected the chaincode output to be logged with its arguments and environment, got %q", log)
+	}
+
+	if err := vm.Destroy(ctxt, ccid, false, false); err == nil {
+		t.Errorf("Expected destroying a running chaincode to fail")
+	}
+	if err := vm.Stop(ctxt, ccid, 5, false, false); err != nil {
+		t.Fatalf("Error stopping chaincode: %s", err)
+	}
+	if err := vm.Stop(ctxt, ccid, 5, false, false); err == nil {
+		t.Errorf("Expected stopping a stopped chaincode to fail")
+	}
+
+	if err := vm.Destroy(ctxt, ccid, false, false); err != nil {
+		t.Fatalf("Error destroying chaincode: %s", err)
+	}
+	if _, err := os.Stat(sandbox); !os.IsNotExist(err) {
+		t.Errorf("Expected the sandbox to be removed")
+	}
+	if err := vm.Start(ctxt, ccid, args, env, false, false, nil); err == nil {
+		t.Errorf("Expected starting a destroyed chaincode to fail")
+	}
+}
+
+func TestExecVMStopWhileRestarting(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not available")
+	}
+	root := setupSandbox(t)
+	defer os.RemoveAll(root)
+	viper.Set("vm.exec.restarts", 1)
+	defer viper.Set("vm.exec.restarts", nil)
+
+	vm := &ExecVM{}
+	ccid := newCCID("crasher")
+	pkg := newPackage(t, map[string]string{"src/example.com/sleeper/main.go": crasher})
+	ctxt := context.Background()
+	if err := vm.Start(ctxt, ccid, nil, nil, false, false, pkg); err != nil {
+		t.Fatalf("Error starting chaincode: %s", err)
+	}
+	sandbox := filepath.Join(root, "dev-vp0-crasher")
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(filepath.Join(sandbox, "crashed")); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the chaincode is stopped while the supervisor waits to restart it
+	time.Sleep(300 * time.Millisecond)
+	stopped := make(chan error, 1)
+	go func() { stopped <- vm.Stop(ctxt, ccid, 1, false, false) }()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Error stopping chaincode: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out stopping a chaincode waiting to be restarted")
+	}
+
+	time.Sleep(time.Second)
+	if log, _ := ioutil.ReadFile(filepath.Join(sandbox, logFile)); bytes.Contains(log, []byte("restarted")) {
+		t.Errorf("Expected a stopped chaincode not to be restarted")
+	}
+}
+
+func TestExecVMDeployErrors(t *testing.T) {
+	root := setupSandbox(t)
+	defer os.RemoveAll(root)
+
+	vm := &ExecVM{}
+	ccid := newCCID("bad")
+	pkg := newPackage(t, map[string]string{"src/../../escape.go": "package main"})
+	if err := vm.Deploy(context.Background(), ccid, nil, nil, false, false, pkg); err == nil {
+		t.Errorf("Expected a package escaping the sandbox to be rejected")
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.go")); !os.IsNotExist(err) {
+		t.Errorf("Expected no file to be written outside the sandbox")
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		return
+	}
+	pkg = newPackage(t, map[string]string{"src/example.com/sleeper/main.go": "package main\n\nfunc main() { undefined() }\n"})
+	if err := vm.Deploy(context.Background(), ccid, nil, nil, false, false, pkg); err == nil {
+		t.Errorf("Expected a chaincode which does not compile to fail to deploy")
+	}
+}
@@ -104,6 +104,11 @@ type Peer interface {
 	// If vkID is nil, then the signature is verified against this validator's verification key.
 	Verify(vkID, signature, message []byte) error
 
+	// DeriveSessionKey returns the symmetric key this peer shares with the peer
+	// identified by id. Both peers derive the same key, by Diffie-Hellman on
+	// their enrollment keys.
+	DeriveSessionKey(id []byte) ([]byte, error)
+
 	// GetStateEncryptor returns a StateEncryptor linked to pair defined by
 	// the deploy transaction and the execute transaction. Notice that,
 	// executeTx can also correspond to a deploy transaction.
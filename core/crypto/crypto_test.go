@@ -1402,6 +1402,28 @@ func TestValidatorVerify(t *testing.T) {
 	}
 }
 
+func TestValidatorDeriveSessionKey(t *testing.T) {
+	initNodes()
+	defer closeNodes()
+
+	validatorKey, err := validator.DeriveSessionKey(peer.GetID())
+	if err != nil {
+		t.Fatalf("Failed deriving session key [%s].", err)
+	}
+	peerKey, err := peer.DeriveSessionKey(validator.GetID())
+	if err != nil {
+		t.Fatalf("Failed deriving session key [%s].", err)
+	}
+	if !bytes.Equal(validatorKey, peerKey) {
+		t.Fatalf("Session keys differ [% x] != [% x].", validatorKey, peerKey)
+	}
+
+	_, err = validator.DeriveSessionKey(nil)
+	if err == nil {
+		t.Fatal("DeriveSessionKey should fail when given an empty id.")
+	}
+}
+
 func BenchmarkTransactionCreation(b *testing.B) {
 	initNodes()
 	defer closeNodes()
@@ -175,6 +175,33 @@ func (peer *peerImpl) Verify(vkID, signature, message []byte) error {
 	return nil
 }
 
+// DeriveSessionKey returns the symmetric key this peer shares with the peer identified by id,
+// the hash of the Diffie-Hellman secret of their enrollment keys.
+func (peer *peerImpl) DeriveSessionKey(id []byte) ([]byte, error) {
+	if !peer.IsInitialized() {
+		return nil, utils.ErrNotInitialized
+	}
+
+	cert, err := peer.getEnrollmentCert(id)
+	if err != nil {
+		peer.Errorf("Failed getting enrollment cert for [% x]: [%s]", id, err)
+
+		return nil, err
+	}
+
+	pk, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Enrollment key of [% x] is not an ECDSA key.", id)
+	}
+	if pk.Curve != peer.enrollPrivKey.Curve {
+		return nil, fmt.Errorf("Enrollment key of [% x] is on a different curve.", id)
+	}
+
+	x, _ := pk.Curve.ScalarMult(pk.X, pk.Y, peer.enrollPrivKey.D.Bytes())
+
+	return primitives.Hash(x.Bytes()), nil
+}
+
 func (peer *peerImpl) GetStateEncryptor(deployTx, invokeTx *obc.Transaction) (StateEncryptor, error) {
 	return nil, utils.ErrNotImplemented
 }
@@ -0,0 +1,40 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/x509"
+)
+
+// TCertSubjectCommonName is the subject common name that the TCA puts in every
+// transaction certificate
+const TCertSubjectCommonName = "Transaction Certificate"
+
+// GetEnrollmentIDFromCert returns the enrollment ID of a DER encoded enrollment
+// certificate. Transaction certificates are unlinkable to the enrollment ID of
+// their owner, so an empty string is returned for them, as for an empty or
+// malformed certificate.
+func GetEnrollmentIDFromCert(der []byte) string {
+	if len(der) == 0 {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil || cert.Subject.CommonName == TCertSubjectCommonName {
+		return ""
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,461 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const boltDBFileName = "bolt.db"
+
+// A read transaction (snapshot or iterator) that is open while the data file
+// grows prevents the file from being re-mapped, and so blocks the writers.
+// Mapping a large region upfront (1 GB) avoids this for all but very large DBs.
+// This reserves virtual address space only, the file itself grows as needed.
+// Once the file outgrows this size, a commit that re-maps the file waits for
+// all the open read transactions. Hence their lifetime is bounded: an iterator
+// renews its transaction after boltIteratorMaxTxAge, and so may observe the
+// updates committed after its creation, while a snapshot expires after
+// boltSnapshotMaxAge, and the reads made from it afterwards fail.
+const boltInitialMmapSize = 1 << 30
+
+var (
+	boltIteratorMaxTxAge = 5 * time.Second
+	boltSnapshotMaxAge   = 5 * time.Minute
+)
+
+func init() {
+	RegisterKVStore("boltdb", func() KVStore { return &BoltDBStore{} })
+}
+
+// BoltDBStore is a pure Go KVStore backed by boltdb. Each column family is
+// stored in its own bucket. As boltdb does not accept empty keys, every key is
+// stored with a one byte prefix, which preserves the ordering of the keys.
+// Snapshots are read-only transactions and hence must be released promptly,
+// as boltdb cannot reuse the pages they reference (see boltInitialMmapSize).
+type BoltDBStore struct {
+	DB *bolt.DB
+}
+
+type boltColumnFamily string
+
+func (cf boltColumnFamily) Name() string {
+	return string(cf)
+}
+
+type boltOperation struct {
+	cf     ColumnFamily
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+type boltWriteBatch struct {
+	operations []boltOperation
+}
+
+func (writeBatch *boltWriteBatch) PutCF(cf ColumnFamily, key []byte, value []byte) {
+	writeBatch.operations = append(writeBatch.operations, boltOperation{cf, boltKey(key), makeCopy(value), false})
+}
+
+func (writeBatch *boltWriteBatch) DeleteCF(cf ColumnFamily, key []byte) {
+	writeBatch.operations = append(writeBatch.operations, boltOperation{cf, boltKey(key), nil, true})
+}
+
+func (writeBatch *boltWriteBatch) Destroy() {
+	writeBatch.operations = nil
+}
+
+// boltReadTx is a read-only transaction that is rolled back by a timer once it
+// is older than maxAge. It can then be renewed, unless it was released.
+type boltReadTx struct {
+	sync.Mutex
+	db       *bolt.DB
+	maxAge   time.Duration
+	tx       *bolt.Tx
+	start    time.Time
+	timer    *time.Timer
+	released bool
+}
+
+func beginBoltReadTx(db *bolt.DB, maxAge time.Duration) (*boltReadTx, error) {
+	rtx := &boltReadTx{db: db, maxAge: maxAge}
+	if err := rtx.renew(); err != nil {
+		return nil, err
+	}
+	return rtx, nil
+}
+
+// renew begins a new transaction. The caller must hold the lock, except when
+// the boltReadTx is being created.
+func (rtx *boltReadTx) renew() error {
+	tx, err := rtx.db.Begin(false)
+	if err != nil {
+		return err
+	}
+	rtx.tx, rtx.start = tx, time.Now()
+	if rtx.timer == nil {
+		rtx.timer = time.AfterFunc(rtx.maxAge, rtx.expire)
+	} else {
+		rtx.timer.Reset(rtx.maxAge)
+	}
+	return nil
+}
+
+func (rtx *boltReadTx) expire() {
+	rtx.Lock()
+	defer rtx.Unlock()
+	// the transaction may have been renewed while the timer was firing
+	if rtx.tx != nil && time.Since(rtx.start) >= rtx.maxAge {
+		rtx.tx.Rollback()
+		rtx.tx = nil
+	}
+}
+
+func (rtx *boltReadTx) release() {
+	rtx.Lock()
+	defer rtx.Unlock()
+	rtx.timer.Stop()
+	if rtx.tx != nil {
+		rtx.tx.Rollback()
+		rtx.tx = nil
+	}
+	rtx.released = true
+}
+
+type boltSnapshot struct {
+	rtx *boltReadTx
+}
+
+func (snapshot *boltSnapshot) Release() {
+	snapshot.rtx.release()
+}
+
+// boltIterator returns copies of the keys and values, as the transaction they
+// belong to may expire while the iterator is not moved
+type boltIterator struct {
+	rtx      *boltReadTx
+	ownTx    bool
+	cf       ColumnFamily
+	cursor   *bolt.Cursor
+	cursorTx *bolt.Tx
+	key      []byte
+	value    []byte
+}
+
+func newBoltIterator(rtx *boltReadTx, ownTx bool, cf ColumnFamily) *boltIterator {
+	return &boltIterator{rtx: rtx, ownTx: ownTx, cf: cf}
+}
+
+// move positions the cursor with the given function, holding the lock of the
+// transaction. If the transaction was renewed since the previous move, the
+// cursor is first re-created and the function is told so.
+func (itr *boltIterator) move(position func(cursor *bolt.Cursor, renewed bool) ([]byte, []byte)) {
+	itr.rtx.Lock()
+	defer itr.rtx.Unlock()
+	var key, value []byte
+	if itr.rtx.tx == nil && !itr.rtx.released {
+		if !itr.ownTx {
+			dbLogger.Warningf("Iterating a boltdb snapshot older than %s, which has expired", boltSnapshotMaxAge)
+		} else if err := itr.rtx.renew(); err != nil {
+			dbLogger.Errorf("Error renewing the transaction of a boltdb iterator: %s", err)
+		}
+	}
+	if itr.rtx.tx != nil {
+		renewed := itr.cursorTx != nil && itr.cursorTx != itr.rtx.tx
+		if itr.cursorTx != itr.rtx.tx {
+			itr.cursor, itr.cursorTx = nil, itr.rtx.tx
+			if bucket := itr.rtx.tx.Bucket([]byte(itr.cf.Name())); bucket != nil {
+				itr.cursor = bucket.Cursor()
+			}
+		}
+		if itr.cursor != nil {
+			key, value = position(itr.cursor, renewed)
+		}
+	}
+	itr.key, itr.value = boltCopy(key), boltCopy(value)
+}
+
+func (itr *boltIterator) Seek(key []byte) {
+	itr.move(func(cursor *bolt.Cursor, renewed bool) ([]byte, []byte) {
+		return cursor.Seek(boltKey(key))
+	})
+}
+
+func (itr *boltIterator) SeekToFirst() {
+	itr.move(func(cursor *bolt.Cursor, renewed bool) ([]byte, []byte) {
+		return cursor.First()
+	})
+}
+
+func (itr *boltIterator) Next() {
+	current := itr.key
+	if current == nil {
+		return
+	}
+	itr.move(func(cursor *bolt.Cursor, renewed bool) ([]byte, []byte) {
+		if renewed {
+			// resume after the current key, which may have been deleted since
+			key, value := cursor.Seek(current)
+			if !bytes.Equal(key, current) {
+				return key, value
+			}
+		}
+		return cursor.Next()
+	})
+}
+
+func (itr *boltIterator) Valid() bool {
+	return itr.key != nil
+}
+
+func (itr *boltIterator) ValidForPrefix(prefix []byte) bool {
+	return itr.key != nil && bytes.HasPrefix(itr.key[1:], prefix)
+}
+
+func (itr *boltIterator) Key() []byte {
+	if itr.key == nil {
+		return nil
+	}
+	return itr.key[1:]
+}
+
+func (itr *boltIterator) Value() []byte {
+	return itr.value
+}
+
+func (itr *boltIterator) Close() {
+	itr.key, itr.value = nil, nil
+	if itr.ownTx {
+		itr.rtx.release()
+	}
+}
+
+// Open implements method in interface KVStore
+func (store *BoltDBStore) Open(dbPath string, cfNames []string) ([]ColumnFamily, error) {
+	dbFile := filepath.Join(dbPath, boltDBFileName)
+	missing, err := dirMissingOrEmpty(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	dbLogger.Debugf("Is db path [%s] empty [%t]", dbPath, missing)
+
+	if missing {
+		err = os.MkdirAll(dbPath, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("Error making directory path [%s]: %s", dbPath, err)
+		}
+	} else if _, err = os.Stat(dbFile); err != nil {
+		return nil, fmt.Errorf("Directory [%s] does not contain a boltdb database: %s", dbPath, err)
+	}
+
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: time.Second, InitialMmapSize: boltInitialMmapSize})
+	if err != nil {
+		return nil, err
+	}
+
+	cfs := make([]ColumnFamily, len(cfNames))
+	err = db.Update(func(tx *bolt.Tx) error {
+		for i, cfName := range cfNames {
+			if _, err := tx.CreateBucketIfNotExists([]byte(cfName)); err != nil {
+				return err
+			}
+			cfs[i] = boltColumnFamily(cfName)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	store.DB = db
+	return cfs, nil
+}
+
+// Close implements method in interface KVStore
+func (store *BoltDBStore) Close() {
+	store.DB.Close()
+}
+
+// Get implements method in interface KVStore
+func (store *BoltDBStore) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	var value []byte
+	err := store.DB.View(func(tx *bolt.Tx) error {
+		value = boltGet(tx, cf, key)
+		return nil
+	})
+	return value, err
+}
+
+// Put implements method in interface KVStore
+func (store *BoltDBStore) Put(cf ColumnFamily, key []byte, value []byte) error {
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		bucket, err := boltBucket(tx, cf)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(boltKey(key), value)
+	})
+}
+
+// Delete implements method in interface KVStore
+func (store *BoltDBStore) Delete(cf ColumnFamily, key []byte) error {
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		bucket, err := boltBucket(tx, cf)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete(boltKey(key))
+	})
+}
+
+// NewWriteBatch implements method in interface KVStore
+func (store *BoltDBStore) NewWriteBatch() WriteBatch {
+	return &boltWriteBatch{}
+}
+
+// Write implements method in interface KVStore
+func (store *BoltDBStore) Write(writeBatch WriteBatch) error {
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		for _, op := range writeBatch.(*boltWriteBatch).operations {
+			bucket, err := boltBucket(tx, op.cf)
+			if err != nil {
+				return err
+			}
+			if op.delete {
+				err = bucket.Delete(op.key)
+			} else {
+				err = bucket.Put(op.key, op.value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewSnapshot implements method in interface KVStore
+func (store *BoltDBStore) NewSnapshot() Snapshot {
+	rtx, err := beginBoltReadTx(store.DB, boltSnapshotMaxAge)
+	if err != nil {
+		panic(fmt.Sprintf("Error creating boltdb snapshot: %s", err))
+	}
+	return &boltSnapshot{rtx}
+}
+
+// GetFromSnapshot implements method in interface KVStore
+func (store *BoltDBStore) GetFromSnapshot(snapshot Snapshot, cf ColumnFamily, key []byte) ([]byte, error) {
+	rtx := snapshot.(*boltSnapshot).rtx
+	rtx.Lock()
+	defer rtx.Unlock()
+	if rtx.tx == nil {
+		return nil, fmt.Errorf("The boltdb snapshot has expired or was released, snapshots are kept for %s at most", boltSnapshotMaxAge)
+	}
+	return boltGet(rtx.tx, cf, key), nil
+}
+
+// NewIterator implements method in interface KVStore
+func (store *BoltDBStore) NewIterator(cf ColumnFamily) Iterator {
+	rtx, err := beginBoltReadTx(store.DB, boltIteratorMaxTxAge)
+	if err != nil {
+		panic(fmt.Sprintf("Error creating boltdb iterator: %s", err))
+	}
+	return newBoltIterator(rtx, true, cf)
+}
+
+// NewSnapshotIterator implements method in interface KVStore
+func (store *BoltDBStore) NewSnapshotIterator(snapshot Snapshot, cf ColumnFamily) Iterator {
+	return newBoltIterator(snapshot.(*boltSnapshot).rtx, false, cf)
+}
+
+// DropColumnFamily implements method in interface KVStore
+func (store *BoltDBStore) DropColumnFamily(cf ColumnFamily) error {
+	return store.DB.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(cf.Name()))
+	})
+}
+
+// CreateColumnFamily implements method in interface KVStore
+func (store *BoltDBStore) CreateColumnFamily(name string) (ColumnFamily, error) {
+	err := store.DB.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return boltColumnFamily(name), nil
+}
+
+// GetProperty implements method in interface KVStore. The only property
+// maintained is 'boltdb.num-keys' of a column family.
+func (store *BoltDBStore) GetProperty(cf ColumnFamily, name string) string {
+	if cf == nil || name != "boltdb.num-keys" {
+		return ""
+	}
+	var property string
+	store.DB.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket([]byte(cf.Name())); bucket != nil {
+			property = fmt.Sprintf("%d", bucket.Stats().KeyN)
+		}
+		return nil
+	})
+	return property
+}
+
+// boltCopy copies a key or a value out of a transaction, keeping nil as nil
+func boltCopy(src []byte) []byte {
+	if src == nil {
+		return nil
+	}
+	return makeCopy(src)
+}
+
+func boltKey(key []byte) []byte {
+	return append([]byte{0}, key...)
+}
+
+// boltBucket returns the bucket of the column family to write to, or an error
+// if the column family does not exist (e.g., it was dropped)
+func boltBucket(tx *bolt.Tx, cf ColumnFamily) (*bolt.Bucket, error) {
+	bucket := tx.Bucket([]byte(cf.Name()))
+	if bucket == nil {
+		return nil, fmt.Errorf("Column family [%s] does not exist", cf.Name())
+	}
+	return bucket, nil
+}
+
+func boltGet(tx *bolt.Tx, cf ColumnFamily, key []byte) []byte {
+	bucket := tx.Bucket([]byte(cf.Name()))
+	if bucket == nil {
+		return nil
+	}
+	value := bucket.Get(boltKey(key))
+	if value == nil {
+		return nil
+	}
+	// the value is only valid for the life of the transaction
+	return makeCopy(value)
+}
@@ -20,13 +20,11 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"strings"
 	"sync"
 
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 var dbLogger = logging.MustGetLogger("db")
@@ -52,14 +50,14 @@ const (
 	opened
 )
 
-// OpenchainDB encapsulates rocksdb's structures
+// OpenchainDB encapsulates the KVStore and the handles of its column families
 type OpenchainDB struct {
-	DB           *gorocksdb.DB
-	BlockchainCF *gorocksdb.ColumnFamilyHandle
-	StateCF      *gorocksdb.ColumnFamilyHandle
-	StateDeltaCF *gorocksdb.ColumnFamilyHandle
-	IndexesCF    *gorocksdb.ColumnFamilyHandle
-	PersistCF    *gorocksdb.ColumnFamilyHandle
+	Store        KVStore
+	BlockchainCF ColumnFamily
+	StateCF      ColumnFamily
+	StateDeltaCF ColumnFamily
+	IndexesCF    ColumnFamily
+	PersistCF    ColumnFamily
 	dbState      dbState
 	mux          sync.Mutex
 }
@@ -83,7 +81,7 @@ func (openchainDB *OpenchainDB) GetFromBlockchainCF(key []byte) ([]byte, error)
 }
 
 // GetFromBlockchainCFSnapshot get value for given key from column family in a DB snapshot - blockchainCF
-func (openchainDB *OpenchainDB) GetFromBlockchainCFSnapshot(snapshot *gorocksdb.Snapshot, key []byte) ([]byte, error) {
+func (openchainDB *OpenchainDB) GetFromBlockchainCFSnapshot(snapshot Snapshot, key []byte) ([]byte, error) {
 	return openchainDB.getFromSnapshot(snapshot, openchainDB.BlockchainCF, key)
 }
 
@@ -103,31 +101,48 @@ func (openchainDB *OpenchainDB) GetFromIndexesCF(key []byte) ([]byte, error) {
 }
 
 // GetBlockchainCFIterator get iterator for column family - blockchainCF
-func (openchainDB *OpenchainDB) GetBlockchainCFIterator() *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetBlockchainCFIterator() Iterator {
 	return openchainDB.GetIterator(openchainDB.BlockchainCF)
 }
 
 // GetStateCFIterator get iterator for column family - stateCF
-func (openchainDB *OpenchainDB) GetStateCFIterator() *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetStateCFIterator() Iterator {
 	return openchainDB.GetIterator(openchainDB.StateCF)
 }
 
 // GetStateCFSnapshotIterator get iterator for column family - stateCF. This iterator
 // is based on a snapshot and should be used for long running scans, such as
 // reading the entire state. Remember to call iterator.Close() when you are done.
-func (openchainDB *OpenchainDB) GetStateCFSnapshotIterator(snapshot *gorocksdb.Snapshot) *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetStateCFSnapshotIterator(snapshot Snapshot) Iterator {
 	return openchainDB.getSnapshotIterator(snapshot, openchainDB.StateCF)
 }
 
 // GetStateDeltaCFIterator get iterator for column family - stateDeltaCF
-func (openchainDB *OpenchainDB) GetStateDeltaCFIterator() *gorocksdb.Iterator {
+func (openchainDB *OpenchainDB) GetStateDeltaCFIterator() Iterator {
 	return openchainDB.GetIterator(openchainDB.StateDeltaCF)
 }
 
 // GetSnapshot returns a point-in-time view of the DB. You MUST call snapshot.Release()
 // when you are done with the snapshot.
-func (openchainDB *OpenchainDB) GetSnapshot() *gorocksdb.Snapshot {
-	return openchainDB.DB.NewSnapshot()
+func (openchainDB *OpenchainDB) GetSnapshot() Snapshot {
+	return openchainDB.Store.NewSnapshot()
+}
+
+// NewWriteBatch returns an empty batch of updates for the DB. You MUST call
+// writeBatch.Destroy() when you are done with the batch.
+func (openchainDB *OpenchainDB) NewWriteBatch() WriteBatch {
+	return openchainDB.Store.NewWriteBatch()
+}
+
+// Write atomically applies the updates of the batch to the DB
+func (openchainDB *OpenchainDB) Write(writeBatch WriteBatch) error {
+	return openchainDB.Store.Write(writeBatch)
+}
+
+// GetProperty returns a statistic maintained by the underlying store about the
+// given column family, or about the whole DB if cf is nil
+func (openchainDB *OpenchainDB) GetProperty(cf ColumnFamily, name string) string {
+	return openchainDB.Store.GetProperty(cf, name)
 }
 
 func getDBPath() string {
@@ -141,7 +156,7 @@ func getDBPath() string {
 	return dbPath + "db"
 }
 
-// Open open underlying rocksdb
+// Open opens the underlying KVStore selected by 'peer.db.type'
 func (openchainDB *OpenchainDB) Open() {
 	openchainDB.mux.Lock()
 	if openchainDB.dbState == opened {
@@ -152,48 +167,26 @@ func (openchainDB *OpenchainDB) Open() {
 	defer openchainDB.mux.Unlock()
 
 	dbPath := getDBPath()
-	missing, err := dirMissingOrEmpty(dbPath)
+	store, err := newKVStore(viper.GetString("peer.db.type"))
 	if err != nil {
-		panic(fmt.Sprintf("Error while trying to open DB: %s", err))
-	}
-	dbLogger.Debugf("Is db path [%s] empty [%t]", dbPath, missing)
-
-	if missing {
-		err = os.MkdirAll(path.Dir(dbPath), 0755)
-		if err != nil {
-			panic(fmt.Sprintf("Error making directory path [%s]: %s", dbPath, err))
-		}
-	}
-
-	opts := gorocksdb.NewDefaultOptions()
-	defer opts.Destroy()
-
-	opts.SetCreateIfMissing(missing)
-	opts.SetCreateIfMissingColumnFamilies(true)
-
-	cfNames := []string{"default"}
-	cfNames = append(cfNames, columnfamilies...)
-	var cfOpts []*gorocksdb.Options
-	for range cfNames {
-		cfOpts = append(cfOpts, opts)
+		panic(fmt.Sprintf("Error opening DB: %s", err))
 	}
 
-	db, cfHandlers, err := gorocksdb.OpenDbColumnFamilies(opts, dbPath, cfNames, cfOpts)
-
+	cfHandlers, err := store.Open(dbPath, columnfamilies)
 	if err != nil {
 		panic(fmt.Sprintf("Error opening DB: %s", err))
 	}
 
-	openchainDB.DB = db
-	openchainDB.BlockchainCF = cfHandlers[1]
-	openchainDB.StateCF = cfHandlers[2]
-	openchainDB.StateDeltaCF = cfHandlers[3]
-	openchainDB.IndexesCF = cfHandlers[4]
-	openchainDB.PersistCF = cfHandlers[5]
+	openchainDB.Store = store
+	openchainDB.BlockchainCF = cfHandlers[0]
+	openchainDB.StateCF = cfHandlers[1]
+	openchainDB.StateDeltaCF = cfHandlers[2]
+	openchainDB.IndexesCF = cfHandlers[3]
+	openchainDB.PersistCF = cfHandlers[4]
 	openchainDB.dbState = opened
 }
 
-// Close releases all column family handles and closes rocksdb
+// Close releases all column family handles and closes the KVStore
 func (openchainDB *OpenchainDB) Close() {
 	openchainDB.mux.Lock()
 	if openchainDB.dbState == closed {
@@ -202,12 +195,7 @@ func (openchainDB *OpenchainDB) Close() {
 	}
 
 	defer openchainDB.mux.Unlock()
-	openchainDB.BlockchainCF.Destroy()
-	openchainDB.StateCF.Destroy()
-	openchainDB.StateDeltaCF.Destroy()
-	openchainDB.IndexesCF.Destroy()
-	openchainDB.PersistCF.Destroy()
-	openchainDB.DB.Close()
+	openchainDB.Store.Close()
 	openchainDB.dbState = closed
 }
 
@@ -215,24 +203,22 @@ func (openchainDB *OpenchainDB) Close() {
 // only used during state synchronization when creating a new state from
 // a snapshot.
 func (openchainDB *OpenchainDB) DeleteState() error {
-	err := openchainDB.DB.DropColumnFamily(openchainDB.StateCF)
+	err := openchainDB.Store.DropColumnFamily(openchainDB.StateCF)
 	if err != nil {
 		dbLogger.Errorf("Error dropping state CF: %s", err)
 		return err
 	}
-	err = openchainDB.DB.DropColumnFamily(openchainDB.StateDeltaCF)
+	err = openchainDB.Store.DropColumnFamily(openchainDB.StateDeltaCF)
 	if err != nil {
 		dbLogger.Errorf("Error dropping state delta CF: %s", err)
 		return err
 	}
-	opts := gorocksdb.NewDefaultOptions()
-	defer opts.Destroy()
-	openchainDB.StateCF, err = openchainDB.DB.CreateColumnFamily(opts, stateCF)
+	openchainDB.StateCF, err = openchainDB.Store.CreateColumnFamily(stateCF)
 	if err != nil {
 		dbLogger.Errorf("Error creating state CF: %s", err)
 		return err
 	}
-	openchainDB.StateDeltaCF, err = openchainDB.DB.CreateColumnFamily(opts, stateDeltaCF)
+	openchainDB.StateDeltaCF, err = openchainDB.Store.CreateColumnFamily(stateDeltaCF)
 	if err != nil {
 		dbLogger.Errorf("Error creating state delta CF: %s", err)
 		return err
@@ -241,27 +227,18 @@ func (openchainDB *OpenchainDB) DeleteState() error {
 }
 
 // Get returns the valud for the given column family and key
-func (openchainDB *OpenchainDB) Get(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	slice, err := openchainDB.DB.GetCF(opt, cfHandler, key)
+func (openchainDB *OpenchainDB) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	value, err := openchainDB.Store.Get(cf, key)
 	if err != nil {
 		fmt.Println("Error while trying to retrieve key:", key)
 		return nil, err
 	}
-	defer slice.Free()
-	if slice.Data() == nil {
-		return nil, nil
-	}
-	data := makeCopy(slice.Data())
-	return data, nil
+	return value, nil
 }
 
 // Put saves the key/value in the given column family
-func (openchainDB *OpenchainDB) Put(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte, value []byte) error {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := openchainDB.DB.PutCF(opt, cfHandler, key, value)
+func (openchainDB *OpenchainDB) Put(cf ColumnFamily, key []byte, value []byte) error {
+	err := openchainDB.Store.Put(cf, key, value)
 	if err != nil {
 		fmt.Println("Error while trying to write key:", key)
 		return err
@@ -270,10 +247,8 @@ func (openchainDB *OpenchainDB) Put(cfHandler *gorocksdb.ColumnFamilyHandle, key
 }
 
 // Delete delets the given key in the specified column family
-func (openchainDB *OpenchainDB) Delete(cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) error {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := openchainDB.DB.DeleteCF(opt, cfHandler, key)
+func (openchainDB *OpenchainDB) Delete(cf ColumnFamily, key []byte) error {
+	err := openchainDB.Store.Delete(cf, key)
 	if err != nil {
 		fmt.Println("Error while trying to delete key:", key)
 		return err
@@ -281,34 +256,22 @@ func (openchainDB *OpenchainDB) Delete(cfHandler *gorocksdb.ColumnFamilyHandle,
 	return nil
 }
 
-func (openchainDB *OpenchainDB) getFromSnapshot(snapshot *gorocksdb.Snapshot, cfHandler *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	opt.SetSnapshot(snapshot)
-	slice, err := openchainDB.DB.GetCF(opt, cfHandler, key)
+func (openchainDB *OpenchainDB) getFromSnapshot(snapshot Snapshot, cf ColumnFamily, key []byte) ([]byte, error) {
+	value, err := openchainDB.Store.GetFromSnapshot(snapshot, cf, key)
 	if err != nil {
 		fmt.Println("Error while trying to retrieve key:", key)
 		return nil, err
 	}
-	defer slice.Free()
-	data := append([]byte(nil), slice.Data()...)
-	return data, nil
+	return value, nil
 }
 
 // GetIterator returns an iterator for the given column family
-func (openchainDB *OpenchainDB) GetIterator(cfHandler *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
-	opt := gorocksdb.NewDefaultReadOptions()
-	opt.SetFillCache(true)
-	defer opt.Destroy()
-	return openchainDB.DB.NewIteratorCF(opt, cfHandler)
+func (openchainDB *OpenchainDB) GetIterator(cf ColumnFamily) Iterator {
+	return openchainDB.Store.NewIterator(cf)
 }
 
-func (openchainDB *OpenchainDB) getSnapshotIterator(snapshot *gorocksdb.Snapshot, cfHandler *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	opt.SetSnapshot(snapshot)
-	iter := openchainDB.DB.NewIteratorCF(opt, cfHandler)
-	return iter
+func (openchainDB *OpenchainDB) getSnapshotIterator(snapshot Snapshot, cf ColumnFamily) Iterator {
+	return openchainDB.Store.NewSnapshotIterator(snapshot, cf)
 }
 
 func dirMissingOrEmpty(path string) (bool, error) {
@@ -23,7 +23,6 @@ import (
 	"testing"
 
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 func TestMain(m *testing.M) {
@@ -229,14 +228,12 @@ func TestDBIteratorAndSnapshotIterator(t *testing.T) {
 }
 
 // db helper functions
-func testIterator(t *testing.T, itr *gorocksdb.Iterator, expectedValues map[string][]byte) {
+func testIterator(t *testing.T, itr Iterator, expectedValues map[string][]byte) {
 	itrResults := make(map[string][]byte)
 	itr.SeekToFirst()
 	for ; itr.Valid(); itr.Next() {
-		key := itr.Key()
-		value := itr.Value()
-		k := makeCopy(key.Data())
-		v := makeCopy(value.Data())
+		k := makeCopy(itr.Key())
+		v := makeCopy(itr.Value())
 		itrResults[string(k)] = v
 	}
 	if len(itrResults) != len(expectedValues) {
@@ -269,15 +266,13 @@ func setupTestConfig() {
 }
 
 func performBasicReadWrite(openchainDB *OpenchainDB, t *testing.T) {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := openchainDB.NewWriteBatch()
 	defer writeBatch.Destroy()
 	writeBatch.PutCF(openchainDB.BlockchainCF, []byte("dummyKey"), []byte("dummyValue"))
 	writeBatch.PutCF(openchainDB.StateCF, []byte("dummyKey1"), []byte("dummyValue1"))
 	writeBatch.PutCF(openchainDB.StateDeltaCF, []byte("dummyKey2"), []byte("dummyValue2"))
 	writeBatch.PutCF(openchainDB.IndexesCF, []byte("dummyKey3"), []byte("dummyValue3"))
-	err := openchainDB.DB.Write(opt, writeBatch)
+	err := openchainDB.Write(writeBatch)
 	if err != nil {
 		t.Fatalf("Error while writing to db: %s", err)
 	}
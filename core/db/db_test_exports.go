@@ -21,7 +21,6 @@ import (
 	"testing"
 
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 // TestDBWrapper wraps the db. Can be used by other modules for testing
@@ -68,32 +67,17 @@ func (testDB *TestDBWrapper) cleanup() {
 func (testDB *TestDBWrapper) removeDBPath() {
 	dbPath := viper.GetString("peer.fileSystemPath")
 	os.RemoveAll(dbPath)
+	removeMemoryStore(getDBPath())
 }
 
 // WriteToDB tests can use this method for persisting a given batch to db
-func (testDB *TestDBWrapper) WriteToDB(t testing.TB, writeBatch *gorocksdb.WriteBatch) {
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := GetDBHandle().DB.Write(opt, writeBatch)
+func (testDB *TestDBWrapper) WriteToDB(t testing.TB, writeBatch WriteBatch) {
+	err := GetDBHandle().Write(writeBatch)
 	if err != nil {
 		t.Fatalf("Error while writing to db. Error:%s", err)
 	}
 }
 
-// GetFromDB gets the value for the given key from default column-family
-func (testDB *TestDBWrapper) GetFromDB(t testing.TB, key []byte) []byte {
-	db := GetDBHandle().DB
-	opt := gorocksdb.NewDefaultReadOptions()
-	defer opt.Destroy()
-	slice, err := db.Get(opt, key)
-	defer slice.Free()
-	if err != nil {
-		t.Fatalf("Error while getting key-value from DB: %s", err)
-	}
-	value := append([]byte(nil), slice.Data()...)
-	return value
-}
-
 // GetFromStateCF tests can use this method for getting value from StateCF column-family
 func (testDB *TestDBWrapper) GetFromStateCF(t testing.TB, key []byte) []byte {
 	openchainDB := GetDBHandle()
@@ -124,15 +108,15 @@ func (testDB *TestDBWrapper) CloseDB(t testing.TB) {
 func (testDB *TestDBWrapper) GetEstimatedNumKeys(t testing.TB) map[string]string {
 	openchainDB := GetDBHandle()
 	result := make(map[string]string, 5)
-	result["stateCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.StateCF)
-	result["stateDeltaCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.StateDeltaCF)
-	result["blockchainCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.BlockchainCF)
-	result["indexCF"] = openchainDB.DB.GetPropertyCF("rocksdb.estimate-num-keys", openchainDB.IndexesCF)
+	result["stateCF"] = openchainDB.GetProperty(openchainDB.StateCF, "rocksdb.estimate-num-keys")
+	result["stateDeltaCF"] = openchainDB.GetProperty(openchainDB.StateDeltaCF, "rocksdb.estimate-num-keys")
+	result["blockchainCF"] = openchainDB.GetProperty(openchainDB.BlockchainCF, "rocksdb.estimate-num-keys")
+	result["indexCF"] = openchainDB.GetProperty(openchainDB.IndexesCF, "rocksdb.estimate-num-keys")
 	return result
 }
 
 // GetDBStats returns statistics for the database
 func (testDB *TestDBWrapper) GetDBStats() string {
 	openchainDB := GetDBHandle()
-	return openchainDB.DB.GetProperty("rocksdb.stats")
+	return openchainDB.GetProperty(nil, "rocksdb.stats")
 }
@@ -0,0 +1,137 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ColumnFamily is a handle to a named key space of a KVStore
+type ColumnFamily interface {
+	Name() string
+}
+
+// WriteBatch accumulates updates to be applied atomically by KVStore.Write.
+// You MUST call writeBatch.Destroy() when you are done with the batch.
+type WriteBatch interface {
+	PutCF(cf ColumnFamily, key []byte, value []byte)
+	DeleteCF(cf ColumnFamily, key []byte)
+	Destroy()
+}
+
+// Snapshot is a point-in-time view of a KVStore. You MUST call snapshot.Release()
+// when you are done with the snapshot.
+type Snapshot interface {
+	Release()
+}
+
+// Iterator walks the keys of a column family in lexical order. The slices
+// returned by Key() and Value() are only valid until the iterator is moved or
+// closed; callers that keep them must make a copy. You MUST call iterator.Close()
+// when you are done with the iterator.
+type Iterator interface {
+	Seek(key []byte)
+	SeekToFirst()
+	Next()
+	Valid() bool
+	ValidForPrefix(prefix []byte) bool
+	Key() []byte
+	Value() []byte
+	Close()
+}
+
+// KVStore is the storage engine underlying the OpenchainDB. Keys are organized
+// in column families that are all created when the store is opened.
+type KVStore interface {
+	// Open opens the store at dbPath, creating it if missing, and returns the
+	// handles of the given column families in the same order
+	Open(dbPath string, cfNames []string) ([]ColumnFamily, error)
+	Close()
+
+	// Get returns nil if the key does not exist
+	Get(cf ColumnFamily, key []byte) ([]byte, error)
+	Put(cf ColumnFamily, key []byte, value []byte) error
+	Delete(cf ColumnFamily, key []byte) error
+
+	NewWriteBatch() WriteBatch
+	Write(writeBatch WriteBatch) error
+
+	NewSnapshot() Snapshot
+	GetFromSnapshot(snapshot Snapshot, cf ColumnFamily, key []byte) ([]byte, error)
+
+	// NewIterator returns an iterator over the column family. The iterator
+	// is not affected by the updates made after its creation, except for
+	// boltdb iterators kept open for long (see boltInitialMmapSize).
+	NewIterator(cf ColumnFamily) Iterator
+	NewSnapshotIterator(snapshot Snapshot, cf ColumnFamily) Iterator
+
+	// DropColumnFamily deletes the column family along with all its keys. The
+	// handle must not be used afterwards.
+	DropColumnFamily(cf ColumnFamily) error
+	CreateColumnFamily(name string) (ColumnFamily, error)
+
+	// GetProperty returns an implementation specific statistic about the column
+	// family, or about the whole store if cf is nil. An empty string is returned
+	// for the properties the store does not maintain.
+	GetProperty(cf ColumnFamily, name string) string
+}
+
+// DefaultKVStore is the store used when 'peer.db.type' is not set
+const DefaultKVStore = "rocksdb"
+
+var kvStoreFactories = struct {
+	sync.RWMutex
+	m map[string]func() KVStore
+}{m: make(map[string]func() KVStore)}
+
+// RegisterKVStore makes a KVStore implementation available under the given
+// name. It is intended to be called from the init function of the implementation.
+func RegisterKVStore(name string, factory func() KVStore) {
+	kvStoreFactories.Lock()
+	defer kvStoreFactories.Unlock()
+	if _, exists := kvStoreFactories.m[name]; exists {
+		panic(fmt.Sprintf("KVStore [%s] is already registered", name))
+	}
+	kvStoreFactories.m[name] = factory
+}
+
+// RegisteredKVStores returns the names of the KVStore implementations compiled into the binary
+func RegisteredKVStores() []string {
+	kvStoreFactories.RLock()
+	defer kvStoreFactories.RUnlock()
+	names := []string{}
+	for name := range kvStoreFactories.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newKVStore(name string) (KVStore, error) {
+	if name == "" {
+		name = DefaultKVStore
+	}
+	kvStoreFactories.RLock()
+	factory, ok := kvStoreFactories.m[name]
+	kvStoreFactories.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown DB type [%s]. Available types are %v", name, RegisteredKVStores())
+	}
+	return factory(), nil
+}
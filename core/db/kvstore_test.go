@@ -0,0 +1,282 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKVStoreUnknownType(t *testing.T) {
+	_, err := newKVStore("no-such-store")
+	if err == nil {
+		t.Fatal("An error was expected for an unknown DB type")
+	}
+}
+
+func TestKVStores(t *testing.T) {
+	for _, name := range RegisteredKVStores() {
+		t.Logf("Testing KVStore [%s]", name)
+		testKVStoreBasicOperations(t, name)
+		testKVStoreWriteBatch(t, name)
+		testKVStoreSnapshot(t, name)
+		testKVStoreIterator(t, name)
+		testKVStoreDropColumnFamily(t, name)
+		testKVStoreReopen(t, name)
+	}
+}
+
+func TestBoltDBMissingColumnFamily(t *testing.T) {
+	store, cfs, _, cleanup := openTestKVStore(t, "boltdb")
+	defer cleanup()
+
+	if err := store.DropColumnFamily(cfs[0]); err != nil {
+		t.Fatalf("Error dropping column family: %s", err)
+	}
+	if err := store.Put(cfs[0], []byte("key1"), []byte("value1")); err == nil {
+		t.Fatal("An error was expected writing to a dropped column family")
+	}
+	if err := store.Delete(cfs[0], []byte("key1")); err == nil {
+		t.Fatal("An error was expected deleting from a dropped column family")
+	}
+	writeBatch := store.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.PutCF(cfs[1], []byte("key1"), []byte("value1"))
+	writeBatch.PutCF(cfs[0], []byte("key1"), []byte("value1"))
+	if err := store.Write(writeBatch); err == nil {
+		t.Fatal("An error was expected writing a batch to a dropped column family")
+	}
+	// the batch is written atomically
+	assertKVStoreValue(t, "boltdb", store, cfs[1], "key1", nil)
+}
+
+func TestBoltDBReadTxLifetime(t *testing.T) {
+	defer func(iteratorMaxTxAge, snapshotMaxAge time.Duration) {
+		boltIteratorMaxTxAge, boltSnapshotMaxAge = iteratorMaxTxAge, snapshotMaxAge
+	}(boltIteratorMaxTxAge, boltSnapshotMaxAge)
+	boltIteratorMaxTxAge, boltSnapshotMaxAge = 10*time.Millisecond, 10*time.Millisecond
+
+	store, cfs, _, cleanup := openTestKVStore(t, "boltdb")
+	defer cleanup()
+
+	for _, key := range []string{"a1", "a2", "a3", "a4"} {
+		store.Put(cfs[0], []byte(key), []byte("value_"+key))
+	}
+	snapshot := store.NewSnapshot()
+	defer snapshot.Release()
+	itr := store.NewIterator(cfs[0])
+	defer itr.Close()
+	itr.SeekToFirst()
+	key := itr.Key()
+	time.Sleep(50 * time.Millisecond)
+
+	// the expired transactions do not block the writers
+	store.Delete(cfs[0], []byte("a2"))
+	if string(key) != "a1" || string(itr.Key()) != "a1" || string(itr.Value()) != "value_a1" {
+		t.Fatalf("Expected key [a1] from the expired iterator, found [%s]", itr.Key())
+	}
+	// the iterator resumes after its current key, with a new transaction
+	itr.Next()
+	assertKVStoreIteration(t, "boltdb", itr, []byte("a"), []string{"a3", "a4"})
+
+	if _, err := store.GetFromSnapshot(snapshot, cfs[0], []byte("a1")); err == nil {
+		t.Fatal("An error was expected reading from an expired snapshot")
+	}
+	snapshotItr := store.NewSnapshotIterator(snapshot, cfs[0])
+	defer snapshotItr.Close()
+	snapshotItr.SeekToFirst()
+	if snapshotItr.Valid() {
+		t.Fatal("An iterator over an expired snapshot should not be valid")
+	}
+}
+
+func testKVStoreBasicOperations(t *testing.T, name string) {
+	store, cfs, _, cleanup := openTestKVStore(t, name)
+	defer cleanup()
+
+	store.Put(cfs[0], []byte("key1"), []byte("value1"))
+	store.Put(cfs[1], []byte("key1"), []byte("value1_cf2"))
+	store.Put(cfs[0], []byte(""), []byte("value_emptyKey"))
+	assertKVStoreValue(t, name, store, cfs[0], "key1", []byte("value1"))
+	assertKVStoreValue(t, name, store, cfs[1], "key1", []byte("value1_cf2"))
+	assertKVStoreValue(t, name, store, cfs[0], "", []byte("value_emptyKey"))
+	assertKVStoreValue(t, name, store, cfs[0], "key2", nil)
+
+	store.Delete(cfs[0], []byte("key1"))
+	assertKVStoreValue(t, name, store, cfs[0], "key1", nil)
+	assertKVStoreValue(t, name, store, cfs[1], "key1", []byte("value1_cf2"))
+}
+
+func testKVStoreWriteBatch(t *testing.T, name string) {
+	store, cfs, _, cleanup := openTestKVStore(t, name)
+	defer cleanup()
+
+	store.Put(cfs[0], []byte("key1"), []byte("value1"))
+	writeBatch := store.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.PutCF(cfs[0], []byte("key2"), []byte("value2"))
+	writeBatch.PutCF(cfs[1], []byte("key3"), []byte("value3"))
+	writeBatch.DeleteCF(cfs[0], []byte("key1"))
+
+	// nothing is visible before the batch is written
+	assertKVStoreValue(t, name, store, cfs[0], "key1", []byte("value1"))
+	assertKVStoreValue(t, name, store, cfs[0], "key2", nil)
+
+	if err := store.Write(writeBatch); err != nil {
+		t.Fatalf("[%s] Error writing batch: %s", name, err)
+	}
+	assertKVStoreValue(t, name, store, cfs[0], "key1", nil)
+	assertKVStoreValue(t, name, store, cfs[0], "key2", []byte("value2"))
+	assertKVStoreValue(t, name, store, cfs[1], "key3", []byte("value3"))
+}
+
+func testKVStoreSnapshot(t *testing.T, name string) {
+	store, cfs, _, cleanup := openTestKVStore(t, name)
+	defer cleanup()
+
+	store.Put(cfs[0], []byte("key1"), []byte("value1"))
+	store.Put(cfs[0], []byte("key2"), []byte("value2"))
+	snapshot := store.NewSnapshot()
+	defer snapshot.Release()
+
+	store.Delete(cfs[0], []byte("key1"))
+	store.Put(cfs[0], []byte("key2"), []byte("value2_new"))
+	store.Put(cfs[0], []byte("key3"), []byte("value3"))
+
+	for key, expected := range map[string][]byte{"key1": []byte("value1"), "key2": []byte("value2"), "key3": nil} {
+		value, err := store.GetFromSnapshot(snapshot, cfs[0], []byte(key))
+		if err != nil {
+			t.Fatalf("[%s] Error reading from snapshot: %s", name, err)
+		}
+		if !bytes.Equal(value, expected) {
+			t.Fatalf("[%s] Wrong value in snapshot for key [%s]. Expected [%s], found [%s]", name, key, expected, value)
+		}
+	}
+
+	itr := store.NewSnapshotIterator(snapshot, cfs[0])
+	defer itr.Close()
+	itr.SeekToFirst()
+	assertKVStoreIteration(t, name, itr, nil, []string{"key1", "key2"})
+}
+
+func testKVStoreIterator(t *testing.T, name string) {
+	store, cfs, _, cleanup := openTestKVStore(t, name)
+	defer cleanup()
+
+	for _, key := range []string{"b2", "a1", "b1", "c1", "b3"} {
+		store.Put(cfs[0], []byte(key), []byte("value_"+key))
+	}
+	store.Put(cfs[1], []byte("b0"), []byte("value_b0"))
+
+	itr := store.NewIterator(cfs[0])
+	// updates made after the creation of the iterator are not visible
+	store.Put(cfs[0], []byte("a2"), []byte("value_a2"))
+	itr.SeekToFirst()
+	assertKVStoreIteration(t, name, itr, nil, []string{"a1", "b1", "b2", "b3", "c1"})
+	itr.Close()
+
+	itr = store.NewIterator(cfs[0])
+	defer itr.Close()
+	itr.Seek([]byte("b"))
+	assertKVStoreIteration(t, name, itr, []byte("b"), []string{"b1", "b2", "b3"})
+	itr.Seek([]byte("bb"))
+	if itr.ValidForPrefix([]byte("b")) {
+		t.Fatalf("[%s] Iterator should not be valid for prefix after seeking past it", name)
+	}
+}
+
+func testKVStoreDropColumnFamily(t *testing.T, name string) {
+	store, cfs, _, cleanup := openTestKVStore(t, name)
+	defer cleanup()
+
+	store.Put(cfs[0], []byte("key1"), []byte("value1"))
+	store.Put(cfs[1], []byte("key1"), []byte("value1"))
+	if err := store.DropColumnFamily(cfs[0]); err != nil {
+		t.Fatalf("[%s] Error dropping column family: %s", name, err)
+	}
+	cf, err := store.CreateColumnFamily(cfs[0].Name())
+	if err != nil {
+		t.Fatalf("[%s] Error creating column family: %s", name, err)
+	}
+	assertKVStoreValue(t, name, store, cf, "key1", nil)
+	assertKVStoreValue(t, name, store, cfs[1], "key1", []byte("value1"))
+}
+
+func testKVStoreReopen(t *testing.T, name string) {
+	store, cfs, dbPath, cleanup := openTestKVStore(t, name)
+	defer cleanup()
+
+	store.Put(cfs[0], []byte("key1"), []byte("value1"))
+	store.Close()
+
+	cfs, err := store.Open(dbPath, []string{"cf1", "cf2"})
+	if err != nil {
+		t.Fatalf("[%s] Error re-opening store: %s", name, err)
+	}
+	assertKVStoreValue(t, name, store, cfs[0], "key1", []byte("value1"))
+}
+
+// openTestKVStore opens a store with two column families in a new directory
+func openTestKVStore(t *testing.T, name string) (KVStore, []ColumnFamily, string, func()) {
+	dir, err := ioutil.TempDir("", "fabric-kvstore-test")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %s", err)
+	}
+	dbPath := filepath.Join(dir, "db")
+	store, err := newKVStore(name)
+	if err != nil {
+		t.Fatalf("Error creating store [%s]: %s", name, err)
+	}
+	cfs, err := store.Open(dbPath, []string{"cf1", "cf2"})
+	if err != nil {
+		t.Fatalf("Error opening store [%s]: %s", name, err)
+	}
+	return store, cfs, dbPath, func() {
+		store.Close()
+		removeMemoryStore(dbPath)
+		os.RemoveAll(dir)
+	}
+}
+
+func assertKVStoreValue(t *testing.T, name string, store KVStore, cf ColumnFamily, key string, expected []byte) {
+	value, err := store.Get(cf, []byte(key))
+	if err != nil {
+		t.Fatalf("[%s] Error getting key [%s]: %s", name, key, err)
+	}
+	if !bytes.Equal(value, expected) || (value == nil) != (expected == nil) {
+		t.Fatalf("[%s] Wrong value for key [%s]. Expected [%s], found [%s]", name, key, expected, value)
+	}
+}
+
+func assertKVStoreIteration(t *testing.T, name string, itr Iterator, prefix []byte, expectedKeys []string) {
+	var keys []string
+	for ; itr.ValidForPrefix(prefix); itr.Next() {
+		keys = append(keys, string(itr.Key()))
+	}
+	if len(keys) != len(expectedKeys) {
+		t.Fatalf("[%s] Expected keys %v from iterator, found %v", name, expectedKeys, keys)
+	}
+	for i := range keys {
+		if keys[i] != expectedKeys[i] {
+			t.Fatalf("[%s] Expected keys %v from iterator, found %v", name, expectedKeys, keys)
+		}
+	}
+}
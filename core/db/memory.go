@@ -0,0 +1,299 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+func init() {
+	RegisterKVStore("memory", func() KVStore { return &MemoryStore{} })
+}
+
+// The data of the memory stores is kept per db path for the life of the
+// process, so that closing and re-opening a store behaves as it would on disk
+var memoryStores = struct {
+	sync.Mutex
+	m map[string]*memoryData
+}{m: make(map[string]*memoryData)}
+
+type memoryData struct {
+	sync.RWMutex
+	cfs map[string]map[string][]byte
+}
+
+// MemoryStore is a KVStore that keeps all the data in memory. Nothing is
+// written to disk, which makes it suitable for tests only.
+type MemoryStore struct {
+	data *memoryData
+}
+
+type memoryColumnFamily string
+
+func (cf memoryColumnFamily) Name() string {
+	return string(cf)
+}
+
+type memoryWriteBatch struct {
+	operations []memoryOperation
+}
+
+type memoryOperation struct {
+	cf     ColumnFamily
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+func (writeBatch *memoryWriteBatch) PutCF(cf ColumnFamily, key []byte, value []byte) {
+	writeBatch.operations = append(writeBatch.operations, memoryOperation{cf, makeCopy(key), makeCopy(value), false})
+}
+
+func (writeBatch *memoryWriteBatch) DeleteCF(cf ColumnFamily, key []byte) {
+	writeBatch.operations = append(writeBatch.operations, memoryOperation{cf, makeCopy(key), nil, true})
+}
+
+func (writeBatch *memoryWriteBatch) Destroy() {
+	writeBatch.operations = nil
+}
+
+// memorySnapshot holds a copy of the column family maps. The values are never
+// modified in place, so the maps can share them with the store.
+type memorySnapshot struct {
+	cfs map[string]map[string][]byte
+}
+
+func (snapshot *memorySnapshot) Release() {
+	snapshot.cfs = nil
+}
+
+type memoryIterator struct {
+	keys   []string
+	values map[string][]byte
+	pos    int
+}
+
+func newMemoryIterator(kvs map[string][]byte) *memoryIterator {
+	itr := &memoryIterator{values: make(map[string][]byte, len(kvs))}
+	for k, v := range kvs {
+		itr.keys = append(itr.keys, k)
+		itr.values[k] = v
+	}
+	sort.Strings(itr.keys)
+	itr.pos = len(itr.keys)
+	return itr
+}
+
+func (itr *memoryIterator) Seek(key []byte) {
+	itr.pos = sort.SearchStrings(itr.keys, string(key))
+}
+
+func (itr *memoryIterator) SeekToFirst() {
+	itr.pos = 0
+}
+
+func (itr *memoryIterator) Next() {
+	itr.pos++
+}
+
+func (itr *memoryIterator) Valid() bool {
+	return itr.pos < len(itr.keys)
+}
+
+func (itr *memoryIterator) ValidForPrefix(prefix []byte) bool {
+	return itr.Valid() && bytes.HasPrefix([]byte(itr.keys[itr.pos]), prefix)
+}
+
+func (itr *memoryIterator) Key() []byte {
+	if !itr.Valid() {
+		return nil
+	}
+	return []byte(itr.keys[itr.pos])
+}
+
+func (itr *memoryIterator) Value() []byte {
+	if !itr.Valid() {
+		return nil
+	}
+	return itr.values[itr.keys[itr.pos]]
+}
+
+func (itr *memoryIterator) Close() {
+	itr.keys = nil
+	itr.values = nil
+}
+
+// Open implements method in interface KVStore
+func (store *MemoryStore) Open(dbPath string, cfNames []string) ([]ColumnFamily, error) {
+	memoryStores.Lock()
+	data, ok := memoryStores.m[dbPath]
+	if !ok {
+		data = &memoryData{cfs: make(map[string]map[string][]byte)}
+		memoryStores.m[dbPath] = data
+	}
+	memoryStores.Unlock()
+
+	data.Lock()
+	defer data.Unlock()
+	cfs := make([]ColumnFamily, len(cfNames))
+	for i, cfName := range cfNames {
+		if _, ok := data.cfs[cfName]; !ok {
+			data.cfs[cfName] = make(map[string][]byte)
+		}
+		cfs[i] = memoryColumnFamily(cfName)
+	}
+	store.data = data
+	return cfs, nil
+}
+
+// Close implements method in interface KVStore. The data is retained and
+// is visible again when a store is opened on the same path.
+func (store *MemoryStore) Close() {
+	store.data = nil
+}
+
+// Get implements method in interface KVStore
+func (store *MemoryStore) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	store.data.RLock()
+	defer store.data.RUnlock()
+	return memoryGet(store.data.cfs, cf, key)
+}
+
+// Put implements method in interface KVStore
+func (store *MemoryStore) Put(cf ColumnFamily, key []byte, value []byte) error {
+	writeBatch := &memoryWriteBatch{}
+	writeBatch.PutCF(cf, key, value)
+	return store.Write(writeBatch)
+}
+
+// Delete implements method in interface KVStore
+func (store *MemoryStore) Delete(cf ColumnFamily, key []byte) error {
+	writeBatch := &memoryWriteBatch{}
+	writeBatch.DeleteCF(cf, key)
+	return store.Write(writeBatch)
+}
+
+// NewWriteBatch implements method in interface KVStore
+func (store *MemoryStore) NewWriteBatch() WriteBatch {
+	return &memoryWriteBatch{}
+}
+
+// Write implements method in interface KVStore
+func (store *MemoryStore) Write(writeBatch WriteBatch) error {
+	store.data.Lock()
+	defer store.data.Unlock()
+	operations := writeBatch.(*memoryWriteBatch).operations
+	for _, op := range operations {
+		if _, ok := store.data.cfs[op.cf.Name()]; !ok {
+			return fmt.Errorf("Column family [%s] does not exist", op.cf.Name())
+		}
+	}
+	for _, op := range operations {
+		if op.delete {
+			delete(store.data.cfs[op.cf.Name()], string(op.key))
+		} else {
+			store.data.cfs[op.cf.Name()][string(op.key)] = op.value
+		}
+	}
+	return nil
+}
+
+// NewSnapshot implements method in interface KVStore
+func (store *MemoryStore) NewSnapshot() Snapshot {
+	store.data.RLock()
+	defer store.data.RUnlock()
+	cfs := make(map[string]map[string][]byte, len(store.data.cfs))
+	for cfName, kvs := range store.data.cfs {
+		cfs[cfName] = make(map[string][]byte, len(kvs))
+		for k, v := range kvs {
+			cfs[cfName][k] = v
+		}
+	}
+	return &memorySnapshot{cfs}
+}
+
+// GetFromSnapshot implements method in interface KVStore
+func (store *MemoryStore) GetFromSnapshot(snapshot Snapshot, cf ColumnFamily, key []byte) ([]byte, error) {
+	return memoryGet(snapshot.(*memorySnapshot).cfs, cf, key)
+}
+
+// NewIterator implements method in interface KVStore
+func (store *MemoryStore) NewIterator(cf ColumnFamily) Iterator {
+	store.data.RLock()
+	defer store.data.RUnlock()
+	return newMemoryIterator(store.data.cfs[cf.Name()])
+}
+
+// NewSnapshotIterator implements method in interface KVStore
+func (store *MemoryStore) NewSnapshotIterator(snapshot Snapshot, cf ColumnFamily) Iterator {
+	return newMemoryIterator(snapshot.(*memorySnapshot).cfs[cf.Name()])
+}
+
+// DropColumnFamily implements method in interface KVStore
+func (store *MemoryStore) DropColumnFamily(cf ColumnFamily) error {
+	store.data.Lock()
+	defer store.data.Unlock()
+	if _, ok := store.data.cfs[cf.Name()]; !ok {
+		return fmt.Errorf("Column family [%s] does not exist", cf.Name())
+	}
+	delete(store.data.cfs, cf.Name())
+	return nil
+}
+
+// CreateColumnFamily implements method in interface KVStore
+func (store *MemoryStore) CreateColumnFamily(name string) (ColumnFamily, error) {
+	store.data.Lock()
+	defer store.data.Unlock()
+	if _, ok := store.data.cfs[name]; ok {
+		return nil, fmt.Errorf("Column family [%s] already exists", name)
+	}
+	store.data.cfs[name] = make(map[string][]byte)
+	return memoryColumnFamily(name), nil
+}
+
+// GetProperty implements method in interface KVStore. The only property
+// maintained is 'memory.num-keys' of a column family.
+func (store *MemoryStore) GetProperty(cf ColumnFamily, name string) string {
+	if cf == nil || name != "memory.num-keys" {
+		return ""
+	}
+	store.data.RLock()
+	defer store.data.RUnlock()
+	return fmt.Sprintf("%d", len(store.data.cfs[cf.Name()]))
+}
+
+func memoryGet(cfs map[string]map[string][]byte, cf ColumnFamily, key []byte) ([]byte, error) {
+	kvs, ok := cfs[cf.Name()]
+	if !ok {
+		return nil, fmt.Errorf("Column family [%s] does not exist", cf.Name())
+	}
+	value, ok := kvs[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	return makeCopy(value), nil
+}
+
+// removeMemoryStore discards the data kept for the memory store at dbPath
+func removeMemoryStore(dbPath string) {
+	memoryStores.Lock()
+	defer memoryStores.Unlock()
+	delete(memoryStores.m, dbPath)
+}
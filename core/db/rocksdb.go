@@ -0,0 +1,235 @@
+// +build cgo
+
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/tecbot/gorocksdb"
+)
+
+func init() {
+	RegisterKVStore("rocksdb", func() KVStore { return &RocksDBStore{} })
+}
+
+// RocksDBStore is the KVStore backed by rocksdb. Column families map to
+// rocksdb column families.
+type RocksDBStore struct {
+	DB *gorocksdb.DB
+}
+
+type rocksDBColumnFamily struct {
+	name   string
+	handle *gorocksdb.ColumnFamilyHandle
+}
+
+func (cf *rocksDBColumnFamily) Name() string {
+	return cf.name
+}
+
+func rocksDBHandle(cf ColumnFamily) *gorocksdb.ColumnFamilyHandle {
+	return cf.(*rocksDBColumnFamily).handle
+}
+
+type rocksDBWriteBatch struct {
+	*gorocksdb.WriteBatch
+}
+
+func (writeBatch rocksDBWriteBatch) PutCF(cf ColumnFamily, key []byte, value []byte) {
+	writeBatch.WriteBatch.PutCF(rocksDBHandle(cf), key, value)
+}
+
+func (writeBatch rocksDBWriteBatch) DeleteCF(cf ColumnFamily, key []byte) {
+	writeBatch.WriteBatch.DeleteCF(rocksDBHandle(cf), key)
+}
+
+type rocksDBIterator struct {
+	*gorocksdb.Iterator
+}
+
+func (itr rocksDBIterator) Key() []byte {
+	slice := itr.Iterator.Key()
+	if slice == nil {
+		return nil
+	}
+	return slice.Data()
+}
+
+func (itr rocksDBIterator) Value() []byte {
+	slice := itr.Iterator.Value()
+	if slice == nil {
+		return nil
+	}
+	return slice.Data()
+}
+
+// Open implements method in interface KVStore
+func (store *RocksDBStore) Open(dbPath string, cfNames []string) ([]ColumnFamily, error) {
+	missing, err := dirMissingOrEmpty(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	dbLogger.Debugf("Is db path [%s] empty [%t]", dbPath, missing)
+
+	if missing {
+		err = os.MkdirAll(path.Dir(dbPath), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("Error making directory path [%s]: %s", dbPath, err)
+		}
+	}
+
+	opts := gorocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+
+	opts.SetCreateIfMissing(missing)
+	opts.SetCreateIfMissingColumnFamilies(true)
+
+	allCFNames := append([]string{"default"}, cfNames...)
+	var cfOpts []*gorocksdb.Options
+	for range allCFNames {
+		cfOpts = append(cfOpts, opts)
+	}
+
+	db, cfHandlers, err := gorocksdb.OpenDbColumnFamilies(opts, dbPath, allCFNames, cfOpts)
+	if err != nil {
+		return nil, err
+	}
+	// the default column family is not used
+	cfHandlers[0].Destroy()
+
+	store.DB = db
+	cfs := make([]ColumnFamily, len(cfNames))
+	for i, cfName := range cfNames {
+		cfs[i] = &rocksDBColumnFamily{cfName, cfHandlers[i+1]}
+	}
+	return cfs, nil
+}
+
+// Close implements method in interface KVStore. The column family handles
+// must not be used after the store has been closed.
+func (store *RocksDBStore) Close() {
+	store.DB.Close()
+}
+
+// Get implements method in interface KVStore
+func (store *RocksDBStore) Get(cf ColumnFamily, key []byte) ([]byte, error) {
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	return store.get(opt, cf, key)
+}
+
+// Put implements method in interface KVStore
+func (store *RocksDBStore) Put(cf ColumnFamily, key []byte, value []byte) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return store.DB.PutCF(opt, rocksDBHandle(cf), key, value)
+}
+
+// Delete implements method in interface KVStore
+func (store *RocksDBStore) Delete(cf ColumnFamily, key []byte) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return store.DB.DeleteCF(opt, rocksDBHandle(cf), key)
+}
+
+// NewWriteBatch implements method in interface KVStore
+func (store *RocksDBStore) NewWriteBatch() WriteBatch {
+	return rocksDBWriteBatch{gorocksdb.NewWriteBatch()}
+}
+
+// Write implements method in interface KVStore
+func (store *RocksDBStore) Write(writeBatch WriteBatch) error {
+	opt := gorocksdb.NewDefaultWriteOptions()
+	defer opt.Destroy()
+	return store.DB.Write(opt, writeBatch.(rocksDBWriteBatch).WriteBatch)
+}
+
+// NewSnapshot implements method in interface KVStore
+func (store *RocksDBStore) NewSnapshot() Snapshot {
+	return store.DB.NewSnapshot()
+}
+
+// GetFromSnapshot implements method in interface KVStore
+func (store *RocksDBStore) GetFromSnapshot(snapshot Snapshot, cf ColumnFamily, key []byte) ([]byte, error) {
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	opt.SetSnapshot(snapshot.(*gorocksdb.Snapshot))
+	return store.get(opt, cf, key)
+}
+
+// NewIterator implements method in interface KVStore
+func (store *RocksDBStore) NewIterator(cf ColumnFamily) Iterator {
+	opt := gorocksdb.NewDefaultReadOptions()
+	opt.SetFillCache(true)
+	defer opt.Destroy()
+	return rocksDBIterator{store.DB.NewIteratorCF(opt, rocksDBHandle(cf))}
+}
+
+// NewSnapshotIterator implements method in interface KVStore
+func (store *RocksDBStore) NewSnapshotIterator(snapshot Snapshot, cf ColumnFamily) Iterator {
+	opt := gorocksdb.NewDefaultReadOptions()
+	defer opt.Destroy()
+	opt.SetSnapshot(snapshot.(*gorocksdb.Snapshot))
+	return rocksDBIterator{store.DB.NewIteratorCF(opt, rocksDBHandle(cf))}
+}
+
+// DropColumnFamily implements method in interface KVStore
+func (store *RocksDBStore) DropColumnFamily(cf ColumnFamily) error {
+	handle := rocksDBHandle(cf)
+	err := store.DB.DropColumnFamily(handle)
+	if err != nil {
+		return err
+	}
+	handle.Destroy()
+	return nil
+}
+
+// CreateColumnFamily implements method in interface KVStore
+func (store *RocksDBStore) CreateColumnFamily(name string) (ColumnFamily, error) {
+	opts := gorocksdb.NewDefaultOptions()
+	defer opts.Destroy()
+	handle, err := store.DB.CreateColumnFamily(opts, name)
+	if err != nil {
+		return nil, err
+	}
+	return &rocksDBColumnFamily{name, handle}, nil
+}
+
+// GetProperty implements method in interface KVStore. See the rocksdb
+// documentation for the supported property names, such as 'rocksdb.stats'.
+func (store *RocksDBStore) GetProperty(cf ColumnFamily, name string) string {
+	if cf == nil {
+		return store.DB.GetProperty(name)
+	}
+	return store.DB.GetPropertyCF(name, rocksDBHandle(cf))
+}
+
+func (store *RocksDBStore) get(opt *gorocksdb.ReadOptions, cf ColumnFamily, key []byte) ([]byte, error) {
+	slice, err := store.DB.GetCF(opt, rocksDBHandle(cf), key)
+	if err != nil {
+		return nil, err
+	}
+	defer slice.Free()
+	if slice.Data() == nil {
+		return nil, nil
+	}
+	return makeCopy(slice.Data()), nil
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/platforms"
 	"github.com/hyperledger/fabric/core/container"
 	crypto "github.com/hyperledger/fabric/core/crypto"
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/peer"
 	"github.com/hyperledger/fabric/core/util"
 	pb "github.com/hyperledger/fabric/protos"
@@ -168,6 +169,9 @@ func (d *Devops) Deploy(ctx context.Context, spec *pb.ChaincodeSpec) (*pb.Chainc
 		sec, err = crypto.InitClient(spec.SecureContext, nil)
 		defer crypto.CloseClient(sec)
 
+		// the deployer administers the chaincode, see executeTerminate and executeUpgrade
+		chaincodeDeploymentSpec.Administrators = []string{spec.SecureContext}
+
 		// remove the security context since we are no longer need it down stream
 		spec.SecureContext = ""
 
@@ -304,6 +308,155 @@ func (d *Devops) Query(ctx context.Context, chaincodeInvocationSpec *pb.Chaincod
 	return d.invokeOrQuery(ctx, chaincodeInvocationSpec, chaincodeInvocationSpec.ChaincodeSpec.Attributes, false)
 }
 
+// Upgrade deploys the chaincode of the upgrade spec to the validators through a
+// transaction, which terminates the previous chaincode
+func (d *Devops) Upgrade(ctx context.Context, upgradeSpec *pb.ChaincodeUpgradeSpec) (*pb.ChaincodeDeploymentSpec, error) {
+	if upgradeSpec.ChaincodeDeploymentSpec == nil || upgradeSpec.ChaincodeDeploymentSpec.ChaincodeSpec == nil {
+		return nil, errors.New("Expected chaincode specification, nil received")
+	}
+	if upgradeSpec.PreviousChaincodeID == nil || upgradeSpec.PreviousChaincodeID.Name == "" {
+		return nil, fmt.Errorf("name of the chaincode to upgrade not given")
+	}
+	spec := upgradeSpec.ChaincodeDeploymentSpec.ChaincodeSpec
+
+	// get the deployment spec of the new chaincode
+	chaincodeDeploymentSpec, err := d.getChaincodeBytes(ctx, spec)
+	if err != nil {
+		devopsLogger.Error(fmt.Sprintf("Error upgrading chaincode spec: %v\n\n error: %s", spec, err))
+		return nil, err
+	}
+	chaincodeDeploymentSpec.Administrators = upgradeSpec.ChaincodeDeploymentSpec.Administrators
+	upgradeSpec.ChaincodeDeploymentSpec = chaincodeDeploymentSpec
+
+	transID := chaincodeDeploymentSpec.ChaincodeSpec.ChaincodeID.Name
+
+	var sec crypto.Client
+	if peer.SecurityEnabled() {
+		if devopsLogger.IsEnabledFor(logging.DEBUG) {
+			devopsLogger.Debugf("Initializing secure devops using context %s", spec.SecureContext)
+		}
+		sec, err = crypto.InitClient(spec.SecureContext, nil)
+		defer crypto.CloseClient(sec)
+
+		// unless other administrators are given, the upgrader administers the new chaincode
+		if len(chaincodeDeploymentSpec.Administrators) == 0 {
+			chaincodeDeploymentSpec.Administrators = []string{spec.SecureContext}
+		}
+
+		// remove the security context since we are no longer need it down stream
+		spec.SecureContext = ""
+
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	if devopsLogger.IsEnabledFor(logging.DEBUG) {
+		devopsLogger.Debugf("Creating upgrade transaction (%s)", transID)
+	}
+	tx, err := pb.NewChaincodeUpgradeTransaction(upgradeSpec, transID)
+	if err != nil {
+		return nil, fmt.Errorf("Error upgrading chaincode: %s ", err)
+	}
+	if nil != sec {
+		if err = signTransaction(sec, tx, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if devopsLogger.IsEnabledFor(logging.DEBUG) {
+		devopsLogger.Debugf("Sending upgrade transaction (%s) to validator", tx.Uuid)
+	}
+	resp := d.coord.ExecuteTransaction(tx)
+	if resp.Status == pb.Response_FAILURE {
+		err = errors.New(string(resp.Msg))
+	}
+
+	return chaincodeDeploymentSpec, err
+}
+
+// Terminate stops the specified chaincode on the validators through a
+// transaction, after which the chaincode can no longer be invoked
+func (d *Devops) Terminate(ctx context.Context, spec *pb.ChaincodeSpec) (*pb.Response, error) {
+	if spec.ChaincodeID == nil || spec.ChaincodeID.Name == "" {
+		return nil, fmt.Errorf("name not given for terminate")
+	}
+
+	var sec crypto.Client
+	var err error
+	if peer.SecurityEnabled() {
+		if devopsLogger.IsEnabledFor(logging.DEBUG) {
+			devopsLogger.Debugf("Initializing secure devops using context %s", spec.SecureContext)
+		}
+		sec, err = crypto.InitClient(spec.SecureContext, nil)
+		defer crypto.CloseClient(sec)
+		// remove the security context since we are no longer need it down stream
+		spec.SecureContext = ""
+		if nil != err {
+			return nil, err
+		}
+	}
+
+	id := util.GenerateUUID()
+	devopsLogger.Infof("Transaction ID: %v", id)
+	tx, err := pb.NewChaincodeExecute(&pb.ChaincodeInvocationSpec{ChaincodeSpec: spec}, id, pb.Transaction_CHAINCODE_TERMINATE)
+	if err != nil {
+		return nil, err
+	}
+	if nil != sec {
+		if err = signTransaction(sec, tx, spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if devopsLogger.IsEnabledFor(logging.DEBUG) {
+		devopsLogger.Debugf("Sending terminate transaction (%s) to validator", tx.Uuid)
+	}
+	resp := d.coord.ExecuteTransaction(tx)
+	if resp.Status == pb.Response_FAILURE {
+		err = errors.New(string(resp.Msg))
+	}
+	return resp, err
+}
+
+// GetTransactionResult returns the result of a transaction once its block is
+// committed to the ledger of the peer
+func (d *Devops) GetTransactionResult(ctx context.Context, request *pb.TransactionRequest) (*pb.TransactionResult, error) {
+	if request.TransactionUuid == "" {
+		return nil, fmt.Errorf("uuid not given for transaction result")
+	}
+	lgr, err := ledger.GetLedger()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get handle to ledger: %s", err)
+	}
+	result, err := lgr.GetTransactionResultByUUID(request.TransactionUuid)
+	if err == ledger.ErrResourceNotFound {
+		return nil, fmt.Errorf("transaction %s is not committed", request.TransactionUuid)
+	}
+	return result, err
+}
+
+// signTransaction signs a public transaction with the enrollment certificate of
+// the client, which validators check against the administrators of the chaincode.
+// The client only builds deploy, invoke and query transactions itself.
+func signTransaction(sec crypto.Client, tx *pb.Transaction, spec *pb.ChaincodeSpec) error {
+	if spec.ConfidentialityLevel != pb.ConfidentialityLevel_PUBLIC {
+		return fmt.Errorf("transaction %s must be public", tx.Uuid)
+	}
+	handler, err := sec.GetEnrollmentCertificateHandler()
+	if err != nil {
+		return err
+	}
+	tx.Metadata = spec.Metadata
+	tx.Cert = handler.GetCertificate()
+	rawTx, err := proto.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	tx.Signature, err = handler.Sign(rawTx)
+	return err
+}
+
 // CheckSpec to see if chaincode resides within current package capture for language.
 func CheckSpec(spec *pb.ChaincodeSpec) error {
 	// Don't allow nil value
@@ -24,7 +24,6 @@ import (
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
-	"github.com/tecbot/gorocksdb"
 	"golang.org/x/net/context"
 )
 
@@ -72,6 +71,9 @@ func newBlockchain() (*blockchain, error) {
 }
 
 func (blockchain *blockchain) startIndexer() (err error) {
+	if err = upgradeIndexes(blockchain); err != nil {
+		return
+	}
 	if indexBlockDataSynchronously {
 		blockchain.indexer = newBlockchainIndexerSync()
 	} else {
@@ -121,6 +123,37 @@ func (blockchain *blockchain) getTransactionByUUID(txUUID string) (*protos.Trans
 	return transaction, nil
 }
 
+func (blockchain *blockchain) getTransactionResultByUUID(txUUID string) (*protos.TransactionResult, error) {
+	blockNumber, resultIndex, err := blockchain.indexer.fetchTransactionResultIndexByUUID(txUUID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := blockchain.getBlock(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	// the results are not hashed, so a block received through state transfer
+	// may carry other results than the ones indexed, or none at all
+	results := block.GetNonHashData().GetTransactionResults()
+	if resultIndex >= uint64(len(results)) || results[resultIndex] == nil || results[resultIndex].Uuid != txUUID {
+		return nil, ErrResourceNotFound
+	}
+	result := *results[resultIndex]
+	for _, ccEvent := range block.GetNonHashData().GetChaincodeEvents() {
+		if ccEvent.TxID == txUUID {
+			result.ChaincodeEvent = ccEvent
+			result.ChaincodeEvents = append(result.ChaincodeEvents, ccEvent)
+		}
+	}
+	return &result, nil
+}
+
+// getTransactionIndexes get the transactions selected by the query in the first maxBlocks blocks of fromBlock to toBlock
+// that contain one
+func (blockchain *blockchain) getTransactionIndexes(query *txIndexQuery, fromBlock uint64, toBlock uint64, maxBlocks int) (*txIndexPage, error) {
+	return blockchain.indexer.fetchTransactionIndexes(query, fromBlock, toBlock, maxBlocks)
+}
+
 // getTransactions get all transactions in a block identified by block number
 func (blockchain *blockchain) getTransactions(blockNumber uint64) ([]*protos.Transaction, error) {
 	block, err := blockchain.getBlock(blockNumber)
@@ -188,7 +221,7 @@ func (blockchain *blockchain) buildBlock(block *protos.Block, stateHash []byte)
 }
 
 func (blockchain *blockchain) addPersistenceChangesForNewBlock(ctx context.Context,
-	block *protos.Block, stateHash []byte, writeBatch *gorocksdb.WriteBatch) (uint64, error) {
+	block *protos.Block, stateHash []byte, writeBatch db.WriteBatch) (uint64, error) {
 	block = blockchain.buildBlock(block, stateHash)
 	if block.NonHashData == nil {
 		block.NonHashData = &protos.NonHashData{LocalLedgerCommitTimestamp: util.CreateUtcTimestamp()}
@@ -230,7 +263,7 @@ func (blockchain *blockchain) persistRawBlock(block *protos.Block, blockNumber u
 	if blockBytesErr != nil {
 		return blockBytesErr
 	}
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := db.GetDBHandle().NewWriteBatch()
 	defer writeBatch.Destroy()
 	writeBatch.PutCF(db.GetDBHandle().BlockchainCF, encodeBlockNumberDBKey(blockNumber), blockBytes)
 
@@ -252,9 +285,7 @@ func (blockchain *blockchain) persistRawBlock(block *protos.Block, blockNumber u
 		blockchain.indexer.createIndexesSync(block, blockNumber, blockHash, writeBatch)
 	}
 
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err = db.GetDBHandle().DB.Write(opt, writeBatch)
+	err = db.GetDBHandle().Write(writeBatch)
 	if err != nil {
 		return err
 	}
@@ -283,7 +314,7 @@ func fetchBlockchainSizeFromDB() (uint64, error) {
 	return decodeToUint64(bytes), nil
 }
 
-func fetchBlockchainSizeFromSnapshot(snapshot *gorocksdb.Snapshot) (uint64, error) {
+func fetchBlockchainSizeFromSnapshot(snapshot db.Snapshot) (uint64, error) {
 	blockNumberBytes, err := db.GetDBHandle().GetFromBlockchainCFSnapshot(snapshot, blockCountKey)
 	if err != nil {
 		return 0, err
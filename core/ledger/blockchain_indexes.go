@@ -18,26 +18,74 @@ package ledger
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/crypto/utils"
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/op/go-logging"
-	"github.com/tecbot/gorocksdb"
 )
 
 var indexLogger = logging.MustGetLogger("indexes")
 var prefixBlockHashKey = byte(1)
 var prefixTxUUIDKey = byte(2)
 var prefixAddressBlockNumCompositeKey = byte(3)
+var prefixChaincodeIDBlockNumCompositeKey = byte(4)
+var prefixStateHistoryKey = byte(5)
+var prefixTxTypeBlockNumCompositeKey = byte(6)
+var prefixBlockNumCommitTimeKey = byte(7)
+var prefixTxResultUUIDKey = byte(8)
+var prefixIndexesVersionKey = byte(9)
+var prefixUnattributedTxBlockNumKey = byte(10)
+var prefixStateHistoryFromBlockKey = byte(11)
+
+// indexesVersion is the version of the indexes built by addIndexDataForPersistence.
+// It is increased whenever an index is added or its encoding changes, so that the
+// indexes of the blocks committed by an older version are rebuilt at startup
+const indexesVersion = 2
+
+var indexesVersionKey = []byte{prefixIndexesVersionKey}
+
+// txIndexQuery selects transactions by the attributes they are indexed under.
+// An attribute with its zero value does not restrict the selection
+type txIndexQuery struct {
+	address     string
+	chaincodeID string
+	txType      protos.Transaction_Type
+	// timeFiltered selects the blocks committed between fromTime and toTime
+	// (both inclusive, in nanoseconds since the epoch)
+	timeFiltered bool
+	fromTime     int64
+	toTime       int64
+}
+
+// txIndexPage holds the transactions selected by a txIndexQuery, block by block
+type txIndexPage struct {
+	blockNumbers []uint64
+	// txIndexes holds the indexes of the selected transactions of each block,
+	// or nil if all the transactions of the block are selected
+	txIndexes [][]uint64
+	// hasMore is true if the queried block range contains more selected blocks,
+	// the first of which is nextBlockNumber
+	hasMore         bool
+	nextBlockNumber uint64
+	// firstUnattributedBlock is, for a query by address, the first block of the
+	// scanned range holding a transaction whose invoker is unknown. It is only
+	// set if hasUnattributed is true
+	hasUnattributed        bool
+	firstUnattributedBlock uint64
+}
 
 type blockchainIndexer interface {
 	isSynchronous() bool
 	start(blockchain *blockchain) error
-	createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error
+	createIndexesSync(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error
 	createIndexesAsync(block *protos.Block, blockNumber uint64, blockHash []byte) error
 	fetchBlockNumberByBlockHash(blockHash []byte) (uint64, error)
 	fetchTransactionIndexByUUID(txUUID string) (uint64, uint64, error)
+	fetchTransactionResultIndexByUUID(txUUID string) (uint64, uint64, error)
+	fetchTransactionIndexes(query *txIndexQuery, fromBlock uint64, toBlock uint64, maxBlocks int) (*txIndexPage, error)
 	stop()
 }
 
@@ -58,7 +106,7 @@ func (indexer *blockchainIndexerSync) start(blockchain *blockchain) error {
 }
 
 func (indexer *blockchainIndexerSync) createIndexesSync(
-	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
 	return addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
 }
 
@@ -74,12 +122,20 @@ func (indexer *blockchainIndexerSync) fetchTransactionIndexByUUID(txUUID string)
 	return fetchTransactionIndexByUUIDFromDB(txUUID)
 }
 
+func (indexer *blockchainIndexerSync) fetchTransactionResultIndexByUUID(txUUID string) (uint64, uint64, error) {
+	return fetchTransactionResultIndexByUUIDFromDB(txUUID)
+}
+
+func (indexer *blockchainIndexerSync) fetchTransactionIndexes(query *txIndexQuery, fromBlock uint64, toBlock uint64, maxBlocks int) (*txIndexPage, error) {
+	return fetchTransactionIndexesFromDB(query, fromBlock, toBlock, maxBlocks)
+}
+
 func (indexer *blockchainIndexerSync) stop() {
 	return
 }
 
 // Functions for persisting and retrieving index data
-func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
 	openchainDB := db.GetDBHandle()
 	cf := openchainDB.IndexesCF
 
@@ -87,28 +143,58 @@ func addIndexDataForPersistence(block *protos.Block, blockNumber uint64, blockHa
 	indexLogger.Debugf("Indexing block number [%d] by hash = [%x]", blockNumber, blockHash)
 	writeBatch.PutCF(cf, encodeBlockHashKey(blockHash), encodeBlockNumber(blockNumber))
 
+	// add blockNumber -> commitTime
+	if commitTime := block.GetNonHashData().GetLocalLedgerCommitTimestamp(); commitTime != nil {
+		writeBatch.PutCF(cf, encodeBlockNumCommitTimeKey(blockNumber),
+			encodeUint64(uint64(commitTime.Seconds*int64(time.Second)+int64(commitTime.Nanos))))
+	}
+
 	addressToTxIndexesMap := make(map[string][]uint64)
-	addressToChaincodeIDsMap := make(map[string][]*protos.ChaincodeID)
+	var unattributedTxIndexes []uint64
+	chaincodeIDToTxIndexesMap := make(map[string][]uint64)
+	typeToTxIndexesMap := make(map[string][]uint64)
 
 	transactions := block.GetTransactions()
 	for txIndex, tx := range transactions {
 		// add TxUUID -> (blockNumber,indexWithinBlock)
 		writeBatch.PutCF(cf, encodeTxUUIDKey(tx.Uuid), encodeBlockNumTxIndex(blockNumber, uint64(txIndex)))
 
-		txExecutingAddress := getTxExecutingAddress(tx)
-		addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
+		if txExecutingAddress := getTxExecutingAddress(tx); txExecutingAddress != "" {
+			addressToTxIndexesMap[txExecutingAddress] = append(addressToTxIndexesMap[txExecutingAddress], uint64(txIndex))
+		} else {
+			unattributedTxIndexes = append(unattributedTxIndexes, uint64(txIndex))
+		}
+
+		typeToTxIndexesMap[tx.Type.String()] = append(typeToTxIndexesMap[tx.Type.String()], uint64(txIndex))
 
 		switch tx.Type {
-		case protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE:
-			authroizedAddresses, chaincodeID := getAuthorisedAddresses(tx)
-			for _, authroizedAddress := range authroizedAddresses {
-				addressToChaincodeIDsMap[authroizedAddress] = append(addressToChaincodeIDsMap[authroizedAddress], chaincodeID)
+		case protos.Transaction_CHAINCODE_DEPLOY, protos.Transaction_CHAINCODE_INVOKE,
+			protos.Transaction_CHAINCODE_UPGRADE, protos.Transaction_CHAINCODE_TERMINATE:
+			if chaincodeID := getTxChaincodeID(tx); chaincodeID != "" {
+				chaincodeIDToTxIndexesMap[chaincodeID] = append(chaincodeIDToTxIndexesMap[chaincodeID], uint64(txIndex))
 			}
 		}
 	}
+	for resultIndex, result := range block.GetNonHashData().GetTransactionResults() {
+		// add TxUUID -> (blockNumber,indexWithinTransactionResults)
+		writeBatch.PutCF(cf, encodeTxResultUUIDKey(result.Uuid), encodeBlockNumTxIndex(blockNumber, uint64(resultIndex)))
+	}
+	// add (address,blockNumber) -> [txIndexes]
 	for address, txsIndexes := range addressToTxIndexesMap {
 		writeBatch.PutCF(cf, encodeAddressBlockNumCompositeKey(address, blockNumber), encodeListTxIndexes(txsIndexes))
 	}
+	// add blockNumber -> [txIndexes] of the transactions whose invoker is unknown
+	if len(unattributedTxIndexes) > 0 {
+		writeBatch.PutCF(cf, encodeUnattributedTxBlockNumKey(blockNumber), encodeListTxIndexes(unattributedTxIndexes))
+	}
+	// add (chaincodeID,blockNumber) -> [txIndexes]
+	for chaincodeID, txsIndexes := range chaincodeIDToTxIndexesMap {
+		writeBatch.PutCF(cf, encodeChaincodeIDBlockNumCompositeKey(chaincodeID, blockNumber), encodeListTxIndexes(txsIndexes))
+	}
+	// add (txType,blockNumber) -> [txIndexes]
+	for txType, txsIndexes := range typeToTxIndexesMap {
+		writeBatch.PutCF(cf, encodeCompositeKey(prefixTxTypeBlockNumCompositeKey, txType, blockNumber), encodeListTxIndexes(txsIndexes))
+	}
 	return nil
 }
 
@@ -137,21 +223,232 @@ func fetchTransactionIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
 	return decodeBlockNumTxIndex(blockNumTxIndexBytes)
 }
 
+func fetchTransactionResultIndexByUUIDFromDB(txUUID string) (uint64, uint64, error) {
+	blockNumResultIndexBytes, err := db.GetDBHandle().GetFromIndexesCF(encodeTxResultUUIDKey(txUUID))
+	if err != nil {
+		return 0, 0, err
+	}
+	if blockNumResultIndexBytes == nil {
+		return 0, 0, ErrResourceNotFound
+	}
+	return decodeBlockNumTxIndex(blockNumResultIndexBytes)
+}
+
+// upgradeIndexes rebuilds the indexes of the committed blocks if they were built by
+// an older version, which lacks some of the indexes or encodes them differently
+func upgradeIndexes(blockchain *blockchain) error {
+	openchainDB := db.GetDBHandle()
+	versionBytes, err := openchainDB.GetFromIndexesCF(indexesVersionKey)
+	if err != nil {
+		return err
+	}
+	if versionBytes != nil && decodeToUint64(versionBytes) >= indexesVersion {
+		return nil
+	}
+	size := blockchain.getSize()
+	if size > 0 {
+		indexLogger.Infof("Rebuilding the indexes of %d blocks", size)
+	}
+	for blockNumber := uint64(0); blockNumber < size; blockNumber++ {
+		block, err := blockchain.getBlock(blockNumber)
+		if err != nil {
+			return err
+		}
+		if block == nil {
+			// not yet received through state transfer, indexed once committed
+			continue
+		}
+		blockHash, err := block.GetHash()
+		if err != nil {
+			return err
+		}
+		writeBatch := openchainDB.NewWriteBatch()
+		err = addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
+		if err == nil {
+			err = openchainDB.Write(writeBatch)
+		}
+		writeBatch.Destroy()
+		if err != nil {
+			return fmt.Errorf("Error rebuilding the indexes of block [%d]: %s", blockNumber, err)
+		}
+	}
+	writeBatch := openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.PutCF(openchainDB.IndexesCF, indexesVersionKey, encodeUint64(indexesVersion))
+	return openchainDB.Write(writeBatch)
+}
+
+// txIndexScan walks, in block order, an index whose keys end with a block number
+type txIndexScan struct {
+	itr       db.Iterator
+	keyPrefix []byte
+	// selectTxs returns whether an indexed block is selected, and the indexes of
+	// its selected transactions, or nil if all of them are selected
+	selectTxs func(value []byte) (bool, []uint64, error)
+}
+
+// seek returns the first selected block in blockNumber to toBlock (both inclusive),
+// or false if there is none
+func (scan *txIndexScan) seek(blockNumber uint64, toBlock uint64) (uint64, []uint64, bool, error) {
+	key := append(append([]byte{}, scan.keyPrefix...), encodeUint64(blockNumber)...)
+	for scan.itr.Seek(key); scan.itr.ValidForPrefix(scan.keyPrefix); scan.itr.Next() {
+		indexedBlockNumber := decodeToUint64(scan.itr.Key()[len(scan.keyPrefix):])
+		if indexedBlockNumber > toBlock {
+			break
+		}
+		selected, txIndexes, err := scan.selectTxs(scan.itr.Value())
+		if err != nil {
+			return 0, nil, false, err
+		}
+		if selected {
+			return indexedBlockNumber, txIndexes, true, nil
+		}
+	}
+	return 0, nil, false, nil
+}
+
+func selectListedTxIndexes(value []byte) (bool, []uint64, error) {
+	txIndexes, err := decodeListTxIndexes(value)
+	return err == nil, txIndexes, err
+}
+
+// fetchTransactionIndexesFromDB returns the transactions selected by the query in the
+// first maxBlocks blocks of fromBlock to toBlock (both inclusive) that contain one.
+// The indexes of the query are walked together in block order, each one skipping
+// to the next block selected by the others, so that the scan stops as soon as the
+// page is full. A maxBlocks of zero selects the transactions of all the blocks
+func fetchTransactionIndexesFromDB(query *txIndexQuery, fromBlock uint64, toBlock uint64, maxBlocks int) (*txIndexPage, error) {
+	openchainDB := db.GetDBHandle()
+	var scans []*txIndexScan
+	addScan := func(keyPrefix []byte, selectTxs func([]byte) (bool, []uint64, error)) {
+		scans = append(scans, &txIndexScan{openchainDB.GetIterator(openchainDB.IndexesCF), keyPrefix, selectTxs})
+	}
+	defer func() {
+		for _, scan := range scans {
+			scan.itr.Close()
+		}
+	}()
+	if query.address != "" {
+		addScan(encodeCompositeKeyPrefix(prefixAddressBlockNumCompositeKey, query.address), selectListedTxIndexes)
+	}
+	if query.chaincodeID != "" {
+		addScan(encodeCompositeKeyPrefix(prefixChaincodeIDBlockNumCompositeKey, query.chaincodeID), selectListedTxIndexes)
+	}
+	if query.txType != protos.Transaction_UNDEFINED {
+		addScan(encodeCompositeKeyPrefix(prefixTxTypeBlockNumCompositeKey, query.txType.String()), selectListedTxIndexes)
+	}
+	if query.timeFiltered {
+		addScan([]byte{prefixBlockNumCommitTimeKey}, func(value []byte) (bool, []uint64, error) {
+			commitTime := int64(decodeToUint64(value))
+			return commitTime >= query.fromTime && commitTime <= query.toTime, nil, nil
+		})
+	}
+
+	page, err := scanTransactionIndexes(scans, fromBlock, toBlock, maxBlocks)
+	if err != nil || query.address == "" {
+		return page, err
+	}
+	// transactions whose invoker is unknown may have been submitted by the queried one
+	scannedToBlock := toBlock
+	if page.hasMore {
+		scannedToBlock = page.nextBlockNumber - 1
+	}
+	unattributedScan := &txIndexScan{openchainDB.GetIterator(openchainDB.IndexesCF), []byte{prefixUnattributedTxBlockNumKey}, selectListedTxIndexes}
+	defer unattributedScan.itr.Close()
+	page.firstUnattributedBlock, _, page.hasUnattributed, err = unattributedScan.seek(fromBlock, scannedToBlock)
+	return page, err
+}
+
+// scanTransactionIndexes walks the scans together from fromBlock to toBlock, as
+// described in fetchTransactionIndexesFromDB
+func scanTransactionIndexes(scans []*txIndexScan, fromBlock uint64, toBlock uint64, maxBlocks int) (*txIndexPage, error) {
+	page := &txIndexPage{}
+	blockNumber := fromBlock
+	for {
+		var txIndexes []uint64
+		allTxs := true
+		for i := 0; i < len(scans); {
+			selectedBlockNumber, selectedTxIndexes, ok, err := scans[i].seek(blockNumber, toBlock)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return page, nil
+			}
+			if selectedBlockNumber > blockNumber {
+				// the block is not selected by this index, start over from the next one it selects
+				blockNumber = selectedBlockNumber
+				txIndexes, allTxs = nil, true
+				i = 0
+				continue
+			}
+			if selectedTxIndexes != nil {
+				if allTxs {
+					txIndexes = selectedTxIndexes
+				} else {
+					txIndexes = intersectTxIndexes(txIndexes, selectedTxIndexes)
+				}
+				allTxs = false
+			}
+			i++
+		}
+
+		if allTxs || len(txIndexes) > 0 {
+			if maxBlocks > 0 && len(page.blockNumbers) >= maxBlocks {
+				page.hasMore = true
+				page.nextBlockNumber = blockNumber
+				return page, nil
+			}
+			page.blockNumbers = append(page.blockNumbers, blockNumber)
+			page.txIndexes = append(page.txIndexes, txIndexes)
+		}
+		if blockNumber >= toBlock {
+			return page, nil
+		}
+		blockNumber++
+	}
+}
+
+// intersectTxIndexes returns the indexes present in both a and b, which must be ordered
+func intersectTxIndexes(a []uint64, b []uint64) []uint64 {
+	txIndexes := []uint64{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			txIndexes = append(txIndexes, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return txIndexes
+}
+
+// getTxExecutingAddress returns the identity of the invoker of the transaction,
+// that is the enrollment ID of its enrollment certificate. Transaction certificates
+// are unlinkable to the enrollment ID of their owner, so transactions signed with
+// them are not indexed by invoker. An empty string is returned in that case, and if
+// the transaction carries no certificate (i.e., security is disabled). Such
+// transactions are indexed as unattributed instead
 func getTxExecutingAddress(tx *protos.Transaction) string {
-	// TODO Fetch address form tx
-	return "address1"
+	return utils.GetEnrollmentIDFromCert(tx.Cert)
 }
 
-func getAuthorisedAddresses(tx *protos.Transaction) ([]string, *protos.ChaincodeID) {
-	// TODO fetch address from chaincode deployment tx
-	// TODO this method should also return error
-	data := tx.ChaincodeID
+// getTxChaincodeID returns the name of the chaincode targeted by the transaction,
+// or an empty string if it cannot be determined (e.g., the chaincode ID is encrypted)
+func getTxChaincodeID(tx *protos.Transaction) string {
+	if tx.ConfidentialityLevel == protos.ConfidentialityLevel_CONFIDENTIAL {
+		return ""
+	}
 	cID := &protos.ChaincodeID{}
-	err := proto.Unmarshal(data, cID)
+	err := proto.Unmarshal(tx.ChaincodeID, cID)
 	if err != nil {
-		return nil, nil
+		return ""
 	}
-	return []string{"address1", "address2"}, cID
+	return cID.Name
 }
 
 // functions for encoding/decoding db keys/values for index data
@@ -196,13 +493,40 @@ func encodeTxUUIDKey(txUUID string) []byte {
 	return prependKeyPrefix(prefixTxUUIDKey, []byte(txUUID))
 }
 
+func encodeTxResultUUIDKey(txUUID string) []byte {
+	return prependKeyPrefix(prefixTxResultUUIDKey, []byte(txUUID))
+}
+
 func encodeAddressBlockNumCompositeKey(address string, blockNumber uint64) []byte {
-	b := proto.NewBuffer([]byte{prefixAddressBlockNumCompositeKey})
-	b.EncodeRawBytes([]byte(address))
-	b.EncodeVarint(blockNumber)
+	return encodeCompositeKey(prefixAddressBlockNumCompositeKey, address, blockNumber)
+}
+
+func encodeUnattributedTxBlockNumKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixUnattributedTxBlockNumKey, encodeUint64(blockNumber))
+}
+
+func encodeChaincodeIDBlockNumCompositeKey(chaincodeID string, blockNumber uint64) []byte {
+	return encodeCompositeKey(prefixChaincodeIDBlockNumCompositeKey, chaincodeID, blockNumber)
+}
+
+// encodeCompositeKey encodes the block number with fixed length big-endian
+// encoding so that the keys for an attribute are ordered by block number
+func encodeCompositeKey(prefix byte, attribute string, blockNumber uint64) []byte {
+	return append(encodeCompositeKeyPrefix(prefix, attribute), encodeUint64(blockNumber)...)
+}
+
+func encodeCompositeKeyPrefix(prefix byte, attribute string) []byte {
+	b := proto.NewBuffer([]byte{prefix})
+	b.EncodeRawBytes([]byte(attribute))
 	return b.Bytes()
 }
 
+// encodeBlockNumCommitTimeKey encodes the block number with fixed length big-endian
+// encoding so that the commit times are ordered by block number
+func encodeBlockNumCommitTimeKey(blockNumber uint64) []byte {
+	return prependKeyPrefix(prefixBlockNumCommitTimeKey, encodeUint64(blockNumber))
+}
+
 func encodeListTxIndexes(listTx []uint64) []byte {
 	b := proto.NewBuffer([]byte{})
 	for i := range listTx {
@@ -211,6 +535,19 @@ func encodeListTxIndexes(listTx []uint64) []byte {
 	return b.Bytes()
 }
 
+func decodeListTxIndexes(encodedBytes []byte) ([]uint64, error) {
+	var listTx []uint64
+	for len(encodedBytes) > 0 {
+		txIndex, n := proto.DecodeVarint(encodedBytes)
+		if n == 0 {
+			return nil, fmt.Errorf("Error decoding list of transaction indexes [%x]", encodedBytes)
+		}
+		listTx = append(listTx, txIndex)
+		encodedBytes = encodedBytes[n:]
+	}
+	return listTx, nil
+}
+
 func prependKeyPrefix(prefix byte, key []byte) []byte {
 	modifiedKey := []byte{}
 	modifiedKey = append(modifiedKey, prefix)
@@ -22,7 +22,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/protos"
-	"github.com/tecbot/gorocksdb"
 )
 
 var lastIndexedBlockKey = []byte{byte(0)}
@@ -100,7 +99,7 @@ func (indexer *blockchainIndexerAsync) start(blockchain *blockchain) error {
 }
 
 func (indexer *blockchainIndexerAsync) createIndexesSync(
-	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch *gorocksdb.WriteBatch) error {
+	block *protos.Block, blockNumber uint64, blockHash []byte, writeBatch db.WriteBatch) error {
 	return fmt.Errorf("Method not applicable")
 }
 
@@ -112,13 +111,11 @@ func (indexer *blockchainIndexerAsync) createIndexesAsync(block *protos.Block, b
 // createIndexes adds entries into db for creating indexes on various attributes
 func (indexer *blockchainIndexerAsync) createIndexesInternal(block *protos.Block, blockNumber uint64, blockHash []byte) error {
 	openchainDB := db.GetDBHandle()
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := openchainDB.NewWriteBatch()
 	defer writeBatch.Destroy()
 	addIndexDataForPersistence(block, blockNumber, blockHash, writeBatch)
 	writeBatch.PutCF(openchainDB.IndexesCF, lastIndexedBlockKey, encodeBlockNumber(blockNumber))
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	err := openchainDB.DB.Write(opt, writeBatch)
+	err := openchainDB.Write(writeBatch)
 	if err != nil {
 		return err
 	}
@@ -145,6 +142,24 @@ func (indexer *blockchainIndexerAsync) fetchTransactionIndexByUUID(txUUID string
 	return fetchTransactionIndexByUUIDFromDB(txUUID)
 }
 
+func (indexer *blockchainIndexerAsync) fetchTransactionResultIndexByUUID(txUUID string) (uint64, uint64, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return 0, 0, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchTransactionResultIndexByUUIDFromDB(txUUID)
+}
+
+func (indexer *blockchainIndexerAsync) fetchTransactionIndexes(query *txIndexQuery, fromBlock uint64, toBlock uint64, maxBlocks int) (*txIndexPage, error) {
+	err := indexer.indexerState.checkError()
+	if err != nil {
+		return nil, err
+	}
+	indexer.indexerState.waitForLastCommittedBlock()
+	return fetchTransactionIndexesFromDB(query, fromBlock, toBlock, maxBlocks)
+}
+
 func (indexer *blockchainIndexerAsync) indexPendingBlocks() error {
 	blockchain := indexer.blockchain
 	if blockchain.getSize() == 0 {
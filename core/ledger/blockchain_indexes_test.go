@@ -19,6 +19,7 @@ package ledger
 import (
 	"testing"
 
+	"github.com/hyperledger/fabric/core/crypto/utils"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/protos"
 )
@@ -65,6 +66,26 @@ func TestIndexes_GetTransactionByUUID(t *testing.T) {
 	testIndexesGetTransactionByUUID(t)
 }
 
+func TestIndexes_GetTransactionsByAddressAndChaincodeID(t *testing.T) {
+	defaultSetting := indexBlockDataSynchronously
+	indexBlockDataSynchronously = true
+	defer func() { indexBlockDataSynchronously = defaultSetting }()
+	testIndexesGetTransactionsByAddressAndChaincodeID(t)
+}
+
+func TestIndexes_GetTxExecutingAddress(t *testing.T) {
+	tx, _ := buildTestTx(t)
+	testutil.AssertEquals(t, getTxExecutingAddress(tx), "")
+
+	ecert := buildTestCert(t, "user1")
+	tx.Cert = ecert
+	testutil.AssertEquals(t, getTxExecutingAddress(tx), "user1")
+
+	tcert := buildTestCert(t, utils.TCertSubjectCommonName)
+	tx.Cert = tcert
+	testutil.AssertEquals(t, getTxExecutingAddress(tx), "")
+}
+
 func testIndexesGetBlockByBlockNumber(t *testing.T) {
 	testDBWrapper.CleanDB(t)
 	testBlockchainWrapper := newTestBlockchainWrapper(t)
@@ -159,3 +180,36 @@ func testIndexesGetTransactionByUUID(t *testing.T) {
 	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid3), tx3)
 	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionByUUID(uuid4), tx4)
 }
+
+func testIndexesGetTransactionsByAddressAndChaincodeID(t *testing.T) {
+	testDBWrapper.CleanDB(t)
+	testBlockchainWrapper := newTestBlockchainWrapper(t)
+	defer func() { testBlockchainWrapper.blockchain.indexer.stop() }()
+
+	user1Cert := buildTestCert(t, "user1")
+	user2Cert := buildTestCert(t, "user2")
+
+	tx1 := buildTestInvokeTx(t, "chaincode1", user1Cert)
+	tx2 := buildTestInvokeTx(t, "chaincode2", user2Cert)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx1, tx2}, nil), []byte("stateHash1"))
+
+	tx3 := buildTestInvokeTx(t, "chaincode1", user2Cert)
+	tx4 := buildTestInvokeTx(t, "chaincode1", user1Cert)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx3, tx4}, nil), []byte("stateHash2"))
+
+	tx5 := buildTestInvokeTx(t, "chaincode2", user1Cert)
+	testBlockchainWrapper.addNewBlock(protos.NewBlock([]*protos.Transaction{tx5}, nil), []byte("stateHash3"))
+
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionsByAddress("user1", 0, 2),
+		[]*protos.Transaction{tx1, tx4, tx5})
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionsByAddress("user1", 1, 1),
+		[]*protos.Transaction{tx4})
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionsByAddress("user2", 0, 2),
+		[]*protos.Transaction{tx2, tx3})
+	testutil.AssertEquals(t, len(testBlockchainWrapper.getTransactionsByAddress("user3", 0, 2)), 0)
+
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionsByChaincodeID("chaincode1", 0, 2),
+		[]*protos.Transaction{tx1, tx3, tx4})
+	testutil.AssertEquals(t, testBlockchainWrapper.getTransactionsByChaincodeID("chaincode2", 1, 2),
+		[]*protos.Transaction{tx5})
+}
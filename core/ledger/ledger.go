@@ -19,8 +19,10 @@ package ledger
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric/core/db"
@@ -28,7 +30,7 @@ import (
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
 	"github.com/hyperledger/fabric/events/producer"
 	"github.com/op/go-logging"
-	"github.com/tecbot/gorocksdb"
+	"github.com/spf13/viper"
 
 	"github.com/hyperledger/fabric/protos"
 	"golang.org/x/net/context"
@@ -77,11 +79,53 @@ var (
 	ErrResourceNotFound = newLedgerError(ErrorTypeResourceNotFound, "ledger: resource not found")
 )
 
+// TransactionsPage is a page of transactions returned by an index based ledger query
+type TransactionsPage struct {
+	Transactions []*protos.Transaction
+	// HasMore is true if the queried block range contains more matching transactions
+	HasMore bool
+	// NextBlockNumber is the block number from which the next page should be queried.
+	// It is only set if HasMore is true
+	NextBlockNumber uint64
+	// Unattributed is only set by GetTransactionsByInvoker. It is true if the blocks
+	// covered by the page hold transactions whose invoker is unknown, that is signed
+	// with a transaction certificate or not signed at all. Any of them may have been
+	// submitted by the queried invoker, although the page does not hold them
+	Unattributed bool
+}
+
+// BlocksPage is a page of blocks returned by GetBlocks
+type BlocksPage struct {
+	Blocks []*protos.Block
+	// BlockNumbers holds the number of each block of Blocks
+	BlockNumbers []uint64
+	// HasMore is true if the queried block range contains more matching blocks
+	HasMore bool
+	// NextBlockNumber is the block number from which the next page should be queried.
+	// It is only set if HasMore is true
+	NextBlockNumber uint64
+}
+
+// TransactionFilter selects the transactions of GetBlocks and GetTransactions.
+// The zero value of a field does not filter
+type TransactionFilter struct {
+	// ChaincodeID selects the transactions for the chaincode with this name
+	ChaincodeID string
+	// Type selects the transactions of this type
+	Type protos.Transaction_Type
+	// FromTime and ToTime select the transactions of the blocks that this peer
+	// committed in this time window (both inclusive)
+	FromTime time.Time
+	ToTime   time.Time
+}
+
 // Ledger - the struct for openchain ledger
 type Ledger struct {
-	blockchain *blockchain
-	state      *state.State
-	currentID  interface{}
+	blockchain       *blockchain
+	state            *state.State
+	currentID        interface{}
+	historyEnabled   bool
+	richQueryEnabled bool
 }
 
 var ledger *Ledger
@@ -104,7 +148,14 @@ func GetNewLedger() (*Ledger, error) {
 	}
 
 	state := state.NewState()
-	return &Ledger{blockchain, state, nil}, nil
+	historyEnabled := viper.GetBool("ledger.history.enabled")
+	if !historyEnabled {
+		// the blocks committed from now on leave a gap in the history
+		if err := deleteStateHistoryFromBlock(); err != nil {
+			return nil, err
+		}
+	}
+	return &Ledger{blockchain, state, nil, historyEnabled, viper.GetBool("ledger.richQuery.enabled")}, nil
 }
 
 /////////////////// Transaction-batch related methods ///////////////////////////////
@@ -156,10 +207,13 @@ func (ledger *Ledger) CommitTxBatch(id interface{}, transactions []*protos.Trans
 		return err
 	}
 
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := db.GetDBHandle().NewWriteBatch()
 	defer writeBatch.Destroy()
 	block := protos.NewBlock(transactions, metadata)
-	block.NonHashData = &protos.NonHashData{}
+	block.NonHashData = &protos.NonHashData{
+		ChaincodeEvents:    getChaincodeEvents(transactions, transactionResults),
+		TransactionResults: getTransactionResults(transactionResults),
+	}
 	newBlockNumber, err := ledger.blockchain.addPersistenceChangesForNewBlock(context.TODO(), block, stateHash, writeBatch)
 	if err != nil {
 		ledger.resetForNextTxGroup(false)
@@ -167,9 +221,18 @@ func (ledger *Ledger) CommitTxBatch(id interface{}, transactions []*protos.Trans
 		return err
 	}
 	ledger.state.AddChangesForPersistence(newBlockNumber, writeBatch)
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	dbErr := db.GetDBHandle().DB.Write(opt, writeBatch)
+	if ledger.historyEnabled {
+		err = addStateHistoryForPersistence(newBlockNumber, ledger.state.GetTxStateDeltas(), writeBatch)
+		if err == nil {
+			err = addStateHistoryFromBlockForPersistence(newBlockNumber, writeBatch)
+		}
+		if err != nil {
+			ledger.resetForNextTxGroup(false)
+			ledger.blockchain.blockPersistenceStatus(false)
+			return err
+		}
+	}
+	dbErr := db.GetDBHandle().Write(writeBatch)
 	if dbErr != nil {
 		ledger.resetForNextTxGroup(false)
 		ledger.blockchain.blockPersistenceStatus(false)
@@ -179,10 +242,7 @@ func (ledger *Ledger) CommitTxBatch(id interface{}, transactions []*protos.Trans
 	ledger.resetForNextTxGroup(true)
 	ledger.blockchain.blockPersistenceStatus(true)
 
-	sendProducerBlockEvent(block)
-	if len(transactionResults) != 0 {
-		ledgerLogger.Debug("There were some erroneous transactions. We need to send a 'TX rejected' message here.")
-	}
+	sendProducerEvents(block, newBlockNumber)
 	return nil
 }
 
@@ -272,6 +332,78 @@ func (ledger *Ledger) SetStateMultipleKeys(chaincodeID string, kvs map[string][]
 	return ledger.state.SetMultipleKeys(chaincodeID, kvs)
 }
 
+// StateHistoryPage is a page of the modifications of a key returned by GetStateHistoryPage
+type StateHistoryPage struct {
+	// Modifications holds the modifications, oldest first. A deletion of the key is
+	// returned with IsDelete set and no value
+	Modifications []*protos.KeyModification
+	// HasMore is true if the queried block range contains more modifications
+	HasMore bool
+	// NextBlockNumber and NextSequence locate the modification from which the next
+	// page should be queried. They are only set if HasMore is true
+	NextBlockNumber uint64
+	NextSequence    uint64
+}
+
+// GetStateHistory returns the modifications made to the key of the given chaincode by the
+// transactions committed in blocks fromBlock to toBlock (both inclusive), oldest first.
+// The history is only maintained if 'ledger.history.enabled' is set, and only covers the
+// blocks committed since; changes applied through state transfer (ApplyStateDelta) are not
+// part of it. An error is returned if the history does not cover fromBlock
+func (ledger *Ledger) GetStateHistory(chaincodeID string, key string, fromBlock uint64, toBlock uint64) ([]*protos.KeyModification, error) {
+	page, err := ledger.GetStateHistoryPage(chaincodeID, key, fromBlock, 0, toBlock, 0)
+	if err != nil {
+		return nil, err
+	}
+	return page.Modifications, nil
+}
+
+// GetStateHistoryPage returns, as GetStateHistory, at most limit modifications of the key,
+// starting at the modification of sequence fromSequence in fromBlock. A first page is queried
+// with a fromSequence of zero, the next ones from the NextBlockNumber and NextSequence of the
+// previous page. A limit of zero returns all the modifications
+func (ledger *Ledger) GetStateHistoryPage(chaincodeID string, key string, fromBlock uint64, fromSequence uint64, toBlock uint64, limit int) (*StateHistoryPage, error) {
+	if !ledger.historyEnabled {
+		return nil, fmt.Errorf("State history is not enabled. Set 'ledger.history.enabled' to maintain it")
+	}
+	toBlock, err := ledger.checkBlockRange(fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	historyFromBlock, ok, err := fetchStateHistoryFromBlock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("State history is not kept for any block yet")
+	}
+	if fromBlock < historyFromBlock {
+		return nil, fmt.Errorf("State history is only kept from block [%d], it does not cover block [%d]", historyFromBlock, fromBlock)
+	}
+	return fetchStateHistoryFromDB(chaincodeID, key, fromBlock, fromSequence, toBlock, limit)
+}
+
+// ExecuteQuery evaluates a rich query (see state_query.go for the syntax) over the values of
+// the chaincode that are JSON objects, and returns the matching key-values in the order
+// requested by the query. If committed is true, only the values in the db are considered.
+// Rich queries are only available if 'ledger.richQuery.enabled' is set. As they scan the
+// entire state of the chaincode, their results may differ between peers that are not at
+// the same block, and must not be used to compute state updates.
+func (ledger *Ledger) ExecuteQuery(chaincodeID string, query string, committed bool) (statemgmt.RangeScanIterator, error) {
+	if !ledger.richQueryEnabled {
+		return nil, fmt.Errorf("Rich queries are not enabled. Set 'ledger.richQuery.enabled' to allow them")
+	}
+	q, err := parseStateQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	itr, err := ledger.state.GetRangeScanIterator(chaincodeID, "", "", committed)
+	if err != nil {
+		return nil, err
+	}
+	return newQueryResultsIterator(q.execute(itr)), nil
+}
+
 // GetStateSnapshot returns a point-in-time view of the global state for the current block. This
 // should be used when transferring the state from one peer to another peer. You must call
 // stateSnapshot.Release() once you are done with the snapshot to free up resources.
@@ -334,6 +466,10 @@ func (ledger *Ledger) CommitStateDelta(id interface{}) error {
 		return err
 	}
 	defer ledger.resetForNextTxGroup(true)
+	// the changes of the transferred blocks are not part of the history
+	if err := deleteStateHistoryFromBlock(); err != nil {
+		return err
+	}
 	return ledger.state.CommitStateDelta()
 }
 
@@ -373,6 +509,16 @@ func (ledger *Ledger) GetBlockByNumber(blockNumber uint64) (*protos.Block, error
 	return ledger.blockchain.getBlock(blockNumber)
 }
 
+// GetBlockEvents returns the events produced by the commit of a block: the block event
+// followed by the events set by the chaincodes invoked by its transactions
+func (ledger *Ledger) GetBlockEvents(blockNumber uint64) ([]*protos.Event, error) {
+	block, err := ledger.GetBlockByNumber(blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return createProducerEvents(block, blockNumber), nil
+}
+
 // GetBlockchainSize returns number of blocks in blockchain
 func (ledger *Ledger) GetBlockchainSize() uint64 {
 	return ledger.blockchain.getSize()
@@ -383,6 +529,135 @@ func (ledger *Ledger) GetTransactionByUUID(txUUID string) (*protos.Transaction,
 	return ledger.blockchain.getTransactionByUUID(txUUID)
 }
 
+// GetTransactionResultByUUID returns the result of the transaction with the given uuid
+// once its block is committed. The result of a transaction that failed is returned
+// too, although the transaction is not in the block.
+func (ledger *Ledger) GetTransactionResultByUUID(txUUID string) (*protos.TransactionResult, error) {
+	return ledger.blockchain.getTransactionResultByUUID(txUUID)
+}
+
+// GetTransactionsByInvoker returns the transactions submitted by the given invoker in blocks
+// fromBlock to toBlock (both inclusive). The invoker is the enrollment ID of the enrollment
+// certificate which signed the transactions. Transactions signed with a transaction certificate,
+// which is unlinkable to its owner, cannot be looked up by invoker: with security enabled, most
+// transactions are, so that an empty page does not mean that the invoker submitted nothing.
+// Unattributed reports whether the page missed such transactions. A page never splits the
+// transactions of a block, so it may hold more than limit transactions. A limit of zero returns all the matching transactions.
+// The index scan stops once the page is full; the next page is queried from NextBlockNumber
+func (ledger *Ledger) GetTransactionsByInvoker(invoker string, fromBlock uint64, toBlock uint64, limit int) (*TransactionsPage, error) {
+	return ledger.getTransactionsPage(&txIndexQuery{address: invoker}, fromBlock, toBlock, limit)
+}
+
+// GetTransactionsByChaincodeID returns the deploy, invoke, upgrade and terminate transactions for the given chaincode
+// name in blocks fromBlock to toBlock (both inclusive). Paging works as in GetTransactionsByInvoker
+func (ledger *Ledger) GetTransactionsByChaincodeID(chaincodeID string, fromBlock uint64, toBlock uint64, limit int) (*TransactionsPage, error) {
+	return ledger.getTransactionsPage(&txIndexQuery{chaincodeID: chaincodeID}, fromBlock, toBlock, limit)
+}
+
+// GetBlocks returns the blocks fromBlock to toBlock (both inclusive) that contain a transaction
+// matching the filter, ordered by block number. A nil filter returns every block of the range.
+// A limit of zero returns all the matching blocks. The index scan stops once the page is full;
+// the next page is queried from NextBlockNumber
+func (ledger *Ledger) GetBlocks(fromBlock uint64, toBlock uint64, filter *TransactionFilter, limit int) (*BlocksPage, error) {
+	toBlock, err := ledger.checkBlockRange(fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	indexPage, err := ledger.blockchain.getTransactionIndexes(filter.indexQuery(), fromBlock, toBlock, limit)
+	if err != nil {
+		return nil, err
+	}
+	page := &BlocksPage{BlockNumbers: indexPage.blockNumbers, HasMore: indexPage.hasMore, NextBlockNumber: indexPage.nextBlockNumber}
+	for _, blockNumber := range indexPage.blockNumbers {
+		block, err := ledger.blockchain.getBlock(blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		page.Blocks = append(page.Blocks, block)
+	}
+	return page, nil
+}
+
+// GetTransactions returns the transactions matching the filter in blocks fromBlock to toBlock
+// (both inclusive). A nil filter returns every transaction of the range. Paging works as in
+// GetTransactionsByInvoker, except that blocks without transactions count towards the limit
+// of an unfiltered query, so that its page may hold fewer than limit transactions
+func (ledger *Ledger) GetTransactions(fromBlock uint64, toBlock uint64, filter *TransactionFilter, limit int) (*TransactionsPage, error) {
+	return ledger.getTransactionsPage(filter.indexQuery(), fromBlock, toBlock, limit)
+}
+
+// indexQuery returns the index query selecting the transactions of the filter
+func (filter *TransactionFilter) indexQuery() *txIndexQuery {
+	if filter == nil {
+		return &txIndexQuery{}
+	}
+	query := &txIndexQuery{chaincodeID: filter.ChaincodeID, txType: filter.Type}
+	if !filter.FromTime.IsZero() || !filter.ToTime.IsZero() {
+		query.timeFiltered = true
+		query.toTime = math.MaxInt64
+		if !filter.FromTime.IsZero() {
+			query.fromTime = filter.FromTime.UnixNano()
+		}
+		if !filter.ToTime.IsZero() {
+			query.toTime = filter.ToTime.UnixNano()
+		}
+	}
+	return query
+}
+
+// getTransactionsPage returns the transactions selected by the query in blocks fromBlock to
+// toBlock. Each selected block holds at least one selected transaction, so a page of limit
+// transactions takes at most limit blocks
+func (ledger *Ledger) getTransactionsPage(query *txIndexQuery, fromBlock uint64, toBlock uint64, limit int) (*TransactionsPage, error) {
+	toBlock, err := ledger.checkBlockRange(fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	indexPage, err := ledger.blockchain.getTransactionIndexes(query, fromBlock, toBlock, limit)
+	if err != nil {
+		return nil, err
+	}
+	page := &TransactionsPage{HasMore: indexPage.hasMore, NextBlockNumber: indexPage.nextBlockNumber}
+	for i, blockNumber := range indexPage.blockNumbers {
+		if limit > 0 && len(page.Transactions) >= limit {
+			page.HasMore = true
+			page.NextBlockNumber = blockNumber
+			break
+		}
+		block, err := ledger.blockchain.getBlock(blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		transactions := block.GetTransactions()
+		if indexPage.txIndexes[i] == nil {
+			page.Transactions = append(page.Transactions, transactions...)
+			continue
+		}
+		for _, txIndex := range indexPage.txIndexes[i] {
+			if txIndex >= uint64(len(transactions)) {
+				return nil, fmt.Errorf("Transaction index [%d] out of range for block [%d]", txIndex, blockNumber)
+			}
+			page.Transactions = append(page.Transactions, transactions[txIndex])
+		}
+	}
+	if indexPage.hasUnattributed && (!page.HasMore || indexPage.firstUnattributedBlock < page.NextBlockNumber) {
+		page.Unattributed = true
+	}
+	return page, nil
+}
+
+// checkBlockRange validates a block range and caps toBlock at the last block of the chain
+func (ledger *Ledger) checkBlockRange(fromBlock uint64, toBlock uint64) (uint64, error) {
+	size := ledger.GetBlockchainSize()
+	if fromBlock >= size || toBlock < fromBlock {
+		return 0, ErrOutOfBounds
+	}
+	if toBlock >= size {
+		toBlock = size - 1
+	}
+	return toBlock, nil
+}
+
 // PutRawBlock puts a raw block on the chain. This function should only be
 // used for synchronization between peers.
 func (ledger *Ledger) PutRawBlock(block *protos.Block, blockNumber uint64) error {
@@ -390,7 +665,7 @@ func (ledger *Ledger) PutRawBlock(block *protos.Block, blockNumber uint64) error
 	if err != nil {
 		return err
 	}
-	sendProducerBlockEvent(block)
+	sendProducerEvents(block, blockNumber)
 	return nil
 }
 
@@ -465,9 +740,54 @@ func (ledger *Ledger) resetForNextTxGroup(txCommited bool) {
 	ledger.state.ClearInMemoryChanges(txCommited)
 }
 
-func sendProducerBlockEvent(block *protos.Block) {
+// getChaincodeEvents returns the chaincode events of the results of the
+// committed transactions, in order. The results of the failed transactions
+// are ignored
+func getChaincodeEvents(transactions []*protos.Transaction, transactionResults []*protos.TransactionResult) []*protos.ChaincodeEvent {
+	committed := make(map[string]bool)
+	for _, transaction := range transactions {
+		committed[transaction.Uuid] = true
+	}
+	var ccEvents []*protos.ChaincodeEvent
+	for _, result := range transactionResults {
+		if !committed[result.Uuid] {
+			continue
+		}
+		resultEvents := result.ChaincodeEvents
+		if len(resultEvents) == 0 && result.ChaincodeEvent != nil {
+			resultEvents = []*protos.ChaincodeEvent{result.ChaincodeEvent}
+		}
+		for _, ccEvent := range resultEvents {
+			if ccEvent.ChaincodeID != "" {
+				ccEvents = append(ccEvents, ccEvent)
+			}
+		}
+	}
+	return ccEvents
+}
+
+// getTransactionResults returns the results persisted with the block. Their
+// chaincode events are persisted with the chaincode events of the block
+func getTransactionResults(transactionResults []*protos.TransactionResult) []*protos.TransactionResult {
+	var results []*protos.TransactionResult
+	for _, result := range transactionResults {
+		persisted := *result
+		persisted.ChaincodeEvent = nil
+		persisted.ChaincodeEvents = nil
+		results = append(results, &persisted)
+	}
+	return results
+}
+
+func sendProducerEvents(block *protos.Block, blockNumber uint64) {
+	for _, event := range createProducerEvents(block, blockNumber) {
+		producer.Send(event)
+	}
+}
+
+func createProducerEvents(block *protos.Block, blockNumber uint64) []*protos.Event {
 
-	// Remove payload from deploy transactions. This is done to make block
+	// Remove payload from deploy and upgrade transactions. This is done to make block
 	// events more lightweight as the payload for these types of transactions
 	// can be very large.
 	blockTransactions := block.GetTransactions()
@@ -486,8 +806,36 @@ func sendProducerBlockEvent(block *protos.Block) {
 				continue
 			}
 			transaction.Payload = deploymentSpecBytes
+		} else if transaction.Type == protos.Transaction_CHAINCODE_UPGRADE {
+			upgradeSpec := &protos.ChaincodeUpgradeSpec{}
+			err := proto.Unmarshal(transaction.Payload, upgradeSpec)
+			if err != nil {
+				ledgerLogger.Errorf("Error unmarshalling upgrade transaction for block event: %s", err)
+				continue
+			}
+			if upgradeSpec.ChaincodeDeploymentSpec != nil {
+				upgradeSpec.ChaincodeDeploymentSpec.CodePackage = nil
+			}
+			upgradeSpecBytes, err := proto.Marshal(upgradeSpec)
+			if err != nil {
+				ledgerLogger.Errorf("Error marshalling upgrade transaction for block event: %s", err)
+				continue
+			}
+			transaction.Payload = upgradeSpecBytes
 		}
 	}
 
-	producer.Send(producer.CreateBlockEvent(block))
+	blockEvent := producer.CreateBlockEvent(block)
+	blockEvent.BlockNumber = blockNumber
+	events := []*protos.Event{blockEvent}
+	for _, event := range producer.CreateChaincodeEvents(block.GetNonHashData().GetChaincodeEvents()) {
+		event.BlockNumber = blockNumber
+		events = append(events, event)
+	}
+	for _, result := range block.GetNonHashData().GetTransactionResults() {
+		event := producer.CreateTransactionResultEvent(result)
+		event.BlockNumber = blockNumber
+		events = append(events, event)
+	}
+	return events
 }
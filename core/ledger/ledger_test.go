@@ -20,7 +20,10 @@ import (
 	"bytes"
 	"strconv"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric/core/crypto/utils"
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/protos"
@@ -706,6 +709,422 @@ func TestGetTransactionByUUID(t *testing.T) {
 	testutil.AssertNil(t, ledgerTransaction)
 }
 
+func TestGetTransactionsByInvokerAndChaincodeID(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	user1Cert := buildTestCert(t, "user1")
+	user2Cert := buildTestCert(t, "user2")
+
+	var user1Txs []*protos.Transaction
+	for i := 0; i < 3; i++ {
+		ledger.BeginTxBatch(i)
+		tx1 := buildTestInvokeTx(t, "chaincode1", user1Cert)
+		tx2 := buildTestInvokeTx(t, "chaincode2", user2Cert)
+		ledger.CommitTxBatch(i, []*protos.Transaction{tx1, tx2}, nil, []byte("proof"))
+		user1Txs = append(user1Txs, tx1)
+	}
+
+	page, err := ledger.GetTransactionsByInvoker("user1", 0, 10, 2)
+	testutil.AssertNoError(t, err, "Error fetching transactions by invoker")
+	testutil.AssertEquals(t, page.Transactions, user1Txs[:2])
+	testutil.AssertEquals(t, page.HasMore, true)
+	testutil.AssertEquals(t, page.NextBlockNumber, uint64(2))
+
+	page, err = ledger.GetTransactionsByInvoker("user1", page.NextBlockNumber, 10, 2)
+	testutil.AssertNoError(t, err, "Error fetching transactions by invoker")
+	testutil.AssertEquals(t, page.Transactions, user1Txs[2:])
+	testutil.AssertEquals(t, page.HasMore, false)
+
+	page, err = ledger.GetTransactionsByChaincodeID("chaincode1", 0, 2, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions by chaincodeID")
+	testutil.AssertEquals(t, page.Transactions, user1Txs)
+
+	_, err = ledger.GetTransactionsByChaincodeID("chaincode1", 3, 5, 0)
+	testutil.AssertEquals(t, err, ErrOutOfBounds)
+}
+
+func TestGetTransactionsByInvokerUnattributed(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	ecert := buildTestCert(t, "user1")
+	tcert := buildTestCert(t, utils.TCertSubjectCommonName)
+
+	// blocks 0 and 1 hold a transaction of user1, block 2 one signed with a TCert
+	var user1Txs []*protos.Transaction
+	for i := 0; i < 3; i++ {
+		cert := ecert
+		if i == 2 {
+			cert = tcert
+		}
+		ledger.BeginTxBatch(i)
+		tx := buildTestInvokeTx(t, "chaincode1", cert)
+		ledger.CommitTxBatch(i, []*protos.Transaction{tx}, nil, []byte("proof"))
+		user1Txs = append(user1Txs, tx)
+	}
+
+	page, err := ledger.GetTransactionsByInvoker("user1", 0, 10, 1)
+	testutil.AssertNoError(t, err, "Error fetching transactions by invoker")
+	testutil.AssertEquals(t, page.Transactions, user1Txs[:1])
+	testutil.AssertEquals(t, page.Unattributed, false)
+
+	page, err = ledger.GetTransactionsByInvoker("user1", page.NextBlockNumber, 10, 1)
+	testutil.AssertNoError(t, err, "Error fetching transactions by invoker")
+	testutil.AssertEquals(t, page.Transactions, user1Txs[1:2])
+	testutil.AssertEquals(t, page.HasMore, false)
+	testutil.AssertEquals(t, page.Unattributed, true)
+
+	page, err = ledger.GetTransactionsByInvoker("user2", 0, 1, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions by invoker")
+	testutil.AssertEquals(t, len(page.Transactions), 0)
+	testutil.AssertEquals(t, page.Unattributed, false)
+
+	page, err = ledger.GetTransactionsByInvoker("user2", 0, 10, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions by invoker")
+	testutil.AssertEquals(t, len(page.Transactions), 0)
+	testutil.AssertEquals(t, page.Unattributed, true)
+}
+
+func TestGetBlocksAndTransactions(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	cert := buildTestCert(t, "user1")
+
+	tx1 := buildTestInvokeTx(t, "chaincode1", cert)
+	tx2 := buildTestInvokeTx(t, "chaincode2", cert)
+	tx3 := buildTestInvokeTx(t, "chaincode2", cert)
+	tx4, _ := buildTestTx(t)
+	tx5 := buildTestInvokeTx(t, "chaincode1", cert)
+	tx5.Type = protos.Transaction_CHAINCODE_TERMINATE
+	for i, txs := range [][]*protos.Transaction{{tx1, tx2}, {tx3, tx4}, {tx5}} {
+		ledger.BeginTxBatch(i)
+		ledger.CommitTxBatch(i, txs, nil, []byte("proof"))
+	}
+
+	blocksPage, err := ledger.GetBlocks(0, 10, nil, 2)
+	testutil.AssertNoError(t, err, "Error fetching blocks")
+	testutil.AssertEquals(t, blocksPage.BlockNumbers, []uint64{0, 1})
+	testutil.AssertEquals(t, blocksPage.Blocks[1].Transactions, []*protos.Transaction{tx3, tx4})
+	testutil.AssertEquals(t, blocksPage.HasMore, true)
+	testutil.AssertEquals(t, blocksPage.NextBlockNumber, uint64(2))
+
+	blocksPage, err = ledger.GetBlocks(0, 10, &TransactionFilter{ChaincodeID: "chaincode1"}, 0)
+	testutil.AssertNoError(t, err, "Error fetching blocks by chaincodeID")
+	testutil.AssertEquals(t, blocksPage.BlockNumbers, []uint64{0, 2})
+	testutil.AssertEquals(t, blocksPage.HasMore, false)
+
+	page, err := ledger.GetTransactions(0, 10, nil, 3)
+	testutil.AssertNoError(t, err, "Error fetching transactions")
+	testutil.AssertEquals(t, page.Transactions, []*protos.Transaction{tx1, tx2, tx3, tx4})
+	testutil.AssertEquals(t, page.HasMore, true)
+	testutil.AssertEquals(t, page.NextBlockNumber, uint64(2))
+
+	page, err = ledger.GetTransactions(0, 10, &TransactionFilter{ChaincodeID: "chaincode1", Type: protos.Transaction_CHAINCODE_INVOKE}, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions by chaincodeID and type")
+	testutil.AssertEquals(t, page.Transactions, []*protos.Transaction{tx1})
+
+	page, err = ledger.GetTransactions(1, 10, &TransactionFilter{Type: protos.Transaction_CHAINCODE_INVOKE}, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions by type")
+	testutil.AssertEquals(t, page.Transactions, []*protos.Transaction{tx3})
+
+	block1, _ := ledger.GetBlockByNumber(1)
+	commitTime := block1.NonHashData.LocalLedgerCommitTimestamp
+	block1Time := time.Unix(commitTime.Seconds, int64(commitTime.Nanos))
+	blocksPage, err = ledger.GetBlocks(0, 10, &TransactionFilter{FromTime: block1Time, ToTime: block1Time}, 0)
+	testutil.AssertNoError(t, err, "Error fetching blocks by commit time")
+	testutil.AssertEquals(t, blocksPage.BlockNumbers, []uint64{1})
+
+	page, err = ledger.GetTransactions(0, 10, &TransactionFilter{Type: protos.Transaction_CHAINCODE_INVOKE, FromTime: block1Time}, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions by type and commit time")
+	testutil.AssertEquals(t, page.Transactions, []*protos.Transaction{tx3})
+
+	_, err = ledger.GetBlocks(3, 5, nil, 0)
+	testutil.AssertEquals(t, err, ErrOutOfBounds)
+}
+
+func TestGetTransactionsPaging(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	cert := buildTestCert(t, "user1")
+
+	var chaincode1Txs []*protos.Transaction
+	for i := 0; i < 6; i++ {
+		txs := []*protos.Transaction{buildTestInvokeTx(t, "chaincode2", cert)}
+		if i%2 == 0 {
+			tx := buildTestInvokeTx(t, "chaincode1", cert)
+			chaincode1Txs = append(chaincode1Txs, tx)
+			txs = append(txs, tx)
+		}
+		ledger.BeginTxBatch(i)
+		ledger.CommitTxBatch(i, txs, nil, []byte("proof"))
+	}
+
+	// each page resumes from the next block of the previous one
+	filter := &TransactionFilter{ChaincodeID: "chaincode1", Type: protos.Transaction_CHAINCODE_INVOKE}
+	fromBlock := uint64(0)
+	for i := range chaincode1Txs {
+		page, err := ledger.GetTransactions(fromBlock, 10, filter, 1)
+		testutil.AssertNoError(t, err, "Error fetching transactions")
+		testutil.AssertEquals(t, page.Transactions, []*protos.Transaction{chaincode1Txs[i]})
+		testutil.AssertEquals(t, page.HasMore, i < 2)
+		fromBlock = page.NextBlockNumber
+	}
+
+	blocksPage, err := ledger.GetBlocks(1, 10, &TransactionFilter{ChaincodeID: "chaincode1"}, 1)
+	testutil.AssertNoError(t, err, "Error fetching blocks")
+	testutil.AssertEquals(t, blocksPage.BlockNumbers, []uint64{2})
+	testutil.AssertEquals(t, blocksPage.HasMore, true)
+	testutil.AssertEquals(t, blocksPage.NextBlockNumber, uint64(4))
+
+	// the index scan stops at the first selected block after the limit
+	indexPage, err := ledger.blockchain.getTransactionIndexes(&txIndexQuery{chaincodeID: "chaincode1"}, 0, 5, 2)
+	testutil.AssertNoError(t, err, "Error fetching transaction indexes")
+	testutil.AssertEquals(t, indexPage.blockNumbers, []uint64{0, 2})
+	testutil.AssertEquals(t, indexPage.txIndexes, [][]uint64{{1}, {1}})
+	testutil.AssertEquals(t, indexPage.nextBlockNumber, uint64(4))
+
+	// chaincode1 has no deploy transaction, although both indexes select blocks 0, 2 and 4
+	page, err := ledger.GetTransactions(0, 10, &TransactionFilter{ChaincodeID: "chaincode1", Type: protos.Transaction_CHAINCODE_DEPLOY}, 0)
+	testutil.AssertNoError(t, err, "Error fetching transactions")
+	testutil.AssertEquals(t, len(page.Transactions), 0)
+	testutil.AssertEquals(t, page.HasMore, false)
+}
+
+func TestUpgradeIndexes(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+	tx, _ := buildTestTx(t)
+	ledger.BeginTxBatch(1)
+	ledger.CommitTxBatch(1, []*protos.Transaction{tx}, nil, []byte("proof"))
+
+	block, _ := ledger.GetBlockByNumber(0)
+	commitTime := block.NonHashData.LocalLedgerCommitTimestamp
+	blockTime := time.Unix(commitTime.Seconds, int64(commitTime.Nanos))
+	filter := &TransactionFilter{FromTime: blockTime, ToTime: blockTime}
+
+	// the block was committed by a version that did not index commit times
+	openchainDB := db.GetDBHandle()
+	testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, encodeBlockNumCommitTimeKey(0)), "Error deleting index")
+	testutil.AssertNoError(t, openchainDB.Delete(openchainDB.IndexesCF, indexesVersionKey), "Error deleting index")
+	blocksPage, err := ledger.GetBlocks(0, 0, filter, 0)
+	testutil.AssertNoError(t, err, "Error fetching blocks by commit time")
+	testutil.AssertEquals(t, len(blocksPage.BlockNumbers), 0)
+
+	// the indexes are rebuilt when the ledger is opened
+	ledger, err = GetNewLedger()
+	testutil.AssertNoError(t, err, "Error opening ledger")
+	blocksPage, err = ledger.GetBlocks(0, 0, filter, 0)
+	testutil.AssertNoError(t, err, "Error fetching blocks by commit time")
+	testutil.AssertEquals(t, blocksPage.BlockNumbers, []uint64{0})
+	versionBytes, err := openchainDB.GetFromIndexesCF(indexesVersionKey)
+	testutil.AssertNoError(t, err, "Error fetching indexes version")
+	testutil.AssertEquals(t, decodeToUint64(versionBytes), uint64(indexesVersion))
+}
+
+func TestGetBlockEvents(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	tx1, uuid1 := buildTestTx(t)
+	_, uuid2 := buildTestTx(t)
+	ccEvent1 := &protos.ChaincodeEvent{ChaincodeID: "chaincode1", TxID: uuid1, EventName: "event1"}
+	ccEvent2 := &protos.ChaincodeEvent{ChaincodeID: "chaincode1", TxID: uuid1, EventName: "event2"}
+	results := []*protos.TransactionResult{
+		{Uuid: uuid1, ChaincodeEvent: ccEvent2, ChaincodeEvents: []*protos.ChaincodeEvent{ccEvent1, ccEvent2}},
+		// the transaction failed and is not in the block
+		{Uuid: uuid2, ErrorCode: 1, ChaincodeEvent: &protos.ChaincodeEvent{ChaincodeID: "chaincode1", TxID: uuid2, EventName: "event1"}},
+	}
+	ledger.BeginTxBatch(1)
+	ledger.CommitTxBatch(1, []*protos.Transaction{tx1}, results, []byte("proof"))
+
+	events, err := ledger.GetBlockEvents(0)
+	testutil.AssertNoError(t, err, "Error fetching block events")
+	testutil.AssertEquals(t, len(events), 5)
+	testutil.AssertEquals(t, events[0].GetBlock().Transactions, []*protos.Transaction{tx1})
+	testutil.AssertEquals(t, events[1].GetChaincodeEvent(), ccEvent1)
+	testutil.AssertEquals(t, events[1].BlockNumber, uint64(0))
+	testutil.AssertEquals(t, events[2].GetChaincodeEvent(), ccEvent2)
+	testutil.AssertEquals(t, events[3].GetTransactionResult().Uuid, uuid1)
+	testutil.AssertEquals(t, events[4].GetTransactionResult().Uuid, uuid2)
+	testutil.AssertEquals(t, events[4].GetTransactionResult().ErrorCode, uint32(1))
+
+	_, err = ledger.GetBlockEvents(1)
+	testutil.AssertEquals(t, err, ErrOutOfBounds)
+}
+
+func TestGetTransactionResultByUUID(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	tx1, uuid1 := buildTestTx(t)
+	_, uuid2 := buildTestTx(t)
+	ccEvent := &protos.ChaincodeEvent{ChaincodeID: "chaincode1", TxID: uuid1, EventName: "event1"}
+	ledger.BeginTxBatch(1)
+	ledger.CommitTxBatch(1, []*protos.Transaction{tx1}, []*protos.TransactionResult{
+		{Uuid: uuid1, Result: []byte("result1"), ChaincodeEvent: ccEvent},
+		{Uuid: uuid2, ErrorCode: 1, Error: "failure"},
+	}, []byte("proof"))
+
+	result, err := ledger.GetTransactionResultByUUID(uuid1)
+	testutil.AssertNoError(t, err, "Error fetching transaction result")
+	testutil.AssertEquals(t, result, &protos.TransactionResult{Uuid: uuid1, Result: []byte("result1"), ChaincodeEvent: ccEvent, ChaincodeEvents: []*protos.ChaincodeEvent{ccEvent}})
+
+	// the result of a failed transaction is persisted with the block
+	result, err = ledger.GetTransactionResultByUUID(uuid2)
+	testutil.AssertNoError(t, err, "Error fetching transaction result")
+	testutil.AssertEquals(t, result, &protos.TransactionResult{Uuid: uuid2, ErrorCode: 1, Error: "failure"})
+
+	_, err = ledger.GetTransactionResultByUUID("non-existing")
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+
+	// the block received through state transfer has no results, which are not hashed
+	block, err := ledger.GetBlockByNumber(0)
+	testutil.AssertNoError(t, err, "Error fetching block")
+	block.NonHashData.TransactionResults = nil
+	testutil.AssertNoError(t, ledger.PutRawBlock(block, 0), "Error putting raw block")
+	_, err = ledger.GetTransactionResultByUUID(uuid1)
+	testutil.AssertEquals(t, err, ErrResourceNotFound)
+}
+
+func TestGetStateHistory(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	// Block 0
+	ledger.BeginTxBatch(0)
+	ledger.TxBegin("txUuid1")
+	ledger.SetState("chaincode1", "key1", []byte("value1A"))
+	ledger.SetState("chaincode2", "key1", []byte("value1A"))
+	ledger.TxFinished("txUuid1", true)
+	ledger.TxBegin("txUuid2")
+	ledger.SetState("chaincode1", "key1", []byte("value1B"))
+	ledger.TxFinished("txUuid2", true)
+	ledger.TxBegin("txUuid3")
+	ledger.SetState("chaincode1", "key1", []byte("value1C"))
+	ledger.TxFinished("txUuid3", false)
+	transaction, _ := buildTestTx(t)
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction}, nil, []byte("proof"))
+
+	// Block 1
+	ledger.BeginTxBatch(1)
+	ledger.TxBegin("txUuid4")
+	ledger.DeleteState("chaincode1", "key1")
+	ledger.TxFinished("txUuid4", true)
+	transaction, _ = buildTestTx(t)
+	ledger.CommitTxBatch(1, []*protos.Transaction{transaction}, nil, []byte("proof"))
+
+	history, err := ledger.GetStateHistory("chaincode1", "key1", 0, 1)
+	testutil.AssertNoError(t, err, "Error fetching state history")
+	testutil.AssertEquals(t, history, []*protos.KeyModification{
+		&protos.KeyModification{Uuid: "txUuid1", BlockNumber: 0, Value: []byte("value1A")},
+		&protos.KeyModification{Uuid: "txUuid2", BlockNumber: 0, Value: []byte("value1B")},
+		&protos.KeyModification{Uuid: "txUuid4", BlockNumber: 1, IsDelete: true},
+	})
+
+	history, err = ledger.GetStateHistory("chaincode1", "key1", 1, 1)
+	testutil.AssertNoError(t, err, "Error fetching state history")
+	testutil.AssertEquals(t, len(history), 1)
+	testutil.AssertEquals(t, history[0].Uuid, "txUuid4")
+
+	history, err = ledger.GetStateHistory("chaincode2", "key1", 0, 1)
+	testutil.AssertNoError(t, err, "Error fetching state history")
+	testutil.AssertEquals(t, len(history), 1)
+
+	history, err = ledger.GetStateHistory("chaincode1", "key2", 0, 1)
+	testutil.AssertNoError(t, err, "Error fetching state history")
+	testutil.AssertEquals(t, len(history), 0)
+
+	page, err := ledger.GetStateHistoryPage("chaincode1", "key1", 0, 0, 1, 2)
+	testutil.AssertNoError(t, err, "Error fetching state history page")
+	testutil.AssertEquals(t, len(page.Modifications), 2)
+	testutil.AssertEquals(t, page.HasMore, true)
+	testutil.AssertEquals(t, page.NextBlockNumber, uint64(1))
+	page, err = ledger.GetStateHistoryPage("chaincode1", "key1", page.NextBlockNumber, page.NextSequence, 1, 2)
+	testutil.AssertNoError(t, err, "Error fetching state history page")
+	testutil.AssertEquals(t, page.Modifications, []*protos.KeyModification{
+		&protos.KeyModification{Uuid: "txUuid4", BlockNumber: 1, IsDelete: true},
+	})
+	testutil.AssertEquals(t, page.HasMore, false)
+
+	// the changes received through state transfer are not part of the history
+	delta := statemgmt.NewStateDelta()
+	delta.Set("chaincode1", "key1", []byte("value1D"), nil)
+	ledger.ApplyStateDelta(2, delta)
+	ledger.CommitStateDelta(2)
+	_, err = ledger.GetStateHistory("chaincode1", "key1", 0, 1)
+	testutil.AssertError(t, err, "Expected an error fetching state history not kept")
+
+	ledger.BeginTxBatch(3)
+	ledger.TxBegin("txUuid5")
+	ledger.SetState("chaincode1", "key1", []byte("value1E"))
+	ledger.TxFinished("txUuid5", true)
+	transaction, _ = buildTestTx(t)
+	ledger.CommitTxBatch(3, []*protos.Transaction{transaction}, nil, []byte("proof"))
+	_, err = ledger.GetStateHistory("chaincode1", "key1", 0, 2)
+	testutil.AssertError(t, err, "Expected an error fetching state history not kept")
+	history, err = ledger.GetStateHistory("chaincode1", "key1", 2, 2)
+	testutil.AssertNoError(t, err, "Error fetching state history")
+	testutil.AssertEquals(t, len(history), 1)
+	testutil.AssertEquals(t, history[0].Uuid, "txUuid5")
+}
+
+func TestExecuteQuery(t *testing.T) {
+	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
+	ledger := ledgerTestWrapper.ledger
+
+	ledger.BeginTxBatch(0)
+	ledger.TxBegin("txUuid1")
+	ledger.SetState("chaincode1", "asset1", []byte(`{"owner":"alice","size":10,"address":{"city":"Paris"}}`))
+	ledger.SetState("chaincode1", "asset2", []byte(`{"owner":"bob","size":20}`))
+	ledger.SetState("chaincode1", "asset3", []byte(`{"owner":"alice","size":30,"address":{"city":"Rome"}}`))
+	ledger.SetState("chaincode1", "asset4", []byte("not a JSON value"))
+	ledger.SetState("chaincode2", "asset1", []byte(`{"owner":"alice","size":40}`))
+	ledger.TxFinished("txUuid1", true)
+	transaction, _ := buildTestTx(t)
+	ledger.CommitTxBatch(0, []*protos.Transaction{transaction}, nil, []byte("proof"))
+
+	assertQueryKeys := func(query string, committed bool, expectedKeys []string) {
+		itr, err := ledger.ExecuteQuery("chaincode1", query, committed)
+		testutil.AssertNoError(t, err, "Error executing query "+query)
+		defer itr.Close()
+		keys := []string{}
+		for itr.Next() {
+			key, _ := itr.GetKeyValue()
+			keys = append(keys, key)
+		}
+		testutil.AssertEquals(t, keys, expectedKeys)
+	}
+
+	assertQueryKeys(`{"selector":{}}`, true, []string{"asset1", "asset2", "asset3"})
+	assertQueryKeys(`{"selector":{"owner":"alice"}}`, true, []string{"asset1", "asset3"})
+	assertQueryKeys(`{"selector":{"size":{"$gt":10,"$lte":30}}}`, true, []string{"asset2", "asset3"})
+	assertQueryKeys(`{"selector":{"owner":{"$ne":"alice"}}}`, true, []string{"asset2"})
+	assertQueryKeys(`{"selector":{"address.city":"Rome"}}`, true, []string{"asset3"})
+	assertQueryKeys(`{"selector":{"owner":{"$gt":10}}}`, true, []string{})
+	assertQueryKeys(`{"selector":{},"sort":[{"size":"desc"}]}`, true, []string{"asset3", "asset2", "asset1"})
+	assertQueryKeys(`{"selector":{},"sort":["address.city","size"],"limit":2}`, true, []string{"asset2", "asset1"})
+
+	// Uncommitted values are only visible if committed is false
+	ledger.BeginTxBatch(1)
+	ledger.TxBegin("txUuid2")
+	ledger.SetState("chaincode1", "asset5", []byte(`{"owner":"alice","size":50}`))
+	ledger.DeleteState("chaincode1", "asset1")
+	assertQueryKeys(`{"selector":{"owner":"alice"}}`, false, []string{"asset3", "asset5"})
+	assertQueryKeys(`{"selector":{"owner":"alice"}}`, true, []string{"asset1", "asset3"})
+	ledger.TxFinished("txUuid2", true)
+
+	for _, query := range []string{
+		`not JSON`,
+		`{"sort":["size"]}`,
+		`{"selector":{"size":{"$in":[10]}}}`,
+		`{"selector":{"size":{"$gt":true}}}`,
+		`{"selector":{},"sort":[{"size":"up"}]}`,
+		`{"selector":{},"limit":-1}`,
+	} {
+		_, err := ledger.ExecuteQuery("chaincode1", query, true)
+		testutil.AssertError(t, err, "Expected an error for query "+query)
+	}
+}
+
 func TestRangeScanIterator(t *testing.T) {
 	ledgerTestWrapper := createFreshDBAndTestLedgerWrapper(t)
 	ledger := ledgerTestWrapper.ledger
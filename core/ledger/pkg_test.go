@@ -17,14 +17,21 @@ limitations under the License.
 package ledger
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
 	"github.com/hyperledger/fabric/core/ledger/testutil"
 	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
-	"github.com/tecbot/gorocksdb"
 	"golang.org/x/net/context"
 )
 
@@ -48,7 +55,7 @@ func newTestBlockchainWrapper(t *testing.T) *blockchainTestWrapper {
 }
 
 func (testWrapper *blockchainTestWrapper) addNewBlock(block *protos.Block, stateHash []byte) uint64 {
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := db.GetDBHandle().NewWriteBatch()
 	defer writeBatch.Destroy()
 	newBlockNumber, err := testWrapper.blockchain.addPersistenceChangesForNewBlock(context.TODO(), block, stateHash, writeBatch)
 	testutil.AssertNoError(testWrapper.t, err, "Error while adding a new block")
@@ -98,6 +105,29 @@ func (testWrapper *blockchainTestWrapper) getTransactionByUUID(txUUID string) *p
 	testutil.AssertNoError(testWrapper.t, err, "Error while getting tx from blockchain")
 	return tx
 }
+
+func (testWrapper *blockchainTestWrapper) getTransactionsByAddress(address string, fromBlock uint64, toBlock uint64) []*protos.Transaction {
+	page, err := testWrapper.blockchain.getTransactionIndexes(&txIndexQuery{address: address}, fromBlock, toBlock, 0)
+	testutil.AssertNoError(testWrapper.t, err, "Error while getting txs by address from blockchain")
+	return testWrapper.getTransactionsInPage(page)
+}
+
+func (testWrapper *blockchainTestWrapper) getTransactionsByChaincodeID(chaincodeID string, fromBlock uint64, toBlock uint64) []*protos.Transaction {
+	page, err := testWrapper.blockchain.getTransactionIndexes(&txIndexQuery{chaincodeID: chaincodeID}, fromBlock, toBlock, 0)
+	testutil.AssertNoError(testWrapper.t, err, "Error while getting txs by chaincodeID from blockchain")
+	return testWrapper.getTransactionsInPage(page)
+}
+
+func (testWrapper *blockchainTestWrapper) getTransactionsInPage(page *txIndexPage) []*protos.Transaction {
+	txs := []*protos.Transaction{}
+	for i, blockNumber := range page.blockNumbers {
+		for _, txIndex := range page.txIndexes[i] {
+			txs = append(txs, testWrapper.getTransaction(blockNumber, txIndex))
+		}
+	}
+	return txs
+}
+
 func (testWrapper *blockchainTestWrapper) populateBlockChainWithSampleData() (blocks []*protos.Block, hashes [][]byte, err error) {
 	var allBlocks []*protos.Block
 	var allHashes [][]byte
@@ -150,6 +180,31 @@ func buildTestTx(tb testing.TB) (*protos.Transaction, string) {
 	return tx, uuid
 }
 
+func buildTestInvokeTx(tb testing.TB, chaincodeName string, cert []byte) *protos.Transaction {
+	spec := &protos.ChaincodeInvocationSpec{ChaincodeSpec: &protos.ChaincodeSpec{
+		ChaincodeID: &protos.ChaincodeID{Name: chaincodeName},
+		CtorMsg:     &protos.ChaincodeInput{Function: "invoke"}}}
+	tx, err := protos.NewChaincodeExecute(spec, util.GenerateUUID(), protos.Transaction_CHAINCODE_INVOKE)
+	testutil.AssertNoError(tb, err, "Error while building invoke tx")
+	tx.Cert = cert
+	return tx
+}
+
+// buildTestCert returns a DER encoded self-signed certificate with the given subject common name
+func buildTestCert(tb testing.TB, commonName string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testutil.AssertNoError(tb, err, "Error while generating key")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	testutil.AssertNoError(tb, err, "Error while creating certificate")
+	return cert
+}
+
 func buildTestBlock(t *testing.T) (*protos.Block, error) {
 	transactions := []*protos.Transaction{}
 	tx, _ := buildTestTx(t)
@@ -0,0 +1,146 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/db"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+	"github.com/hyperledger/fabric/core/ledger/statemgmt/state"
+	"github.com/hyperledger/fabric/protos"
+)
+
+// The state history is kept in the indexesCF. For each key modified by a transaction, an entry
+// (chaincodeID, key, blockNumber, sequenceInBlock) -> KeyModification is added when the block is committed.
+// sequenceInBlock is the position of the modification among all modifications in the block, which
+// preserves the order of transactions that change the same key within a block.
+// The history is only complete from the block recorded under stateHistoryFromBlockKey: blocks
+// committed while the history was disabled, or received through state transfer, are not part of it.
+
+var stateHistoryFromBlockKey = []byte{prefixStateHistoryFromBlockKey}
+
+func addStateHistoryForPersistence(blockNumber uint64, txStateDeltas []*state.TxStateDelta, writeBatch db.WriteBatch) error {
+	cf := db.GetDBHandle().IndexesCF
+	sequenceInBlock := uint64(0)
+	for _, txStateDelta := range txStateDeltas {
+		delta := txStateDelta.StateDelta
+		for _, chaincodeID := range delta.GetUpdatedChaincodeIds(true) {
+			updates := delta.GetUpdates(chaincodeID)
+			for _, key := range sortedKeys(updates) {
+				updatedValue := updates[key]
+				modification := &protos.KeyModification{Uuid: txStateDelta.TxUUID, IsDelete: updatedValue.IsDelete()}
+				if !updatedValue.IsDelete() {
+					modification.Value = updatedValue.GetValue()
+				}
+				modificationBytes, err := proto.Marshal(modification)
+				if err != nil {
+					return err
+				}
+				writeBatch.PutCF(cf, encodeStateHistoryKey(chaincodeID, key, blockNumber, sequenceInBlock), modificationBytes)
+				sequenceInBlock++
+			}
+		}
+	}
+	return nil
+}
+
+// fetchStateHistoryFromDB returns the first limit modifications of the key made in blocks
+// fromBlock to toBlock (both inclusive), starting at sequence fromSequence of fromBlock.
+// A limit of zero returns all of them
+func fetchStateHistoryFromDB(chaincodeID string, key string, fromBlock uint64, fromSequence uint64, toBlock uint64, limit int) (*StateHistoryPage, error) {
+	openchainDB := db.GetDBHandle()
+	itr := openchainDB.GetIterator(openchainDB.IndexesCF)
+	defer itr.Close()
+
+	keyPrefix := encodeStateHistoryKeyPrefix(chaincodeID, key)
+	page := &StateHistoryPage{}
+	for itr.Seek(append(append(keyPrefix, encodeUint64(fromBlock)...), encodeUint64(fromSequence)...)); itr.ValidForPrefix(keyPrefix); itr.Next() {
+		blockNumber := decodeToUint64(itr.Key()[len(keyPrefix) : len(keyPrefix)+8])
+		if blockNumber > toBlock {
+			break
+		}
+		if limit > 0 && len(page.Modifications) >= limit {
+			page.HasMore = true
+			page.NextBlockNumber = blockNumber
+			page.NextSequence = decodeToUint64(itr.Key()[len(keyPrefix)+8:])
+			break
+		}
+		modification := &protos.KeyModification{}
+		err := proto.Unmarshal(itr.Value(), modification)
+		if err != nil {
+			return nil, err
+		}
+		modification.BlockNumber = blockNumber
+		page.Modifications = append(page.Modifications, modification)
+	}
+	return page, nil
+}
+
+// fetchStateHistoryFromBlock returns the block from which the state history is kept,
+// or false if it is not kept for any block yet
+func fetchStateHistoryFromBlock() (uint64, bool, error) {
+	blockNumberBytes, err := db.GetDBHandle().GetFromIndexesCF(stateHistoryFromBlockKey)
+	if err != nil || blockNumberBytes == nil {
+		return 0, false, err
+	}
+	return decodeToUint64(blockNumberBytes), true, nil
+}
+
+// addStateHistoryFromBlockForPersistence records that the state history is kept from
+// blockNumber, unless it is already kept from an earlier block
+func addStateHistoryFromBlockForPersistence(blockNumber uint64, writeBatch db.WriteBatch) error {
+	_, ok, err := fetchStateHistoryFromBlock()
+	if err != nil || ok {
+		return err
+	}
+	writeBatch.PutCF(db.GetDBHandle().IndexesCF, stateHistoryFromBlockKey, encodeUint64(blockNumber))
+	return nil
+}
+
+// deleteStateHistoryFromBlock records that the state history is not kept for the committed
+// blocks, either because it is disabled or because state transfer skipped over their changes
+func deleteStateHistoryFromBlock() error {
+	openchainDB := db.GetDBHandle()
+	writeBatch := openchainDB.NewWriteBatch()
+	defer writeBatch.Destroy()
+	writeBatch.DeleteCF(openchainDB.IndexesCF, stateHistoryFromBlockKey)
+	return openchainDB.Write(writeBatch)
+}
+
+func sortedKeys(updates map[string]*statemgmt.UpdatedValue) []string {
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func encodeStateHistoryKey(chaincodeID string, key string, blockNumber uint64, sequenceInBlock uint64) []byte {
+	historyKey := encodeStateHistoryKeyPrefix(chaincodeID, key)
+	historyKey = append(historyKey, encodeUint64(blockNumber)...)
+	return append(historyKey, encodeUint64(sequenceInBlock)...)
+}
+
+func encodeStateHistoryKeyPrefix(chaincodeID string, key string) []byte {
+	b := proto.NewBuffer([]byte{prefixStateHistoryKey})
+	b.EncodeRawBytes([]byte(chaincodeID))
+	b.EncodeRawBytes([]byte(key))
+	return b.Bytes()
+}
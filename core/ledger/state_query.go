@@ -0,0 +1,366 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ledger
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/ledger/statemgmt"
+)
+
+// A rich query is a JSON document evaluated over the values of a chaincode
+// that are JSON objects. For example
+//
+//	{
+//	  "selector": {"owner": "alice", "size": {"$gte": 10, "$lt": 20}, "address.city": "Paris"},
+//	  "sort": [{"size": "desc"}, "name"],
+//	  "limit": 10
+//	}
+//
+// returns at most 10 values whose field owner is "alice", whose field size is
+// in [10, 20) and whose nested field address.city is "Paris", the largest size
+// first and then by name. A condition is either a value, which must be equal
+// to the field, or an object of operators among $eq, $ne, $gt, $gte, $lt and
+// $lte. Ranges only compare numbers with numbers and strings with strings.
+// Without a sort, the values are returned in the order of their keys.
+// The selector is required; an empty selector matches all JSON objects.
+
+const (
+	queryOpEq  = "$eq"
+	queryOpNe  = "$ne"
+	queryOpGt  = "$gt"
+	queryOpGte = "$gte"
+	queryOpLt  = "$lt"
+	queryOpLte = "$lte"
+)
+
+type queryCondition struct {
+	field    []string
+	operator string
+	operand  interface{}
+}
+
+type querySortField struct {
+	field      []string
+	descending bool
+}
+
+type stateQuery struct {
+	conditions []queryCondition
+	sort       []querySortField
+	limit      int
+}
+
+type queryResult struct {
+	key   string
+	value []byte
+	doc   map[string]interface{}
+}
+
+func parseStateQuery(query string) (*stateQuery, error) {
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+		Sort     []interface{}          `json:"sort"`
+		Limit    int                    `json:"limit"`
+	}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		return nil, invalidQueryError("%s", err)
+	}
+	if parsed.Selector == nil {
+		return nil, invalidQueryError("a selector is required")
+	}
+	if parsed.Limit < 0 {
+		return nil, invalidQueryError("limit must not be negative")
+	}
+
+	q := &stateQuery{limit: parsed.Limit}
+	for field, condition := range parsed.Selector {
+		operators, ok := condition.(map[string]interface{})
+		if !ok || !isOperatorObject(operators) {
+			q.conditions = append(q.conditions, queryCondition{splitQueryField(field), queryOpEq, condition})
+			continue
+		}
+		for operator, operand := range operators {
+			switch operator {
+			case queryOpEq, queryOpNe:
+			case queryOpGt, queryOpGte, queryOpLt, queryOpLte:
+				if !isComparable(operand) {
+					return nil, invalidQueryError("operator %s of field %s requires a number or a string", operator, field)
+				}
+			default:
+				return nil, invalidQueryError("unknown operator %s for field %s", operator, field)
+			}
+			q.conditions = append(q.conditions, queryCondition{splitQueryField(field), operator, operand})
+		}
+	}
+
+	for _, s := range parsed.Sort {
+		switch sortField := s.(type) {
+		case string:
+			q.sort = append(q.sort, querySortField{field: splitQueryField(sortField)})
+		case map[string]interface{}:
+			if len(sortField) != 1 {
+				return nil, invalidQueryError("a sort object must have a single field")
+			}
+			for field, direction := range sortField {
+				switch direction {
+				case "asc":
+					q.sort = append(q.sort, querySortField{field: splitQueryField(field)})
+				case "desc":
+					q.sort = append(q.sort, querySortField{field: splitQueryField(field), descending: true})
+				default:
+					return nil, invalidQueryError("sort direction of field %s must be asc or desc", field)
+				}
+			}
+		default:
+			return nil, invalidQueryError("sort fields must be strings or objects")
+		}
+	}
+	return q, nil
+}
+
+func invalidQueryError(format string, args ...interface{}) error {
+	return newLedgerError(ErrorTypeInvalidArgument, "invalid query: "+fmt.Sprintf(format, args...))
+}
+
+func isOperatorObject(object map[string]interface{}) bool {
+	if len(object) == 0 {
+		return false
+	}
+	for key := range object {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func isComparable(value interface{}) bool {
+	switch value.(type) {
+	case float64, string:
+		return true
+	}
+	return false
+}
+
+func splitQueryField(field string) []string {
+	return strings.Split(field, ".")
+}
+
+// execute evaluates the query over the key-values of itr, which it closes
+func (q *stateQuery) execute(itr statemgmt.RangeScanIterator) []*queryResult {
+	defer itr.Close()
+	var results []*queryResult
+	for itr.Next() {
+		key, value := itr.GetKeyValue()
+		var doc map[string]interface{}
+		if err := json.Unmarshal(value, &doc); err != nil || doc == nil {
+			continue
+		}
+		if q.matches(doc) {
+			results = append(results, &queryResult{key, value, doc})
+		}
+	}
+
+	// The range scan iterators do not return the keys in order
+	sort.Sort(queryResultsByKey(results))
+	if len(q.sort) > 0 {
+		sort.Stable(&queryResultsBySortFields{results, q.sort})
+	}
+	if q.limit > 0 && len(results) > q.limit {
+		results = results[:q.limit]
+	}
+	return results
+}
+
+func (q *stateQuery) matches(doc map[string]interface{}) bool {
+	for _, condition := range q.conditions {
+		value, found := lookupQueryField(doc, condition.field)
+		if !found {
+			return false
+		}
+		if !condition.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (condition *queryCondition) matches(value interface{}) bool {
+	switch condition.operator {
+	case queryOpEq:
+		return reflect.DeepEqual(value, condition.operand)
+	case queryOpNe:
+		return !reflect.DeepEqual(value, condition.operand)
+	}
+	cmp, ok := compareQueryValues(value, condition.operand)
+	if !ok {
+		return false
+	}
+	switch condition.operator {
+	case queryOpGt:
+		return cmp > 0
+	case queryOpGte:
+		return cmp >= 0
+	case queryOpLt:
+		return cmp < 0
+	case queryOpLte:
+		return cmp <= 0
+	}
+	return false
+}
+
+func lookupQueryField(doc map[string]interface{}, field []string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, name := range field {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[name]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compareQueryValues compares two numbers or two strings. ok is false if the
+// values are not of the same comparable type.
+func compareQueryValues(a, b interface{}) (cmp int, ok bool) {
+	switch av := a.(type) {
+	case float64:
+		bv, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(av, bv), true
+	}
+	return 0, false
+}
+
+// sortRank orders values of different types when sorting: a missing field
+// first, then null, booleans, numbers, strings, arrays and objects
+func sortRank(value interface{}, found bool) int {
+	if !found {
+		return 0
+	}
+	switch value.(type) {
+	case nil:
+		return 1
+	case bool:
+		return 2
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+type queryResultsByKey []*queryResult
+
+func (r queryResultsByKey) Len() int           { return len(r) }
+func (r queryResultsByKey) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r queryResultsByKey) Less(i, j int) bool { return r[i].key < r[j].key }
+
+type queryResultsBySortFields struct {
+	results []*queryResult
+	fields  []querySortField
+}
+
+func (r *queryResultsBySortFields) Len() int {
+	return len(r.results)
+}
+
+func (r *queryResultsBySortFields) Swap(i, j int) {
+	r.results[i], r.results[j] = r.results[j], r.results[i]
+}
+
+func (r *queryResultsBySortFields) Less(i, j int) bool {
+	for _, sortField := range r.fields {
+		a, aFound := lookupQueryField(r.results[i].doc, sortField.field)
+		b, bFound := lookupQueryField(r.results[j].doc, sortField.field)
+		cmp := sortRank(a, aFound) - sortRank(b, bFound)
+		if cmp == 0 {
+			if c, ok := compareQueryValues(a, b); ok {
+				cmp = c
+			} else if aBool, ok := a.(bool); ok && aBool != b.(bool) {
+				// false sorts before true
+				if aBool {
+					cmp = 1
+				} else {
+					cmp = -1
+				}
+			}
+		}
+		if cmp != 0 {
+			if sortField.descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+	}
+	return false
+}
+
+// queryResultsIterator returns the results of a rich query through the
+// RangeScanIterator interface, so that they can be consumed as a range query
+type queryResultsIterator struct {
+	results []*queryResult
+	current int
+}
+
+func newQueryResultsIterator(results []*queryResult) *queryResultsIterator {
+	return &queryResultsIterator{results, -1}
+}
+
+// Next - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *queryResultsIterator) Next() bool {
+	if itr.current < len(itr.results) {
+		itr.current++
+	}
+	return itr.current < len(itr.results)
+}
+
+// GetKeyValue - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *queryResultsIterator) GetKeyValue() (string, []byte) {
+	result := itr.results[itr.current]
+	return result.key, result.value
+}
+
+// Close - see interface 'statemgmt.RangeScanIterator' for details
+func (itr *queryResultsIterator) Close() {
+	itr.results = nil
+}
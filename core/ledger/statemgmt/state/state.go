@@ -26,7 +26,6 @@ import (
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/raw"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt/trie"
 	"github.com/op/go-logging"
-	"github.com/tecbot/gorocksdb"
 )
 
 var logger = logging.MustGetLogger("state")
@@ -35,6 +34,12 @@ const detaultStateImpl = "buckettree"
 
 var stateImpl statemgmt.HashableState
 
+// TxStateDelta holds the state changes made by a single successful transaction
+type TxStateDelta struct {
+	TxUUID     string
+	StateDelta *statemgmt.StateDelta
+}
+
 // State structure for maintaining world state.
 // This encapsulates a particular implementation for managing the state persistence
 // This is not thread safe
@@ -44,6 +49,7 @@ type State struct {
 	currentTxStateDelta   *statemgmt.StateDelta
 	currentTxUUID         string
 	txStateDeltaHash      map[string][]byte
+	txStateDeltas         []*TxStateDelta
 	updateStateImpl       bool
 	historyStateDeltaSize uint64
 }
@@ -67,7 +73,7 @@ func NewState() *State {
 		panic(fmt.Errorf("Error during initialization of state implementation: %s", err))
 	}
 	return &State{stateImpl, statemgmt.NewStateDelta(), statemgmt.NewStateDelta(), "", make(map[string][]byte),
-		false, uint64(deltaHistorySize)}
+		nil, false, uint64(deltaHistorySize)}
 }
 
 // TxBegin marks begin of a new tx. If a tx is already in progress, this call panics
@@ -90,6 +96,7 @@ func (state *State) TxFinish(txUUID string, txSuccessful bool) {
 			logger.Debugf("txFinish() for txUuid [%s] merging state changes", txUUID)
 			state.stateDelta.ApplyChanges(state.currentTxStateDelta)
 			state.txStateDeltaHash[txUUID] = state.currentTxStateDelta.ComputeCryptoHash()
+			state.txStateDeltas = append(state.txStateDeltas, &TxStateDelta{txUUID, state.currentTxStateDelta})
 			state.updateStateImpl = true
 		} else {
 			state.txStateDeltaHash[txUUID] = nil
@@ -247,10 +254,17 @@ func (state *State) GetTxStateDeltaHash() map[string][]byte {
 	return state.txStateDeltaHash
 }
 
+// GetTxStateDeltas returns the state changes made by each successful transaction
+// since the most recent call to ClearInMemoryChanges, in the order the transactions finished
+func (state *State) GetTxStateDeltas() []*TxStateDelta {
+	return state.txStateDeltas
+}
+
 // ClearInMemoryChanges remove from memory all the changes to state
 func (state *State) ClearInMemoryChanges(changesPersisted bool) {
 	state.stateDelta = statemgmt.NewStateDelta()
 	state.txStateDeltaHash = make(map[string][]byte)
+	state.txStateDeltas = nil
 	state.stateImpl.ClearWorkingSet(changesPersisted)
 }
 
@@ -261,7 +275,7 @@ func (state *State) getStateDelta() *statemgmt.StateDelta {
 
 // GetSnapshot returns a snapshot of the global state for the current block. stateSnapshot.Release()
 // must be called once you are done.
-func (state *State) GetSnapshot(blockNumber uint64, dbSnapshot *gorocksdb.Snapshot) (*StateSnapshot, error) {
+func (state *State) GetSnapshot(blockNumber uint64, dbSnapshot db.Snapshot) (*StateSnapshot, error) {
 	return newStateSnapshot(blockNumber, dbSnapshot)
 }
 
@@ -280,7 +294,7 @@ func (state *State) FetchStateDeltaFromDB(blockNumber uint64) (*statemgmt.StateD
 }
 
 // AddChangesForPersistence adds key-value pairs to writeBatch
-func (state *State) AddChangesForPersistence(blockNumber uint64, writeBatch *gorocksdb.WriteBatch) {
+func (state *State) AddChangesForPersistence(blockNumber uint64, writeBatch db.WriteBatch) {
 	logger.Debug("state.addChangesForPersistence()...start")
 	if state.updateStateImpl {
 		state.stateImpl.PrepareWorkingSet(state.stateDelta)
@@ -319,12 +333,10 @@ func (state *State) CommitStateDelta() error {
 		state.updateStateImpl = false
 	}
 
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := db.GetDBHandle().NewWriteBatch()
 	defer writeBatch.Destroy()
 	state.stateImpl.AddChangesForPersistence(writeBatch)
-	opt := gorocksdb.NewDefaultWriteOptions()
-	defer opt.Destroy()
-	return db.GetDBHandle().DB.Write(opt, writeBatch)
+	return db.GetDBHandle().Write(writeBatch)
 }
 
 // DeleteState deletes ALL state keys/values from the DB. This is generally
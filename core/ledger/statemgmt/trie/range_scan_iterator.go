@@ -19,12 +19,11 @@ package trie
 import (
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/hyperledger/fabric/core/ledger/statemgmt"
-	"github.com/tecbot/gorocksdb"
 )
 
 // RangeScanIterator implements the interface 'statemgmt.RangeScanIterator'
 type RangeScanIterator struct {
-	dbItr        *gorocksdb.Iterator
+	dbItr        db.Iterator
 	chaincodeID  string
 	endKey       string
 	currentKey   string
@@ -48,8 +47,8 @@ func (itr *RangeScanIterator) Next() bool {
 
 		// making a copy of key-value bytes because, underlying key bytes are reused by itr.
 		// no need to free slices as iterator frees memory when closed.
-		trieKeyBytes := statemgmt.Copy(itr.dbItr.Key().Data())
-		trieNodeBytes := statemgmt.Copy(itr.dbItr.Value().Data())
+		trieKeyBytes := statemgmt.Copy(itr.dbItr.Key())
+		trieNodeBytes := statemgmt.Copy(itr.dbItr.Value())
 		value := unmarshalTrieNodeValue(trieNodeBytes)
 		if value == nil {
 			continue
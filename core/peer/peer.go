@@ -208,6 +208,21 @@ type Engine interface {
 	//GetInputChannel() (chan<- *pb.Transaction, error)
 }
 
+// ConsensusStatusReporter is implemented by engines which can report the state of their consensus plugin
+type ConsensusStatusReporter interface {
+	GetConsensusStatus() (*pb.ConsensusStatus, error)
+}
+
+// ConsensusEvidenceCollector is implemented by engines whose consensus plugin collects evidence of misbehaving validators
+type ConsensusEvidenceCollector interface {
+	GetConsensusEvidence() ([]*pb.ConsensusEvidence, error)
+}
+
+// ConsensusReconfigurer is implemented by engines whose consensus plugin supports changing the replica set
+type ConsensusReconfigurer interface {
+	ReconfigureConsensus(replicas []uint64, f int) error
+}
+
 // NewPeerWithHandler returns a Peer which uses the supplied handler factory function for creating new handlers on new Chat service invocations.
 func NewPeerWithHandler(secHelperFunc func() crypto.Peer, handlerFact HandlerFactory) (*PeerImpl, error) {
 	peer := new(PeerImpl)
@@ -316,6 +331,42 @@ func (p *PeerImpl) GetPeers() (*pb.PeersMessage, error) {
 	return peersMessage, nil
 }
 
+// GetConsensusStatus returns a snapshot of the state of the consensus plugin of this peer
+func (p *PeerImpl) GetConsensusStatus() (*pb.ConsensusStatus, error) {
+	if !p.isValidator {
+		return nil, fmt.Errorf("This peer is not a validator, it does not run consensus")
+	}
+	reporter, ok := p.engine.(ConsensusStatusReporter)
+	if !ok {
+		return nil, fmt.Errorf("The consensus engine of this peer does not report its status")
+	}
+	return reporter.GetConsensusStatus()
+}
+
+// GetConsensusEvidence returns the evidence of misbehaving validators the consensus plugin of this peer collected
+func (p *PeerImpl) GetConsensusEvidence() ([]*pb.ConsensusEvidence, error) {
+	if !p.isValidator {
+		return nil, fmt.Errorf("This peer is not a validator, it does not run consensus")
+	}
+	collector, ok := p.engine.(ConsensusEvidenceCollector)
+	if !ok {
+		return nil, fmt.Errorf("The consensus engine of this peer does not collect evidence")
+	}
+	return collector.GetConsensusEvidence()
+}
+
+// ReconfigureConsensus requests that the consensus plugin of this peer switch the network to a new replica set
+func (p *PeerImpl) ReconfigureConsensus(replicas []uint64, f int) error {
+	if !p.isValidator {
+		return fmt.Errorf("This peer is not a validator, it does not run consensus")
+	}
+	reconfigurer, ok := p.engine.(ConsensusReconfigurer)
+	if !ok {
+		return fmt.Errorf("The consensus engine of this peer does not support reconfiguration")
+	}
+	return reconfigurer.ReconfigureConsensus(replicas, f)
+}
+
 func getPeerAddresses(peersMsg *pb.PeersMessage) []string {
 	peers := peersMsg.GetPeers()
 	addresses := make([]string, len(peers))
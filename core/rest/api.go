@@ -38,6 +38,7 @@ var (
 type PeerInfo interface {
 	GetPeers() (*pb.PeersMessage, error)
 	GetPeerEndpoint() (*pb.PeerEndpoint, error)
+	GetConsensusStatus() (*pb.ConsensusStatus, error)
 }
 
 // ServerOpenchain defines the Openchain server object, which holds the
@@ -96,10 +97,57 @@ func (s *ServerOpenchain) GetBlockByNumber(ctx context.Context, num *pb.BlockNum
 		}
 	}
 
-	// Remove payload from deploy transactions. This is done to make rest api
-	// calls more lightweight as the payload for these types of transactions
-	// can be very large. If the payload is needed, the caller should fetch the
-	// individual transaction.
+	if err = removeCodePackages(block); err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// GetBlocks returns a page of the blocks in fromBlock to toBlock that contain a
+// transaction matching the filter. The code packages are removed as in
+// GetBlockByNumber, and with headersOnly all the transactions are removed.
+func (s *ServerOpenchain) GetBlocks(ctx context.Context, fromBlock, toBlock uint64, filter *ledger.TransactionFilter, limit int, headersOnly bool) (*ledger.BlocksPage, error) {
+	page, err := s.ledger.GetBlocks(fromBlock, toBlock, filter, limit)
+	if err != nil {
+		switch err {
+		case ledger.ErrOutOfBounds:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving blocks from blockchain: %s", err)
+		}
+	}
+	for _, block := range page.Blocks {
+		if headersOnly {
+			block.Transactions = nil
+		} else if err = removeCodePackages(block); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// GetTransactions returns a page of the transactions matching the filter in
+// blocks fromBlock to toBlock
+func (s *ServerOpenchain) GetTransactions(ctx context.Context, fromBlock, toBlock uint64, filter *ledger.TransactionFilter, limit int) (*ledger.TransactionsPage, error) {
+	page, err := s.ledger.GetTransactions(fromBlock, toBlock, filter, limit)
+	if err != nil {
+		switch err {
+		case ledger.ErrOutOfBounds:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving transactions from blockchain: %s", err)
+		}
+	}
+	return page, nil
+}
+
+// removeCodePackages removes the code package from the payload of the deploy
+// and upgrade transactions of a block. This is done to make rest api calls
+// more lightweight as the payload for these types of transactions can be very
+// large. If the payload is needed, the caller should fetch the individual
+// transaction.
+func removeCodePackages(block *pb.Block) error {
 	blockTransactions := block.GetTransactions()
 	for _, transaction := range blockTransactions {
 		if transaction.Type == pb.Transaction_CHAINCODE_DEPLOY {
@@ -107,7 +155,7 @@ func (s *ServerOpenchain) GetBlockByNumber(ctx context.Context, num *pb.BlockNum
 			err := proto.Unmarshal(transaction.Payload, deploymentSpec)
 			if err != nil {
 				if !viper.GetBool("security.privacy") {
-					return nil, err
+					return err
 				}
 				//if privacy is enabled, payload is encrypted and unmarshal will
 				//likely fail... given we were going to just set the CodePackage
@@ -117,13 +165,27 @@ func (s *ServerOpenchain) GetBlockByNumber(ctx context.Context, num *pb.BlockNum
 			deploymentSpec.CodePackage = nil
 			deploymentSpecBytes, err := proto.Marshal(deploymentSpec)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			transaction.Payload = deploymentSpecBytes
+		} else if transaction.Type == pb.Transaction_CHAINCODE_UPGRADE {
+			// upgrade transactions are always public
+			upgradeSpec := &pb.ChaincodeUpgradeSpec{}
+			err := proto.Unmarshal(transaction.Payload, upgradeSpec)
+			if err != nil {
+				return err
+			}
+			if upgradeSpec.ChaincodeDeploymentSpec != nil {
+				upgradeSpec.ChaincodeDeploymentSpec.CodePackage = nil
+			}
+			upgradeSpecBytes, err := proto.Marshal(upgradeSpec)
+			if err != nil {
+				return err
+			}
+			transaction.Payload = upgradeSpecBytes
 		}
 	}
-
-	return block, nil
+	return nil
 }
 
 // GetBlockCount returns the current number of blocks in the blockchain data
@@ -148,6 +210,21 @@ func (s *ServerOpenchain) GetState(ctx context.Context, chaincodeID, key string)
 	return s.ledger.GetState(chaincodeID, key, true)
 }
 
+// GetStateHistory returns the modifications made to a particular chaincode ID and
+// key by the transactions committed in blocks fromBlock to toBlock
+func (s *ServerOpenchain) GetStateHistory(ctx context.Context, chaincodeID, key string, fromBlock, toBlock uint64) ([]*pb.KeyModification, error) {
+	modifications, err := s.ledger.GetStateHistory(chaincodeID, key, fromBlock, toBlock)
+	if err != nil {
+		switch err {
+		case ledger.ErrOutOfBounds:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving state history: %s", err)
+		}
+	}
+	return modifications, nil
+}
+
 // GetTransactionByUUID returns a transaction matching the specified UUID
 func (s *ServerOpenchain) GetTransactionByUUID(ctx context.Context, txUUID string) (*pb.Transaction, error) {
 	transaction, err := s.ledger.GetTransactionByUUID(txUUID)
@@ -162,11 +239,31 @@ func (s *ServerOpenchain) GetTransactionByUUID(ctx context.Context, txUUID strin
 	return transaction, nil
 }
 
+// GetTransactionResultByUUID returns the result of the transaction matching the specified UUID
+// once its block is committed
+func (s *ServerOpenchain) GetTransactionResultByUUID(ctx context.Context, txUUID string) (*pb.TransactionResult, error) {
+	result, err := s.ledger.GetTransactionResultByUUID(txUUID)
+	if err != nil {
+		switch err {
+		case ledger.ErrResourceNotFound:
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("Error retrieving transaction result from blockchain: %s", err)
+		}
+	}
+	return result, nil
+}
+
 // GetPeers returns a list of all peer nodes currently connected to the target peer.
 func (s *ServerOpenchain) GetPeers(ctx context.Context, e *google_protobuf.Empty) (*pb.PeersMessage, error) {
 	return s.peerInfo.GetPeers()
 }
 
+// GetConsensusStatus returns a snapshot of the state of the consensus plugin of the target peer.
+func (s *ServerOpenchain) GetConsensusStatus(ctx context.Context, e *google_protobuf.Empty) (*pb.ConsensusStatus, error) {
+	return s.peerInfo.GetConsensusStatus()
+}
+
 // GetPeerEndpoint returns PeerEndpoint info of target peer.
 func (s *ServerOpenchain) GetPeerEndpoint(ctx context.Context, e *google_protobuf.Empty) (*pb.PeersMessage, error) {
 	peers := []*pb.PeerEndpoint{}
@@ -65,6 +65,11 @@ func (p *peerInfo) GetPeers() (*protos.PeersMessage, error) {
 	return peersMessage, nil
 }
 
+func (p *peerInfo) GetConsensusStatus() (*protos.ConsensusStatus, error) {
+	status := &protos.ConsensusStatus{Plugin: "pbft", Replicas: []uint64{0, 1, 2, 3}, F: 1, View: 1, Primary: 1, HighWatermark: 40}
+	return status, nil
+}
+
 func (p *peerInfo) GetPeerEndpoint() (*protos.PeerEndpoint, error) {
 	pe := &protos.PeerEndpoint{ID: &protos.PeerID{Name: viper.GetString("peer.id")}, Address: "localhost:30303", Type: protos.PeerEndpoint_VALIDATOR}
 	return pe, nil
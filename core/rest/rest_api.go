@@ -17,18 +17,21 @@ limitations under the License.
 package rest
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"google/protobuf"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -42,6 +45,7 @@ import (
 	"github.com/hyperledger/fabric/core/comm"
 	"github.com/hyperledger/fabric/core/crypto"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/core/ledger"
 	pb "github.com/hyperledger/fabric/protos"
 )
 
@@ -74,12 +78,61 @@ type tcertsResult struct {
 	OK []string
 }
 
+// blocksResult defines the response payload for the GetBlocks REST interface
+// request. ContinuationToken is set if more blocks match the query.
+type blocksResult struct {
+	Blocks            []*numberedBlock `json:"blocks"`
+	ContinuationToken string           `json:"continuationToken,omitempty"`
+}
+
+// numberedBlock is a block with its number within the blockchain.
+type numberedBlock struct {
+	Number uint64    `json:"number"`
+	Block  *pb.Block `json:"block"`
+}
+
+// transactionsResult defines the response payload for the GetTransactions
+// REST interface request. ContinuationToken is set if more transactions match
+// the query.
+type transactionsResult struct {
+	Transactions      []*pb.Transaction `json:"transactions"`
+	ContinuationToken string            `json:"continuationToken,omitempty"`
+}
+
+// pageQuery holds the query parameters of the GetBlocks and GetTransactions
+// REST interface requests.
+type pageQuery struct {
+	fromBlock uint64
+	toBlock   uint64
+	limit     int
+	filter    *ledger.TransactionFilter
+}
+
+const (
+	// defaultPageLimit is the number of blocks or transactions returned by a
+	// page query without a limit
+	defaultPageLimit = 100
+
+	// maxPageLimit is the maximum limit of a page query
+	maxPageLimit = 1000
+)
+
 // rpcRequest defines the JSON RPC 2.0 request payload for the /chaincode endpoint.
 type rpcRequest struct {
-	Jsonrpc *string           `json:"jsonrpc,omitempty"`
-	Method  *string           `json:"method,omitempty"`
-	Params  *pb.ChaincodeSpec `json:"params,omitempty"`
-	ID      *rpcID            `json:"id,omitempty"`
+	Jsonrpc *string    `json:"jsonrpc,omitempty"`
+	Method  *string    `json:"method,omitempty"`
+	Params  *rpcParams `json:"params,omitempty"`
+	ID      *rpcID     `json:"id,omitempty"`
+}
+
+// rpcParams defines the params of a JSON RPC 2.0 request for the /chaincode
+// endpoint, which is a ChaincodeSpec. For the upgrade method, the ChaincodeSpec
+// describes the new chaincode and previousChaincodeID names the chaincode to
+// upgrade, whose state is copied to the new chaincode if carryState is set.
+type rpcParams struct {
+	*pb.ChaincodeSpec
+	PreviousChaincodeID *pb.ChaincodeID `json:"previousChaincodeID,omitempty"`
+	CarryState          bool            `json:"carryState,omitempty"`
 }
 
 type rpcID struct {
@@ -154,6 +207,8 @@ var (
 	ChaincodeDeployError     = &rpcError{Code: -32001, Message: "Deployment failure", Data: "Chaincode deployment has failed."}
 	ChaincodeInvokeError     = &rpcError{Code: -32002, Message: "Invocation failure", Data: "Chaincode invocation has failed."}
 	ChaincodeQueryError      = &rpcError{Code: -32003, Message: "Query failure", Data: "Chaincode query has failed."}
+	ChaincodeUpgradeError    = &rpcError{Code: -32004, Message: "Upgrade failure", Data: "Chaincode upgrade has failed."}
+	ChaincodeTerminateError  = &rpcError{Code: -32005, Message: "Termination failure", Data: "Chaincode termination has failed."}
 )
 
 // SetOpenchainServer is a middleware function that sets the pointer to the
@@ -689,6 +744,101 @@ func (s *ServerOpenchainREST) GetBlockByNumber(rw web.ResponseWriter, req *web.R
 	encoder.Encode(block)
 }
 
+// GetBlocks returns a page of the blocks of the blockchain. The optional query
+// parameters are described in parsePageQuery. The transactions of the blocks
+// are omitted if the headersOnly query parameter is true.
+func (s *ServerOpenchainREST) GetBlocks(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+
+	query, err := parsePageQuery(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: err.Error()})
+		return
+	}
+	headersOnly := false
+	if headers := req.URL.Query().Get("headersOnly"); headers != "" {
+		if headersOnly, err = strconv.ParseBool(headers); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: "headersOnly must be a boolean."})
+			return
+		}
+	}
+
+	// Retrieve the page of blocks
+	page, err := s.server.GetBlocks(context.Background(), query.fromBlock, query.toBlock, query.filter, query.limit, headersOnly)
+	if err != nil {
+		switch err {
+		case ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: "Requested block range is not in the blockchain."})
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(restResult{Error: err.Error()})
+			restLogger.Errorf("Error retrieving blocks: %s", err)
+		}
+		return
+	}
+
+	result := blocksResult{Blocks: []*numberedBlock{}}
+	for i, block := range page.Blocks {
+		result.Blocks = append(result.Blocks, &numberedBlock{Number: page.BlockNumbers[i], Block: block})
+	}
+	if page.HasMore {
+		result.ContinuationToken = encodeContinuationToken(page.NextBlockNumber)
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(result)
+}
+
+// GetStateHistory returns the modifications made to a key of a chaincode. The
+// optional fromBlock and toBlock query parameters restrict the block range.
+func (s *ServerOpenchainREST) GetStateHistory(rw web.ResponseWriter, req *web.Request) {
+	chaincodeID := req.PathParams["chaincodeID"]
+	key := req.PathParams["key"]
+
+	encoder := json.NewEncoder(rw)
+
+	// Parse out the optional block range, which defaults to the whole blockchain
+	fromBlock, toBlock := uint64(0), uint64(math.MaxUint64)
+	var err error
+	if from := req.URL.Query().Get("fromBlock"); from != "" {
+		if fromBlock, err = strconv.ParseUint(from, 10, 64); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: "fromBlock must be an integer (uint64)."})
+			return
+		}
+	}
+	if to := req.URL.Query().Get("toBlock"); to != "" {
+		if toBlock, err = strconv.ParseUint(to, 10, 64); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			encoder.Encode(restResult{Error: "toBlock must be an integer (uint64)."})
+			return
+		}
+	}
+
+	// Retrieve the history of the key
+	modifications, err := s.server.GetStateHistory(context.Background(), chaincodeID, key, fromBlock, toBlock)
+	if err != nil {
+		switch err {
+		case ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: "Requested block range is not in the blockchain."})
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(restResult{Error: err.Error()})
+			restLogger.Errorf("Error retrieving history of key %s of chaincode %s: %s", key, chaincodeID, err)
+		}
+		return
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(&pb.GetHistoryForKeyResponse{Modifications: modifications})
+}
+
 // GetTransactionByUUID returns a transaction matching the specified UUID
 func (s *ServerOpenchainREST) GetTransactionByUUID(rw web.ResponseWriter, req *web.Request) {
 	// Parse out the transaction UUID
@@ -718,6 +868,152 @@ func (s *ServerOpenchainREST) GetTransactionByUUID(rw web.ResponseWriter, req *w
 	}
 }
 
+// GetTransactionResultByUUID returns the result of the transaction matching the
+// specified UUID once its block is committed. The result of a transaction that
+// failed is returned too, with a non-zero error code.
+func (s *ServerOpenchainREST) GetTransactionResultByUUID(rw web.ResponseWriter, req *web.Request) {
+	// Parse out the transaction UUID
+	txUUID := req.PathParams["uuid"]
+
+	// Retrieve the result of the transaction matching the UUID
+	result, err := s.server.GetTransactionResultByUUID(context.Background(), txUUID)
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for Error
+	if err != nil {
+		switch err {
+		case ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Result of transaction %s is not found.", txUUID)})
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(restResult{Error: fmt.Sprintf("Error retrieving result of transaction %s: %s.", txUUID, err)})
+			restLogger.Errorf("Error retrieving result of transaction %s: %s", txUUID, err)
+		}
+	} else {
+		// Return the transaction result
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(result)
+		restLogger.Infof("Successfully retrieved result of transaction: %s", txUUID)
+	}
+}
+
+// GetTransactions returns a page of the transactions of the blockchain. The
+// optional query parameters are described in parsePageQuery. A page never
+// splits the transactions of a block, so it may hold more than limit
+// transactions.
+// There is no invoker filter: transactions signed with a transaction
+// certificate, which is unlinkable to its owner, are not indexed by invoker.
+func (s *ServerOpenchainREST) GetTransactions(rw web.ResponseWriter, req *web.Request) {
+	encoder := json.NewEncoder(rw)
+
+	query, err := parsePageQuery(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: err.Error()})
+		return
+	}
+
+	// Retrieve the page of transactions
+	page, err := s.server.GetTransactions(context.Background(), query.fromBlock, query.toBlock, query.filter, query.limit)
+	if err != nil {
+		switch err {
+		case ErrNotFound:
+			rw.WriteHeader(http.StatusNotFound)
+			encoder.Encode(restResult{Error: "Requested block range is not in the blockchain."})
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+			encoder.Encode(restResult{Error: err.Error()})
+			restLogger.Errorf("Error retrieving transactions: %s", err)
+		}
+		return
+	}
+
+	result := transactionsResult{Transactions: page.Transactions}
+	if result.Transactions == nil {
+		result.Transactions = []*pb.Transaction{}
+	}
+	if page.HasMore {
+		result.ContinuationToken = encodeContinuationToken(page.NextBlockNumber)
+	}
+
+	// Success
+	rw.WriteHeader(http.StatusOK)
+	encoder.Encode(result)
+}
+
+// parsePageQuery parses the query parameters of a page query:
+//  - fromBlock and toBlock restrict the block range, which defaults to the
+//    whole blockchain
+//  - limit is the maximum number of blocks or transactions to return
+//  - continuationToken is the token returned with the previous page, which
+//    replaces fromBlock. The other parameters must be repeated
+//  - chaincodeID and type select the transactions with this chaincode name
+//    and this type (e.g., CHAINCODE_INVOKE)
+//  - fromTime and toTime select the transactions of the blocks committed by
+//    the peer in this time window, in RFC 3339 format
+func parsePageQuery(req *web.Request) (*pageQuery, error) {
+	values := req.URL.Query()
+	query := &pageQuery{toBlock: math.MaxUint64, limit: defaultPageLimit, filter: &ledger.TransactionFilter{}}
+	var err error
+
+	if from := values.Get("fromBlock"); from != "" {
+		if query.fromBlock, err = strconv.ParseUint(from, 10, 64); err != nil {
+			return nil, errors.New("fromBlock must be an integer (uint64).")
+		}
+	}
+	if to := values.Get("toBlock"); to != "" {
+		if query.toBlock, err = strconv.ParseUint(to, 10, 64); err != nil {
+			return nil, errors.New("toBlock must be an integer (uint64).")
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.limit, err = strconv.Atoi(limit); err != nil || query.limit <= 0 || query.limit > maxPageLimit {
+			return nil, fmt.Errorf("limit must be an integer between 1 and %d.", maxPageLimit)
+		}
+	}
+	if token := values.Get("continuationToken"); token != "" {
+		if query.fromBlock, err = decodeContinuationToken(token); err != nil {
+			return nil, errors.New("Invalid continuationToken.")
+		}
+	}
+
+	query.filter.ChaincodeID = values.Get("chaincodeID")
+	if txType := values.Get("type"); txType != "" {
+		value, ok := pb.Transaction_Type_value[txType]
+		if !ok || value == int32(pb.Transaction_UNDEFINED) {
+			return nil, fmt.Errorf("Invalid transaction type %s.", txType)
+		}
+		query.filter.Type = pb.Transaction_Type(value)
+	}
+	if fromTime := values.Get("fromTime"); fromTime != "" {
+		if query.filter.FromTime, err = time.Parse(time.RFC3339Nano, fromTime); err != nil {
+			return nil, errors.New("fromTime must be a time in RFC 3339 format.")
+		}
+	}
+	if toTime := values.Get("toTime"); toTime != "" {
+		if query.filter.ToTime, err = time.Parse(time.RFC3339Nano, toTime); err != nil {
+			return nil, errors.New("toTime must be a time in RFC 3339 format.")
+		}
+	}
+	return query, nil
+}
+
+// encodeContinuationToken returns an opaque token for the page of a query
+// that starts at the given block
+func encodeContinuationToken(nextBlockNumber uint64) string {
+	return base64.URLEncoding.EncodeToString([]byte(strconv.FormatUint(nextBlockNumber, 10)))
+}
+
+func decodeContinuationToken(token string) (uint64, error) {
+	decoded, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(decoded), 10, 64)
+}
+
 // Deploy first builds the chaincode package and subsequently deploys it to the
 // blockchain.
 //
@@ -1244,7 +1540,8 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 		return
 	}
 
-	// Insure that the JSON method string is present and is either deploy, invoke or query
+	// Insure that the JSON method string is present and is one of deploy, invoke,
+	// query, upgrade or terminate
 	if requestPayload.Method == nil {
 		// If the request is not a notification, produce a response.
 		if !notification {
@@ -1256,7 +1553,8 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 		restLogger.Error("Missing JSON RPC 2.0 method string.")
 
 		return
-	} else if (*(requestPayload.Method) != "deploy") && (*(requestPayload.Method) != "invoke") && (*(requestPayload.Method) != "query") {
+	} else if (*(requestPayload.Method) != "deploy") && (*(requestPayload.Method) != "invoke") && (*(requestPayload.Method) != "query") &&
+		(*(requestPayload.Method) != "upgrade") && (*(requestPayload.Method) != "terminate") {
 		// If the request is not a notification, produce a response.
 		if !notification {
 			// Format the error appropriately and produce JSON RPC 2.0 response
@@ -1276,6 +1574,12 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 	// Variable that will hold the execution result
 	var result rpcResult
 
+	// The ChaincodeSpec message of the params field
+	var paramsSpec *pb.ChaincodeSpec
+	if requestPayload.Params != nil {
+		paramsSpec = requestPayload.Params.ChaincodeSpec
+	}
+
 	if *(requestPayload.Method) == "deploy" {
 
 		//
@@ -1283,7 +1587,7 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 		//
 
 		// Payload params field must contain a ChaincodeSpec message
-		if requestPayload.Params == nil {
+		if paramsSpec == nil {
 			// If the request is not a notification, produce a response.
 			if !notification {
 				// Format the error appropriately and produce JSON RPC 2.0 response
@@ -1297,10 +1601,36 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 		}
 
 		// Extract the ChaincodeSpec from the params field
-		deploySpec := requestPayload.Params
+		deploySpec := paramsSpec
 
 		// Process the chaincode deployment request and record the result
 		result = s.processChaincodeDeploy(deploySpec)
+	} else if *(requestPayload.Method) == "upgrade" || *(requestPayload.Method) == "terminate" {
+
+		//
+		// Chaincode upgrade/termination was requested
+		//
+
+		// Payload params field must contain a ChaincodeSpec message
+		if paramsSpec == nil {
+			// If the request is not a notification, produce a response.
+			if !notification {
+				// Format the error appropriately and produce JSON RPC 2.0 response
+				errObj := formatRPCError(InvalidParams.Code, InvalidParams.Message, fmt.Sprintf("Client must supply ChaincodeSpec for chaincode %s request.", *(requestPayload.Method)))
+				rw.WriteHeader(http.StatusBadRequest)
+				encoder.Encode(formatRPCResponse(errObj, requestPayload.ID))
+			}
+			restLogger.Errorf("Client must supply ChaincodeSpec for chaincode %s request.", *(requestPayload.Method))
+
+			return
+		}
+
+		// Process the chaincode upgrade/termination request and record the result
+		if *(requestPayload.Method) == "upgrade" {
+			result = s.processChaincodeUpgrade(requestPayload.Params)
+		} else {
+			result = s.processChaincodeTerminate(paramsSpec)
+		}
 	} else {
 
 		//
@@ -1310,7 +1640,7 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 		// Because chaincode invocation/query requests require a ChaincodeInvocationSpec
 		// message instead of a ChaincodeSpec message, we must initialize it here
 		// before  proceeding.
-		invokequeryPayload := &pb.ChaincodeInvocationSpec{ChaincodeSpec: requestPayload.Params}
+		invokequeryPayload := &pb.ChaincodeInvocationSpec{ChaincodeSpec: paramsSpec}
 
 		// Payload params field must contain a ChaincodeSpec message
 		if invokequeryPayload.ChaincodeSpec == nil {
@@ -1343,9 +1673,9 @@ func (s *ServerOpenchainREST) ProcessChaincode(rw web.ResponseWriter, req *web.R
 		rw.Write(jsonResponse)
 	}
 
-	// Make a clarification in the invoke response message, that the transaction has been successfully submitted but not completed
-	if *(requestPayload.Method) == "invoke" {
-		restLogger.Infof("REST successfully submitted invoke transaction: %s", string(jsonResponse))
+	// Make a clarification in the invoke and terminate response messages, that the transaction has been successfully submitted but not completed
+	if *(requestPayload.Method) == "invoke" || *(requestPayload.Method) == "terminate" {
+		restLogger.Infof("REST successfully submitted %s transaction: %s", *(requestPayload.Method), string(jsonResponse))
 	} else {
 		restLogger.Infof("REST successfully %s chaincode: %s", *(requestPayload.Method), string(jsonResponse))
 	}
@@ -1412,59 +1742,13 @@ func (s *ServerOpenchainREST) processChaincodeDeploy(spec *pb.ChaincodeSpec) rpc
 	// Check if security is enabled
 	//
 
-	if core.SecurityEnabled() {
-		// User registrationID must be present inside request payload with security enabled
-		chaincodeUsr := spec.SecureContext
-		if chaincodeUsr == "" {
-			// Format the error appropriately for further processing
-			error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Must supply username for chaincode when security is enabled.")
-			restLogger.Error("Must supply username for chaincode when security is enabled.")
-
-			return error
-		}
-
-		// Retrieve the REST data storage path
-		// Returns /var/hyperledger/production/client/
-		localStore := getRESTFilePath()
-
-		// Check if the user is logged in before sending transaction
-		if _, err := os.Stat(localStore + "loginToken_" + chaincodeUsr); err == nil {
-			// No error returned, therefore token exists so user is already logged in
-			restLogger.Infof("Local user '%s' is already logged in. Retrieving login token.", chaincodeUsr)
-
-			// Read in the login token
-			token, err := ioutil.ReadFile(localStore + "loginToken_" + chaincodeUsr)
-			if err != nil {
-				// Format the error appropriately for further processing
-				error := formatRPCError(InternalError.Code, InternalError.Message, fmt.Sprintf("Fatal error when reading client login token: %s", err))
-				restLogger.Errorf("Fatal error when reading client login token: %s", err)
-
-				return error
-			}
-
-			// Add the login token to the chaincodeSpec
-			spec.SecureContext = string(token)
-
-			// If privacy is enabled, mark chaincode as confidential
-			if viper.GetBool("security.privacy") {
-				spec.ConfidentialityLevel = pb.ConfidentialityLevel_CONFIDENTIAL
-			}
-		} else {
-			// Check if the token is not there and fail
-			if os.IsNotExist(err) {
-				// Format the error appropriately for further processing
-				error := formatRPCError(MissingRegistrationError.Code, MissingRegistrationError.Message, MissingRegistrationError.Data)
-				restLogger.Error(MissingRegistrationError.Data)
-
-				return error
-			}
-			// Unexpected error
-			// Format the error appropriately for further processing
-			error := formatRPCError(InternalError.Code, InternalError.Message, fmt.Sprintf("Unexpected fatal error when checking for client login token: %s", err))
-			restLogger.Errorf("Unexpected fatal error when checking for client login token: %s", err)
+	if result, ok := setChaincodeSecureContext(spec); !ok {
+		return result
+	}
 
-			return error
-		}
+	// If privacy is enabled, mark chaincode as confidential
+	if core.SecurityEnabled() && viper.GetBool("security.privacy") {
+		spec.ConfidentialityLevel = pb.ConfidentialityLevel_CONFIDENTIAL
 	}
 
 	//
@@ -1536,59 +1820,13 @@ func (s *ServerOpenchainREST) processChaincodeInvokeOrQuery(method string, spec
 	// Check if security is enabled
 	//
 
-	if core.SecurityEnabled() {
-		// User registrationID must be present inside request payload with security enabled
-		chaincodeUsr := spec.ChaincodeSpec.SecureContext
-		if chaincodeUsr == "" {
-			// Format the error appropriately for further processing
-			error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Must supply username for chaincode when security is enabled.")
-			restLogger.Error("Must supply username for chaincode when security is enabled.")
-
-			return error
-		}
-
-		// Retrieve the REST data storage path
-		// Returns /var/hyperledger/production/client/
-		localStore := getRESTFilePath()
-
-		// Check if the user is logged in before sending transaction
-		if _, err := os.Stat(localStore + "loginToken_" + chaincodeUsr); err == nil {
-			// No error returned, therefore token exists so user is already logged in
-			restLogger.Infof("Local user '%s' is already logged in. Retrieving login token.\n", chaincodeUsr)
-
-			// Read in the login token
-			token, err := ioutil.ReadFile(localStore + "loginToken_" + chaincodeUsr)
-			if err != nil {
-				// Format the error appropriately for further processing
-				error := formatRPCError(InternalError.Code, InternalError.Message, fmt.Sprintf("Fatal error when reading client login token: %s", err))
-				restLogger.Errorf("Fatal error when reading client login token: %s", err)
-
-				return error
-			}
-
-			// Add the login token to the chaincodeSpec
-			spec.ChaincodeSpec.SecureContext = string(token)
-
-			// If privacy is enabled, mark chaincode as confidential
-			if viper.GetBool("security.privacy") {
-				spec.ChaincodeSpec.ConfidentialityLevel = pb.ConfidentialityLevel_CONFIDENTIAL
-			}
-		} else {
-			// Check if the token is not there and fail
-			if os.IsNotExist(err) {
-				// Format the error appropriately for further processing
-				error := formatRPCError(MissingRegistrationError.Code, MissingRegistrationError.Message, MissingRegistrationError.Data)
-				restLogger.Error(MissingRegistrationError.Data)
-
-				return error
-			}
-			// Unexpected error
-			// Format the error appropriately for further processing
-			error := formatRPCError(InternalError.Code, InternalError.Message, fmt.Sprintf("Unexpected fatal error when checking for client login token: %s", err))
-			restLogger.Errorf("Unexpected fatal error when checking for client login token: %s", err)
+	if result, ok := setChaincodeSecureContext(spec.ChaincodeSpec); !ok {
+		return result
+	}
 
-			return error
-		}
+	// If privacy is enabled, mark chaincode as confidential
+	if core.SecurityEnabled() && viper.GetBool("security.privacy") {
+		spec.ChaincodeSpec.ConfidentialityLevel = pb.ConfidentialityLevel_CONFIDENTIAL
 	}
 
 	//
@@ -1671,6 +1909,191 @@ func (s *ServerOpenchainREST) processChaincodeInvokeOrQuery(method string, spec
 	return result
 }
 
+// processChaincodeUpgrade triggers chaincode upgrade and returns a result or an error
+func (s *ServerOpenchainREST) processChaincodeUpgrade(params *rpcParams) rpcResult {
+	restLogger.Info("REST upgrading chaincode...")
+	spec := params.ChaincodeSpec
+
+	// Check that the chaincode to upgrade is named.
+	if (params.PreviousChaincodeID == nil) || (params.PreviousChaincodeID.Name == "") {
+		// Format the error appropriately for further processing
+		error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Payload must contain a previousChaincodeID with the name of the chaincode to upgrade.")
+		restLogger.Error("Payload must contain a previousChaincodeID with the name of the chaincode to upgrade.")
+
+		return error
+	}
+
+	// Check that the ChaincodeID of the new chaincode is not nil.
+	if spec.ChaincodeID == nil {
+		// Format the error appropriately for further processing
+		error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Payload must contain a ChaincodeID.")
+		restLogger.Error("Payload must contain a ChaincodeID.")
+
+		return error
+	}
+
+	// Check that the CtorMsg is not left blank.
+	if (spec.CtorMsg == nil) || (spec.CtorMsg.Function == "") {
+		// Format the error appropriately for further processing
+		error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Payload must contain a CtorMsg with a Chaincode function name.")
+		restLogger.Error("Payload must contain a CtorMsg with a Chaincode function name.")
+
+		return error
+	}
+
+	//
+	// Check if security is enabled
+	//
+
+	if result, ok := setChaincodeSecureContext(spec); !ok {
+		return result
+	}
+
+	//
+	// Trigger the chaincode upgrade through the devops service
+	//
+	upgradeSpec := &pb.ChaincodeUpgradeSpec{
+		ChaincodeDeploymentSpec: &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec},
+		PreviousChaincodeID:     params.PreviousChaincodeID,
+		CarryState:              params.CarryState,
+	}
+	chaincodeDeploymentSpec, err := s.devops.Upgrade(context.Background(), upgradeSpec)
+
+	//
+	// Upgrade failed
+	//
+
+	if err != nil {
+		// Format the error appropriately for further processing
+		error := formatRPCError(ChaincodeUpgradeError.Code, ChaincodeUpgradeError.Message, fmt.Sprintf("Error when upgrading chaincode: %s", err))
+		restLogger.Errorf("Error when upgrading chaincode: %s", err)
+
+		return error
+	}
+
+	//
+	// Upgrade succeeded
+	//
+
+	// Clients will need the name of the new chaincode in order to invoke or query it, record it
+	chainID := chaincodeDeploymentSpec.ChaincodeSpec.ChaincodeID.Name
+
+	result := formatRPCOK(chainID)
+	restLogger.Infof("Successfully upgraded chainCode %s to %s", params.PreviousChaincodeID.Name, chainID)
+
+	return result
+}
+
+// processChaincodeTerminate triggers chaincode termination and returns a result or an error
+func (s *ServerOpenchainREST) processChaincodeTerminate(spec *pb.ChaincodeSpec) rpcResult {
+	restLogger.Info("REST terminating chaincode...")
+
+	// Check that the Chaincode name is not blank.
+	if (spec.ChaincodeID == nil) || (spec.ChaincodeID.Name == "") {
+		// Format the error appropriately for further processing
+		error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Payload must contain a ChaincodeID with the Chaincode name.")
+		restLogger.Error("Payload must contain a ChaincodeID with the Chaincode name.")
+
+		return error
+	}
+
+	//
+	// Check if security is enabled
+	//
+
+	if result, ok := setChaincodeSecureContext(spec); !ok {
+		return result
+	}
+
+	//
+	// Trigger the chaincode termination through the devops service
+	//
+	resp, err := s.devops.Terminate(context.Background(), spec)
+
+	//
+	// Termination failed
+	//
+
+	if err != nil {
+		// Format the error appropriately for further processing
+		error := formatRPCError(ChaincodeTerminateError.Code, ChaincodeTerminateError.Message, fmt.Sprintf("Error when terminating chaincode: %s", err))
+		restLogger.Errorf("Error when terminating chaincode: %s", err)
+
+		return error
+	}
+
+	//
+	// Termination submitted
+	//
+
+	// Clients will need the txuuid in order to track the termination, record it
+	txuuid := string(resp.Msg)
+
+	result := formatRPCOK(txuuid)
+	restLogger.Infof("Successfully submitted terminate transaction with txuuid (%s)", txuuid)
+
+	return result
+}
+
+// setChaincodeSecureContext replaces the username in the SecureContext of the
+// spec with the login token of the user when security is enabled. If the token
+// cannot be read, ok is false and the error is returned as result.
+func setChaincodeSecureContext(spec *pb.ChaincodeSpec) (result rpcResult, ok bool) {
+	if !core.SecurityEnabled() {
+		return result, true
+	}
+
+	// User registrationID must be present inside request payload with security enabled
+	chaincodeUsr := spec.SecureContext
+	if chaincodeUsr == "" {
+		// Format the error appropriately for further processing
+		error := formatRPCError(InvalidParams.Code, InvalidParams.Message, "Must supply username for chaincode when security is enabled.")
+		restLogger.Error("Must supply username for chaincode when security is enabled.")
+
+		return error, false
+	}
+
+	// Retrieve the REST data storage path
+	// Returns /var/hyperledger/production/client/
+	localStore := getRESTFilePath()
+
+	// Check if the user is logged in before sending transaction
+	if _, err := os.Stat(localStore + "loginToken_" + chaincodeUsr); err == nil {
+		// No error returned, therefore token exists so user is already logged in
+		restLogger.Infof("Local user '%s' is already logged in. Retrieving login token.", chaincodeUsr)
+
+		// Read in the login token
+		token, err := ioutil.ReadFile(localStore + "loginToken_" + chaincodeUsr)
+		if err != nil {
+			// Format the error appropriately for further processing
+			error := formatRPCError(InternalError.Code, InternalError.Message, fmt.Sprintf("Fatal error when reading client login token: %s", err))
+			restLogger.Errorf("Fatal error when reading client login token: %s", err)
+
+			return error, false
+		}
+
+		// Add the login token to the chaincodeSpec
+		spec.SecureContext = string(token)
+	} else {
+		// Check if the token is not there and fail
+		if os.IsNotExist(err) {
+			// Format the error appropriately for further processing
+			error := formatRPCError(MissingRegistrationError.Code, MissingRegistrationError.Message, MissingRegistrationError.Data)
+			restLogger.Error(MissingRegistrationError.Data)
+
+			return error, false
+		}
+		// Unexpected error
+		// Format the error appropriately for further processing
+		error := formatRPCError(InternalError.Code, InternalError.Message, fmt.Sprintf("Unexpected fatal error when checking for client login token: %s", err))
+		restLogger.Errorf("Unexpected fatal error when checking for client login token: %s", err)
+
+		return error, false
+	}
+
+	return result, true
+}
+
 // GetPeers returns a list of all peer nodes currently connected to the target peer, including itself
 func (s *ServerOpenchainREST) GetPeers(rw web.ResponseWriter, req *web.Request) {
 	peers, err := s.server.GetPeers(context.Background(), &google_protobuf.Empty{})
@@ -1709,6 +2132,25 @@ func (s *ServerOpenchainREST) GetPeers(rw web.ResponseWriter, req *web.Request)
 	}
 }
 
+// GetConsensusStatus returns a snapshot of the state of the consensus plugin of the target peer
+func (s *ServerOpenchainREST) GetConsensusStatus(rw web.ResponseWriter, req *web.Request) {
+	status, err := s.server.GetConsensusStatus(context.Background(), &google_protobuf.Empty{})
+
+	encoder := json.NewEncoder(rw)
+
+	// Check for error
+	if err != nil {
+		// Failure
+		rw.WriteHeader(http.StatusBadRequest)
+		encoder.Encode(restResult{Error: err.Error()})
+		restLogger.Errorf("Error: Querying consensus status -- %s", err)
+	} else {
+		// Success
+		rw.WriteHeader(http.StatusOK)
+		encoder.Encode(status)
+	}
+}
+
 // NotFound returns a custom landing page when a given hyperledger end point
 // had not been defined.
 func (s *ServerOpenchainREST) NotFound(rw web.ResponseWriter, r *web.Request) {
@@ -1731,7 +2173,9 @@ func buildOpenchainRESTRouter() *web.Router {
 	router.Get("/registrar/:id/tcert", (*ServerOpenchainREST).GetTransactionCert)
 
 	router.Get("/chain", (*ServerOpenchainREST).GetBlockchainInfo)
+	router.Get("/chain/blocks", (*ServerOpenchainREST).GetBlocks)
 	router.Get("/chain/blocks/:id", (*ServerOpenchainREST).GetBlockByNumber)
+	router.Get("/chain/state/:chaincodeID/:key/history", (*ServerOpenchainREST).GetStateHistory)
 
 	// The /devops endpoint is now considered deprecated and superseded by the /chaincode endpoint
 	router.Post("/devops/deploy", (*ServerOpenchainREST).Deploy)
@@ -1741,9 +2185,12 @@ func buildOpenchainRESTRouter() *web.Router {
 	// The /chaincode endpoint which superceedes the /devops endpoint from above
 	router.Post("/chaincode", (*ServerOpenchainREST).ProcessChaincode)
 
+	router.Get("/transactions", (*ServerOpenchainREST).GetTransactions)
 	router.Get("/transactions/:uuid", (*ServerOpenchainREST).GetTransactionByUUID)
+	router.Get("/transactions/:uuid/result", (*ServerOpenchainREST).GetTransactionResultByUUID)
 
 	router.Get("/network/peers", (*ServerOpenchainREST).GetPeers)
+	router.Get("/network/consensus", (*ServerOpenchainREST).GetConsensusStatus)
 
 	// Add not found page
 	router.NotFound((*ServerOpenchainREST).NotFound)
@@ -136,6 +136,26 @@ func (d *mockDevops) Query(c context.Context, cis *protos.ChaincodeInvocationSpe
 	return nil, fmt.Errorf("Unknown query function")
 }
 
+func (d *mockDevops) Upgrade(c context.Context, cus *protos.ChaincodeUpgradeSpec) (*protos.ChaincodeDeploymentSpec, error) {
+	if cus.PreviousChaincodeID.Name == "non-existing" {
+		return nil, fmt.Errorf("Upgrade failure on non-existing chaincode")
+	}
+	spec := cus.ChaincodeDeploymentSpec.ChaincodeSpec
+	spec.ChaincodeID.Name = "new_name_for_upgraded_chaincode"
+	return &protos.ChaincodeDeploymentSpec{ChaincodeSpec: spec, CodePackage: []byte{}}, nil
+}
+
+func (d *mockDevops) Terminate(c context.Context, spec *protos.ChaincodeSpec) (*protos.Response, error) {
+	if spec.ChaincodeID.Name == "non-existing" {
+		return nil, fmt.Errorf("Terminate failure on non-existing chaincode")
+	}
+	return &protos.Response{Status: protos.Response_SUCCESS, Msg: []byte("terminate_result")}, nil
+}
+
+func (d *mockDevops) GetTransactionResult(c context.Context, request *protos.TransactionRequest) (*protos.TransactionResult, error) {
+	return nil, fmt.Errorf("GetTransactionResult not implemented")
+}
+
 func (d *mockDevops) EXP_GetApplicationTCert(ctx context.Context, secret *protos.Secret) (*protos.Response, error) {
 	return nil, nil
 }
@@ -266,6 +286,182 @@ func TestServerOpenchainREST_API_GetBlockByNumber(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_GetBlocks(t *testing.T) {
+	// Construct a ledger with 0 blocks.
+	ledger := ledger.InitTestLedger(t)
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/chain/blocks")
+	res := parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error when retrieving blocks of an empty blockchain, but got none")
+	}
+
+	// add 3 blocks to the ledger
+	buildTestLedger1(ledger, t)
+
+	// Retrieve the first 2 blocks
+	body = performHTTPGet(t, httpServer.URL+"/chain/blocks?limit=2")
+	var blocks blocksResult
+	err := json.Unmarshal(body, &blocks)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(blocks.Blocks) != 2 || blocks.Blocks[0].Number != 0 || blocks.Blocks[1].Number != 1 {
+		t.Fatalf("Expected blocks 0 and 1 but got %v", blocks.Blocks)
+	}
+	if blocks.ContinuationToken == "" {
+		t.Fatalf("Expected a continuation token")
+	}
+
+	// Continue with the next page, without transactions
+	body = performHTTPGet(t, httpServer.URL+"/chain/blocks?limit=2&headersOnly=true&continuationToken="+blocks.ContinuationToken)
+	blocks = blocksResult{}
+	err = json.Unmarshal(body, &blocks)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(blocks.Blocks) != 1 || blocks.Blocks[0].Number != 2 {
+		t.Fatalf("Expected block 2 but got %v", blocks.Blocks)
+	}
+	if len(blocks.Blocks[0].Block.Transactions) != 0 || blocks.Blocks[0].Block.StateHash == nil {
+		t.Errorf("Expected the header of block 2 but got %v", blocks.Blocks[0].Block)
+	}
+	if blocks.ContinuationToken != "" {
+		t.Errorf("Expected no continuation token but got %s", blocks.ContinuationToken)
+	}
+
+	// No block holds an invoke transaction
+	body = performHTTPGet(t, httpServer.URL+"/chain/blocks?type=CHAINCODE_INVOKE")
+	blocks = blocksResult{}
+	err = json.Unmarshal(body, &blocks)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(blocks.Blocks) != 0 {
+		t.Errorf("Expected no block but got %v", blocks.Blocks)
+	}
+
+	// Invalid parameters
+	for _, query := range []string{"fromBlock=NOT_A_NUMBER", "limit=0", "type=NOT_A_TYPE", "fromTime=yesterday", "headersOnly=maybe", "continuationToken=!"} {
+		body = performHTTPGet(t, httpServer.URL+"/chain/blocks?"+query)
+		res = parseRESTResult(t, body)
+		if res.Error == "" {
+			t.Errorf("Expected an error for query %s, but got none", query)
+		}
+	}
+}
+
+func TestServerOpenchainREST_API_GetTransactions(t *testing.T) {
+	// Construct a ledger with 0 blocks.
+	ledger := ledger.InitTestLedger(t)
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	// add 3 blocks to the ledger
+	buildTestLedger1(ledger, t)
+
+	// A page does not split the transactions of block 2
+	body := performHTTPGet(t, httpServer.URL+"/transactions?fromBlock=1&limit=2")
+	var txs transactionsResult
+	err := json.Unmarshal(body, &txs)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(txs.Transactions) != 3 {
+		t.Errorf("Expected 3 transactions but got %d", len(txs.Transactions))
+	}
+	if txs.ContinuationToken != "" {
+		t.Errorf("Expected no continuation token but got %s", txs.ContinuationToken)
+	}
+
+	// Blocks committed in the future
+	body = performHTTPGet(t, httpServer.URL+"/transactions?fromTime="+time.Now().Add(time.Hour).Format(time.RFC3339))
+	txs = transactionsResult{}
+	err = json.Unmarshal(body, &txs)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(txs.Transactions) != 0 {
+		t.Errorf("Expected no transaction but got %d", len(txs.Transactions))
+	}
+
+	// Block range beyond the blockchain
+	body = performHTTPGet(t, httpServer.URL+"/transactions?fromBlock=5")
+	res := parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error when block range doesn't exist, but got none")
+	}
+}
+
+func TestServerOpenchainREST_API_GetStateHistory(t *testing.T) {
+	// Construct a ledger with 0 blocks.
+	ledger := ledger.InitTestLedger(t)
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/chain/state/MyContract/x/history")
+	res := parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error when retrieving history of an empty blockchain, but got none")
+	}
+
+	// add 3 blocks to the ledger
+	buildTestLedger1(ledger, t)
+
+	// The key 'x' of 'MyContract' was set in block 2
+	body = performHTTPGet(t, httpServer.URL+"/chain/state/MyContract/x/history")
+	var history protos.GetHistoryForKeyResponse
+	err := json.Unmarshal(body, &history)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(history.Modifications) != 1 {
+		t.Fatalf("Expected 1 modification but got %d", len(history.Modifications))
+	}
+	if history.Modifications[0].BlockNumber != 2 || string(history.Modifications[0].Value) != "hello" {
+		t.Errorf("Unexpected modification: %v", history.Modifications[0])
+	}
+
+	// Restricting the range to blocks before 2 returns no modification
+	body = performHTTPGet(t, httpServer.URL+"/chain/state/MyContract/x/history?fromBlock=0&toBlock=1")
+	history = protos.GetHistoryForKeyResponse{}
+	err = json.Unmarshal(body, &history)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if len(history.Modifications) != 0 {
+		t.Errorf("Expected no modification but got %d", len(history.Modifications))
+	}
+
+	// Block range beyond the blockchain
+	body = performHTTPGet(t, httpServer.URL+"/chain/state/MyContract/x/history?fromBlock=5")
+	res = parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error when block range doesn't exist, but got none")
+	}
+
+	// Illegal block number
+	body = performHTTPGet(t, httpServer.URL+"/chain/state/MyContract/x/history?toBlock=NOT_A_NUMBER")
+	res = parseRESTResult(t, body)
+	if res.Error == "" {
+		t.Errorf("Expected an error when toBlock isn't a number, but got none")
+	}
+}
+
 func TestServerOpenchainREST_API_GetTransactionByUUID(t *testing.T) {
 	startTime := time.Now().Unix()
 
@@ -311,6 +507,48 @@ func TestServerOpenchainREST_API_GetTransactionByUUID(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_GetTransactionResultByUUID(t *testing.T) {
+	// Construct a ledger with a block whose second transaction failed
+	ledger := ledger.InitTestLedger(t)
+	tx1, err := protos.NewTransaction(protos.ChaincodeID{Path: "Contracts"}, generateUUID(t), "NewContract", []string{})
+	if err != nil {
+		t.Fatalf("Can't create transaction: %v", err)
+	}
+	failedUUID := generateUUID(t)
+	ledger.BeginTxBatch(0)
+	ledger.CommitTxBatch(0, []*protos.Transaction{tx1}, []*protos.TransactionResult{
+		{Uuid: tx1.Uuid, Result: []byte("result")},
+		{Uuid: failedUUID, ErrorCode: 1, Error: "failure"},
+	}, []byte("dummy-proof"))
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/transactions/NON-EXISTING-UUID/result")
+	if res := parseRESTResult(t, body); res.Error == "" {
+		t.Errorf("Expected an error when retrieving the result of a non-existing transaction, but got none")
+	}
+
+	var result1 protos.TransactionResult
+	if err = json.Unmarshal(performHTTPGet(t, httpServer.URL+"/transactions/"+tx1.Uuid+"/result"), &result1); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if result1.Uuid != tx1.Uuid || result1.ErrorCode != 0 || string(result1.Result) != "result" {
+		t.Errorf("Unexpected result of committed transaction: %v", result1)
+	}
+
+	var failedResult protos.TransactionResult
+	if err = json.Unmarshal(performHTTPGet(t, httpServer.URL+"/transactions/"+failedUUID+"/result"), &failedResult); err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if failedResult.Uuid != failedUUID || failedResult.ErrorCode != 1 || failedResult.Error != "failure" {
+		t.Errorf("Unexpected result of failed transaction: %v", failedResult)
+	}
+}
+
 func TestServerOpenchainREST_API_Register(t *testing.T) {
 	os.RemoveAll(getRESTFilePath())
 	initGlobalServerOpenchain(t)
@@ -464,6 +702,24 @@ func TestServerOpenchainREST_API_GetPeers(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_GetConsensusStatus(t *testing.T) {
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	body := performHTTPGet(t, httpServer.URL+"/network/consensus")
+	var status protos.ConsensusStatus
+	err := json.Unmarshal(body, &status)
+	if err != nil {
+		t.Fatalf("Invalid JSON response: %v", err)
+	}
+	if status.Plugin != "pbft" || status.Primary != 1 || len(status.Replicas) != 4 {
+		t.Errorf("Expected the status of the pbft replica in view 1, but got %v", status)
+	}
+}
+
 func TestServerOpenchainREST_API_Chaincode_InvalidRequests(t *testing.T) {
 	// Construct a ledger with 3 blocks.
 	ledger := ledger.InitTestLedger(t)
@@ -651,6 +907,115 @@ func TestServerOpenchainREST_API_Chaincode_Deploy(t *testing.T) {
 	}
 }
 
+func TestServerOpenchainREST_API_Chaincode_Upgrade(t *testing.T) {
+	// Construct a ledger with 3 blocks.
+	ledger := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger, t)
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	// Test upgrade without params
+	httpResponse, body := performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"upgrade"}`))
+	if httpResponse.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusBadRequest, httpResponse.StatusCode)
+	}
+	res := parseRPCResponse(t, body)
+	if res.Error == nil || res.Error.Code != InvalidParams.Code {
+		t.Errorf("Expected an error when sending missing params, but got %#v", res.Error)
+	}
+
+	// Login
+	performHTTPPost(t, httpServer.URL+"/registrar", []byte(`{"enrollId":"myuser","enrollSecret":"password"}`))
+
+	// Test upgrade without the chaincode to upgrade
+	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"upgrade","params":{"type":1,"chaincodeID":{"path":"github.com/hyperledger/fabric/core/rest/test_chaincode"},"ctorMsg":{"function":"Init","args":[]},"secureContext":"myuser"}}`))
+	res = parseRPCResponse(t, body)
+	if res.Error == nil || res.Error.Code != InvalidParams.Code {
+		t.Errorf("Expected an error when sending without previousChaincodeID, but got %#v", res.Error)
+	}
+
+	// Test upgrade of a non-existing chaincode
+	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"upgrade","params":{"type":1,"chaincodeID":{"path":"github.com/hyperledger/fabric/core/rest/test_chaincode"},"ctorMsg":{"function":"Init","args":[]},"secureContext":"myuser","previousChaincodeID":{"name":"non-existing"}}}`))
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusOK, httpResponse.StatusCode)
+	}
+	res = parseRPCResponse(t, body)
+	if res.Error == nil || res.Error.Code != ChaincodeUpgradeError.Code {
+		t.Errorf("Expected an error when upgrading a non-existing chaincode, but got %#v", res.Error)
+	}
+
+	// Test upgrade with state carried forward
+	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"upgrade","params":{"type":1,"chaincodeID":{"path":"github.com/hyperledger/fabric/core/rest/test_chaincode"},"ctorMsg":{"function":"Init","args":[]},"secureContext":"myuser","previousChaincodeID":{"name":"dummy"},"carryState":true}}`))
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusOK, httpResponse.StatusCode)
+	}
+	res = parseRPCResponse(t, body)
+	if res.Error != nil {
+		t.Errorf("Expected success but got %#v", res.Error)
+	}
+	if res.Result.Status != "OK" {
+		t.Errorf("Expected OK but got %#v", res.Result.Status)
+	}
+	if res.Result.Message != "new_name_for_upgraded_chaincode" {
+		t.Errorf("Expected 'new_name_for_upgraded_chaincode' but got '%#v'", res.Result.Message)
+	}
+}
+
+func TestServerOpenchainREST_API_Chaincode_Terminate(t *testing.T) {
+	// Construct a ledger with 3 blocks.
+	ledger := ledger.InitTestLedger(t)
+	buildTestLedger1(ledger, t)
+
+	initGlobalServerOpenchain(t)
+
+	// Start the HTTP REST test server
+	httpServer := httptest.NewServer(buildOpenchainRESTRouter())
+	defer httpServer.Close()
+
+	// Test terminate without params
+	httpResponse, body := performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"terminate"}`))
+	if httpResponse.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusBadRequest, httpResponse.StatusCode)
+	}
+	res := parseRPCResponse(t, body)
+	if res.Error == nil || res.Error.Code != InvalidParams.Code {
+		t.Errorf("Expected an error when sending missing params, but got %#v", res.Error)
+	}
+
+	// Login
+	performHTTPPost(t, httpServer.URL+"/registrar", []byte(`{"enrollId":"myuser","enrollSecret":"password"}`))
+
+	// Test terminate of a non-existing chaincode
+	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"terminate","params":{"type":1,"chaincodeID":{"name":"non-existing"},"secureContext":"myuser"}}`))
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusOK, httpResponse.StatusCode)
+	}
+	res = parseRPCResponse(t, body)
+	if res.Error == nil || res.Error.Code != ChaincodeTerminateError.Code {
+		t.Errorf("Expected an error when terminating a non-existing chaincode, but got %#v", res.Error)
+	}
+
+	// Test terminate
+	httpResponse, body = performHTTPPost(t, httpServer.URL+"/chaincode", []byte(`{"jsonrpc":"2.0","ID":123,"method":"terminate","params":{"type":1,"chaincodeID":{"name":"dummy"},"secureContext":"myuser"}}`))
+	if httpResponse.StatusCode != http.StatusOK {
+		t.Errorf("Expected an HTTP status code %#v but got %#v", http.StatusOK, httpResponse.StatusCode)
+	}
+	res = parseRPCResponse(t, body)
+	if res.Error != nil {
+		t.Errorf("Expected success but got %#v", res.Error)
+	}
+	if res.Result.Status != "OK" {
+		t.Errorf("Expected OK but got %#v", res.Result.Status)
+	}
+	if res.Result.Message != "terminate_result" {
+		t.Errorf("Expected 'terminate_result' but got '%v'", res.Result.Message)
+	}
+}
+
 func TestServerOpenchainREST_API_Chaincode_Invoke(t *testing.T) {
 	// Construct a ledger with 3 blocks.
 	ledger := ledger.InitTestLedger(t)
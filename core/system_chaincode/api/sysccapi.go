@@ -18,26 +18,32 @@ package api
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	"golang.org/x/net/context"
 
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/core/container/inproccontroller"
-	"github.com/hyperledger/fabric/core/peer"
+	"github.com/hyperledger/fabric/core/util"
 	"github.com/hyperledger/fabric/protos"
 	"github.com/op/go-logging"
+	"github.com/spf13/cast"
 	"github.com/spf13/viper"
 )
 
 var sysccLogger = logging.MustGetLogger("sysccapi")
 
 // SystemChaincode defines the metadata needed to initialize system chaincode
-// when the fabric comes up. SystemChaincodes are installed by adding an
-// entry in importsysccs.go
+// when the fabric comes up. SystemChaincodes are either compiled into the peer
+// and made available with AddSysCC, or loaded from the Go plugin set in their
+// entry of the chaincode.system section of core.yaml. They only run if they are
+// enabled in that section
 type SystemChaincode struct {
 	// Enabled a convenient switch to enable/disable system chaincode without
-	// having to remove entry from importsysccs.go
+	// having to remove it from the peer
 	Enabled bool
 
 	//Unique name of the system chaincode
@@ -46,20 +52,85 @@ type SystemChaincode struct {
 	//Path to the system chaincode; currently not used
 	Path string
 
-	//InitArgs initialization arguments to startup the system chaincode
+	//InitArgs initialization arguments to startup the system chaincode, unless
+	//they are set in core.yaml
 	InitArgs []string
 
 	// Chaincode is the actual chaincode object
 	Chaincode shim.Chaincode
 }
 
+var (
+	sysccsLock sync.Mutex
+	sysccs     = make(map[string]*SystemChaincode)
+)
+
+// AddSysCC makes a system chaincode compiled into the peer available. It is
+// registered at startup by RegisterSysCCs if it is enabled in core.yaml
+func AddSysCC(syscc *SystemChaincode) error {
+	sysccsLock.Lock()
+	defer sysccsLock.Unlock()
+	if _, ok := sysccs[syscc.Name]; ok {
+		return fmt.Errorf("system chaincode %s already added", syscc.Name)
+	}
+	sysccs[syscc.Name] = syscc
+	return nil
+}
+
+// SysCCs returns the system chaincodes available, ordered by name
+func SysCCs() []*SystemChaincode {
+	sysccsLock.Lock()
+	defer sysccsLock.Unlock()
+	names := make([]string, 0, len(sysccs))
+	for name := range sysccs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]*SystemChaincode, len(names))
+	for i, name := range names {
+		list[i] = sysccs[name]
+	}
+	return list
+}
+
+// RegisterSysCCs registers the system chaincodes available with the peer,
+// after loading the plugins of the ones enabled in core.yaml
+func RegisterSysCCs() {
+	addSysCCPlugins()
+	for _, syscc := range SysCCs() {
+		RegisterSysCC(syscc)
+	}
+}
+
+// addSysCCPlugins adds the system chaincodes enabled in core.yaml which are not
+// compiled into the peer, loading them from their plugin. The chaincodes which
+// have no plugin, or whose plugin cannot be loaded, are reported
+func addSysCCPlugins() {
+	for name := range getSysCCConfigs() {
+		sysccsLock.Lock()
+		_, ok := sysccs[name]
+		sysccsLock.Unlock()
+		if ok || !isEnabled(name) {
+			continue
+		}
+		file, ok := getPlugin(name)
+		if !ok {
+			sysccLogger.Warningf("system chaincode %s enabled but neither compiled into the peer nor given a plugin", name)
+			continue
+		}
+		cc, err := loadSysCCPlugin(file)
+		if err != nil {
+			sysccLogger.Errorf("could not load system chaincode %s from plugin %s: %s", name, file, err)
+			continue
+		}
+		AddSysCC(&SystemChaincode{Enabled: true, Name: name, Path: file, InitArgs: []string{}, Chaincode: cc})
+		sysccLogger.Infof("system chaincode %s loaded from plugin %s", name, file)
+	}
+}
+
 // RegisterSysCC registers the given system chaincode with the peer
 func RegisterSysCC(syscc *SystemChaincode) error {
-	if peer.SecurityEnabled() {
-		sysccLogger.Warning(fmt.Sprintf("Currently system chaincode does support security(%s,%s)", syscc.Name, syscc.Path))
-		return nil
-	}
-	if !syscc.Enabled || !isWhitelisted(syscc) {
+	if !syscc.Enabled || !isEnabled(syscc.Name) {
 		sysccLogger.Info(fmt.Sprintf("system chaincode (%s,%s) disabled", syscc.Name, syscc.Path))
 		return nil
 	}
@@ -71,8 +142,13 @@ func RegisterSysCC(syscc *SystemChaincode) error {
 		return fmt.Errorf(errStr)
 	}
 
+	initArgs := syscc.InitArgs
+	if args, ok := getInitArgs(syscc.Name); ok {
+		initArgs = args
+	}
+
 	chaincodeID := &protos.ChaincodeID{Path: syscc.Path, Name: syscc.Name}
-	spec := protos.ChaincodeSpec{Type: protos.ChaincodeSpec_Type(protos.ChaincodeSpec_Type_value["GOLANG"]), ChaincodeID: chaincodeID, CtorMsg: &protos.ChaincodeInput{Args: syscc.InitArgs}}
+	spec := protos.ChaincodeSpec{Type: protos.ChaincodeSpec_Type(protos.ChaincodeSpec_Type_value["GOLANG"]), ChaincodeID: chaincodeID, CtorMsg: &protos.ChaincodeInput{Args: initArgs}}
 
 	if deployErr := deploySysCC(context.Background(), &spec); deployErr != nil {
 		errStr := fmt.Sprintf("deploy chaincode failed: %s", deployErr)
@@ -106,14 +182,94 @@ func deploySysCC(ctx context.Context, spec *protos.ChaincodeSpec) error {
 		return fmt.Errorf("Error deploying chaincode: %s ", err)
 	}
 
+	setSysCCSecurityContext(transaction)
+
 	_, _, err = chaincode.Execute(ctx, chaincode.GetChain(chaincode.DefaultChain), transaction)
 
 	return err
 }
 
-func isWhitelisted(syscc *SystemChaincode) bool {
-	chaincodes := viper.GetStringMapString("chaincode.system")
-	val, ok := chaincodes[syscc.Name]
-	enabled := val == "enable" || val == "true" || val == "yes"
-	return ok && enabled
+// setSysCCSecurityContext sets the fields of the deploy transaction of a system
+// chaincode which make up the security context of its Init. Every validator
+// deploys its system chaincodes on its own, so the transaction has no caller
+// and its nonce is derived from the ID of the chaincode: Init sees the same
+// caller and binding on every validator
+func setSysCCSecurityContext(transaction *protos.Transaction) {
+	transaction.Cert = nil
+	transaction.Signature = nil
+	transaction.Nonce = util.ComputeCryptoHash([]byte(transaction.ChaincodeID))
+}
+
+// getSysCCConfigs returns the entries of chaincode.system by name. An entry is
+// either a switch, or a section with the enabled switch, the init args and the
+// plugin
+func getSysCCConfigs() map[string]interface{} {
+	configs := make(map[string]interface{})
+	switch section := viper.Get("chaincode.system").(type) {
+	case map[string]string:
+		for name, value := range section {
+			configs[name] = value
+		}
+	case map[string]interface{}:
+		for name, value := range section {
+			configs[name] = value
+		}
+	case map[interface{}]interface{}:
+		for name, value := range section {
+			configs[fmt.Sprint(name)] = value
+		}
+	}
+	return configs
+}
+
+// getSysCCConfig returns the setting of the entry of the system chaincode,
+// keys are matched ignoring case as viper lowercases them
+func getSysCCConfig(name string, key string) (interface{}, bool) {
+	var entry map[string]interface{}
+	switch config := getSysCCConfigs()[name].(type) {
+	case map[string]interface{}:
+		entry = config
+	case map[interface{}]interface{}:
+		entry = cast.ToStringMap(config)
+	default:
+		return nil, false
+	}
+	for k, value := range entry {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// isEnabled returns true if the system chaincode is whitelisted in chaincode.system
+func isEnabled(name string) bool {
+	config, ok := getSysCCConfigs()[name]
+	if !ok {
+		return false
+	}
+	if enabled, ok := getSysCCConfig(name, "enabled"); ok {
+		config = enabled
+	}
+	val := strings.ToLower(fmt.Sprint(config))
+	return val == "enable" || val == "true" || val == "yes"
+}
+
+// getInitArgs returns the init args set in the entry of the system chaincode
+func getInitArgs(name string) ([]string, bool) {
+	args, ok := getSysCCConfig(name, "initArgs")
+	if !ok {
+		return nil, false
+	}
+	return cast.ToStringSlice(args), true
+}
+
+// getPlugin returns the file of the Go plugin set in the entry of the system
+// chaincode
+func getPlugin(name string) (string, bool) {
+	file, ok := getSysCCConfig(name, "plugin")
+	if !ok || cast.ToString(file) == "" {
+		return "", false
+	}
+	return cast.ToString(file), true
 }
@@ -0,0 +1,139 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+)
+
+func TestSysCCConfig(t *testing.T) {
+	// entries as read from core.yaml
+	viper.Set("chaincode.system", map[interface{}]interface{}{
+		"switch":   "yes",
+		"disabled": false,
+		"section":  map[interface{}]interface{}{"enabled": true, "initargs": []interface{}{"a", "b"}},
+		"noargs":   map[interface{}]interface{}{"enabled": "true"},
+		"off":      map[interface{}]interface{}{"enabled": false, "initargs": []interface{}{"a"}},
+	})
+	defer viper.Set("chaincode.system", nil)
+
+	for name, expected := range map[string]bool{"switch": true, "disabled": false, "section": true, "noargs": true, "off": false, "unknown": false} {
+		if enabled := isEnabled(name); enabled != expected {
+			t.Errorf("Expected enabled of %s to be %t, got %t", name, expected, enabled)
+		}
+	}
+
+	if args, ok := getInitArgs("section"); !ok || !reflect.DeepEqual(args, []string{"a", "b"}) {
+		t.Errorf("Expected the init args of section to be set, got %v", args)
+	}
+	if _, ok := getInitArgs("switch"); ok {
+		t.Errorf("Expected no init args for switch")
+	}
+	if _, ok := getInitArgs("noargs"); ok {
+		t.Errorf("Expected no init args for noargs")
+	}
+
+	// entries set by the tests
+	viper.Set("chaincode.system", map[string]string{"legacy": "true"})
+	if !isEnabled("legacy") {
+		t.Errorf("Expected legacy to be enabled")
+	}
+}
+
+func TestAddSysCC(t *testing.T) {
+	if err := AddSysCC(&SystemChaincode{Name: "b"}); err != nil {
+		t.Fatalf("Error adding system chaincode: %s", err)
+	}
+	if err := AddSysCC(&SystemChaincode{Name: "a"}); err != nil {
+		t.Fatalf("Error adding system chaincode: %s", err)
+	}
+	if err := AddSysCC(&SystemChaincode{Name: "a"}); err == nil {
+		t.Errorf("Expected adding a system chaincode twice to fail")
+	}
+	list := SysCCs()
+	if len(list) != 2 || list[0].Name != "a" || list[1].Name != "b" {
+		t.Errorf("Expected the system chaincodes ordered by name, got %v", list)
+	}
+}
+
+func TestSysCCSecurityContext(t *testing.T) {
+	newDeployTx := func(name string) *protos.Transaction {
+		spec := &protos.ChaincodeSpec{ChaincodeID: &protos.ChaincodeID{Path: "github.com/example/" + name, Name: name}}
+		transaction, err := protos.NewChaincodeDeployTransaction(&protos.ChaincodeDeploymentSpec{ExecEnv: protos.ChaincodeDeploymentSpec_SYSTEM, ChaincodeSpec: spec}, name)
+		if err != nil {
+			t.Fatalf("Error creating deploy transaction: %s", err)
+		}
+		// as signed by the local peer
+		transaction.Cert = []byte("cert")
+		transaction.Signature = []byte("signature")
+		setSysCCSecurityContext(transaction)
+		return transaction
+	}
+
+	// deployed on two validators
+	tx1, tx2 := newDeployTx("a"), newDeployTx("a")
+	if len(tx1.Cert) != 0 || len(tx1.Signature) != 0 {
+		t.Errorf("Expected no caller, got cert %x and signature %x", tx1.Cert, tx1.Signature)
+	}
+	if len(tx1.Nonce) == 0 || !bytes.Equal(tx1.Nonce, tx2.Nonce) {
+		t.Errorf("Expected the same nonce on every validator, got %x and %x", tx1.Nonce, tx2.Nonce)
+	}
+	if other := newDeployTx("b"); bytes.Equal(tx1.Nonce, other.Nonce) {
+		t.Errorf("Expected system chaincodes to get different nonces")
+	}
+}
+
+func TestAddSysCCPlugins(t *testing.T) {
+	if err := AddSysCC(&SystemChaincode{Name: "compiled", Path: "github.com/example/compiled"}); err != nil {
+		t.Fatalf("Error adding system chaincode: %s", err)
+	}
+	viper.Set("chaincode.system", map[interface{}]interface{}{
+		"compiled":   map[interface{}]interface{}{"enabled": true, "plugin": "/no/such/compiled.so"},
+		"missing":    map[interface{}]interface{}{"enabled": true, "plugin": "/no/such/missing.so"},
+		"noplugin":   "true",
+		"pluginoff":  map[interface{}]interface{}{"enabled": false, "plugin": "/no/such/pluginoff.so"},
+		"emptyentry": map[interface{}]interface{}{"enabled": true, "plugin": ""},
+	})
+	defer viper.Set("chaincode.system", nil)
+
+	if file, ok := getPlugin("missing"); !ok || file != "/no/such/missing.so" {
+		t.Errorf("Expected the plugin of missing to be set, got %s", file)
+	}
+	if _, ok := getPlugin("emptyentry"); ok {
+		t.Errorf("Expected no plugin for emptyentry")
+	}
+
+	// the plugins which cannot be loaded are reported and skipped
+	addSysCCPlugins()
+	names := make(map[string]*SystemChaincode)
+	for _, syscc := range SysCCs() {
+		names[syscc.Name] = syscc
+	}
+	for _, name := range []string{"missing", "noplugin", "pluginoff", "emptyentry"} {
+		if _, ok := names[name]; ok {
+			t.Errorf("Expected system chaincode %s not to be added", name)
+		}
+	}
+	if syscc := names["compiled"]; syscc == nil || syscc.Path != "github.com/example/compiled" {
+		t.Errorf("Expected the compiled in system chaincode to be kept, got %v", syscc)
+	}
+}
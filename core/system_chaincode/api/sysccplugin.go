@@ -0,0 +1,44 @@
+// +build cgo
+
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package api
+
+import (
+	"fmt"
+	"plugin"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// loadSysCCPlugin opens the Go plugin file of a system chaincode and returns
+// the chaincode made by its exported function New
+func loadSysCCPlugin(file string) (shim.Chaincode, error) {
+	p, err := plugin.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("New")
+	if err != nil {
+		return nil, err
+	}
+	newChaincode, ok := sym.(func() shim.Chaincode)
+	if !ok {
+		return nil, fmt.Errorf("New of plugin %s is a %T, expected a func() shim.Chaincode", file, sym)
+	}
+	return newChaincode(), nil
+}
@@ -22,20 +22,21 @@ import (
 	"github.com/hyperledger/fabric/bddtests/syschaincode/noop"
 )
 
+//system chaincodes compiled into the peer, they run if they are enabled in the
+//chaincode.system section of core.yaml
 //see systemchaincode_test.go for an example using "sample_syscc"
-var systemChaincodes = []*api.SystemChaincode{
-	{
+func init() {
+	api.AddSysCC(&api.SystemChaincode{
 		Enabled:   true,
 		Name:      "noop",
 		Path:      "github.com/hyperledger/fabric/bddtests/syschaincode/noop",
 		InitArgs:  []string{},
 		Chaincode: &noop.SystemChaincode{},
-	}}
+	})
+}
 
 //RegisterSysCCs is the hook for system chaincodes where system chaincodes are registered with the fabric
 //note the chaincode must still be deployed and launched like a user chaincode will be
 func RegisterSysCCs() {
-	for _, sysCC := range systemChaincodes {
-		api.RegisterSysCC(sysCC)
-	}
+	api.RegisterSysCCs()
 }
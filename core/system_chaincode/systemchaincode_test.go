@@ -35,7 +35,7 @@ import (
 )
 
 // Invoke or query a chaincode.
-func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type) (*pb.ChaincodeEvent, string, []byte, error) {
+func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type) ([]*pb.ChaincodeEvent, string, []byte, error) {
 	chaincodeInvocationSpec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: spec}
 
 	// Now create the Transactions message and send to Peer.
@@ -50,7 +50,7 @@ func invoke(ctx context.Context, spec *pb.ChaincodeSpec, typ pb.Transaction_Type
 
 	var retval []byte
 	var execErr error
-	var ccevt *pb.ChaincodeEvent
+	var ccevt []*pb.ChaincodeEvent
 	if typ == pb.Transaction_CHAINCODE_QUERY {
 		retval, ccevt, execErr = chaincode.Execute(ctx, chaincode.GetChain(chaincode.DefaultChain), transaction)
 	} else {
@@ -100,19 +100,17 @@ func TestExecuteDeploySysChaincode(t *testing.T) {
 
 	var ctxt = context.Background()
 
-	//set systemChaincodes to sample
-	systemChaincodes = []*api.SystemChaincode{
-		{
-			Enabled:   true,
-			Name:      "sample_syscc",
-			Path:      "github.com/hyperledger/fabric/core/system_chaincode/samplesyscc",
-			InitArgs:  []string{},
-			Chaincode: &samplesyscc.SampleSysCC{},
-		},
-	}
+	//add the sample system chaincode
+	api.AddSysCC(&api.SystemChaincode{
+		Enabled:   true,
+		Name:      "sample_syscc",
+		Path:      "github.com/hyperledger/fabric/core/system_chaincode/samplesyscc",
+		InitArgs:  []string{},
+		Chaincode: &samplesyscc.SampleSysCC{},
+	})
 
 	// System chaincode has to be enabled
-	viper.Set("chaincode.system", map[string]string{"sample_syscc": "true"})
+	viper.Set("chaincode.system", map[string]interface{}{"sample_syscc": map[string]interface{}{"enabled": true, "initArgs": []string{"greeting", "hello"}}})
 	RegisterSysCCs()
 
 	url := "github.com/hyperledger/fabric/core/system_chaincode/sample_syscc"
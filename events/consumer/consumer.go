@@ -33,11 +33,26 @@ type EventsClient struct {
 	peerAddress string
 	stream      ehpb.Events_ChatClient
 	adapter     EventAdapter
+	replay      *ehpb.Replay
+	headersOnly bool
 }
 
 //NewEventsClient Returns a new grpc.ClientConn to the configured local PEER.
 func NewEventsClient(peerAddress string, adapter EventAdapter) *EventsClient {
-	return &EventsClient{peerAddress, nil, adapter}
+	return &EventsClient{peerAddress, nil, adapter, nil, false}
+}
+
+//NewEventsClientFromBlock Returns a new grpc.ClientConn to the configured local PEER
+//that first receives the events of the committed blocks from startBlock, then
+//the live events. The block number of the events tells where to resume after a restart
+func NewEventsClientFromBlock(peerAddress string, startBlock uint64, adapter EventAdapter) *EventsClient {
+	return &EventsClient{peerAddress, nil, adapter, &ehpb.Replay{StartBlock: startBlock}, false}
+}
+
+//SetHeadersOnly sets whether the client receives the events without the payloads
+//of the transactions and chaincode events. It must be called before Start
+func (ec *EventsClient) SetHeadersOnly(headersOnly bool) {
+	ec.headersOnly = headersOnly
 }
 
 //newEventsClientConnectionWithAddress Returns a new grpc.ClientConn to the configured local PEER.
@@ -49,7 +64,7 @@ func newEventsClientConnectionWithAddress(peerAddress string) (*grpc.ClientConn,
 }
 
 func (ec *EventsClient) register(ies []*ehpb.Interest) error {
-	emsg := &ehpb.Event{Event: &ehpb.Event_Register{Register: &ehpb.Register{Events: ies}}}
+	emsg := &ehpb.Event{Event: &ehpb.Event_Register{Register: &ehpb.Register{Events: ies, Replay: ec.replay, HeadersOnly: ec.headersOnly}}}
 	var err error
 	if err = ec.stream.Send(emsg); err != nil {
 		fmt.Printf("error on Register send %s\n", err)
@@ -80,6 +80,64 @@ func (a *Adapter) Disconnected(err error) {
 	}
 }
 
+// ChannelAdapter receives the events of its interests on a channel, and the
+// error it is disconnected with on disconnected if set
+type ChannelAdapter struct {
+	interests    []*ehpb.Interest
+	events       chan *ehpb.Event
+	disconnected chan error
+}
+
+func newChannelAdapter(interests ...*ehpb.Interest) *ChannelAdapter {
+	return &ChannelAdapter{interests: interests, events: make(chan *ehpb.Event, 10)}
+}
+
+func (a *ChannelAdapter) GetInterestedEvents() ([]*ehpb.Interest, error) {
+	return a.interests, nil
+}
+
+func (a *ChannelAdapter) Recv(msg *ehpb.Event) (bool, error) {
+	a.events <- msg
+	return true, nil
+}
+
+func (a *ChannelAdapter) Disconnected(err error) {
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+	}
+	if a.disconnected != nil {
+		a.disconnected <- err
+	}
+}
+
+// testEventSource is a blockchain of 3 blocks, each of which has a chaincode event.
+// If gate is set, the replay of block 0 signals entered then waits until gate is closed
+type testEventSource struct {
+	gate    chan struct{}
+	entered chan struct{}
+}
+
+var eventSource = &testEventSource{}
+
+// testReplayQueueSize is the number of live events queued for a consumer during a replay
+const testReplayQueueSize = 5
+
+func (s *testEventSource) GetBlockchainSize() uint64 {
+	return 3
+}
+
+func (s *testEventSource) GetBlockEvents(blockNumber uint64) ([]*ehpb.Event, error) {
+	if s.gate != nil && blockNumber == 0 {
+		s.entered <- struct{}{}
+		<-s.gate
+	}
+	blockEvent := createTestBlock()
+	blockEvent.BlockNumber = blockNumber
+	ccEvent := createTestChaincodeEvent("0xeeeeeeee", "event1")
+	ccEvent.BlockNumber = blockNumber
+	return []*ehpb.Event{blockEvent, ccEvent}, nil
+}
+
 func createTestBlock() *ehpb.Event {
 	emsg := producer.CreateBlockEvent(&ehpb.Block{Transactions: []*ehpb.Transaction{}})
 	return emsg
@@ -163,6 +221,176 @@ func TestFailReceive(t *testing.T) {
 	}
 }
 
+func TestReplay(t *testing.T) {
+	replayAdapter := newChannelAdapter(&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xeeeeeeee", EventName: ""}}})
+	replayClient := consumer.NewEventsClientFromBlock(peerAddress, 1, replayAdapter)
+	if err := replayClient.Start(); err != nil {
+		t.Fatalf("could not start chat %s", err)
+	}
+	defer replayClient.Stop()
+
+	//the live event of replayed block 2 must be dropped
+	for _, blockNumber := range []uint64{2, 3} {
+		emsg := createTestChaincodeEvent("0xeeeeeeee", "event2")
+		emsg.BlockNumber = blockNumber
+		if err := producer.Send(emsg); err != nil {
+			t.Fail()
+			t.Logf("Error sending message %s", err)
+		}
+	}
+
+	//receive the events of blocks 1 and 2, then the live event of block 3
+	for _, blockNumber := range []uint64{1, 2, 3} {
+		select {
+		case e := <-replayAdapter.events:
+			if e.GetChaincodeEvent() == nil || e.BlockNumber != blockNumber {
+				t.Fatalf("expected the chaincode event of block %d but got %v", blockNumber, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out on event of block %d", blockNumber)
+		}
+	}
+
+	select {
+	case e := <-replayAdapter.events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(time.Second):
+	}
+}
+
+func TestReplayQueueFull(t *testing.T) {
+	eventSource.gate = make(chan struct{})
+	eventSource.entered = make(chan struct{}, 1)
+	defer func() { eventSource.gate = nil }()
+
+	replayAdapter := newChannelAdapter(&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xeeeeeeee", EventName: ""}}})
+	replayAdapter.disconnected = make(chan error, 1)
+	replayClient := consumer.NewEventsClientFromBlock(peerAddress, 0, replayAdapter)
+	if err := replayClient.Start(); err != nil {
+		t.Fatalf("could not start chat %s", err)
+	}
+	defer replayClient.Stop()
+
+	select {
+	case <-eventSource.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the replay")
+	}
+	//more live events than can be queued arrive while block 0 is replayed
+	for i := 0; i <= testReplayQueueSize; i++ {
+		emsg := createTestChaincodeEvent("0xeeeeeeee", "event2")
+		emsg.BlockNumber = 3
+		if err := producer.Send(emsg); err != nil {
+			t.Fatalf("Error sending message %s", err)
+		}
+	}
+	time.Sleep(time.Second)
+	close(eventSource.gate)
+
+	select {
+	case err := <-replayAdapter.disconnected:
+		if err == nil {
+			t.Fatalf("expected the consumer to be disconnected with an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for the consumer to be disconnected")
+	}
+	//the consumer gets none of the live events
+	for {
+		select {
+		case e := <-replayAdapter.events:
+			if e.BlockNumber == 3 {
+				t.Fatalf("unexpected live event %v", e)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func TestReceiveTransactionResult(t *testing.T) {
+	resultAdapter := newChannelAdapter(&ehpb.Interest{EventType: ehpb.EventType_TRANSACTION_RESULT})
+	resultClient := consumer.NewEventsClient(peerAddress, resultAdapter)
+	if err := resultClient.Start(); err != nil {
+		t.Fatalf("could not start chat %s", err)
+	}
+	defer resultClient.Stop()
+
+	emsg := producer.CreateTransactionResultEvent(&ehpb.TransactionResult{Uuid: "uuid1", ErrorCode: 1, Error: "failure"})
+	if err := producer.Send(emsg); err != nil {
+		t.Fail()
+		t.Logf("Error sending message %s", err)
+	}
+
+	select {
+	case e := <-resultAdapter.events:
+		if result := e.GetTransactionResult(); result == nil || result.Uuid != "uuid1" || result.ErrorCode != 1 {
+			t.Fatalf("expected the result of transaction uuid1 but got %v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out on transaction result")
+	}
+}
+
+func TestRegexAndHeadersOnly(t *testing.T) {
+	regexAdapter := newChannelAdapter(&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xdddddddd", EventName: "asset.*", IsRegex: true}}})
+	regexClient := consumer.NewEventsClient(peerAddress, regexAdapter)
+	regexClient.SetHeadersOnly(true)
+	if err := regexClient.Start(); err != nil {
+		t.Fatalf("could not start chat %s", err)
+	}
+	defer regexClient.Stop()
+
+	//only the events whose whole name matches are received
+	for _, name := range []string{"transfer", "assetCreated", "newasset"} {
+		emsg := producer.CreateChaincodeEvent(&ehpb.ChaincodeEvent{ChaincodeID: "0xdddddddd", EventName: name, Payload: []byte("payload")})
+		if err := producer.Send(emsg); err != nil {
+			t.Fail()
+			t.Logf("Error sending message %s", err)
+		}
+	}
+
+	select {
+	case e := <-regexAdapter.events:
+		ce := e.GetChaincodeEvent()
+		if ce == nil || ce.EventName != "assetCreated" {
+			t.Fatalf("expected event assetCreated but got %v", e)
+		}
+		if ce.Payload != nil {
+			t.Fatalf("expected no payload but got %s", ce.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out on event assetCreated")
+	}
+
+	select {
+	case e := <-regexAdapter.events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(time.Second):
+	}
+}
+
+func TestInvalidRegex(t *testing.T) {
+	regexAdapter := newChannelAdapter(&ehpb.Interest{EventType: ehpb.EventType_CHAINCODE, RegInfo: &ehpb.Interest_ChaincodeRegInfo{ChaincodeRegInfo: &ehpb.ChaincodeReg{ChaincodeID: "0xcccccccc", EventName: "asset(", IsRegex: true}}})
+	regexClient := consumer.NewEventsClient(peerAddress, regexAdapter)
+	if err := regexClient.Start(); err != nil {
+		t.Fatalf("could not start chat %s", err)
+	}
+	defer regexClient.Stop()
+
+	emsg := createTestChaincodeEvent("0xcccccccc", "asset(")
+	if err := producer.Send(emsg); err != nil {
+		t.Fail()
+		t.Logf("Error sending message %s", err)
+	}
+
+	select {
+	case e := <-regexAdapter.events:
+		t.Fatalf("unexpected event %v", e)
+	case <-time.After(time.Second):
+	}
+}
+
 func BenchmarkMessages(b *testing.B) {
 	numMessages := 10000
 
@@ -214,7 +442,7 @@ func TestMain(m *testing.M) {
 
 	// Register EventHub server
 	// use a buffer of 100 and blocking timeout
-	ehServer := producer.NewEventsServer(100, 0)
+	ehServer := producer.NewEventsServer(100, 0, eventSource, testReplayQueueSize)
 	ehpb.RegisterEventsServer(grpcServer, ehServer)
 
 	fmt.Printf("Starting events server\n")
@@ -30,7 +30,79 @@ func CreateChaincodeEvent(te *ehpb.ChaincodeEvent) *ehpb.Event {
 	return &ehpb.Event{Event: &ehpb.Event_ChaincodeEvent{ChaincodeEvent: te}}
 }
 
+//CreateChaincodeEvents creates an Event from each of the ChaincodeEvents of a
+//transaction or block, in order. Consumers receive them one by one
+func CreateChaincodeEvents(tes []*ehpb.ChaincodeEvent) []*ehpb.Event {
+	events := make([]*ehpb.Event, 0, len(tes))
+	for _, te := range tes {
+		events = append(events, CreateChaincodeEvent(te))
+	}
+	return events
+}
+
 //CreateRejectionEvent creates an Event from TxResults
 func CreateRejectionEvent(tx *ehpb.Transaction, errorMsg string) *ehpb.Event {
 	return &ehpb.Event{Event: &ehpb.Event_Rejection{Rejection: &ehpb.Rejection{Tx: tx, ErrorMsg: errorMsg}}}
 }
+
+//CreateTransactionResultEvent creates an Event from the result of a committed transaction
+func CreateTransactionResultEvent(result *ehpb.TransactionResult) *ehpb.Event {
+	return &ehpb.Event{Event: &ehpb.Event_TransactionResult{TransactionResult: result}}
+}
+
+//CreateConsensusEvidenceEvent creates an Event from the evidence of a misbehaving validator
+func CreateConsensusEvidenceEvent(evidence *ehpb.ConsensusEvidence) *ehpb.Event {
+	return &ehpb.Event{Event: &ehpb.Event_ConsensusEvidence{ConsensusEvidence: evidence}}
+}
+
+//removePayloads returns a copy of the event without the payloads of its
+//transactions and chaincode events. The event is shared by all the consumers
+//so it is not modified
+func removePayloads(e *ehpb.Event) *ehpb.Event {
+	switch event := e.Event.(type) {
+	case *ehpb.Event_Block:
+		if event.Block == nil {
+			return e
+		}
+		block := *event.Block
+		block.Transactions = make([]*ehpb.Transaction, len(event.Block.Transactions))
+		for i, tx := range event.Block.Transactions {
+			block.Transactions[i] = removeTransactionPayload(tx)
+		}
+		if event.Block.NonHashData != nil {
+			nonHashData := *event.Block.NonHashData
+			nonHashData.ChaincodeEvents = make([]*ehpb.ChaincodeEvent, len(event.Block.NonHashData.ChaincodeEvents))
+			for i, ce := range event.Block.NonHashData.ChaincodeEvents {
+				nonHashData.ChaincodeEvents[i] = removeChaincodeEventPayload(ce)
+			}
+			block.NonHashData = &nonHashData
+		}
+		return &ehpb.Event{Event: &ehpb.Event_Block{Block: &block}, BlockNumber: e.BlockNumber}
+	case *ehpb.Event_ChaincodeEvent:
+		return &ehpb.Event{Event: &ehpb.Event_ChaincodeEvent{ChaincodeEvent: removeChaincodeEventPayload(event.ChaincodeEvent)}, BlockNumber: e.BlockNumber}
+	case *ehpb.Event_Rejection:
+		if event.Rejection == nil {
+			return e
+		}
+		return &ehpb.Event{Event: &ehpb.Event_Rejection{Rejection: &ehpb.Rejection{Tx: removeTransactionPayload(event.Rejection.Tx), ErrorMsg: event.Rejection.ErrorMsg}}, BlockNumber: e.BlockNumber}
+	}
+	return e
+}
+
+func removeTransactionPayload(tx *ehpb.Transaction) *ehpb.Transaction {
+	if tx == nil {
+		return nil
+	}
+	header := *tx
+	header.Payload = nil
+	return &header
+}
+
+func removeChaincodeEventPayload(ce *ehpb.ChaincodeEvent) *ehpb.ChaincodeEvent {
+	if ce == nil {
+		return nil
+	}
+	header := *ce
+	header.Payload = nil
+	return &header
+}
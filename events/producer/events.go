@@ -18,6 +18,7 @@ package producer
 
 import (
 	"fmt"
+	"regexp"
 	"sync"
 	"time"
 
@@ -50,6 +51,20 @@ type chaincodeHandlerList struct {
 	sync.RWMutex
 	// this map used as a list - add/del/iterate
 	handlers map[string]map[string]map[*handler]bool
+	// the handlers registered with a regular expression for the event name,
+	// by chaincode ID and by expression
+	patterns map[string]map[string]*eventNamePattern
+}
+
+type eventNamePattern struct {
+	regexp   *regexp.Regexp
+	handlers map[*handler]bool
+}
+
+//compileEventNamePattern compiles the regular expression of a registration
+//so that it must match the whole event name
+func compileEventNamePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
 }
 
 func (hl *chaincodeHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
@@ -64,6 +79,9 @@ func (hl *chaincodeHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
 	if ie.GetChaincodeRegInfo().ChaincodeID == "" {
 		return false, fmt.Errorf("chaincode ID not provided for registering")
 	}
+	if ie.GetChaincodeRegInfo().IsRegex {
+		return hl.addPattern(ie.GetChaincodeRegInfo(), h)
+	}
 	//is there a event type map for the chaincode
 	emap, ok := hl.handlers[ie.GetChaincodeRegInfo().ChaincodeID]
 	if !ok {
@@ -85,6 +103,33 @@ func (hl *chaincodeHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
 
 	return true, nil
 }
+
+func (hl *chaincodeHandlerList) addPattern(regInfo *pb.ChaincodeReg, h *handler) (bool, error) {
+	pmap, ok := hl.patterns[regInfo.ChaincodeID]
+	if !ok {
+		pmap = make(map[string]*eventNamePattern)
+		hl.patterns[regInfo.ChaincodeID] = pmap
+	}
+
+	pattern := pmap[regInfo.EventName]
+	if pattern == nil {
+		re, err := compileEventNamePattern(regInfo.EventName)
+		if err != nil {
+			if len(pmap) == 0 {
+				delete(hl.patterns, regInfo.ChaincodeID)
+			}
+			return false, fmt.Errorf("invalid event name expression %s: %s", regInfo.EventName, err)
+		}
+		pattern = &eventNamePattern{regexp: re, handlers: make(map[*handler]bool)}
+		pmap[regInfo.EventName] = pattern
+	} else if _, ok = pattern.handlers[h]; ok {
+		return false, fmt.Errorf("handler exists for event name expression")
+	}
+
+	pattern.handlers[h] = true
+
+	return true, nil
+}
 func (hl *chaincodeHandlerList) del(ie *pb.Interest, h *handler) (bool, error) {
 	hl.Lock()
 	defer hl.Unlock()
@@ -98,6 +143,9 @@ func (hl *chaincodeHandlerList) del(ie *pb.Interest, h *handler) (bool, error) {
 	if ie.GetChaincodeRegInfo().ChaincodeID == "" {
 		return false, fmt.Errorf("chaincode ID not provided for de-registering")
 	}
+	if ie.GetChaincodeRegInfo().IsRegex {
+		return hl.delPattern(ie.GetChaincodeRegInfo(), h)
+	}
 
 	//if there's no event type map, nothing to do
 	emap, ok := hl.handlers[ie.GetChaincodeRegInfo().ChaincodeID]
@@ -131,6 +179,31 @@ func (hl *chaincodeHandlerList) del(ie *pb.Interest, h *handler) (bool, error) {
 	return true, nil
 }
 
+func (hl *chaincodeHandlerList) delPattern(regInfo *pb.ChaincodeReg, h *handler) (bool, error) {
+	pmap, ok := hl.patterns[regInfo.ChaincodeID]
+	if !ok {
+		return false, fmt.Errorf("chaincode ID not registered")
+	}
+
+	pattern := pmap[regInfo.EventName]
+	if pattern == nil {
+		return false, fmt.Errorf("event name expression %s not registered for chaincode ID %s", regInfo.EventName, regInfo.ChaincodeID)
+	} else if _, ok = pattern.handlers[h]; !ok {
+		return false, fmt.Errorf("handler not registered for event name expression %s for chaincode ID %s", regInfo.EventName, regInfo.ChaincodeID)
+	}
+
+	delete(pattern.handlers, h)
+
+	if len(pattern.handlers) == 0 {
+		delete(pmap, regInfo.EventName)
+		if len(pmap) == 0 {
+			delete(hl.patterns, regInfo.ChaincodeID)
+		}
+	}
+
+	return true, nil
+}
+
 func (hl *chaincodeHandlerList) foreach(e *pb.Event, action func(h *handler)) {
 	hl.Lock()
 	defer hl.Unlock()
@@ -158,6 +231,15 @@ func (hl *chaincodeHandlerList) foreach(e *pb.Event, action func(h *handler)) {
 			}
 		}
 	}
+
+	//send to handlers whose expression matches the event name
+	for _, pattern := range hl.patterns[e.GetChaincodeEvent().ChaincodeID] {
+		if pattern.regexp.MatchString(e.GetChaincodeEvent().EventName) {
+			for h := range pattern.handlers {
+				action(h)
+			}
+		}
+	}
 }
 
 func (hl *genericHandlerList) add(ie *pb.Interest, h *handler) (bool, error) {
@@ -266,9 +348,13 @@ func AddEventType(eventType pb.EventType) error {
 	case pb.EventType_BLOCK:
 		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
 	case pb.EventType_CHAINCODE:
-		gEventProcessor.eventConsumers[eventType] = &chaincodeHandlerList{handlers: make(map[string]map[string]map[*handler]bool)}
+		gEventProcessor.eventConsumers[eventType] = &chaincodeHandlerList{handlers: make(map[string]map[string]map[*handler]bool), patterns: make(map[string]map[string]*eventNamePattern)}
 	case pb.EventType_REJECTION:
 		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
+	case pb.EventType_TRANSACTION_RESULT:
+		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
+	case pb.EventType_CONSENSUS_EVIDENCE:
+		gEventProcessor.eventConsumers[eventType] = &genericHandlerList{handlers: make(map[*handler]bool)}
 	}
 	gEventProcessor.Unlock()
 
@@ -17,24 +17,55 @@ limitations under the License.
 package producer
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"sync"
 
 	pb "github.com/hyperledger/fabric/protos"
 )
 
+// errReplayQueueFull is returned when more live events arrive during a replay
+// than the handler can queue. The consumer is disconnected, and must register
+// again to replay the events from the last block it received
+var errReplayQueueFull = errors.New("too many live events queued during the replay of events")
+
 type handler struct {
 	ChatStream pb.Events_ChatServer
 	doneChan   chan bool
 	registered bool
 	// PM: this should be a list, add/del, iterate
 	interestedEvents []*pb.Interest
+	// the compiled event name expressions of the interests, used to match
+	// the replayed events
+	eventNamePatterns map[string]*regexp.Regexp
+	// the payloads are removed from the events sent to consumers that only
+	// want the headers
+	headersOnly bool
+
+	source EventSource
+	// sendLock serializes the messages sent through ChatStream. While the
+	// events of the committed blocks are replayed, up to maxPending live
+	// events are queued in pending. Once more arrive, pendingOverflow is set
+	// and the live events are dropped until the consumer is disconnected
+	sendLock        sync.Mutex
+	replaying       bool
+	pending         []*pb.Event
+	maxPending      int
+	pendingOverflow bool
+	// liveFromBlock is the first block whose live events are sent after a
+	// replay, the events of the previous blocks have been replayed
+	liveFromBlock uint64
 }
 
-func newEventHandler(stream pb.Events_ChatServer) (*handler, error) {
+func newEventHandler(stream pb.Events_ChatServer, source EventSource, maxPending int) (*handler, error) {
 	d := &handler{
 		ChatStream: stream,
+		source:     source,
+		maxPending: maxPending,
 	}
-	d.doneChan = make(chan bool)
+	//buffered so that Stop does not block, as nothing waits on doneChan
+	d.doneChan = make(chan bool, 1)
 	return d, nil
 }
 
@@ -68,6 +99,14 @@ func (d *handler) register(iMsg []*pb.Interest) error {
 			continue
 		}
 		d.addInterest(v)
+		if regInfo := v.GetChaincodeRegInfo(); regInfo != nil && regInfo.IsRegex {
+			//the expression compiled when the handler was registered
+			re, _ := compileEventNamePattern(regInfo.EventName)
+			if d.eventNamePatterns == nil {
+				d.eventNamePatterns = make(map[string]*regexp.Regexp)
+			}
+			d.eventNamePatterns[regInfo.EventName] = re
+		}
 	}
 
 	return nil
@@ -83,6 +122,7 @@ func (d *handler) deregister() {
 	}
 	// PM the following should release slice and its elements for GC?
 	d.interestedEvents = nil
+	d.eventNamePatterns = nil
 }
 
 // HandleMessage handles the Openchain messages for the Peer.
@@ -93,23 +133,170 @@ func (d *handler) HandleMessage(msg *pb.Event) error {
 		return fmt.Errorf("Invalid object from consumer %v", msg.GetEvent())
 	}
 
+	if eventsObj.Replay != nil && d.source == nil {
+		return fmt.Errorf("Replay of events is not supported")
+	}
+
+	d.sendLock.Lock()
+	d.headersOnly = eventsObj.HeadersOnly
+	if eventsObj.Replay != nil {
+		//queue the live events until the replay is done
+		d.replaying = true
+	}
+	d.sendLock.Unlock()
+
 	if err := d.register(eventsObj.Events); err != nil {
 		return fmt.Errorf("Could not register events %s", err)
 	}
 
 	//TODO return supported events.. for now just return the received msg
-	if err := d.ChatStream.Send(msg); err != nil {
+	if err := d.send(msg); err != nil {
 		return fmt.Errorf("Error sending response to %v:  %s", msg, err)
 	}
 
 	d.registered = true
 
+	if eventsObj.Replay != nil {
+		if err := d.replay(eventsObj.Replay.StartBlock); err == errReplayQueueFull {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("Error replaying events from block %d: %s", eventsObj.Replay.StartBlock, err)
+		}
+	}
+
 	return nil
 }
 
+// replay sends the events of the committed blocks from startBlock that the
+// consumer is interested in, then the live events queued in the meantime.
+// The live events of the replayed blocks are dropped. The replay stops with
+// errReplayQueueFull if too many live events are queued.
+func (d *handler) replay(startBlock uint64) error {
+	//the live events of the blocks committed from now on are queued, as
+	//the handler registered before the height is read
+	height := d.source.GetBlockchainSize()
+	var err error
+	for blockNumber := startBlock; blockNumber < height && err == nil; blockNumber++ {
+		if d.isPendingOverflow() {
+			err = errReplayQueueFull
+			break
+		}
+		var events []*pb.Event
+		if events, err = d.source.GetBlockEvents(blockNumber); err != nil {
+			break
+		}
+		for _, e := range events {
+			if d.isInterested(e) {
+				if err = d.send(d.eventToSend(e)); err != nil {
+					break
+				}
+			}
+		}
+	}
+
+	d.sendLock.Lock()
+	defer d.sendLock.Unlock()
+	if d.pendingOverflow {
+		//keep dropping the live events until the handler is stopped
+		d.pending = nil
+		return errReplayQueueFull
+	}
+	d.replaying = false
+	d.liveFromBlock = height
+	pending := d.pending
+	d.pending = nil
+	if err != nil {
+		return err
+	}
+	for _, e := range pending {
+		if !d.isReplayed(e) {
+			if err = d.ChatStream.Send(d.eventToSend(e)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *handler) isPendingOverflow() bool {
+	d.sendLock.Lock()
+	defer d.sendLock.Unlock()
+	return d.pendingOverflow
+}
+
+// isInterested returns true if the consumer registered for the event
+func (d *handler) isInterested(e *pb.Event) bool {
+	for _, interest := range d.interestedEvents {
+		switch getMessageType(e) {
+		case pb.EventType_BLOCK, pb.EventType_TRANSACTION_RESULT:
+			if interest.EventType == getMessageType(e) {
+				return true
+			}
+		case pb.EventType_CHAINCODE:
+			if interest.EventType != pb.EventType_CHAINCODE || interest.GetChaincodeRegInfo() == nil {
+				continue
+			}
+			regInfo := interest.GetChaincodeRegInfo()
+			if regInfo.ChaincodeID != e.GetChaincodeEvent().ChaincodeID {
+				continue
+			}
+			if regInfo.IsRegex {
+				if re := d.eventNamePatterns[regInfo.EventName]; re != nil && re.MatchString(e.GetChaincodeEvent().EventName) {
+					return true
+				}
+			} else if regInfo.EventName == "" || regInfo.EventName == e.GetChaincodeEvent().EventName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isReplayed returns true if the live event is for a block that has been
+// replayed
+func (d *handler) isReplayed(e *pb.Event) bool {
+	switch getMessageType(e) {
+	case pb.EventType_BLOCK, pb.EventType_CHAINCODE, pb.EventType_TRANSACTION_RESULT:
+		return e.BlockNumber < d.liveFromBlock
+	}
+	return false
+}
+
+// eventToSend returns the event as the consumer registered to receive it
+func (d *handler) eventToSend(e *pb.Event) *pb.Event {
+	if d.headersOnly {
+		return removePayloads(e)
+	}
+	return e
+}
+
+func (d *handler) send(msg *pb.Event) error {
+	d.sendLock.Lock()
+	defer d.sendLock.Unlock()
+	return d.ChatStream.Send(msg)
+}
+
 // SendMessage sends a message to the remote PEER through the stream
 func (d *handler) SendMessage(msg *pb.Event) error {
-	err := d.ChatStream.Send(msg)
+	d.sendLock.Lock()
+	defer d.sendLock.Unlock()
+	if d.replaying {
+		if d.pendingOverflow {
+			return nil
+		}
+		if d.maxPending > 0 && len(d.pending) >= d.maxPending {
+			producerLogger.Warningf("More than %d live events queued during a replay, disconnecting the consumer", d.maxPending)
+			d.pendingOverflow = true
+			d.pending = nil
+			return errReplayQueueFull
+		}
+		d.pending = append(d.pending, msg)
+		return nil
+	}
+	if d.isReplayed(msg) {
+		return nil
+	}
+	err := d.ChatStream.Send(d.eventToSend(msg))
 	if err != nil {
 		return fmt.Errorf("Error Sending message through ChatStream: %s", err)
 	}
@@ -29,19 +29,33 @@ const defaultTimeout = time.Second * 3
 
 var producerLogger = logging.MustGetLogger("eventhub_producer")
 
+// EventSource gives access to the events of the committed blocks, which are
+// replayed to the consumers that register with a start block
+type EventSource interface {
+	GetBlockchainSize() uint64
+	GetBlockEvents(blockNumber uint64) ([]*pb.Event, error)
+}
+
 // EventsServer implementation of the Peer service
 type EventsServer struct {
+	source EventSource
+	// maxPending is the number of live events queued for a consumer while
+	// its events are replayed
+	maxPending int
 }
 
 //singleton - if we want to create multiple servers, we need to subsume events.gEventConsumers into EventsServer
 var globalEventsServer *EventsServer
 
-// NewEventsServer returns a EventsServer
-func NewEventsServer(bufferSize uint, timeout int) *EventsServer {
+// NewEventsServer returns a EventsServer. The events replayed to consumers
+// are read from source, which may be nil if replay is not supported. A
+// consumer is disconnected if more than replayQueueSize live events arrive
+// while its events are replayed, zero for no limit
+func NewEventsServer(bufferSize uint, timeout int, source EventSource, replayQueueSize int) *EventsServer {
 	if globalEventsServer != nil {
 		panic("Cannot create multiple event hub servers")
 	}
-	globalEventsServer = new(EventsServer)
+	globalEventsServer = &EventsServer{source: source, maxPending: replayQueueSize}
 	initializeEvents(bufferSize, timeout)
 	//initializeCCEventProcessor(bufferSize, timeout)
 	return globalEventsServer
@@ -49,7 +63,7 @@ func NewEventsServer(bufferSize uint, timeout int) *EventsServer {
 
 // Chat implementation of the the Chat bidi streaming RPC function
 func (p *EventsServer) Chat(stream pb.Events_ChatServer) error {
-	handler, err := newEventHandler(stream)
+	handler, err := newEventHandler(stream, p.source, p.maxPending)
 	if err != nil {
 		return fmt.Errorf("Error creating handler during handleChat initiation: %s", err)
 	}
@@ -66,6 +80,11 @@ func (p *EventsServer) Chat(stream pb.Events_ChatServer) error {
 			return e
 		}
 		err = handler.HandleMessage(in)
+		if err == errReplayQueueFull {
+			//the consumer fell too far behind, end the stream
+			producerLogger.Errorf("Error handling message: %s", err)
+			return err
+		}
 		if err != nil {
 			producerLogger.Errorf("Error handling message: %s", err)
 			//return err
@@ -42,6 +42,10 @@ func getMessageType(e *pb.Event) pb.EventType {
 		return pb.EventType_CHAINCODE
 	case *pb.Event_Rejection:
 		return pb.EventType_REJECTION
+	case *pb.Event_TransactionResult:
+		return pb.EventType_TRANSACTION_RESULT
+	case *pb.Event_ConsensusEvidence:
+		return pb.EventType_CONSENSUS_EVIDENCE
 	default:
 		return -1
 	}
@@ -52,5 +56,7 @@ func addInternalEventTypes() {
 	AddEventType(pb.EventType_BLOCK)
 	AddEventType(pb.EventType_CHAINCODE)
 	AddEventType(pb.EventType_REJECTION)
+	AddEventType(pb.EventType_TRANSACTION_RESULT)
+	AddEventType(pb.EventType_CONSENSUS_EVIDENCE)
 	AddEventType(pb.EventType_REGISTER)
 }
@@ -0,0 +1,67 @@
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+func checkQuery(t *testing.T, stub *shim.MockStub, name string, value string) {
+	bytes, err := stub.MockQuery("query", []string{name})
+	if err != nil {
+		t.Fatalf("Query %s failed: %s", name, err)
+	}
+	if string(bytes) != value {
+		t.Fatalf("Expected %s to hold %s, got %s", name, value, bytes)
+	}
+}
+
+func TestExample02_Init(t *testing.T) {
+	stub := shim.NewMockStub("ex02", new(SimpleChaincode))
+
+	if _, err := stub.MockInit("1", "init", []string{"A", "123", "B", "234"}); err != nil {
+		t.Fatalf("Init failed: %s", err)
+	}
+
+	checkQuery(t, stub, "A", "123")
+	checkQuery(t, stub, "B", "234")
+}
+
+func TestExample02_Invoke(t *testing.T) {
+	stub := shim.NewMockStub("ex02", new(SimpleChaincode))
+	stub.MockInit("1", "init", []string{"A", "567", "B", "678"})
+
+	if _, err := stub.MockInvoke("2", "invoke", []string{"A", "B", "123"}); err != nil {
+		t.Fatalf("Invoke failed: %s", err)
+	}
+	checkQuery(t, stub, "A", "444")
+	checkQuery(t, stub, "B", "801")
+
+	if _, err := stub.MockInvoke("3", "invoke", []string{"A", "C", "10"}); err == nil {
+		t.Fatalf("Expected the transfer to an unknown entity to fail")
+	}
+	checkQuery(t, stub, "A", "444")
+
+	if _, err := stub.MockInvoke("4", "delete", []string{"A"}); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if _, err := stub.MockQuery("query", []string{"A"}); err == nil {
+		t.Fatalf("Expected A to be deleted")
+	}
+}
@@ -29,7 +29,7 @@ import (
 )
 
 type adapter struct {
-	notfy              chan *pb.Event_Block
+	notfy              chan *pb.Event
 	rejected           chan *pb.Event_Rejection
 	listenToRejections bool
 }
@@ -41,8 +41,8 @@ func (a *adapter) GetInterestedEvents() ([]*pb.Interest, error) {
 
 //Recv implements consumer.EventAdapter interface for receiving events
 func (a *adapter) Recv(msg *pb.Event) (bool, error) {
-	if o, e := msg.Event.(*pb.Event_Block); e {
-		a.notfy <- o
+	if _, e := msg.Event.(*pb.Event_Block); e {
+		a.notfy <- msg
 		return true, nil
 	}
 	if o, e := msg.Event.(*pb.Event_Rejection); e && a.listenToRejections {
@@ -59,13 +59,17 @@ func (a *adapter) Disconnected(err error) {
 	os.Exit(1)
 }
 
-func createEventClient(eventAddress string, listenToRejections bool) *adapter {
+func createEventClient(eventAddress string, listenToRejections bool, startBlock int64) *adapter {
 	var obcEHClient *consumer.EventsClient
 
-	done := make(chan *pb.Event_Block)
+	done := make(chan *pb.Event)
 	reject := make(chan *pb.Event_Rejection)
 	adapter := &adapter{notfy: done, rejected: reject, listenToRejections: listenToRejections}
-	obcEHClient = consumer.NewEventsClient(eventAddress, adapter)
+	if startBlock < 0 {
+		obcEHClient = consumer.NewEventsClient(eventAddress, adapter)
+	} else {
+		obcEHClient = consumer.NewEventsClientFromBlock(eventAddress, uint64(startBlock), adapter)
+	}
 	if err := obcEHClient.Start(); err != nil {
 		fmt.Printf("could not start chat %s\n", err)
 		obcEHClient.Stop()
@@ -78,13 +82,15 @@ func createEventClient(eventAddress string, listenToRejections bool) *adapter {
 func main() {
 	var eventAddress string
 	var listenToRejections bool
+	var startBlock int64
 	flag.StringVar(&eventAddress, "events-address", "0.0.0.0:31315", "address of events server")
 	flag.BoolVar(&listenToRejections, "listen-to-rejections", false, "whether to listen to rejection events")
+	flag.Int64Var(&startBlock, "start-block", -1, "block from which to replay the blocks already committed, only new blocks if negative")
 	flag.Parse()
 
 	fmt.Printf("Event Address: %s\n", eventAddress)
 
-	a := createEventClient(eventAddress, listenToRejections)
+	a := createEventClient(eventAddress, listenToRejections, startBlock)
 	if a == nil {
 		fmt.Printf("Error creating event client\n")
 		return
@@ -95,9 +101,9 @@ func main() {
 		case b := <-a.notfy:
 			fmt.Printf("\n")
 			fmt.Printf("\n")
-			fmt.Printf("Received block\n")
+			fmt.Printf("Received block %d\n", b.BlockNumber)
 			fmt.Printf("--------------\n")
-			for _, r := range b.Block.Transactions {
+			for _, r := range b.GetBlock().Transactions {
 				fmt.Printf("Transaction:\n\t[%v]\n", r)
 			}
 		case r := <-a.rejected:
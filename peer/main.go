@@ -52,6 +52,7 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode"
 	"github.com/hyperledger/fabric/core/comm"
 	"github.com/hyperledger/fabric/core/crypto"
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/genesis"
 	"github.com/hyperledger/fabric/core/peer"
 	"github.com/hyperledger/fabric/core/rest"
@@ -131,6 +132,37 @@ var nodeStatusCmd = &cobra.Command{
 	},
 }
 
+var nodeConsensusStatusCmd = &cobra.Command{
+	Use:   "consensus-status",
+	Short: "Returns the consensus status of the node.",
+	Long:  `Returns a snapshot of the state of the consensus plugin of the running validating node, such as its view and watermarks.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return consensusStatus()
+	},
+}
+
+var nodeConsensusEvidenceCmd = &cobra.Command{
+	Use:   "consensus-evidence",
+	Short: "Returns the evidence of misbehaving validators.",
+	Long:  `Returns the signed evidence of misbehavior, such as conflicting pre-prepares or checkpoints, which the consensus plugin of the running validating node collected against other validators.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return consensusEvidence()
+	},
+}
+
+var (
+	reconfigureF int
+)
+
+var nodeConsensusReconfigureCmd = &cobra.Command{
+	Use:   "consensus-reconfigure <replica>...",
+	Short: "Requests a new validator replica set.",
+	Long:  `Requests that the validating network switch to the given replica set, tolerating --f byzantine validators. The administrators of enough validators must request the same replica set before it takes effect.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return consensusReconfigure(args)
+	},
+}
+
 var (
 	stopPidFile string
 )
@@ -207,6 +239,8 @@ var (
 	chaincodeQueryHex       bool
 	chaincodeAttributesJSON string
 	customIDGenAlg          string
+	chaincodeUpgradeName    string
+	chaincodeCarryState     bool
 )
 
 // Peer command version flag
@@ -253,6 +287,26 @@ var chaincodeQueryCmd = &cobra.Command{
 	},
 }
 
+var chaincodeUpgradeCmd = &cobra.Command{
+	Use:       "upgrade",
+	Short:     fmt.Sprintf("Upgrade the specified %s to a new version.", chainFuncName),
+	Long:      fmt.Sprintf(`Upgrade the %s given by name to the %s found at path, which replaces it.`, chainFuncName, chainFuncName),
+	ValidArgs: []string{"1"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return chaincodeUpgrade(cmd, args)
+	},
+}
+
+var chaincodeTerminateCmd = &cobra.Command{
+	Use:       "terminate",
+	Short:     fmt.Sprintf("Terminate the specified %s.", chainFuncName),
+	Long:      fmt.Sprintf(`Terminate the specified %s, which can no longer be invoked or queried.`, chainFuncName),
+	ValidArgs: []string{"1"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return chaincodeTerminate(cmd, args)
+	},
+}
+
 func main() {
 	// For environment variables.
 	viper.SetEnvPrefix(cmdRoot)
@@ -298,6 +352,11 @@ func main() {
 
 	nodeCmd.AddCommand(nodeStartCmd)
 	nodeCmd.AddCommand(nodeStatusCmd)
+	nodeCmd.AddCommand(nodeConsensusStatusCmd)
+	nodeCmd.AddCommand(nodeConsensusEvidenceCmd)
+
+	nodeConsensusReconfigureCmd.Flags().IntVar(&reconfigureF, "f", 0, "Number of byzantine validators the new replica set tolerates")
+	nodeCmd.AddCommand(nodeConsensusReconfigureCmd)
 
 	nodeStopCmd.Flags().StringVar(&stopPidFile, "stop-peer-pid-file", viper.GetString("peer.fileSystemPath"), "Location of peer pid local file, for forces kill")
 	nodeCmd.AddCommand(nodeStopCmd)
@@ -327,9 +386,14 @@ func main() {
 	chaincodeQueryCmd.Flags().BoolVarP(&chaincodeQueryRaw, "raw", "r", false, "If true, output the query value as raw bytes, otherwise format as a printable string")
 	chaincodeQueryCmd.Flags().BoolVarP(&chaincodeQueryHex, "hex", "x", false, "If true, output the query value byte array in hexadecimal. Incompatible with --raw")
 
+	chaincodeUpgradeCmd.Flags().BoolVarP(&chaincodeCarryState, "carry-state", "s", true, fmt.Sprintf("If true, the state of the upgraded %s is copied to the new version", chainFuncName))
+	chaincodeUpgradeCmd.Flags().StringVarP(&chaincodeUpgradeName, "new-name", "N", undefinedParamValue, fmt.Sprintf("Name of the new version of the %s in development mode", chainFuncName))
+
 	chaincodeCmd.AddCommand(chaincodeDeployCmd)
 	chaincodeCmd.AddCommand(chaincodeInvokeCmd)
 	chaincodeCmd.AddCommand(chaincodeQueryCmd)
+	chaincodeCmd.AddCommand(chaincodeUpgradeCmd)
+	chaincodeCmd.AddCommand(chaincodeTerminateCmd)
 
 	mainCmd.AddCommand(chaincodeCmd)
 
@@ -369,7 +433,12 @@ func createEventHubServer() (net.Listener, *grpc.Server, error) {
 		}
 
 		grpcServer = grpc.NewServer(opts...)
-		ehServer := producer.NewEventsServer(uint(viper.GetInt("peer.validator.events.buffersize")), viper.GetInt("peer.validator.events.timeout"))
+		//the ledger is the source of the events replayed to consumers
+		eventSource, err := ledger.GetLedger()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to get the ledger: %v", err)
+		}
+		ehServer := producer.NewEventsServer(uint(viper.GetInt("peer.validator.events.buffersize")), viper.GetInt("peer.validator.events.timeout"), eventSource, viper.GetInt("peer.validator.events.replayQueueSize"))
 		pb.RegisterEventsServer(grpcServer, ehServer)
 	}
 	return lis, grpcServer, err
@@ -518,7 +587,7 @@ func serve(args []string) error {
 	pb.RegisterPeerServer(grpcServer, peerServer)
 
 	// Register the Admin server
-	pb.RegisterAdminServer(grpcServer, core.NewAdminServer())
+	pb.RegisterAdminServer(grpcServer, core.NewAdminServerWithConsensus(peerServer))
 
 	// Register Devops server
 	serverDevops := core.NewDevopsServer(peerServer)
@@ -609,6 +678,76 @@ func status() (err error) {
 	return nil
 }
 
+// Show a snapshot of the state of the consensus plugin of the local validating peer
+func consensusStatus() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+	serverClient := pb.NewAdminClient(clientConn)
+	status, err := serverClient.GetConsensusStatus(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		err = fmt.Errorf("Error trying to get consensus status: %s", err)
+		return
+	}
+
+	jsonOutput, _ := json.Marshal(status)
+	fmt.Println(string(jsonOutput))
+	return nil
+}
+
+// Show the evidence of misbehaving validators collected by the consensus plugin of the local validating peer
+func consensusEvidence() (err error) {
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+	serverClient := pb.NewAdminClient(clientConn)
+	evidence, err := serverClient.GetConsensusEvidence(context.Background(), &google_protobuf.Empty{})
+	if err != nil {
+		err = fmt.Errorf("Error trying to get consensus evidence: %s", err)
+		return
+	}
+
+	jsonOutput, _ := json.Marshal(evidence)
+	fmt.Println(string(jsonOutput))
+	return nil
+}
+
+// Request a new replica set from the consensus plugin of the local validating peer
+func consensusReconfigure(args []string) (err error) {
+	if len(args) == 0 {
+		return fmt.Errorf("Must supply the IDs of the replicas of the new replica set")
+	}
+	if reconfigureF < 0 {
+		return fmt.Errorf("Cannot tolerate a negative number of byzantine validators (%d)", reconfigureF)
+	}
+	reconfiguration := &pb.ConsensusReconfiguration{F: uint32(reconfigureF)}
+	for _, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid replica ID %s: %s", arg, err)
+		}
+		reconfiguration.Replicas = append(reconfiguration.Replicas, id)
+	}
+
+	clientConn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		err = fmt.Errorf("Error trying to connect to local peer: %s", err)
+		return
+	}
+	serverClient := pb.NewAdminClient(clientConn)
+	if _, err = serverClient.ReconfigureConsensus(context.Background(), reconfiguration); err != nil {
+		err = fmt.Errorf("Error trying to reconfigure consensus: %s", err)
+		return
+	}
+
+	fmt.Printf("Requested replica set %v (f=%d)\n", reconfiguration.Replicas, reconfiguration.F)
+	return nil
+}
+
 func stop() (err error) {
 	clientConn, err := peer.NewPeerClientConnection()
 	if err != nil {
@@ -853,8 +992,25 @@ func chaincodeDeploy(cmd *cobra.Command, args []string) (err error) {
 		ChaincodeID: &pb.ChaincodeID{Path: chaincodePath, Name: chaincodeName}, CtorMsg: input, Attributes: attributes}
 
 	// If security is enabled, add client login token
+	if err = setChaincodeSecureContext(spec, true); err != nil {
+		return
+	}
+
+	chaincodeDeploymentSpec, err := devopsClient.Deploy(context.Background(), spec)
+	if err != nil {
+		err = fmt.Errorf("Error building %s: %s\n", chainFuncName, err)
+		return
+	}
+	logger.Infof("Deploy result: %s", chaincodeDeploymentSpec.ChaincodeSpec)
+	fmt.Println(chaincodeDeploymentSpec.ChaincodeSpec.ChaincodeID.Name)
+	return nil
+}
+
+// setChaincodeSecureContext adds the login token of the user to the spec when
+// security is enabled. Unless confidential is false, the spec is marked as
+// confidential when privacy is enabled.
+func setChaincodeSecureContext(spec *pb.ChaincodeSpec, confidential bool) (err error) {
 	if core.SecurityEnabled() {
-		logger.Debug("Security is enabled. Include security context in deploy spec")
 		if chaincodeUsr == undefinedParamValue {
 			err = errors.New("Must supply username for chaincode when security is enabled")
 			return
@@ -878,7 +1034,7 @@ func chaincodeDeploy(cmd *cobra.Command, args []string) (err error) {
 			spec.SecureContext = string(token)
 
 			// If privacy is enabled, mark chaincode as confidential
-			if viper.GetBool("security.privacy") {
+			if confidential && viper.GetBool("security.privacy") {
 				logger.Info("Set confidentiality level to CONFIDENTIAL.\n")
 				spec.ConfidentialityLevel = pb.ConfidentialityLevel_CONFIDENTIAL
 			}
@@ -899,17 +1055,99 @@ func chaincodeDeploy(cmd *cobra.Command, args []string) (err error) {
 			panic(errors.New("Privacy cannot be enabled as requested because security is disabled"))
 		}
 	}
+	return
+}
 
-	chaincodeDeploymentSpec, err := devopsClient.Deploy(context.Background(), spec)
+// chaincodeUpgrade upgrades the chaincode given by name to the chaincode found
+// at path. On success, the name (hash) of the new chaincode is printed to
+// STDOUT for use by subsequent chaincode-related CLI commands.
+func chaincodeUpgrade(cmd *cobra.Command, args []string) (err error) {
+	if chaincodeName == undefinedParamValue {
+		err = fmt.Errorf("Must supply the name of the %s to upgrade.\n", chainFuncName)
+		return
+	}
+	if chaincodePath == undefinedParamValue && chaincodeUpgradeName == undefinedParamValue {
+		err = fmt.Errorf("Must supply value for %s path parameter.\n", chainFuncName)
+		return
+	}
+	if err = checkChaincodeCmdParams(cmd); err != nil {
+		return
+	}
+	devopsClient, err := getDevopsClient(cmd)
 	if err != nil {
-		err = fmt.Errorf("Error building %s: %s\n", chainFuncName, err)
+		err = fmt.Errorf("Error building %s: %s", chainFuncName, err)
 		return
 	}
-	logger.Infof("Deploy result: %s", chaincodeDeploymentSpec.ChaincodeSpec)
+	// Build the spec of the new chaincode
+	input := &pb.ChaincodeInput{}
+	if err = json.Unmarshal([]byte(chaincodeCtorJSON), &input); err != nil {
+		err = fmt.Errorf("Chaincode argument error: %s", err)
+		return
+	}
+
+	var attributes []string
+	if err = json.Unmarshal([]byte(chaincodeAttributesJSON), &attributes); err != nil {
+		err = fmt.Errorf("Chaincode argument error: %s", err)
+		return
+	}
+
+	chaincodeLang = strings.ToUpper(chaincodeLang)
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_Type(pb.ChaincodeSpec_Type_value[chaincodeLang]),
+		ChaincodeID: &pb.ChaincodeID{Path: chaincodePath, Name: chaincodeUpgradeName}, CtorMsg: input, Attributes: attributes}
+
+	// If security is enabled, add client login token. Upgrades are public.
+	if err = setChaincodeSecureContext(spec, false); err != nil {
+		return
+	}
+
+	upgradeSpec := &pb.ChaincodeUpgradeSpec{
+		ChaincodeDeploymentSpec: &pb.ChaincodeDeploymentSpec{ChaincodeSpec: spec},
+		PreviousChaincodeID:     &pb.ChaincodeID{Name: chaincodeName},
+		CarryState:              chaincodeCarryState,
+	}
+	chaincodeDeploymentSpec, err := devopsClient.Upgrade(context.Background(), upgradeSpec)
+	if err != nil {
+		err = fmt.Errorf("Error upgrading %s: %s\n", chainFuncName, err)
+		return
+	}
+	logger.Infof("Upgrade result: %s", chaincodeDeploymentSpec.ChaincodeSpec)
 	fmt.Println(chaincodeDeploymentSpec.ChaincodeSpec.ChaincodeID.Name)
 	return nil
 }
 
+// chaincodeTerminate terminates the chaincode given by name. On success, the
+// transaction ID is printed to STDOUT.
+func chaincodeTerminate(cmd *cobra.Command, args []string) (err error) {
+	if chaincodeName == undefinedParamValue {
+		err = errors.New("Name not given for terminate")
+		return
+	}
+	devopsClient, err := getDevopsClient(cmd)
+	if err != nil {
+		err = fmt.Errorf("Error building %s: %s", chainFuncName, err)
+		return
+	}
+
+	chaincodeLang = strings.ToUpper(chaincodeLang)
+	spec := &pb.ChaincodeSpec{Type: pb.ChaincodeSpec_Type(pb.ChaincodeSpec_Type_value[chaincodeLang]),
+		ChaincodeID: &pb.ChaincodeID{Name: chaincodeName}}
+
+	// If security is enabled, add client login token. Terminations are public.
+	if err = setChaincodeSecureContext(spec, false); err != nil {
+		return
+	}
+
+	resp, err := devopsClient.Terminate(context.Background(), spec)
+	if err != nil {
+		err = fmt.Errorf("Error terminating %s: %s\n", chainFuncName, err)
+		return
+	}
+	transactionID := string(resp.Msg)
+	logger.Infof("Successfully submitted terminate transaction: %s(%s)", chaincodeName, transactionID)
+	fmt.Println(transactionID)
+	return nil
+}
+
 func chaincodeInvoke(cmd *cobra.Command, args []string) error {
 	return chaincodeInvokeOrQuery(cmd, args, true)
 }
@@ -958,50 +1196,8 @@ func chaincodeInvokeOrQuery(cmd *cobra.Command, args []string, invoke bool) (err
 		ChaincodeID: &pb.ChaincodeID{Name: chaincodeName}, CtorMsg: input, Attributes: attributes}
 
 	// If security is enabled, add client login token
-	if core.SecurityEnabled() {
-		if chaincodeUsr == undefinedParamValue {
-			err = errors.New("Must supply username for chaincode when security is enabled")
-			return
-		}
-
-		// Retrieve the CLI data storage path
-		// Returns /var/openchain/production/client/
-		localStore := getCliFilePath()
-
-		// Check if the user is logged in before sending transaction
-		if _, err = os.Stat(localStore + "loginToken_" + chaincodeUsr); err == nil {
-			logger.Infof("Local user '%s' is already logged in. Retrieving login token.\n", chaincodeUsr)
-
-			// Read in the login token
-			token, err := ioutil.ReadFile(localStore + "loginToken_" + chaincodeUsr)
-			if err != nil {
-				panic(fmt.Errorf("Fatal error when reading client login token: %s\n", err))
-			}
-
-			// Add the login token to the chaincodeSpec
-			spec.SecureContext = string(token)
-
-			// If privacy is enabled, mark chaincode as confidential
-			if viper.GetBool("security.privacy") {
-				logger.Info("Set confidentiality level to CONFIDENTIAL.\n")
-				spec.ConfidentialityLevel = pb.ConfidentialityLevel_CONFIDENTIAL
-			}
-		} else {
-			// Check if the token is not there and fail
-			if os.IsNotExist(err) {
-				err = fmt.Errorf("User '%s' not logged in. Use the 'login' command to obtain a security token.", chaincodeUsr)
-				return
-			}
-			// Unexpected error
-			panic(fmt.Errorf("Fatal error when checking for client login token: %s\n", err))
-		}
-	} else {
-		if chaincodeUsr != undefinedParamValue {
-			logger.Warning("Username supplied but security is disabled.")
-		}
-		if viper.GetBool("security.privacy") {
-			panic(errors.New("Privacy cannot be enabled as requested because security is disabled"))
-		}
+	if err = setChaincodeSecureContext(spec, true); err != nil {
+		return
 	}
 
 	// Build the ChaincodeInvocationSpec message
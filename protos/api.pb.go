@@ -22,6 +22,8 @@ It has these top-level messages:
 	ChaincodeInput
 	ChaincodeSpec
 	ChaincodeDeploymentSpec
+	ChaincodeUpgradeSpec
+	ChaincodeLifecycle
 	ChaincodeInvocationSpec
 	ChaincodeSecurityContext
 	ChaincodeMessage
@@ -31,6 +33,10 @@ It has these top-level messages:
 	RangeQueryStateClose
 	RangeQueryStateKeyValue
 	RangeQueryStateResponse
+	ExecuteQuery
+	GetHistoryForKey
+	KeyModification
+	GetHistoryForKeyResponse
 	Secret
 	SigmaInput
 	ExecuteWithBinding
@@ -40,6 +46,7 @@ It has these top-level messages:
 	ChaincodeReg
 	Interest
 	Register
+	Replay
 	Rejection
 	Event
 	Transaction
@@ -40,6 +40,26 @@ func (x ConfidentialityLevel) String() string {
 	return proto.EnumName(ConfidentialityLevel_name, int32(x))
 }
 
+type ChaincodeLifecycle_Status int32
+
+const (
+	ChaincodeLifecycle_ACTIVE     ChaincodeLifecycle_Status = 0
+	ChaincodeLifecycle_TERMINATED ChaincodeLifecycle_Status = 1
+)
+
+var ChaincodeLifecycle_Status_name = map[int32]string{
+	0: "ACTIVE",
+	1: "TERMINATED",
+}
+var ChaincodeLifecycle_Status_value = map[string]int32{
+	"ACTIVE":     0,
+	"TERMINATED": 1,
+}
+
+func (x ChaincodeLifecycle_Status) String() string {
+	return proto.EnumName(ChaincodeLifecycle_Status_name, int32(x))
+}
+
 type ChaincodeSpec_Type int32
 
 const (
@@ -113,6 +133,8 @@ const (
 	ChaincodeMessage_RANGE_QUERY_STATE_NEXT  ChaincodeMessage_Type = 18
 	ChaincodeMessage_RANGE_QUERY_STATE_CLOSE ChaincodeMessage_Type = 19
 	ChaincodeMessage_KEEPALIVE               ChaincodeMessage_Type = 20
+	ChaincodeMessage_GET_HISTORY_FOR_KEY     ChaincodeMessage_Type = 21
+	ChaincodeMessage_EXECUTE_QUERY           ChaincodeMessage_Type = 22
 )
 
 var ChaincodeMessage_Type_name = map[int32]string{
@@ -137,6 +159,8 @@ var ChaincodeMessage_Type_name = map[int32]string{
 	18: "RANGE_QUERY_STATE_NEXT",
 	19: "RANGE_QUERY_STATE_CLOSE",
 	20: "KEEPALIVE",
+	21: "GET_HISTORY_FOR_KEY",
+	22: "EXECUTE_QUERY",
 }
 var ChaincodeMessage_Type_value = map[string]int32{
 	"UNDEFINED":               0,
@@ -160,6 +184,8 @@ var ChaincodeMessage_Type_value = map[string]int32{
 	"RANGE_QUERY_STATE_NEXT":  18,
 	"RANGE_QUERY_STATE_CLOSE": 19,
 	"KEEPALIVE":               20,
+	"GET_HISTORY_FOR_KEY":     21,
+	"EXECUTE_QUERY":           22,
 }
 
 func (x ChaincodeMessage_Type) String() string {
@@ -185,6 +211,46 @@ func (m *ChaincodeID) Reset()         { *m = ChaincodeID{} }
 func (m *ChaincodeID) String() string { return proto.CompactTextString(m) }
 func (*ChaincodeID) ProtoMessage()    {}
 
+// Carries the chaincode deployed by an upgrade transaction and the chaincode
+// it replaces. With carryState, the state of the previous chaincode is copied
+// to the new one before its `Init` function is called.
+type ChaincodeUpgradeSpec struct {
+	ChaincodeDeploymentSpec *ChaincodeDeploymentSpec `protobuf:"bytes,1,opt,name=chaincodeDeploymentSpec" json:"chaincodeDeploymentSpec,omitempty"`
+	PreviousChaincodeID     *ChaincodeID             `protobuf:"bytes,2,opt,name=previousChaincodeID" json:"previousChaincodeID,omitempty"`
+	CarryState              bool                     `protobuf:"varint,3,opt,name=carryState" json:"carryState,omitempty"`
+}
+
+func (m *ChaincodeUpgradeSpec) Reset()         { *m = ChaincodeUpgradeSpec{} }
+func (m *ChaincodeUpgradeSpec) String() string { return proto.CompactTextString(m) }
+func (*ChaincodeUpgradeSpec) ProtoMessage()    {}
+
+func (m *ChaincodeUpgradeSpec) GetChaincodeDeploymentSpec() *ChaincodeDeploymentSpec {
+	if m != nil {
+		return m.ChaincodeDeploymentSpec
+	}
+	return nil
+}
+
+func (m *ChaincodeUpgradeSpec) GetPreviousChaincodeID() *ChaincodeID {
+	if m != nil {
+		return m.PreviousChaincodeID
+	}
+	return nil
+}
+
+// The lifecycle of a deployed chaincode as recorded on the ledger. version
+// starts at 1 and is incremented by each upgrade.
+type ChaincodeLifecycle struct {
+	Status              ChaincodeLifecycle_Status `protobuf:"varint,1,opt,name=status,enum=protos.ChaincodeLifecycle_Status" json:"status,omitempty"`
+	Version             uint64                    `protobuf:"varint,2,opt,name=version" json:"version,omitempty"`
+	PreviousChaincodeID string                    `protobuf:"bytes,3,opt,name=previousChaincodeID" json:"previousChaincodeID,omitempty"`
+	UpgradedChaincodeID string                    `protobuf:"bytes,4,opt,name=upgradedChaincodeID" json:"upgradedChaincodeID,omitempty"`
+}
+
+func (m *ChaincodeLifecycle) Reset()         { *m = ChaincodeLifecycle{} }
+func (m *ChaincodeLifecycle) String() string { return proto.CompactTextString(m) }
+func (*ChaincodeLifecycle) ProtoMessage()    {}
+
 // Carries the chaincode function and its arguments.
 type ChaincodeInput struct {
 	Function string   `protobuf:"bytes,1,opt,name=function" json:"function,omitempty"`
@@ -234,6 +300,8 @@ type ChaincodeDeploymentSpec struct {
 	EffectiveDate *google_protobuf.Timestamp                   `protobuf:"bytes,2,opt,name=effectiveDate" json:"effectiveDate,omitempty"`
 	CodePackage   []byte                                       `protobuf:"bytes,3,opt,name=codePackage,proto3" json:"codePackage,omitempty"`
 	ExecEnv       ChaincodeDeploymentSpec_ExecutionEnvironment `protobuf:"varint,4,opt,name=execEnv,enum=protos.ChaincodeDeploymentSpec_ExecutionEnvironment" json:"execEnv,omitempty"`
+	// Enrollment IDs allowed to upgrade and terminate the chaincode
+	Administrators []string `protobuf:"bytes,5,rep,name=administrators" json:"administrators,omitempty"`
 }
 
 func (m *ChaincodeDeploymentSpec) Reset()         { *m = ChaincodeDeploymentSpec{} }
@@ -312,7 +380,10 @@ type ChaincodeMessage struct {
 	// event emmited by chaincode. Used only with Init or Invoke.
 	// This event is then stored (currently)
 	// with Block.NonHashData.TransactionResult
+	// If the chaincode set several events, this is the last one
 	ChaincodeEvent *ChaincodeEvent `protobuf:"bytes,6,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	// events emitted by chaincode, in the order they were set
+	ChaincodeEvents []*ChaincodeEvent `protobuf:"bytes,7,rep,name=chaincodeEvents" json:"chaincodeEvents,omitempty"`
 }
 
 func (m *ChaincodeMessage) Reset()         { *m = ChaincodeMessage{} }
@@ -340,6 +411,13 @@ func (m *ChaincodeMessage) GetChaincodeEvent() *ChaincodeEvent {
 	return nil
 }
 
+func (m *ChaincodeMessage) GetChaincodeEvents() []*ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvents
+	}
+	return nil
+}
+
 type PutStateInfo struct {
 	Key   string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
 	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
@@ -400,8 +478,63 @@ func (m *RangeQueryStateResponse) GetKeysAndValues() []*RangeQueryStateKeyValue
 	return nil
 }
 
+// ExecuteQuery is a rich query over the JSON values of the chaincode. The results
+// are returned in a RangeQueryStateResponse and are paged with RANGE_QUERY_STATE_NEXT.
+type ExecuteQuery struct {
+	Query string `protobuf:"bytes,1,opt,name=query" json:"query,omitempty"`
+}
+
+func (m *ExecuteQuery) Reset()         { *m = ExecuteQuery{} }
+func (m *ExecuteQuery) String() string { return proto.CompactTextString(m) }
+func (*ExecuteQuery) ProtoMessage()    {}
+
+// GetHistoryForKey requests a page of the modifications of a key. The first page
+// is requested with fromBlock and fromSequence unset, the next ones with the
+// nextBlockNumber and nextSequence of the previous GetHistoryForKeyResponse.
+type GetHistoryForKey struct {
+	Key          string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+	FromBlock    uint64 `protobuf:"varint,2,opt,name=fromBlock" json:"fromBlock,omitempty"`
+	FromSequence uint64 `protobuf:"varint,3,opt,name=fromSequence" json:"fromSequence,omitempty"`
+}
+
+func (m *GetHistoryForKey) Reset()         { *m = GetHistoryForKey{} }
+func (m *GetHistoryForKey) String() string { return proto.CompactTextString(m) }
+func (*GetHistoryForKey) ProtoMessage()    {}
+
+// KeyModification is a single change made to a key by a committed transaction.
+// value is not set if the transaction deleted the key.
+type KeyModification struct {
+	Uuid        string `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	BlockNumber uint64 `protobuf:"varint,2,opt,name=blockNumber" json:"blockNumber,omitempty"`
+	Value       []byte `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	IsDelete    bool   `protobuf:"varint,4,opt,name=isDelete" json:"isDelete,omitempty"`
+}
+
+func (m *KeyModification) Reset()         { *m = KeyModification{} }
+func (m *KeyModification) String() string { return proto.CompactTextString(m) }
+func (*KeyModification) ProtoMessage()    {}
+
+type GetHistoryForKeyResponse struct {
+	Modifications   []*KeyModification `protobuf:"bytes,1,rep,name=modifications" json:"modifications,omitempty"`
+	HasMore         bool               `protobuf:"varint,2,opt,name=hasMore" json:"hasMore,omitempty"`
+	NextBlockNumber uint64             `protobuf:"varint,3,opt,name=nextBlockNumber" json:"nextBlockNumber,omitempty"`
+	NextSequence    uint64             `protobuf:"varint,4,opt,name=nextSequence" json:"nextSequence,omitempty"`
+}
+
+func (m *GetHistoryForKeyResponse) Reset()         { *m = GetHistoryForKeyResponse{} }
+func (m *GetHistoryForKeyResponse) String() string { return proto.CompactTextString(m) }
+func (*GetHistoryForKeyResponse) ProtoMessage()    {}
+
+func (m *GetHistoryForKeyResponse) GetModifications() []*KeyModification {
+	if m != nil {
+		return m.Modifications
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("protos.ConfidentialityLevel", ConfidentialityLevel_name, ConfidentialityLevel_value)
+	proto.RegisterEnum("protos.ChaincodeLifecycle_Status", ChaincodeLifecycle_Status_name, ChaincodeLifecycle_Status_value)
 	proto.RegisterEnum("protos.ChaincodeSpec_Type", ChaincodeSpec_Type_name, ChaincodeSpec_Type_value)
 	proto.RegisterEnum("protos.ChaincodeDeploymentSpec_ExecutionEnvironment", ChaincodeDeploymentSpec_ExecutionEnvironment_name, ChaincodeDeploymentSpec_ExecutionEnvironment_value)
 	proto.RegisterEnum("protos.ChaincodeMessage_Type", ChaincodeMessage_Type_name, ChaincodeMessage_Type_value)
@@ -142,6 +142,13 @@ type DevopsClient interface {
 	Invoke(ctx context.Context, in *ChaincodeInvocationSpec, opts ...grpc.CallOption) (*Response, error)
 	// Invoke chaincode.
 	Query(ctx context.Context, in *ChaincodeInvocationSpec, opts ...grpc.CallOption) (*Response, error)
+	// Upgrade a deployed chaincode to the chaincode of the deployment spec,
+	// whose code package is built by the server.
+	Upgrade(ctx context.Context, in *ChaincodeUpgradeSpec, opts ...grpc.CallOption) (*ChaincodeDeploymentSpec, error)
+	// Terminate a deployed chaincode.
+	Terminate(ctx context.Context, in *ChaincodeSpec, opts ...grpc.CallOption) (*Response, error)
+	// Retrieve the result of a transaction once its block is committed.
+	GetTransactionResult(ctx context.Context, in *TransactionRequest, opts ...grpc.CallOption) (*TransactionResult, error)
 	// Retrieve a TCert.
 	EXP_GetApplicationTCert(ctx context.Context, in *Secret, opts ...grpc.CallOption) (*Response, error)
 	// Prepare for performing a TX, which will return a binding that can later be used to sign and then execute a transaction.
@@ -205,6 +212,33 @@ func (c *devopsClient) Query(ctx context.Context, in *ChaincodeInvocationSpec, o
 	return out, nil
 }
 
+func (c *devopsClient) Upgrade(ctx context.Context, in *ChaincodeUpgradeSpec, opts ...grpc.CallOption) (*ChaincodeDeploymentSpec, error) {
+	out := new(ChaincodeDeploymentSpec)
+	err := grpc.Invoke(ctx, "/protos.Devops/Upgrade", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *devopsClient) Terminate(ctx context.Context, in *ChaincodeSpec, opts ...grpc.CallOption) (*Response, error) {
+	out := new(Response)
+	err := grpc.Invoke(ctx, "/protos.Devops/Terminate", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *devopsClient) GetTransactionResult(ctx context.Context, in *TransactionRequest, opts ...grpc.CallOption) (*TransactionResult, error) {
+	out := new(TransactionResult)
+	err := grpc.Invoke(ctx, "/protos.Devops/GetTransactionResult", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *devopsClient) EXP_GetApplicationTCert(ctx context.Context, in *Secret, opts ...grpc.CallOption) (*Response, error) {
 	out := new(Response)
 	err := grpc.Invoke(ctx, "/protos.Devops/EXP_GetApplicationTCert", in, out, c.cc, opts...)
@@ -255,6 +289,13 @@ type DevopsServer interface {
 	Invoke(context.Context, *ChaincodeInvocationSpec) (*Response, error)
 	// Invoke chaincode.
 	Query(context.Context, *ChaincodeInvocationSpec) (*Response, error)
+	// Upgrade a deployed chaincode to the chaincode of the deployment spec,
+	// whose code package is built by the server.
+	Upgrade(context.Context, *ChaincodeUpgradeSpec) (*ChaincodeDeploymentSpec, error)
+	// Terminate a deployed chaincode.
+	Terminate(context.Context, *ChaincodeSpec) (*Response, error)
+	// Retrieve the result of a transaction once its block is committed.
+	GetTransactionResult(context.Context, *TransactionRequest) (*TransactionResult, error)
 	// Retrieve a TCert.
 	EXP_GetApplicationTCert(context.Context, *Secret) (*Response, error)
 	// Prepare for performing a TX, which will return a binding that can later be used to sign and then execute a transaction.
@@ -329,6 +370,42 @@ func _Devops_Query_Handler(srv interface{}, ctx context.Context, dec func(interf
 	return out, nil
 }
 
+func _Devops_Upgrade_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ChaincodeUpgradeSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(DevopsServer).Upgrade(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Devops_Terminate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ChaincodeSpec)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(DevopsServer).Terminate(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Devops_GetTransactionResult_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(TransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(DevopsServer).GetTransactionResult(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func _Devops_EXP_GetApplicationTCert_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
 	in := new(Secret)
 	if err := dec(in); err != nil {
@@ -401,6 +478,18 @@ var _Devops_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Query",
 			Handler:    _Devops_Query_Handler,
 		},
+		{
+			MethodName: "Upgrade",
+			Handler:    _Devops_Upgrade_Handler,
+		},
+		{
+			MethodName: "Terminate",
+			Handler:    _Devops_Terminate_Handler,
+		},
+		{
+			MethodName: "GetTransactionResult",
+			Handler:    _Devops_GetTransactionResult_Handler,
+		},
 		{
 			MethodName: "EXP_GetApplicationTCert",
 			Handler:    _Devops_EXP_GetApplicationTCert_Handler,
@@ -7,6 +7,7 @@ package protos
 import proto "github.com/golang/protobuf/proto"
 import fmt "fmt"
 import math "math"
+import google_protobuf "google/protobuf"
 
 import (
 	context "golang.org/x/net/context"
@@ -21,10 +22,12 @@ var _ = math.Inf
 type EventType int32
 
 const (
-	EventType_REGISTER  EventType = 0
-	EventType_BLOCK     EventType = 1
-	EventType_CHAINCODE EventType = 2
-	EventType_REJECTION EventType = 3
+	EventType_REGISTER           EventType = 0
+	EventType_BLOCK              EventType = 1
+	EventType_CHAINCODE          EventType = 2
+	EventType_REJECTION          EventType = 3
+	EventType_TRANSACTION_RESULT EventType = 4
+	EventType_CONSENSUS_EVIDENCE EventType = 5
 )
 
 var EventType_name = map[int32]string{
@@ -32,12 +35,16 @@ var EventType_name = map[int32]string{
 	1: "BLOCK",
 	2: "CHAINCODE",
 	3: "REJECTION",
+	4: "TRANSACTION_RESULT",
+	5: "CONSENSUS_EVIDENCE",
 }
 var EventType_value = map[string]int32{
-	"REGISTER":  0,
-	"BLOCK":     1,
-	"CHAINCODE": 2,
-	"REJECTION": 3,
+	"REGISTER":           0,
+	"BLOCK":              1,
+	"CHAINCODE":          2,
+	"REJECTION":          3,
+	"TRANSACTION_RESULT": 4,
+	"CONSENSUS_EVIDENCE": 5,
 }
 
 func (x EventType) String() string {
@@ -46,9 +53,14 @@ func (x EventType) String() string {
 
 // ChaincodeReg is used for registering chaincode Interests
 // when EventType is CHAINCODE
+// ChaincodeReg registers for the events of a chaincode named eventName, or
+// for all its events if eventName is empty. If isRegex is set, eventName is
+// a regular expression that must match the whole name of the events, so
+// "asset.*" registers for the events whose name starts with "asset"
 type ChaincodeReg struct {
 	ChaincodeID string `protobuf:"bytes,1,opt,name=chaincodeID" json:"chaincodeID,omitempty"`
 	EventName   string `protobuf:"bytes,2,opt,name=eventName" json:"eventName,omitempty"`
+	IsRegex     bool   `protobuf:"varint,3,opt,name=isRegex" json:"isRegex,omitempty"`
 }
 
 func (m *ChaincodeReg) Reset()         { *m = ChaincodeReg{} }
@@ -71,9 +83,7 @@ func (m *Interest) Reset()         { *m = Interest{} }
 func (m *Interest) String() string { return proto.CompactTextString(m) }
 func (*Interest) ProtoMessage()    {}
 
-type isInterest_RegInfo interface {
-	isInterest_RegInfo()
-}
+type isInterest_RegInfo interface{ isInterest_RegInfo() }
 
 type Interest_ChaincodeRegInfo struct {
 	ChaincodeRegInfo *ChaincodeReg `protobuf:"bytes,2,opt,name=chaincodeRegInfo,oneof"`
@@ -137,8 +147,14 @@ func _Interest_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffe
 // ---------- consumer events ---------
 // Register is sent by consumers for registering events
 // string type - "register"
+// If replay is set, the events of the committed blocks from
+// replay.startBlock are sent before the live events
+// If headersOnly is set, the payloads of the chaincode events and of the
+// transactions are removed from the events sent to the consumer
 type Register struct {
-	Events []*Interest `protobuf:"bytes,1,rep,name=events" json:"events,omitempty"`
+	Events      []*Interest `protobuf:"bytes,1,rep,name=events" json:"events,omitempty"`
+	Replay      *Replay     `protobuf:"bytes,2,opt,name=replay" json:"replay,omitempty"`
+	HeadersOnly bool        `protobuf:"varint,3,opt,name=headersOnly" json:"headersOnly,omitempty"`
 }
 
 func (m *Register) Reset()         { *m = Register{} }
@@ -152,11 +168,27 @@ func (m *Register) GetEvents() []*Interest {
 	return nil
 }
 
+func (m *Register) GetReplay() *Replay {
+	if m != nil {
+		return m.Replay
+	}
+	return nil
+}
+
+// Replay is used to resume receiving events from a given block
+type Replay struct {
+	StartBlock uint64 `protobuf:"varint,1,opt,name=startBlock" json:"startBlock,omitempty"`
+}
+
+func (m *Replay) Reset()         { *m = Replay{} }
+func (m *Replay) String() string { return proto.CompactTextString(m) }
+func (*Replay) ProtoMessage()    {}
+
 // Rejection is sent by consumers for erroneous transaction rejection events
 // string type - "rejection"
 type Rejection struct {
 	Tx       *Transaction `protobuf:"bytes,1,opt,name=tx" json:"tx,omitempty"`
-	ErrorMsg string       `protobuf:"bytes,2,opt,name=ErrorMsg" json:"ErrorMsg,omitempty"`
+	ErrorMsg string       `protobuf:"bytes,2,opt,name=errorMsg" json:"errorMsg,omitempty"`
 }
 
 func (m *Rejection) Reset()         { *m = Rejection{} }
@@ -170,26 +202,59 @@ func (m *Rejection) GetTx() *Transaction {
 	return nil
 }
 
+// ConsensusEvidence is sent when a validating peer detects that another one
+// misbehaved in consensus. The messages prove it, they are signed by the
+// faulty replica and serialized in the format of the consensus plugin
+type ConsensusEvidence struct {
+	Plugin      string                     `protobuf:"bytes,1,opt,name=plugin" json:"plugin,omitempty"`
+	Faulty      *PeerID                    `protobuf:"bytes,2,opt,name=faulty" json:"faulty,omitempty"`
+	ReplicaId   uint64                     `protobuf:"varint,3,opt,name=replicaId" json:"replicaId,omitempty"`
+	Kind        string                     `protobuf:"bytes,4,opt,name=kind" json:"kind,omitempty"`
+	Description string                     `protobuf:"bytes,5,opt,name=description" json:"description,omitempty"`
+	Messages    [][]byte                   `protobuf:"bytes,6,rep,name=messages,proto3" json:"messages,omitempty"`
+	Timestamp   *google_protobuf.Timestamp `protobuf:"bytes,7,opt,name=timestamp" json:"timestamp,omitempty"`
+}
+
+func (m *ConsensusEvidence) Reset()         { *m = ConsensusEvidence{} }
+func (m *ConsensusEvidence) String() string { return proto.CompactTextString(m) }
+func (*ConsensusEvidence) ProtoMessage()    {}
+
+func (m *ConsensusEvidence) GetFaulty() *PeerID {
+	if m != nil {
+		return m.Faulty
+	}
+	return nil
+}
+
+func (m *ConsensusEvidence) GetTimestamp() *google_protobuf.Timestamp {
+	if m != nil {
+		return m.Timestamp
+	}
+	return nil
+}
+
 // ---------- producer events ---------
 // Event is used by
-//  - consumers (adapters) to send Register
-//  - producer to advertise supported types and events
+//   - consumers (adapters) to send Register
+//   - producer to advertise supported types and events
 type Event struct {
 	// Types that are valid to be assigned to Event:
 	//	*Event_Register
 	//	*Event_Block
 	//	*Event_ChaincodeEvent
 	//	*Event_Rejection
+	//	*Event_TransactionResult
+	//	*Event_ConsensusEvidence
 	Event isEvent_Event `protobuf_oneof:"Event"`
+	// number of the block of block, chaincode and transaction result events
+	BlockNumber uint64 `protobuf:"varint,5,opt,name=blockNumber" json:"blockNumber,omitempty"`
 }
 
 func (m *Event) Reset()         { *m = Event{} }
 func (m *Event) String() string { return proto.CompactTextString(m) }
 func (*Event) ProtoMessage()    {}
 
-type isEvent_Event interface {
-	isEvent_Event()
-}
+type isEvent_Event interface{ isEvent_Event() }
 
 type Event_Register struct {
 	Register *Register `protobuf:"bytes,1,opt,name=register,oneof"`
@@ -203,11 +268,19 @@ type Event_ChaincodeEvent struct {
 type Event_Rejection struct {
 	Rejection *Rejection `protobuf:"bytes,4,opt,name=rejection,oneof"`
 }
+type Event_TransactionResult struct {
+	TransactionResult *TransactionResult `protobuf:"bytes,6,opt,name=transactionResult,oneof"`
+}
+type Event_ConsensusEvidence struct {
+	ConsensusEvidence *ConsensusEvidence `protobuf:"bytes,7,opt,name=consensusEvidence,oneof"`
+}
 
-func (*Event_Register) isEvent_Event()       {}
-func (*Event_Block) isEvent_Event()          {}
-func (*Event_ChaincodeEvent) isEvent_Event() {}
-func (*Event_Rejection) isEvent_Event()      {}
+func (*Event_Register) isEvent_Event()          {}
+func (*Event_Block) isEvent_Event()             {}
+func (*Event_ChaincodeEvent) isEvent_Event()    {}
+func (*Event_Rejection) isEvent_Event()         {}
+func (*Event_TransactionResult) isEvent_Event() {}
+func (*Event_ConsensusEvidence) isEvent_Event() {}
 
 func (m *Event) GetEvent() isEvent_Event {
 	if m != nil {
@@ -244,6 +317,20 @@ func (m *Event) GetRejection() *Rejection {
 	return nil
 }
 
+func (m *Event) GetTransactionResult() *TransactionResult {
+	if x, ok := m.GetEvent().(*Event_TransactionResult); ok {
+		return x.TransactionResult
+	}
+	return nil
+}
+
+func (m *Event) GetConsensusEvidence() *ConsensusEvidence {
+	if x, ok := m.GetEvent().(*Event_ConsensusEvidence); ok {
+		return x.ConsensusEvidence
+	}
+	return nil
+}
+
 // XXX_OneofFuncs is for the internal use of the proto package.
 func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), []interface{}) {
 	return _Event_OneofMarshaler, _Event_OneofUnmarshaler, []interface{}{
@@ -251,6 +338,8 @@ func (*Event) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error,
 		(*Event_Block)(nil),
 		(*Event_ChaincodeEvent)(nil),
 		(*Event_Rejection)(nil),
+		(*Event_TransactionResult)(nil),
+		(*Event_ConsensusEvidence)(nil),
 	}
 }
 
@@ -278,6 +367,16 @@ func _Event_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
 		if err := b.EncodeMessage(x.Rejection); err != nil {
 			return err
 		}
+	case *Event_TransactionResult:
+		b.EncodeVarint(6<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.TransactionResult); err != nil {
+			return err
+		}
+	case *Event_ConsensusEvidence:
+		b.EncodeVarint(7<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.ConsensusEvidence); err != nil {
+			return err
+		}
 	case nil:
 	default:
 		return fmt.Errorf("Event.Event has unexpected type %T", x)
@@ -320,6 +419,22 @@ func _Event_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer)
 		err := b.DecodeMessage(msg)
 		m.Event = &Event_Rejection{msg}
 		return true, err
+	case 6: // Event.transactionResult
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(TransactionResult)
+		err := b.DecodeMessage(msg)
+		m.Event = &Event_TransactionResult{msg}
+		return true, err
+	case 7: // Event.consensusEvidence
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(ConsensusEvidence)
+		err := b.DecodeMessage(msg)
+		m.Event = &Event_ConsensusEvidence{msg}
+		return true, err
 	default:
 		return false, nil
 	}
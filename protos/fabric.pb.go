@@ -29,8 +29,10 @@ const (
 	Transaction_CHAINCODE_INVOKE Transaction_Type = 2
 	// call a chaincode `query` function
 	Transaction_CHAINCODE_QUERY Transaction_Type = 3
-	// terminate a chaincode; not implemented yet
+	// stop a chaincode and reject its further invocations
 	Transaction_CHAINCODE_TERMINATE Transaction_Type = 4
+	// deploy a new version of a chaincode and terminate the previous one
+	Transaction_CHAINCODE_UPGRADE Transaction_Type = 5
 )
 
 var Transaction_Type_name = map[int32]string{
@@ -39,6 +41,7 @@ var Transaction_Type_name = map[int32]string{
 	2: "CHAINCODE_INVOKE",
 	3: "CHAINCODE_QUERY",
 	4: "CHAINCODE_TERMINATE",
+	5: "CHAINCODE_UPGRADE",
 }
 var Transaction_Type_value = map[string]int32{
 	"UNDEFINED":           0,
@@ -46,6 +49,7 @@ var Transaction_Type_value = map[string]int32{
 	"CHAINCODE_INVOKE":    2,
 	"CHAINCODE_QUERY":     3,
 	"CHAINCODE_TERMINATE": 4,
+	"CHAINCODE_UPGRADE":   5,
 }
 
 func (x Transaction_Type) String() string {
@@ -214,13 +218,16 @@ func (m *TransactionBlock) GetTransactions() []*Transaction {
 // result - The return value of the transaction.
 // errorCode - An error code. 5xx will be logged as a failure in the dashboard.
 // error - An error string for logging an issue.
-// chaincodeEvent - any event emitted by a transaction
+// chaincodeEvent - any event emitted by a transaction, the last one if
+// the transaction emitted several events.
+// chaincodeEvents - the events emitted by a transaction, in order.
 type TransactionResult struct {
-	Uuid           string          `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
-	Result         []byte          `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
-	ErrorCode      uint32          `protobuf:"varint,3,opt,name=errorCode" json:"errorCode,omitempty"`
-	Error          string          `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
-	ChaincodeEvent *ChaincodeEvent `protobuf:"bytes,5,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	Uuid            string            `protobuf:"bytes,1,opt,name=uuid" json:"uuid,omitempty"`
+	Result          []byte            `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"`
+	ErrorCode       uint32            `protobuf:"varint,3,opt,name=errorCode" json:"errorCode,omitempty"`
+	Error           string            `protobuf:"bytes,4,opt,name=error" json:"error,omitempty"`
+	ChaincodeEvent  *ChaincodeEvent   `protobuf:"bytes,5,opt,name=chaincodeEvent" json:"chaincodeEvent,omitempty"`
+	ChaincodeEvents []*ChaincodeEvent `protobuf:"bytes,6,rep,name=chaincodeEvents" json:"chaincodeEvents,omitempty"`
 }
 
 func (m *TransactionResult) Reset()         { *m = TransactionResult{} }
@@ -234,6 +241,13 @@ func (m *TransactionResult) GetChaincodeEvent() *ChaincodeEvent {
 	return nil
 }
 
+func (m *TransactionResult) GetChaincodeEvents() []*ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvents
+	}
+	return nil
+}
+
 // Block carries The data that describes a block in the blockchain.
 // version - Version used to track any protocol changes.
 // timestamp - The time at which the block or transaction order
@@ -297,8 +311,15 @@ func (*BlockchainInfo) ProtoMessage()    {}
 // the block hash when verifying the blockchain.
 // localLedgerCommitTimestamp - The time at which the block was added
 // to the ledger on the local peer.
+// chaincodeEvents - The events set by the chaincodes invoked by the
+// transactions of the block.
+// transactionResults - The results of the transactions executed for the
+// block, including the transactions that failed and are not in the block.
+// Their chaincode events are in chaincodeEvents.
 type NonHashData struct {
 	LocalLedgerCommitTimestamp *google_protobuf.Timestamp `protobuf:"bytes,1,opt,name=localLedgerCommitTimestamp" json:"localLedgerCommitTimestamp,omitempty"`
+	ChaincodeEvents            []*ChaincodeEvent          `protobuf:"bytes,2,rep,name=chaincodeEvents" json:"chaincodeEvents,omitempty"`
+	TransactionResults         []*TransactionResult       `protobuf:"bytes,3,rep,name=transactionResults" json:"transactionResults,omitempty"`
 }
 
 func (m *NonHashData) Reset()         { *m = NonHashData{} }
@@ -312,6 +333,20 @@ func (m *NonHashData) GetLocalLedgerCommitTimestamp() *google_protobuf.Timestamp
 	return nil
 }
 
+func (m *NonHashData) GetChaincodeEvents() []*ChaincodeEvent {
+	if m != nil {
+		return m.ChaincodeEvents
+	}
+	return nil
+}
+
+func (m *NonHashData) GetTransactionResults() []*TransactionResult {
+	if m != nil {
+		return m.TransactionResults
+	}
+	return nil
+}
+
 type PeerAddress struct {
 	Host string `protobuf:"bytes,1,opt,name=host" json:"host,omitempty"`
 	Port int32  `protobuf:"varint,2,opt,name=port" json:"port,omitempty"`
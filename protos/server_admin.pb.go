@@ -59,6 +59,75 @@ func (m *ServerStatus) Reset()         { *m = ServerStatus{} }
 func (m *ServerStatus) String() string { return proto.CompactTextString(m) }
 func (*ServerStatus) ProtoMessage()    {}
 
+// ConsensusStatus is a snapshot of the state of the consensus plugin of a
+// validating peer. Plugins fill in the fields which apply to them.
+type ConsensusStatus struct {
+	Plugin                    string                        `protobuf:"bytes,1,opt,name=plugin" json:"plugin,omitempty"`
+	ReplicaId                 uint64                        `protobuf:"varint,2,opt,name=replicaId" json:"replicaId,omitempty"`
+	Replicas                  []uint64                      `protobuf:"varint,3,rep,name=replicas" json:"replicas,omitempty"`
+	F                         uint32                        `protobuf:"varint,4,opt,name=f" json:"f,omitempty"`
+	View                      uint64                        `protobuf:"varint,5,opt,name=view" json:"view,omitempty"`
+	Primary                   uint64                        `protobuf:"varint,6,opt,name=primary" json:"primary,omitempty"`
+	ViewChange                bool                          `protobuf:"varint,7,opt,name=viewChange" json:"viewChange,omitempty"`
+	StateTransfer             bool                          `protobuf:"varint,8,opt,name=stateTransfer" json:"stateTransfer,omitempty"`
+	SequenceNumber            uint64                        `protobuf:"varint,9,opt,name=sequenceNumber" json:"sequenceNumber,omitempty"`
+	LastExecuted              uint64                        `protobuf:"varint,10,opt,name=lastExecuted" json:"lastExecuted,omitempty"`
+	LowWatermark              uint64                        `protobuf:"varint,11,opt,name=lowWatermark" json:"lowWatermark,omitempty"`
+	HighWatermark             uint64                        `protobuf:"varint,12,opt,name=highWatermark" json:"highWatermark,omitempty"`
+	OutstandingRequestBatches []string                      `protobuf:"bytes,13,rep,name=outstandingRequestBatches" json:"outstandingRequestBatches,omitempty"`
+	Checkpoints               []*ConsensusStatus_Checkpoint `protobuf:"bytes,14,rep,name=checkpoints" json:"checkpoints,omitempty"`
+}
+
+func (m *ConsensusStatus) Reset()         { *m = ConsensusStatus{} }
+func (m *ConsensusStatus) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStatus) ProtoMessage()    {}
+
+func (m *ConsensusStatus) GetCheckpoints() []*ConsensusStatus_Checkpoint {
+	if m != nil {
+		return m.Checkpoints
+	}
+	return nil
+}
+
+// Checkpoint is a checkpoint certificate, the replicas which reported
+// the same state at a sequence number.
+type ConsensusStatus_Checkpoint struct {
+	SequenceNumber uint64   `protobuf:"varint,1,opt,name=sequenceNumber" json:"sequenceNumber,omitempty"`
+	Id             string   `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Replicas       []uint64 `protobuf:"varint,3,rep,name=replicas" json:"replicas,omitempty"`
+}
+
+func (m *ConsensusStatus_Checkpoint) Reset()         { *m = ConsensusStatus_Checkpoint{} }
+func (m *ConsensusStatus_Checkpoint) String() string { return proto.CompactTextString(m) }
+func (*ConsensusStatus_Checkpoint) ProtoMessage()    {}
+
+type ConsensusEvidenceList struct {
+	Evidence []*ConsensusEvidence `protobuf:"bytes,1,rep,name=evidence" json:"evidence,omitempty"`
+}
+
+func (m *ConsensusEvidenceList) Reset()         { *m = ConsensusEvidenceList{} }
+func (m *ConsensusEvidenceList) String() string { return proto.CompactTextString(m) }
+func (*ConsensusEvidenceList) ProtoMessage()    {}
+
+func (m *ConsensusEvidenceList) GetEvidence() []*ConsensusEvidence {
+	if m != nil {
+		return m.Evidence
+	}
+	return nil
+}
+
+// ConsensusReconfiguration is the replica set a validator requests the
+// validating network to switch to. It takes effect once enough validators
+// requested the same replica set.
+type ConsensusReconfiguration struct {
+	Replicas []uint64 `protobuf:"varint,1,rep,name=replicas" json:"replicas,omitempty"`
+	F        uint32   `protobuf:"varint,2,opt,name=f" json:"f,omitempty"`
+}
+
+func (m *ConsensusReconfiguration) Reset()         { *m = ConsensusReconfiguration{} }
+func (m *ConsensusReconfiguration) String() string { return proto.CompactTextString(m) }
+func (*ConsensusReconfiguration) ProtoMessage()    {}
+
 func init() {
 	proto.RegisterEnum("protos.ServerStatus_StatusCode", ServerStatus_StatusCode_name, ServerStatus_StatusCode_value)
 }
@@ -74,6 +143,12 @@ type AdminClient interface {
 	GetStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
 	StartServer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
 	StopServer(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ServerStatus, error)
+	// Return a snapshot of the state of the consensus plugin.
+	GetConsensusStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStatus, error)
+	// Return the evidence of misbehaving validators collected by the consensus plugin.
+	GetConsensusEvidence(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusEvidenceList, error)
+	// Request that the validating network switch to a new replica set.
+	ReconfigureConsensus(ctx context.Context, in *ConsensusReconfiguration, opts ...grpc.CallOption) (*google_protobuf1.Empty, error)
 }
 
 type adminClient struct {
@@ -111,6 +186,33 @@ func (c *adminClient) StopServer(ctx context.Context, in *google_protobuf1.Empty
 	return out, nil
 }
 
+func (c *adminClient) GetConsensusStatus(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusStatus, error) {
+	out := new(ConsensusStatus)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetConsensusStatus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetConsensusEvidence(ctx context.Context, in *google_protobuf1.Empty, opts ...grpc.CallOption) (*ConsensusEvidenceList, error) {
+	out := new(ConsensusEvidenceList)
+	err := grpc.Invoke(ctx, "/protos.Admin/GetConsensusEvidence", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ReconfigureConsensus(ctx context.Context, in *ConsensusReconfiguration, opts ...grpc.CallOption) (*google_protobuf1.Empty, error) {
+	out := new(google_protobuf1.Empty)
+	err := grpc.Invoke(ctx, "/protos.Admin/ReconfigureConsensus", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Admin service
 
 type AdminServer interface {
@@ -118,6 +220,12 @@ type AdminServer interface {
 	GetStatus(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
 	StartServer(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
 	StopServer(context.Context, *google_protobuf1.Empty) (*ServerStatus, error)
+	// Return a snapshot of the state of the consensus plugin.
+	GetConsensusStatus(context.Context, *google_protobuf1.Empty) (*ConsensusStatus, error)
+	// Return the evidence of misbehaving validators collected by the consensus plugin.
+	GetConsensusEvidence(context.Context, *google_protobuf1.Empty) (*ConsensusEvidenceList, error)
+	// Request that the validating network switch to a new replica set.
+	ReconfigureConsensus(context.Context, *ConsensusReconfiguration) (*google_protobuf1.Empty, error)
 }
 
 func RegisterAdminServer(s *grpc.Server, srv AdminServer) {
@@ -160,6 +268,42 @@ func _Admin_StopServer_Handler(srv interface{}, ctx context.Context, dec func(in
 	return out, nil
 }
 
+func _Admin_GetConsensusStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetConsensusStatus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_GetConsensusEvidence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(google_protobuf1.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).GetConsensusEvidence(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func _Admin_ReconfigureConsensus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+	in := new(ConsensusReconfiguration)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	out, err := srv.(AdminServer).ReconfigureConsensus(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 var _Admin_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "protos.Admin",
 	HandlerType: (*AdminServer)(nil),
@@ -176,6 +320,18 @@ var _Admin_serviceDesc = grpc.ServiceDesc{
 			MethodName: "StopServer",
 			Handler:    _Admin_StopServer_Handler,
 		},
+		{
+			MethodName: "GetConsensusStatus",
+			Handler:    _Admin_GetConsensusStatus_Handler,
+		},
+		{
+			MethodName: "GetConsensusEvidence",
+			Handler:    _Admin_GetConsensusEvidence_Handler,
+		},
+		{
+			MethodName: "ReconfigureConsensus",
+			Handler:    _Admin_ReconfigureConsensus_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{},
 }
@@ -23,7 +23,6 @@ import (
 
 	"github.com/hyperledger/fabric/core/db"
 	"github.com/spf13/viper"
-	"github.com/tecbot/gorocksdb"
 )
 
 func TestMain(m *testing.M) {
@@ -44,7 +43,7 @@ func TestDBStatsOversizedKV(t *testing.T) {
 	defer deleteTestDBDir()
 
 	openchainDB := db.GetDBHandle()
-	writeBatch := gorocksdb.NewWriteBatch()
+	writeBatch := openchainDB.NewWriteBatch()
 	writeBatch.PutCF(openchainDB.BlockchainCF, []byte("key1"), []byte("value1"))
 	writeBatch.PutCF(openchainDB.BlockchainCF, []byte("key2"), generateOversizedValue(0))
 	writeBatch.PutCF(openchainDB.BlockchainCF, []byte("key3"), generateOversizedValue(100))
@@ -0,0 +1,31 @@
+// +build !cgo
+
+/*
+Copyright IBM Corp. 2016 All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+		 http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/db"
+)
+
+// rocksdb is not available in peers built without cgo
+func printLiveFilesMetaData(openchainDB *db.OpenchainDB) {
+	fmt.Println("------ Details of LiveFilesMetaData ---")
+	fmt.Println("LiveFilesMetaData is only available for rocksdb")
+}